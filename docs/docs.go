@@ -101,103 +101,174 @@ const docTemplate = `{
                 }
             }
         },
-        "/admin/dashboard": {
+        "/admin/audit": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Возвращает общую статистику системы",
+                "description": "Входы, изменения учетных записей и административные действия, новые сверху. Общее число подходящих записей возвращается в заголовке X-Total-Count",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "admin"
                 ],
-                "summary": "Получить дашборд администратора",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/models.AdminDashboard"
-                        }
+                "summary": "Журнал аудита",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Кто выполнил действие",
+                        "name": "actorId",
+                        "in": "query"
                     },
-                    "401": {
-                        "description": "Unauthorized",
-                        "schema": {
-                            "$ref": "#/definitions/handlers.ErrorResponse"
-                        }
-                    }
-                }
-            }
-        },
-        "/admin/roles": {
-            "get": {
-                "security": [
                     {
-                        "BearerAuth": []
+                        "type": "string",
+                        "description": "Действие или группа с * на конце (auth.*)",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Тип объекта: user, role, room, session, token, passkey, identity",
+                        "name": "targetType",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID объекта",
+                        "name": "targetId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "IP клиента",
+                        "name": "ip",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало периода (RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода (RFC 3339), не включительно",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Лимит",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Смещение",
+                        "name": "offset",
+                        "in": "query"
                     }
                 ],
-                "description": "Возвращает список всех ролей в системе",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "admin"
-                ],
-                "summary": "Получить все роли",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Role"
+                                "$ref": "#/definitions/models.AuditEvent"
                             }
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
                     "401": {
                         "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
                     }
                 }
-            },
-            "post": {
+            }
+        },
+        "/admin/audit/export": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Создает новую роль в системе",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Потоковая выгрузка журнала в формате NDJSON (одна запись JSON на строку) в порядке возрастания id. Фильтры те же, что у /admin/audit",
                 "produces": [
-                    "application/json"
+                    "application/x-ndjson"
                 ],
                 "tags": [
                     "admin"
                 ],
-                "summary": "Создать роль",
+                "summary": "Выгрузить журнал аудита",
                 "parameters": [
                     {
-                        "description": "Данные роли",
-                        "name": "role",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Role"
-                        }
+                        "type": "integer",
+                        "description": "Кто выполнил действие",
+                        "name": "actorId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Действие или группа с * на конце (auth.*)",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Тип объекта",
+                        "name": "targetType",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID объекта",
+                        "name": "targetId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "IP клиента",
+                        "name": "ip",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало периода (RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода (RFC 3339), не включительно",
+                        "name": "to",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "NDJSON",
                         "schema": {
-                            "$ref": "#/definitions/models.Role"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -211,30 +282,36 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/analytics/me": {
+        "/admin/dashboard": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Возвращает метрики использования пользователя",
+                "description": "Возвращает общую статистику системы",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "analytics"
+                    "admin"
                 ],
-                "summary": "Получить аналитику пользователя",
+                "summary": "Получить дашборд администратора",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Analytics"
+                            "$ref": "#/definitions/models.AdminDashboard"
                         }
                     },
                     "401": {
@@ -246,55 +323,74 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/2fa/setup": {
-            "post": {
+        "/admin/invites": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Настраивает двухфакторную аутентификацию для пользователя",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Возвращает приглашения без кодов, новые сверху. По умолчанию только действующие; all=true включает отозванные, истекшие и исчерпанные",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
+                ],
+                "summary": "Список приглашений",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Включая недействующие",
+                        "name": "all",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Лимит",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Смещение",
+                        "name": "offset",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Настроить 2FA",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.InviteResponse"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     }
                 }
-            }
-        },
-        "/auth/2fa/verify": {
+            },
             "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Подтверждает настройку 2FA с помощью кода",
+                "description": "Создает код приглашения на регистрацию с лимитом использований и сроком действия (по умолчанию одно использование и 7 дней). Новый пользователь может сразу получить участие в комнатах и глобальные роли; выдача ролей требует права admin.roles.assign. Код и ссылка возвращаются только один раз",
                 "consumes": [
                     "application/json"
                 ],
@@ -302,28 +398,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Подтвердить 2FA",
+                "summary": "Создать приглашение",
                 "parameters": [
                     {
-                        "description": "Код подтверждения",
-                        "name": "code",
+                        "description": "Параметры приглашения",
+                        "name": "invite",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.CreateInviteRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/handlers.SuccessResponse"
+                            "$ref": "#/definitions/handlers.CreateInviteResponse"
                         }
                     },
                     "400": {
@@ -337,30 +430,45 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/level": {
-            "get": {
+        "/admin/invites/{id}": {
+            "delete": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Возвращает информацию об уровне пользователя",
+                "description": "Отзывает приглашение; уже зарегистрированных по нему пользователей это не затрагивает",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "achievements"
+                    "admin"
+                ],
+                "summary": "Отозвать приглашение",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID приглашения",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Получить уровень пользователя",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.UserLevel"
+                            "$ref": "#/definitions/handlers.SuccessResponse"
                         }
                     },
                     "401": {
@@ -368,75 +476,53 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/login": {
-            "post": {
-                "description": "Вход в систему с логином и паролем",
-                "consumes": [
-                    "application/json"
+        "/admin/login-attempts": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Журнал неудачных попыток входа для разбора инцидентов, новые сверху",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Авторизация пользователя",
+                "summary": "Неудачные попытки входа",
                 "parameters": [
                     {
-                        "description": "Данные для входа",
-                        "name": "credentials",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handlers.LoginRequest"
-                        }
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/handlers.AuthResponse"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "$ref": "#/definitions/handlers.ErrorResponse"
-                        }
+                        "type": "string",
+                        "description": "Фильтр по логину",
+                        "name": "login",
+                        "in": "query"
                     },
-                    "401": {
-                        "description": "Unauthorized",
-                        "schema": {
-                            "$ref": "#/definitions/handlers.ErrorResponse"
-                        }
-                    }
-                }
-            }
-        },
-        "/mentions": {
-            "get": {
-                "security": [
                     {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Возвращает список упоминаний пользователя",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "mentions"
-                ],
-                "summary": "Получить упоминания пользователя",
-                "parameters": [
+                        "type": "string",
+                        "description": "Фильтр по IP",
+                        "name": "ip",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "default": 20,
+                        "default": 50,
                         "description": "Лимит",
                         "name": "limit",
                         "in": "query"
@@ -455,7 +541,7 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Mention"
+                                "$ref": "#/definitions/models.LoginAttempt"
                             }
                         }
                     },
@@ -464,39 +550,39 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/mentions/{id}/read": {
-            "post": {
+        "/admin/roles": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Отмечает упоминание как прочитанное",
+                "description": "Возвращает список всех ролей в системе",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "mentions"
-                ],
-                "summary": "Отметить упоминание как прочитанное",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "ID упоминания",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "admin"
                 ],
+                "summary": "Получить все роли",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handlers.SuccessResponse"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Role"
+                            }
                         }
                     },
                     "401": {
@@ -506,16 +592,14 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/polls/{id}/vote": {
+            },
             "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Голосует в опросе",
+                "description": "Создает новую роль в системе",
                 "consumes": [
                     "application/json"
                 ],
@@ -523,35 +607,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "messages"
+                    "admin"
                 ],
-                "summary": "Голосовать в опросе",
+                "summary": "Создать роль",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "ID опроса",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Голос",
-                        "name": "vote",
+                        "description": "Данные роли",
+                        "name": "role",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.Role"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/handlers.SuccessResponse"
+                            "$ref": "#/definitions/models.Role"
                         }
                     },
                     "400": {
@@ -569,35 +643,35 @@ const docTemplate = `{
                 }
             }
         },
-        "/register": {
-            "post": {
-                "description": "Создает нового пользователя в системе",
-                "consumes": [
-                    "application/json"
+        "/admin/users/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Администратор удаляет аккаунт пользователя по его запросу. Действует так же, как DELETE /user/me, но без подтверждения паролем",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Регистрация пользователя",
+                "summary": "Удалить аккаунт пользователя",
                 "parameters": [
                     {
-                        "description": "Данные пользователя",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handlers.RegisterRequest"
-                        }
+                        "type": "integer",
+                        "description": "ID пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handlers.AuthResponse"
+                            "$ref": "#/definitions/handlers.SuccessResponse"
                         }
                     },
                     "400": {
@@ -606,81 +680,50 @@ const docTemplate = `{
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
-                    "409": {
-                        "description": "Conflict",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
-                    }
-                }
-            }
-        },
-        "/rooms": {
-            "get": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Возвращает список всех доступных комнат",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "rooms"
-                ],
-                "summary": "Получить список комнат",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/handlers.RoomResponse"
-                            }
-                        }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     }
                 }
-            },
-            "post": {
+            }
+        },
+        "/admin/users/{id}/export": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Создает новую комнату для чата",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Администратор выгружает архив с персональными данными пользователя по его запросу. Формат тот же, что у /user/me/export",
                 "produces": [
-                    "application/json"
+                    "application/zip"
                 ],
                 "tags": [
-                    "rooms"
+                    "admin"
                 ],
-                "summary": "Создать комнату",
+                "summary": "Выгрузить данные пользователя",
                 "parameters": [
                     {
-                        "description": "Данные комнаты",
-                        "name": "room",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handlers.CreateRoomRequest"
-                        }
+                        "type": "integer",
+                        "description": "ID пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handlers.RoomResponse"
+                            "type": "file"
                         }
                     },
                     "400": {
@@ -689,8 +732,14 @@ const docTemplate = `{
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
-                    "409": {
-                        "description": "Conflict",
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
@@ -698,25 +747,25 @@ const docTemplate = `{
                 }
             }
         },
-        "/rooms/{id}/join": {
+        "/admin/users/{id}/unlock": {
             "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Присоединяет текущего пользователя к указанной комнате",
+                "description": "Снимает блокировку входа, наложенную после неудачных попыток",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "rooms"
+                    "admin"
                 ],
-                "summary": "Присоединиться к комнате",
+                "summary": "Разблокировать пользователя",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "ID комнаты",
+                        "description": "ID пользователя",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -729,8 +778,14 @@ const docTemplate = `{
                             "$ref": "#/definitions/handlers.SuccessResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
@@ -744,45 +799,36 @@ const docTemplate = `{
                 }
             }
         },
-        "/rooms/{id}/leave": {
-            "post": {
+        "/admin/ws/hubs": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Удаляет текущего пользователя из указанной комнаты",
+                "description": "Возвращает запущенные на этом узле хабы комнат, число подключенных к каждому клиентов и счетчики событий соединений с момента запуска: истекшие heartbeat, слишком большие кадры, таймауты записи, отклоненные по лимиту частоты кадры и отключения за превышение лимита или переполнение очереди отправки",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "rooms"
-                ],
-                "summary": "Покинуть комнату",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "ID комнаты",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "admin"
                 ],
+                "summary": "Хабы комнат",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handlers.SuccessResponse"
+                            "$ref": "#/definitions/handlers.HubsResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
@@ -790,47 +836,71 @@ const docTemplate = `{
                 }
             }
         },
-        "/rooms/{id}/messages": {
-            "post": {
+        "/analytics/me": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Отправляет новое сообщение в указанную комнату",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Возвращает метрики использования пользователя",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "messages"
+                    "analytics"
                 ],
-                "summary": "Отправить сообщение",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "ID комнаты",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Текст сообщения",
-                        "name": "message",
-                        "in": "body",
+                "summary": "Получить аналитику пользователя",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Analytics"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/2fa/disable": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отключает двухфакторную аутентификацию. Требует действующий TOTP-код",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Отключить 2FA",
+                "parameters": [
+                    {
+                        "description": "Код подтверждения",
+                        "name": "code",
+                        "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.SendMessageRequest"
+                            "$ref": "#/definitions/handlers.Verify2FARequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handlers.MessageResponse"
+                            "$ref": "#/definitions/handlers.SuccessResponse"
                         }
                     },
                     "400": {
@@ -854,14 +924,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/rooms/{id}/polls": {
+        "/auth/2fa/login": {
             "post": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Создает опрос в комнате",
+                "description": "Обменивает challenge-токен из /login и TOTP-код (или одноразовый резервный код) на JWT. Challenge-токен одноразовый: после успешного входа он больше не принимается ни здесь, ни в /auth/2fa/webauthn",
                 "consumes": [
                     "application/json"
                 ],
@@ -869,33 +934,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "messages"
+                    "auth"
                 ],
-                "summary": "Создать опрос",
+                "summary": "Второй шаг входа с 2FA",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "ID комнаты",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Данные опроса",
-                        "name": "poll",
+                        "description": "Challenge-токен и код",
+                        "name": "credentials",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/handlers.Login2FARequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Poll"
+                            "$ref": "#/definitions/handlers.AuthResponse"
                         }
                     },
                     "400": {
@@ -909,12 +966,18 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/rooms/{id}/read": {
-            "post": {
+        "/auth/2fa/recovery-codes": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
@@ -924,81 +987,69 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "rooms"
-                ],
-                "summary": "Отметить комнату как прочитанную",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "ID комнаты",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "auth"
                 ],
+                "summary": "Количество оставшихся резервных кодов",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "boolean"
-                            }
+                            "$ref": "#/definitions/handlers.RecoveryCodesStatusResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     }
                 }
-            }
-        },
-        "/rooms/{id}/users": {
-            "get": {
+            },
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Возвращает список всех пользователей в указанной комнате",
+                "description": "Генерирует новый набор одноразовых резервных кодов. Старые коды перестают действовать. Требует действующий TOTP-код",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "rooms"
+                    "auth"
                 ],
-                "summary": "Список пользователей в комнате",
+                "summary": "Перевыпустить резервные коды",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "ID комнаты",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Код подтверждения",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.Verify2FARequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/handlers.UserResponse"
-                            }
+                            "$ref": "#/definitions/handlers.RecoveryCodesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
                     "401": {
@@ -1016,26 +1067,35 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/me": {
-            "get": {
+        "/auth/2fa/setup": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Возвращает информацию о текущем авторизованном пользователе",
+                "description": "Генерирует новый TOTP-секрет и QR-код. 2FA включается только после подтверждения кодом",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "auth"
                 ],
-                "summary": "Получить профиль текущего пользователя",
+                "summary": "Настроить 2FA",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handlers.UserResponse"
+                            "$ref": "#/definitions/handlers.Setup2FAResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
                     "401": {
@@ -1044,21 +1104,23 @@ const docTemplate = `{
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "409": {
+                        "description": "Conflict",
                         "schema": {
                             "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     }
                 }
-            },
-            "put": {
+            }
+        },
+        "/auth/2fa/verify": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Обновляет информацию профиля текущего пользователя",
+                "description": "Подтверждает настройку 2FA с помощью кода",
                 "consumes": [
                     "application/json"
                 ],
@@ -1066,17 +1128,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "auth"
                 ],
-                "summary": "Обновить профиль пользователя",
+                "summary": "Подтвердить 2FA",
                 "parameters": [
                     {
-                        "description": "Данные для обновления",
-                        "name": "user",
+                        "description": "Код подтверждения",
+                        "name": "code",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.UpdateProfileRequest"
+                            "$ref": "#/definitions/handlers.Verify2FARequest"
                         }
                     }
                 ],
@@ -1084,7 +1146,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handlers.UserResponse"
+                            "$ref": "#/definitions/handlers.SuccessResponse"
                         }
                     },
                     "400": {
@@ -1107,96 +1169,3478 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "handlers.AuthResponse": {
-            "type": "object",
-            "properties": {
-                "token": {
-                    "type": "string",
-                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
-                },
-                "user": {
-                    "$ref": "#/definitions/handlers.UserResponse"
-                }
-            }
         },
-        "handlers.CreateRoomRequest": {
-            "type": "object",
-            "required": [
-                "name",
-                "slug"
-            ],
-            "properties": {
-                "isPrivate": {
-                    "type": "boolean",
-                    "example": false
-                },
-                "name": {
-                    "type": "string",
-                    "example": "General Chat"
-                },
-                "slug": {
-                    "type": "string",
-                    "example": "general"
+        "/auth/2fa/webauthn/begin": {
+            "post": {
+                "description": "Вместо TOTP-кода второй фактор можно подтвердить зарегистрированным ключом. Принимает challenge-токен из /login",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Начать проверку второго фактора по passkey",
+                "parameters": [
+                    {
+                        "description": "Challenge-токен",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.Passkey2FABeginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.WebAuthnRequestResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
                 }
             }
         },
-        "handlers.ErrorResponse": {
-            "type": "object",
-            "properties": {
-                "error": {
-                    "type": "string",
-                    "example": "Invalid request"
+        "/auth/2fa/webauthn/finish": {
+            "post": {
+                "description": "Завершает вход с 2FA ключом WebAuthn вместо TOTP-кода",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Подтвердить второй фактор passkey",
+                "parameters": [
+                    {
+                        "description": "Challenge-токен и ответ navigator.credentials.get()",
+                        "name": "credential",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.Passkey2FARequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/email/verify": {
+            "post": {
+                "description": "Принимает токен из письма и отмечает адрес подтвержденным",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Подтвердить email",
+                "parameters": [
+                    {
+                        "description": "Токен из письма",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.EmailTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/email/verify/resend": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Отправить письмо подтверждения повторно",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/identities": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Привязанные внешние аккаунты",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ExternalIdentity"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/identities/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Нельзя отвязать последний способ входа у пользователя без пароля",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Отвязать внешний аккаунт",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID привязки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/logout": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отзывает текущую сессию вместе со всеми ее токенами",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Выйти из системы",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/oidc/providers": {
+            "get": {
+                "description": "Возвращает имена настроенных OIDC-провайдеров для кнопок входа",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Список SSO-провайдеров",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/oidc/{provider}/authorize": {
+            "get": {
+                "description": "Возвращает адрес авторизации у провайдера (authorization code + PKCE). Клиент должен сохранить state и сверить его при возврате",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Начать вход через SSO",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Имя провайдера",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.OIDCAuthorizeResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/oidc/{provider}/callback": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Принимает code и state из редиректа провайдера. Для входа возвращает токены (или challenge 2FA), для привязки — связанную учетную запись; привязку принимает только с токеном пользователя, который ее начал (иначе 403), чтобы чужая ссылка не привязала аккаунт провайдера к чужому пользователю. Пользователь без привязанного аккаунта создается, только если у провайдера включен AUTO_PROVISION и это позволяет REGISTRATION_MODE (в режимах invite и closed — только с REGISTRATION_SSO_PROVISION=true)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Завершить вход через SSO",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Имя провайдера",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Code и state",
+                        "name": "callback",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.OIDCCallbackRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/oidc/{provider}/link": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Начинает вход у провайдера, по завершении которого внешняя учетная запись привязывается к текущему пользователю. Callback привязки нужно вызвать с токеном этого же пользователя",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Привязать внешний аккаунт",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Имя провайдера",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.OIDCAuthorizeResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/password/change": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Меняет пароль текущего пользователя. Требует текущий пароль; новый пароль проверяется парольной политикой. Остальные сессии пользователя завершаются, его персональные токены отзываются",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Сменить пароль",
+                "parameters": [
+                    {
+                        "description": "Текущий и новый пароль",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ChangePasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/password/forgot": {
+            "post": {
+                "description": "Отправляет ссылку сброса на подтвержденный email. Ответ одинаков независимо от того, найден ли адрес",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Запросить сброс пароля",
+                "parameters": [
+                    {
+                        "description": "Email",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ForgotPasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/password/reset": {
+            "post": {
+                "description": "Задает новый пароль по одноразовому токену из письма, завершает все сессии пользователя и отзывает его персональные токены. Новый пароль проверяется парольной политикой",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Сбросить пароль",
+                "parameters": [
+                    {
+                        "description": "Токен и новый пароль",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ResetPasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/refresh": {
+            "post": {
+                "description": "Обменивает refresh-токен на новую пару токенов. Refresh-токен одноразовый: повторное использование отзывает всю сессию",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Обновить токены",
+                "parameters": [
+                    {
+                        "description": "Refresh-токен",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.RefreshRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/sessions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает активные сессии текущего пользователя",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Активные сессии",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.SessionResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Завершает все сессии пользователя, кроме текущей. Запрос с персональным токеном или токеном без сессии отклоняется: текущей сессии у него нет",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Отозвать все остальные сессии",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/sessions/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Отозвать сессию",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID сессии",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/tokens": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает действующие персональные токены текущего пользователя без их значений",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Персональные токены",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.PersonalTokenResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создает токен доступа для ботов и скриптов с ограниченными областями (rooms:read, rooms:write, messages:read, messages:write, user:read, user:write). Токен с roomId действует только в этой комнате: ему доступны маршруты /rooms/{roomId}/..., список комнат, поиск, реакции, опросы и WebSocket этой комнаты, но не создание комнат, загрузка файлов и профиль. Значение токена возвращается только один раз",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Создать персональный токен",
+                "parameters": [
+                    {
+                        "description": "Параметры токена",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateTokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/tokens/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Отозвать персональный токен",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID токена",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/webauthn/credentials": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает ключи WebAuthn текущего пользователя",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Список passkeys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.PasskeyResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/webauthn/credentials/{id}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Переименовать passkey",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID ключа",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Новое название",
+                        "name": "credential",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.RenamePasskeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PasskeyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаляет ключ WebAuthn. Нельзя удалить последний способ входа аккаунта без пароля",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Удалить passkey",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID ключа",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/webauthn/login/begin": {
+            "post": {
+                "description": "Возвращает параметры для navigator.credentials.get(). Без логина используется discoverable-ключ, который сам сообщает пользователя",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Начать вход по passkey",
+                "parameters": [
+                    {
+                        "description": "Логин (необязательно)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PasskeyLoginBeginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.WebAuthnRequestResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/webauthn/login/finish": {
+            "post": {
+                "description": "Вход без пароля. Ключ с проверкой пользователя (PIN, биометрия) заменяет оба фактора, поэтому 2FA не запрашивается",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Войти по passkey",
+                "parameters": [
+                    {
+                        "description": "Ответ navigator.credentials.get()",
+                        "name": "credential",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PasskeyLoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/webauthn/register/begin": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает параметры для navigator.credentials.create() в JSON-представлении WebAuthn (бинарные поля в base64url)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Начать регистрацию passkey",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.WebAuthnCreationResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/webauthn/register/finish": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Проверяет ответ аутентификатора и сохраняет ключ. После регистрации ключ можно использовать для входа без пароля и как второй фактор",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Завершить регистрацию passkey",
+                "parameters": [
+                    {
+                        "description": "Название и ответ navigator.credentials.create()",
+                        "name": "credential",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PasskeyRegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PasskeyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/level": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает информацию об уровне пользователя",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "achievements"
+                ],
+                "summary": "Получить уровень пользователя",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserLevel"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/login": {
+            "post": {
+                "description": "Вход в систему с логином и паролем. Пароль проверяется цепочкой источников из AUTH_PROVIDERS (локальные пароли, LDAP); при первом входе через LDAP пользователь создается автоматически, если это позволяет REGISTRATION_MODE (в режимах invite и closed — только с REGISTRATION_SSO_PROVISION=true, иначе 403). Если у пользователя включена 2FA или зарегистрированы passkeys, вместо JWT возвращается TwoFactorChallengeResponse для /auth/2fa/login или /auth/2fa/webauthn. После серии неудачных попыток логин и IP временно блокируются (429 с Retry-After)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Авторизация пользователя",
+                "parameters": [
+                    {
+                        "description": "Данные для входа",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.LoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/mentions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает список упоминаний пользователя",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "mentions"
+                ],
+                "summary": "Получить упоминания пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Лимит",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Смещение",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Mention"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/mentions/{id}/read": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отмечает упоминание как прочитанное",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "mentions"
+                ],
+                "summary": "Отметить упоминание как прочитанное",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID упоминания",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/polls/{id}/vote": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Голосует в опросе",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Голосовать в опросе",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID опроса",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Голос",
+                        "name": "vote",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/register": {
+            "post": {
+                "description": "Создает нового пользователя в системе. Пароль проверяется парольной политикой: минимальная длина, список распространенных паролей, запрет на логин в пароле. Если указан email, на него отправляется ссылка подтверждения. В режиме REGISTRATION_MODE=invite нужен код приглашения, в режиме closed регистрация недоступна; код, переданный в открытом режиме, тоже списывается и выдает комнаты и роли приглашения",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Регистрация пользователя",
+                "parameters": [
+                    {
+                        "description": "Данные пользователя",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает список всех доступных комнат",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Получить список комнат",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.RoomResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создает новую комнату для чата",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Создать комнату",
+                "parameters": [
+                    {
+                        "description": "Данные комнаты",
+                        "name": "room",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateRoomRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.RoomResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/events": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Поток text/event-stream с теми же событиями комнаты и в том же JSON, что и /ws/rooms/{id}, для клиентов, у которых прокси не пропускает WebSocket. Тип события — поле type в data; id события — его seq, у typing и presence_* id нет. Первым приходит пустое событие с id — текущим курсором, поэтому EventSource при переподключении всегда передает Last-Event-ID, и сервер досылает пропущенные события из журнала комнаты или присылает resync_required (после него историю нужно перечитать через REST; id этого события — номер, с которого поток продолжается). Курсор можно передать и параметром lastEventId. Каждые WS_PING_INTERVAL приходит комментарий-heartbeat. Соединение считается подключением пользователя к комнате для присутствия. Отправка сообщений — через POST /rooms/{id}/messages",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "websocket"
+                ],
+                "summary": "События комнаты (Server-Sent Events)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID комнаты",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "seq последнего полученного события",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "То же, что Last-Event-ID",
+                        "name": "lastEventId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Поток событий",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/events/poll": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Резервный транспорт для клиентов без WebSocket и SSE. Возвращает события комнаты после курсора lastEventId (или заголовка Last-Event-ID) — те же, что и /ws/rooms/{id}, — сразу, если они есть в журнале комнаты, или ждет новых до LONGPOLL_TIMEOUT (по умолчанию 25 с) и отвечает пустым списком. Следующий запрос передает lastEventId из ответа. Без курсора ожидание начинается с последнего события комнаты. Если разрыв больше журнала, в events приходит resync_required: историю нужно перечитать через REST. typing и presence_* приходят, только если произошли во время ожидания; сам опрос на присутствие не влияет. Отправка сообщений — через POST /rooms/{id}/messages",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "websocket"
+                ],
+                "summary": "События комнаты (long-poll)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID комнаты",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "seq последнего полученного события",
+                        "name": "lastEventId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "То же, что lastEventId",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.RoomEventsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/join": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Присоединяет текущего пользователя к указанной комнате",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Присоединиться к комнате",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID комнаты",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/leave": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаляет текущего пользователя из указанной комнаты",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Покинуть комнату",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID комнаты",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/messages": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отправляет новое сообщение в указанную комнату и возвращает его id и время создания. Необязательный clientMsgId, выбранный клиентом, делает отправку идемпотентной: повтор с тем же clientMsgId в ту же комнату возвращает уже сохраненное сообщение с duplicate=true и кодом 200, не создавая и не рассылая новое; в другой комнате тот же clientMsgId создает новое сообщение. Событие message в WebSocket повторяет clientMsgId, чтобы клиент сопоставил его с оптимистично показанным сообщением. Ошибка содержит машиночитаемый code: invalid_payload, room_not_found, forbidden или internal_error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Отправить сообщение",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID комнаты",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Текст сообщения",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SendMessageRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Повтор: сообщение с этим clientMsgId уже сохранено",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.MessageAckResponse"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.MessageAckResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SendErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SendErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SendErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SendErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/owner": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Назначает нового владельца комнаты. Доступно текущему владельцу или администратору с правом admin.rooms.transfer; новый владелец должен состоять в комнате",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Передать владение комнатой",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID комнаты",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Новый владелец",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TransferRoomRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.RoomResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/polls": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создает опрос в комнате",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Создать опрос",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID комнаты",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Данные опроса",
+                        "name": "poll",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Poll"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/read": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Отметить комнату как прочитанную",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID комнаты",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "boolean"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает список всех пользователей в указанной комнате с их присутствием: состояние, свой статус и lastSeen; скрывающие присутствие показываются офлайн без lastSeen",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Список пользователей в комнате",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID комнаты",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.UserResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/me": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает информацию о текущем авторизованном пользователе",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Получить профиль текущего пользователя",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UserResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Обновляет информацию профиля текущего пользователя. Новый email считается неподтвержденным, на него отправляется ссылка подтверждения",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Обновить профиль пользователя",
+                "parameters": [
+                    {
+                        "description": "Данные для обновления",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UpdateProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Безвозвратно удаляет аккаунт текущего пользователя. Сообщения остаются в комнатах от имени «Deleted user», остальные персональные данные и загруженные файлы удаляются, все сессии и токены отзываются. Требует текущий пароль, а для аккаунтов без пароля — повтор логина в поле confirm",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Удалить мой аккаунт",
+                "parameters": [
+                    {
+                        "description": "Подтверждение удаления",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DeleteAccountRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/me/export": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает zip-архив с персональными данными текущего пользователя: data.json (профиль, сообщения, реакции, голоса, упоминания, аналитика, достижения, файлы, сессии и др.) и загруженные файлы в каталоге files/",
+                "produces": [
+                    "application/zip"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Выгрузить мои данные",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/me/status": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Меняет статус текущего пользователя. mode: auto — online или idle по активности клиентов, away и dnd показываются вместо них, пока пользователь подключен. text, emoji и expiresAt задают свой статус целиком: пропущенные поля очищаются, пустые text и emoji снимают статус, после expiresAt он снимается сам. hideOnline — другие видят пользователя офлайн и без lastSeen. Изменение сразу видно в presence_update комнат, а соединения пользователя получают событие status",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Изменить статус присутствия",
+                "parameters": [
+                    {
+                        "description": "Новый статус",
+                        "name": "status",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UpdateStatusRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PresenceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Снимает свой статус и возвращает режим auto. Настройка hideOnline не меняется",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Сбросить статус присутствия",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PresenceResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ws": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Одно соединение на пользователя вместо соединения на комнату. Клиент управляет подписками кадрами {\"type\":\"subscribe\",\"roomId\":1} и {\"type\":\"unsubscribe\",\"roomId\":1}; сервер отвечает subscribed, unsubscribed или error. Доступ проверяется при каждой подписке: приватные комнаты — только участникам, токен с ограничением комнатой — только эта комната. События комнат помечены roomId; кадры typing и message тоже указывают roomId и требуют подписки. На кадр message сервер отвечает ack с id и createdAt сохраненного сообщения или nack с машиночитаемым code (not_subscribed, read_only, rate_limited, invalid_payload, internal_error); payload.clientMsgId делает отправку идемпотентной и повторяется в ack, nack и событии message. Без подписок приходят события пользователя: dm (сообщение в приватной комнате, на которую соединение не подписано), mention, unread, membership и status (пользователь изменил свой статус присутствия). Кадр {\"type\":\"activity\"} сообщает об активности пользователя, {\"type\":\"activity\",\"payload\":{\"idle\":true}} — что он отошел; соединение без activity, typing и message дольше WS_IDLE_AFTER бездействует, и presence_update показывает для каждого пользователя state (online, idle, away, dnd) и свой статус. Для возобновления сессии subscribe передает lastSeq — номер seq последнего полученного события комнаты: сервер досылает пропущенные события до живых или, если разрыв больше журнала, присылает resync_required, после которого историю нужно перечитать через REST. Версия протокола согласуется заголовком Sec-WebSocket-Protocol: linkup.v1 — JSON в текстовых кадрах, linkup.v1+msgpack и linkup.v1+cbor — те же кадры в MessagePack или CBOR в двоичных кадрах; сервер выбирает первый поддерживаемый в порядке клиента (клиент без заголовка получает linkup.v1, только неизвестные подпротоколы — 400). Каждый кадр проверяется по схеме из /ws/schema; отклоненный кадр получает error с code (malformed_frame, invalid_frame, unknown_type, unsupported_frame, room_not_found, forbidden, not_subscribed, rate_limited) и message, а requestId кадра повторяется в ответах на него. Токен передается заголовком Authorization; браузер, который не может задать заголовок, передает параметром ticket одноразовый билет из POST /ws/ticket. Параметр token с самим токеном попадает в журналы прокси и принимается, только если для старых клиентов включен WS_ALLOW_QUERY_TOKEN. Подключение со страницы, источник которой не входит в CORS_ORIGINS, отклоняется с 403",
+                "tags": [
+                    "websocket"
+                ],
+                "summary": "Мультиплексное WebSocket-соединение",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Одноразовый билет из POST /ws/ticket",
+                        "name": "ticket",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "JWT или персональный токен (устаревший способ, только с WS_ALLOW_QUERY_TOKEN=true)",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "linkup.v1",
+                            "linkup.v1+msgpack",
+                            "linkup.v1+cbor"
+                        ],
+                        "type": "string",
+                        "description": "Подпротоколы в порядке предпочтения",
+                        "name": "Sec-WebSocket-Protocol",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ws/asyncapi": {
+            "get": {
+                "description": "Возвращает описание каналов /ws и /ws/rooms/{roomId} в формате AsyncAPI 2.6, построенное из JSON Schema протокола linkup.v1, для генераторов клиентов",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "websocket"
+                ],
+                "summary": "AsyncAPI протокола WebSocket",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/ws/schema": {
+            "get": {
+                "description": "Возвращает JSON Schema (draft 2020-12) кадров протокола linkup.v1: $defs/clientFrame — кадры клиента, $defs/serverEvent и *Payload — события сервера. По этой схеме сервер проверяет каждый входящий кадр",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "websocket"
+                ],
+                "summary": "JSON Schema протокола WebSocket",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/ws/ticket": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Выдает одноразовый билет, с которым браузер подключается к /ws или /ws/rooms/{id} параметром ticket вместо токена: долгоживущий токен не попадает в URL и журналы прокси. Билет действует WS_TICKET_TTL (по умолчанию 30 секунд), гасится при подключении и дает те же права, что токен запроса. roomId привязывает билет к комнате: с ним можно подключиться только к /ws/rooms/{roomId} или подписаться на мультиплексном соединении только на эту комнату. Билет по персональному токену, ограниченному комнатой, всегда привязан к ней",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "websocket"
+                ],
+                "summary": "Билет для подключения к WebSocket",
+                "parameters": [
+                    {
+                        "description": "Комната, к которой привязать билет",
+                        "name": "ticket",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.WSTicketRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.WSTicketResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "handlers.AuthResponse": {
+            "type": "object",
+            "properties": {
+                "expiresIn": {
+                    "type": "integer",
+                    "example": 900
+                },
+                "refreshToken": {
+                    "type": "string",
+                    "example": "3q2-7wZ1nV0c9Xb1m0oYt7fJx1qk8y2dLr4uQm5HcTs"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+                },
+                "user": {
+                    "$ref": "#/definitions/handlers.UserResponse"
+                }
+            }
+        },
+        "handlers.ChangePasswordRequest": {
+            "type": "object",
+            "required": [
+                "currentPassword",
+                "newPassword"
+            ],
+            "properties": {
+                "currentPassword": {
+                    "type": "string",
+                    "example": "securepassword123"
+                },
+                "newPassword": {
+                    "type": "string",
+                    "example": "correct-horse-battery-staple"
+                }
+            }
+        },
+        "handlers.CreateInviteRequest": {
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2025-01-22T00:00:00Z"
+                },
+                "maxUses": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "roleIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        3
+                    ]
+                },
+                "roomIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        1,
+                        2
+                    ]
+                }
+            }
+        },
+        "handlers.CreateInviteResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "Zk3mP9qL2xWv7cR4tY8bN1sD6fH0jA5e"
+                },
+                "createdAt": {
+                    "type": "string",
+                    "example": "2024-01-15T10:30:00Z"
+                },
+                "createdBy": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2024-01-22T10:30:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "maxUses": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "Zk3mP9qL"
+                },
+                "revokedAt": {
+                    "type": "string",
+                    "example": "2024-01-16T08:00:00Z"
+                },
+                "roleIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        3
+                    ]
+                },
+                "roomIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        1,
+                        2
+                    ]
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://chat.example.com/register?invite=Zk3mP9qL2xWv7cR4tY8bN1sD6fH0jA5e"
+                },
+                "uses": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "handlers.CreateRoomRequest": {
+            "type": "object",
+            "required": [
+                "name",
+                "slug"
+            ],
+            "properties": {
+                "isPrivate": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "name": {
+                    "type": "string",
+                    "example": "General Chat"
+                },
+                "slug": {
+                    "type": "string",
+                    "example": "general"
+                }
+            }
+        },
+        "handlers.CreateTokenRequest": {
+            "type": "object",
+            "required": [
+                "name",
+                "scopes"
+            ],
+            "properties": {
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2025-01-15T00:00:00Z"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "deploy bot"
+                },
+                "roomId": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "messages:write",
+                        "rooms:read"
+                    ]
+                }
+            }
+        },
+        "handlers.CreateTokenResponse": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string",
+                    "example": "2024-01-15T10:30:00Z"
+                },
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2025-01-15T00:00:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "lastUsedAt": {
+                    "type": "string",
+                    "example": "2024-01-16T08:00:00Z"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "deploy bot"
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "lup_Xr0nW3d9"
+                },
+                "roomId": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "messages:write",
+                        "rooms:read"
+                    ]
+                },
+                "token": {
+                    "type": "string",
+                    "example": "lup_Xr0nW3d9yq1kz7cT2bVQm8sPpL4eJfHaGiU6oNwDx5E"
+                }
+            }
+        },
+        "handlers.DeleteAccountRequest": {
+            "type": "object",
+            "properties": {
+                "confirm": {
+                    "type": "string",
+                    "example": "john_doe"
+                },
+                "password": {
+                    "type": "string",
+                    "example": "securepassword123"
+                }
+            }
+        },
+        "handlers.EmailTokenRequest": {
+            "type": "object",
+            "required": [
+                "token"
+            ],
+            "properties": {
+                "token": {
+                    "type": "string",
+                    "example": "Xr0nW3d9yq1kz7cT2bVQm8sPpL4eJfHaGiU6oNwDx5E"
+                }
+            }
+        },
+        "handlers.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "Invalid request"
+                }
+            }
+        },
+        "handlers.Event": {
+            "type": "object",
+            "properties": {
+                "payload": {},
+                "requestId": {
+                    "type": "string"
+                },
+                "roomId": {
+                    "type": "integer"
+                },
+                "seq": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ForgotPasswordRequest": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "john@example.com"
+                }
+            }
+        },
+        "handlers.HubStats": {
+            "type": "object",
+            "properties": {
+                "clients": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "roomId": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "handlers.HubsResponse": {
+            "type": "object",
+            "properties": {
+                "activeHubs": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "clients": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "events": {
+                    "$ref": "#/definitions/handlers.WSCounters"
+                },
+                "hubs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.HubStats"
+                    }
+                },
+                "node": {
+                    "type": "string",
+                    "example": "backend-1-3f9a2c01"
+                }
+            }
+        },
+        "handlers.InviteResponse": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string",
+                    "example": "2024-01-15T10:30:00Z"
+                },
+                "createdBy": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2024-01-22T10:30:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "maxUses": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "Zk3mP9qL"
+                },
+                "revokedAt": {
+                    "type": "string",
+                    "example": "2024-01-16T08:00:00Z"
+                },
+                "roleIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        3
+                    ]
+                },
+                "roomIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        1,
+                        2
+                    ]
+                },
+                "uses": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "handlers.Login2FARequest": {
+            "type": "object",
+            "required": [
+                "challengeToken",
+                "code"
+            ],
+            "properties": {
+                "challengeToken": {
+                    "type": "string",
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+                },
+                "code": {
+                    "description": "TOTP-код или резервный код",
+                    "type": "string",
+                    "example": "123456"
+                }
+            }
+        },
+        "handlers.LoginRequest": {
+            "type": "object",
+            "required": [
+                "login",
+                "password"
+            ],
+            "properties": {
+                "login": {
+                    "type": "string",
+                    "example": "john_doe"
+                },
+                "password": {
+                    "type": "string",
+                    "example": "securepassword123"
+                }
+            }
+        },
+        "handlers.MessageAckResponse": {
+            "type": "object",
+            "properties": {
+                "clientMsgId": {
+                    "type": "string",
+                    "example": "7f3c2a9e-5b1d-4c8e-9a0f-2d6b8e1c4f7a"
+                },
+                "createdAt": {
+                    "type": "string",
+                    "example": "2024-01-15T10:30:00Z"
+                },
+                "duplicate": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 42
+                }
+            }
+        },
+        "handlers.OIDCAuthorizeResponse": {
+            "type": "object",
+            "properties": {
+                "authorizationUrl": {
+                    "type": "string",
+                    "example": "https://idp.example.com/authorize?response_type=code\u0026client_id=linkup"
+                },
+                "state": {
+                    "type": "string",
+                    "example": "b3JpZ2luYWwtc3RhdGU"
+                }
+            }
+        },
+        "handlers.OIDCCallbackRequest": {
+            "type": "object",
+            "required": [
+                "code",
+                "state"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "SplxlOBeZQQYbYS6WxSbIA"
+                },
+                "state": {
+                    "type": "string",
+                    "example": "b3JpZ2luYWwtc3RhdGU"
+                }
+            }
+        },
+        "handlers.Passkey2FABeginRequest": {
+            "type": "object",
+            "required": [
+                "challengeToken"
+            ],
+            "properties": {
+                "challengeToken": {
+                    "type": "string",
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+                }
+            }
+        },
+        "handlers.Passkey2FARequest": {
+            "type": "object",
+            "required": [
+                "challengeToken",
+                "credential"
+            ],
+            "properties": {
+                "challengeToken": {
+                    "type": "string",
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+                },
+                "credential": {
+                    "$ref": "#/definitions/webauthn.AssertionResponse"
+                }
+            }
+        },
+        "handlers.PasskeyLoginBeginRequest": {
+            "type": "object",
+            "properties": {
+                "login": {
+                    "type": "string",
+                    "example": "john_doe"
+                }
+            }
+        },
+        "handlers.PasskeyLoginRequest": {
+            "type": "object",
+            "required": [
+                "credential"
+            ],
+            "properties": {
+                "credential": {
+                    "$ref": "#/definitions/webauthn.AssertionResponse"
+                }
+            }
+        },
+        "handlers.PasskeyRegisterRequest": {
+            "type": "object",
+            "required": [
+                "credential"
+            ],
+            "properties": {
+                "credential": {
+                    "$ref": "#/definitions/webauthn.RegistrationResponse"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "MacBook Touch ID"
+                }
+            }
+        },
+        "handlers.PasskeyResponse": {
+            "type": "object",
+            "properties": {
+                "backupEligible": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "createdAt": {
+                    "type": "string",
+                    "example": "2024-01-15T10:30:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "lastUsedAt": {
+                    "type": "string",
+                    "example": "2024-01-16T08:00:00Z"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "MacBook Touch ID"
+                },
+                "transports": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "internal",
+                        "hybrid"
+                    ]
+                }
+            }
+        },
+        "handlers.PersonalTokenResponse": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string",
+                    "example": "2024-01-15T10:30:00Z"
+                },
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2025-01-15T00:00:00Z"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "lastUsedAt": {
+                    "type": "string",
+                    "example": "2024-01-16T08:00:00Z"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "deploy bot"
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "lup_Xr0nW3d9"
+                },
+                "roomId": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "messages:write",
+                        "rooms:read"
+                    ]
+                }
+            }
+        },
+        "handlers.PresenceResponse": {
+            "type": "object",
+            "properties": {
+                "emoji": {
+                    "type": "string",
+                    "example": "📅"
+                },
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2024-01-15T12:00:00Z"
+                },
+                "hideOnline": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "lastSeen": {
+                    "type": "string",
+                    "example": "2024-01-15T10:30:00Z"
+                },
+                "mode": {
+                    "description": "Mode and HideOnline are only returned for the current user",
+                    "type": "string",
+                    "enum": [
+                        "auto",
+                        "away",
+                        "dnd"
+                    ],
+                    "example": "auto"
+                },
+                "state": {
+                    "description": "State is online, idle, away, dnd or offline; users hiding their online state appear offline to others",
+                    "type": "string",
+                    "enum": [
+                        "online",
+                        "idle",
+                        "away",
+                        "dnd",
+                        "offline"
+                    ],
+                    "example": "online"
+                },
+                "text": {
+                    "type": "string",
+                    "example": "In a meeting"
+                }
+            }
+        },
+        "handlers.RecoveryCodesResponse": {
+            "type": "object",
+            "properties": {
+                "codes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "[\"K7QXM-2PD4A\"",
+                        " \"ZR5TB-NW3HE\"]"
+                    ]
+                }
+            }
+        },
+        "handlers.RecoveryCodesStatusResponse": {
+            "type": "object",
+            "properties": {
+                "remaining": {
+                    "type": "integer",
+                    "example": 8
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 10
                 }
             }
         },
-        "handlers.LoginRequest": {
+        "handlers.RefreshRequest": {
+            "type": "object",
+            "required": [
+                "refreshToken"
+            ],
+            "properties": {
+                "refreshToken": {
+                    "type": "string",
+                    "example": "3q2-7wZ1nV0c9Xb1m0oYt7fJx1qk8y2dLr4uQm5HcTs"
+                }
+            }
+        },
+        "handlers.RegisterRequest": {
             "type": "object",
             "required": [
                 "login",
+                "name",
                 "password"
             ],
             "properties": {
+                "avatarUrl": {
+                    "type": "string",
+                    "example": "https://example.com/avatar.jpg"
+                },
+                "email": {
+                    "type": "string",
+                    "example": "john@example.com"
+                },
+                "invite": {
+                    "description": "Invite is required when REGISTRATION_MODE=invite",
+                    "type": "string",
+                    "example": "Zk3mP9qL2xWv7cR4tY8bN1sD6fH0jA5e"
+                },
                 "login": {
                     "type": "string",
                     "example": "john_doe"
                 },
+                "name": {
+                    "type": "string",
+                    "example": "John Doe"
+                },
                 "password": {
                     "type": "string",
                     "example": "securepassword123"
                 }
             }
         },
-        "handlers.MessageResponse": {
+        "handlers.RenamePasskeyRequest": {
             "type": "object",
+            "required": [
+                "name"
+            ],
             "properties": {
-                "createdAt": {
+                "name": {
                     "type": "string",
-                    "example": "2024-01-15T10:30:00Z"
+                    "example": "YubiKey 5C"
+                }
+            }
+        },
+        "handlers.ResetPasswordRequest": {
+            "type": "object",
+            "required": [
+                "password",
+                "token"
+            ],
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": "newsecurepassword123"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "Xr0nW3d9yq1kz7cT2bVQm8sPpL4eJfHaGiU6oNwDx5E"
+                }
+            }
+        },
+        "handlers.RoomEventsResponse": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "description": "Events are the same frames the room WebSocket delivers, oldest first",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.Event"
+                    }
                 },
+                "lastEventId": {
+                    "description": "LastEventID is the cursor for the next poll",
+                    "type": "integer",
+                    "example": 42
+                }
+            }
+        },
+        "handlers.RoomResponse": {
+            "type": "object",
+            "properties": {
                 "id": {
                     "type": "integer",
                     "example": 1
                 },
-                "imageUrl": {
-                    "type": "string",
-                    "example": "https://example.com/image.jpg"
+                "isPrivate": {
+                    "type": "boolean",
+                    "example": false
                 },
-                "reactions": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "array",
-                        "items": {
-                            "type": "integer"
-                        }
-                    }
+                "name": {
+                    "type": "string",
+                    "example": "General Chat"
                 },
-                "roomId": {
+                "ownerId": {
                     "type": "integer",
                     "example": 1
                 },
+                "slug": {
+                    "type": "string",
+                    "example": "general"
+                },
+                "unread": {
+                    "type": "integer",
+                    "example": 5
+                }
+            }
+        },
+        "handlers.SendErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "forbidden"
+                },
+                "error": {
+                    "type": "string",
+                    "example": "not a member of private room"
+                }
+            }
+        },
+        "handlers.SendMessageRequest": {
+            "type": "object",
+            "properties": {
+                "clientMsgId": {
+                    "description": "ClientMsgID deduplicates retries of the same send",
+                    "type": "string",
+                    "example": "7f3c2a9e-5b1d-4c8e-9a0f-2d6b8e1c4f7a"
+                },
+                "imageUrl": {
+                    "type": "string",
+                    "example": "https://example.com/image.jpg"
+                },
                 "text": {
                     "type": "string",
                     "example": "Hello everyone!"
@@ -1204,133 +4648,284 @@ const docTemplate = `{
                 "type": {
                     "type": "string",
                     "example": "text"
+                }
+            }
+        },
+        "handlers.SessionResponse": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string",
+                    "example": "2024-01-15T10:30:00Z"
                 },
-                "userId": {
+                "current": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "device": {
+                    "type": "string",
+                    "example": "John's laptop"
+                },
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2024-02-14T12:00:00Z"
+                },
+                "id": {
                     "type": "integer",
-                    "example": 1
+                    "example": 12
+                },
+                "ip": {
+                    "type": "string",
+                    "example": "203.0.113.7"
+                },
+                "lastUsedAt": {
+                    "type": "string",
+                    "example": "2024-01-15T12:00:00Z"
+                },
+                "userAgent": {
+                    "type": "string",
+                    "example": "Mozilla/5.0"
                 }
             }
         },
-        "handlers.RegisterRequest": {
+        "handlers.Setup2FAResponse": {
+            "type": "object",
+            "properties": {
+                "backupCodes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "[\"K7QXM-2PD4A\"",
+                        " \"ZR5TB-NW3HE\"]"
+                    ]
+                },
+                "otpauthUrl": {
+                    "type": "string",
+                    "example": "otpauth://totp/LinkUp:john_doe?issuer=LinkUp\u0026secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+                },
+                "qrCode": {
+                    "type": "string",
+                    "example": "data:image/png;base64,iVBORw0KGgo..."
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+                }
+            }
+        },
+        "handlers.SuccessResponse": {
+            "type": "object",
+            "properties": {
+                "ok": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "handlers.TokenResponse": {
+            "type": "object",
+            "properties": {
+                "expiresIn": {
+                    "type": "integer",
+                    "example": 900
+                },
+                "refreshToken": {
+                    "type": "string",
+                    "example": "3q2-7wZ1nV0c9Xb1m0oYt7fJx1qk8y2dLr4uQm5HcTs"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+                }
+            }
+        },
+        "handlers.TransferRoomRequest": {
             "type": "object",
             "required": [
-                "login",
-                "name",
-                "password"
+                "userId"
             ],
+            "properties": {
+                "userId": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "handlers.UpdateProfileRequest": {
+            "type": "object",
             "properties": {
                 "avatarUrl": {
                     "type": "string",
-                    "example": "https://example.com/avatar.jpg"
+                    "example": "https://example.com/new-avatar.jpg"
                 },
-                "login": {
+                "email": {
                     "type": "string",
-                    "example": "john_doe"
+                    "example": "john.smith@example.com"
                 },
                 "name": {
                     "type": "string",
-                    "example": "John Doe"
-                },
-                "password": {
-                    "type": "string",
-                    "example": "securepassword123"
+                    "example": "John Smith"
                 }
             }
         },
-        "handlers.RoomResponse": {
+        "handlers.UpdateStatusRequest": {
             "type": "object",
             "properties": {
-                "id": {
-                    "type": "integer",
-                    "example": 1
+                "emoji": {
+                    "type": "string",
+                    "example": "📅"
                 },
-                "isPrivate": {
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2024-01-15T12:00:00Z"
+                },
+                "hideOnline": {
+                    "description": "HideOnline makes the user appear offline to others",
                     "type": "boolean",
                     "example": false
                 },
-                "name": {
+                "mode": {
+                    "description": "Mode auto derives online or idle from client activity; away and dnd override it while connected",
                     "type": "string",
-                    "example": "General Chat"
+                    "enum": [
+                        "auto",
+                        "away",
+                        "dnd"
+                    ],
+                    "example": "dnd"
                 },
-                "ownerId": {
+                "text": {
+                    "description": "Text, Emoji and ExpiresAt replace the custom status together; empty text and emoji clear it",
+                    "type": "string",
+                    "example": "In a meeting"
+                }
+            }
+        },
+        "handlers.UserResponse": {
+            "type": "object",
+            "properties": {
+                "avatarUrl": {
+                    "type": "string",
+                    "example": "https://example.com/avatar.jpg"
+                },
+                "email": {
+                    "description": "Email and EmailVerified are only returned for the current user",
+                    "type": "string",
+                    "example": "john@example.com"
+                },
+                "emailVerified": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "id": {
                     "type": "integer",
                     "example": 1
                 },
-                "slug": {
+                "lastSeen": {
                     "type": "string",
-                    "example": "general"
+                    "example": "2024-01-15T10:30:00Z"
                 },
-                "unread": {
-                    "type": "integer",
-                    "example": 5
+                "login": {
+                    "type": "string",
+                    "example": "john_doe"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "John Doe"
+                },
+                "online": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "presence": {
+                    "description": "Presence is returned for the current user and in room member lists",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/handlers.PresenceResponse"
+                        }
+                    ]
                 }
             }
         },
-        "handlers.SendMessageRequest": {
+        "handlers.Verify2FARequest": {
             "type": "object",
+            "required": [
+                "code"
+            ],
             "properties": {
-                "imageUrl": {
+                "code": {
                     "type": "string",
-                    "example": "https://example.com/image.jpg"
+                    "example": "123456"
+                }
+            }
+        },
+        "handlers.WSCounters": {
+            "type": "object",
+            "properties": {
+                "oversizedFrames": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "pingTimeouts": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "rateLimitEvictions": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "rateLimitedFrames": {
+                    "type": "integer",
+                    "example": 12
                 },
-                "text": {
-                    "type": "string",
-                    "example": "Hello everyone!"
+                "slowConsumerEvictions": {
+                    "type": "integer",
+                    "example": 2
                 },
-                "type": {
-                    "type": "string",
-                    "example": "text"
+                "writeTimeouts": {
+                    "type": "integer",
+                    "example": 1
                 }
             }
         },
-        "handlers.SuccessResponse": {
+        "handlers.WSTicketRequest": {
             "type": "object",
             "properties": {
-                "ok": {
-                    "type": "boolean",
-                    "example": true
+                "roomId": {
+                    "description": "RoomID binds the ticket to one room",
+                    "type": "integer",
+                    "example": 1
                 }
             }
         },
-        "handlers.UpdateProfileRequest": {
+        "handlers.WSTicketResponse": {
             "type": "object",
             "properties": {
-                "avatarUrl": {
+                "expiresAt": {
                     "type": "string",
-                    "example": "https://example.com/new-avatar.jpg"
+                    "example": "2024-01-15T10:30:30Z"
                 },
-                "name": {
+                "ticket": {
                     "type": "string",
-                    "example": "John Smith"
+                    "example": "3q2-7wEjRkq8ZyVbQ1x0mN5tLcP4sHgUaJd9oIeKfW6"
                 }
             }
         },
-        "handlers.UserResponse": {
+        "handlers.WebAuthnCreationResponse": {
             "type": "object",
             "properties": {
-                "avatarUrl": {
-                    "type": "string",
-                    "example": "https://example.com/avatar.jpg"
-                },
-                "id": {
-                    "type": "integer",
-                    "example": 1
-                },
-                "lastSeen": {
-                    "type": "string",
-                    "example": "2024-01-15T10:30:00Z"
-                },
-                "login": {
-                    "type": "string",
-                    "example": "john_doe"
-                },
-                "name": {
-                    "type": "string",
-                    "example": "John Doe"
-                },
-                "online": {
-                    "type": "boolean",
-                    "example": true
+                "publicKey": {
+                    "$ref": "#/definitions/webauthn.CreationOptions"
+                }
+            }
+        },
+        "handlers.WebAuthnRequestResponse": {
+            "type": "object",
+            "properties": {
+                "publicKey": {
+                    "$ref": "#/definitions/webauthn.RequestOptions"
                 }
             }
         },
@@ -1395,6 +4990,106 @@ const docTemplate = `{
                 }
             }
         },
+        "models.AuditEvent": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "\"auth.login\", \"admin.role.assign\", ...",
+                    "type": "string"
+                },
+                "actorId": {
+                    "description": "nil — действие без входа (сброс пароля по ссылке и т. п.)",
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "diff": {
+                    "description": "поле -\u003e {\"old\": ..., \"new\": ...}",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "targetId": {
+                    "type": "integer"
+                },
+                "targetType": {
+                    "description": "user | role | room | session | token | passkey | identity",
+                    "type": "string"
+                },
+                "userAgent": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ExternalIdentity": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "issuer": {
+                    "type": "string"
+                },
+                "lastLoginAt": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "subject": {
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "userId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.LoginAttempt": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "login": {
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "\"bad_password\" | \"unknown_user\" | \"bad_2fa\" | \"locked\"",
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "userAgent": {
+                    "type": "string"
+                },
+                "userId": {
+                    "description": "nil — такого пользователя нет",
+                    "type": "integer"
+                }
+            }
+        },
         "models.Mention": {
             "type": "object",
             "properties": {
@@ -1561,6 +5256,193 @@ const docTemplate = `{
                     "type": "integer"
                 }
             }
+        },
+        "webauthn.AssertionResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "rawId": {
+                    "type": "string"
+                },
+                "response": {
+                    "type": "object",
+                    "properties": {
+                        "authenticatorData": {
+                            "type": "string"
+                        },
+                        "clientDataJSON": {
+                            "type": "string"
+                        },
+                        "signature": {
+                            "type": "string"
+                        },
+                        "userHandle": {
+                            "type": "string"
+                        }
+                    }
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "webauthn.AuthenticatorSelection": {
+            "type": "object",
+            "properties": {
+                "requireResidentKey": {
+                    "type": "boolean"
+                },
+                "residentKey": {
+                    "type": "string"
+                },
+                "userVerification": {
+                    "type": "string"
+                }
+            }
+        },
+        "webauthn.CreationOptions": {
+            "type": "object",
+            "properties": {
+                "attestation": {
+                    "type": "string"
+                },
+                "authenticatorSelection": {
+                    "$ref": "#/definitions/webauthn.AuthenticatorSelection"
+                },
+                "challenge": {
+                    "type": "string"
+                },
+                "excludeCredentials": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webauthn.CredentialDescriptor"
+                    }
+                },
+                "pubKeyCredParams": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webauthn.CredentialParameter"
+                    }
+                },
+                "rp": {
+                    "$ref": "#/definitions/webauthn.RPEntity"
+                },
+                "timeout": {
+                    "type": "integer"
+                },
+                "user": {
+                    "$ref": "#/definitions/webauthn.UserEntity"
+                }
+            }
+        },
+        "webauthn.CredentialDescriptor": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "transports": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "webauthn.CredentialParameter": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "type": "integer"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "webauthn.RPEntity": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "webauthn.RegistrationResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "rawId": {
+                    "type": "string"
+                },
+                "response": {
+                    "type": "object",
+                    "properties": {
+                        "attestationObject": {
+                            "type": "string"
+                        },
+                        "clientDataJSON": {
+                            "type": "string"
+                        },
+                        "transports": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "webauthn.RequestOptions": {
+            "type": "object",
+            "properties": {
+                "allowCredentials": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webauthn.CredentialDescriptor"
+                    }
+                },
+                "challenge": {
+                    "type": "string"
+                },
+                "rpId": {
+                    "type": "string"
+                },
+                "timeout": {
+                    "type": "integer"
+                },
+                "userVerification": {
+                    "type": "string"
+                }
+            }
+        },
+        "webauthn.UserEntity": {
+            "type": "object",
+            "properties": {
+                "displayName": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
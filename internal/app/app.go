@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"LinkUp/internal/auth"
+	"LinkUp/internal/cors"
 	"LinkUp/internal/handlers"
 	"LinkUp/internal/storage"
 
@@ -46,6 +47,10 @@ func Run() error {
 		port = "8080"
 	}
 
+	if err := auth.LoadKeys(); err != nil {
+		return err
+	}
+
 	db, err := storage.OpenDefault()
 	if err != nil {
 		return err
@@ -60,22 +65,8 @@ func Run() error {
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	
-	r.Use(func(c *gin.Context) {
-		origins := os.Getenv("CORS_ORIGINS")
-		if origins == "" {
-			origins = "*"
-		}
-		c.Header("Access-Control-Allow-Origin", origins)
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type")
-		c.Header("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-		if c.Request.Method == http.MethodOptions {
-			c.Status(http.StatusNoContent)
-			c.Abort()
-			return
-		}
-		c.Next()
-	})
+	// Тот же список источников проверяется при подключении к WebSocket
+	r.Use(cors.FromEnv().Middleware())
 
 	uploadDir := os.Getenv("UPLOAD_DIR")
 	if uploadDir == "" {
@@ -90,6 +81,9 @@ func Run() error {
 	r.Static("/uploads", uploadDir)
 
 	h := handlers.New(db, uploadDir, staticBase)
+	auth.SetSessionValidator(h.SessionActive)
+	auth.SetPATResolver(h.ResolvePAT)
+	auth.SetTicketRedeemer(h.RedeemWSTicket)
 
 	
 	// @Summary Проверка здоровья сервера
@@ -101,20 +95,29 @@ func Run() error {
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"ok": true, "time": time.Now()})
 	})
+
+	// @Summary Публичные ключи подписи JWT
+	// @Description JWKS для проверки токенов LinkUp другими сервисами
+	// @Tags system
+	// @Produce json
+	// @Success 200 {object} auth.JWKSet
+	// @Router /.well-known/jwks.json [get]
+	r.GET("/.well-known/jwks.json", auth.JWKSHandler)
 	// @Summary Регистрация пользователя
-	// @Description Создает нового пользователя в системе
+	// @Description Создает нового пользователя в системе. Пароль проверяется парольной политикой: минимальная длина, список распространенных паролей, запрет на логин в пароле. Если указан email, на него отправляется ссылка подтверждения. В режиме REGISTRATION_MODE=invite нужен код приглашения, в режиме closed регистрация недоступна; код, переданный в открытом режиме, тоже списывается и выдает комнаты и роли приглашения
 	// @Tags auth
 	// @Accept json
 	// @Produce json
 	// @Param user body handlers.RegisterRequest true "Данные пользователя"
 	// @Success 201 {object} handlers.AuthResponse
 	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
 	// @Failure 409 {object} handlers.ErrorResponse
 	// @Router /register [post]
 	r.POST("/register", h.Register)
 
 	// @Summary Авторизация пользователя
-	// @Description Вход в систему с логином и паролем
+	// @Description Вход в систему с логином и паролем. Пароль проверяется цепочкой источников из AUTH_PROVIDERS (локальные пароли, LDAP); при первом входе через LDAP пользователь создается автоматически, если это позволяет REGISTRATION_MODE (в режимах invite и closed — только с REGISTRATION_SSO_PROVISION=true, иначе 403). Если у пользователя включена 2FA или зарегистрированы passkeys, вместо JWT возвращается TwoFactorChallengeResponse для /auth/2fa/login или /auth/2fa/webauthn. После серии неудачных попыток логин и IP временно блокируются (429 с Retry-After)
 	// @Tags auth
 	// @Accept json
 	// @Produce json
@@ -122,11 +125,163 @@ func Run() error {
 	// @Success 200 {object} handlers.AuthResponse
 	// @Failure 400 {object} handlers.ErrorResponse
 	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Failure 429 {object} handlers.ErrorResponse
+	// @Failure 503 {object} handlers.ErrorResponse
 	// @Router /login [post]
 	r.POST("/login", h.Login)
 
+	// @Summary Второй шаг входа с 2FA
+	// @Description Обменивает challenge-токен из /login и TOTP-код (или одноразовый резервный код) на JWT. Challenge-токен одноразовый: после успешного входа он больше не принимается ни здесь, ни в /auth/2fa/webauthn
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param credentials body handlers.Login2FARequest true "Challenge-токен и код"
+	// @Success 200 {object} handlers.AuthResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 429 {object} handlers.ErrorResponse
+	// @Router /auth/2fa/login [post]
+	r.POST("/auth/2fa/login", h.Login2FA)
+
+	// @Summary Начать вход по passkey
+	// @Description Возвращает параметры для navigator.credentials.get(). Без логина используется discoverable-ключ, который сам сообщает пользователя
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param request body handlers.PasskeyLoginBeginRequest false "Логин (необязательно)"
+	// @Success 200 {object} handlers.WebAuthnRequestResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Router /auth/webauthn/login/begin [post]
+	r.POST("/auth/webauthn/login/begin", h.BeginPasskeyLogin)
+
+	// @Summary Войти по passkey
+	// @Description Вход без пароля. Ключ с проверкой пользователя (PIN, биометрия) заменяет оба фактора, поэтому 2FA не запрашивается
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param credential body handlers.PasskeyLoginRequest true "Ответ navigator.credentials.get()"
+	// @Success 200 {object} handlers.AuthResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 429 {object} handlers.ErrorResponse
+	// @Router /auth/webauthn/login/finish [post]
+	r.POST("/auth/webauthn/login/finish", h.FinishPasskeyLogin)
+
+	// @Summary Начать проверку второго фактора по passkey
+	// @Description Вместо TOTP-кода второй фактор можно подтвердить зарегистрированным ключом. Принимает challenge-токен из /login
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param request body handlers.Passkey2FABeginRequest true "Challenge-токен"
+	// @Success 200 {object} handlers.WebAuthnRequestResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Router /auth/2fa/webauthn/begin [post]
+	r.POST("/auth/2fa/webauthn/begin", h.BeginPasskey2FA)
+
+	// @Summary Подтвердить второй фактор passkey
+	// @Description Завершает вход с 2FA ключом WebAuthn вместо TOTP-кода
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param credential body handlers.Passkey2FARequest true "Challenge-токен и ответ navigator.credentials.get()"
+	// @Success 200 {object} handlers.AuthResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 429 {object} handlers.ErrorResponse
+	// @Router /auth/2fa/webauthn/finish [post]
+	r.POST("/auth/2fa/webauthn/finish", h.FinishPasskey2FA)
+
+	// @Summary Обновить токены
+	// @Description Обменивает refresh-токен на новую пару токенов
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param token body handlers.RefreshRequest true "Refresh-токен"
+	// @Success 200 {object} handlers.TokenResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Router /auth/refresh [post]
+	r.POST("/auth/refresh", h.Refresh)
+
+	// @Summary Список SSO-провайдеров
+	// @Description Возвращает имена настроенных OIDC-провайдеров для кнопок входа
+	// @Tags auth
+	// @Produce json
+	// @Success 200 {array} string
+	// @Router /auth/oidc/providers [get]
+	r.GET("/auth/oidc/providers", h.OIDCProviders)
+
+	// @Summary Начать вход через SSO
+	// @Description Возвращает адрес авторизации у провайдера (authorization code + PKCE). Клиент должен сохранить state и сверить его при возврате
+	// @Tags auth
+	// @Produce json
+	// @Param provider path string true "Имя провайдера"
+	// @Success 200 {object} handlers.OIDCAuthorizeResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Failure 502 {object} handlers.ErrorResponse
+	// @Router /auth/oidc/{provider}/authorize [get]
+	r.GET("/auth/oidc/:provider/authorize", h.OIDCAuthorize)
+
+	// @Summary Завершить вход через SSO
+	// @Description Принимает code и state из редиректа провайдера. Для входа возвращает токены (или challenge 2FA), для привязки — связанную учетную запись; привязку принимает только с токеном пользователя, который ее начал (иначе 403), чтобы чужая ссылка не привязала аккаунт провайдера к чужому пользователю. Пользователь без привязанного аккаунта создается, только если у провайдера включен AUTO_PROVISION и это позволяет REGISTRATION_MODE (в режимах invite и closed — только с REGISTRATION_SSO_PROVISION=true)
+	// @Tags auth
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param provider path string true "Имя провайдера"
+	// @Param callback body handlers.OIDCCallbackRequest true "Code и state"
+	// @Success 200 {object} handlers.AuthResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Failure 409 {object} handlers.ErrorResponse
+	// @Router /auth/oidc/{provider}/callback [post]
+	r.POST("/auth/oidc/:provider/callback", auth.OptionalJWTMiddleware(), h.OIDCCallback)
+
+	// @Summary Подтвердить email
+	// @Description Принимает токен из письма и отмечает адрес подтвержденным
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param token body handlers.EmailTokenRequest true "Токен из письма"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Router /auth/email/verify [post]
+	r.POST("/auth/email/verify", h.VerifyEmail)
+
+	// @Summary Запросить сброс пароля
+	// @Description Отправляет ссылку сброса на подтвержденный email. Ответ одинаков независимо от того, найден ли адрес
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param request body handlers.ForgotPasswordRequest true "Email"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Router /auth/password/forgot [post]
+	r.POST("/auth/password/forgot", h.ForgotPassword)
+
+	// @Summary Сбросить пароль
+	// @Description Задает новый пароль по одноразовому токену из письма, завершает все сессии пользователя и отзывает его персональные токены. Новый пароль проверяется парольной политикой
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param request body handlers.ResetPasswordRequest true "Токен и новый пароль"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Router /auth/password/reset [post]
+	r.POST("/auth/password/reset", h.ResetPassword)
+
 	pr := r.Group("")
 	pr.Use(auth.JWTMiddleware())
+	// Маршруты api доступны и персональным токенам с нужной областью,
+	// остальные маршруты pr — только JWT-сессиям
+	api := auth.Scoped(pr)
+	// Маршруты roomAPI сами применяют ограничение комнатой и доступны токенам,
+	// ограниченным комнатой, наравне с /rooms/:id/...
+	roomAPI := api.RoomAware()
 
 	// @Summary Получить профиль текущего пользователя
 	// @Description Возвращает информацию о текущем авторизованном пользователе
@@ -136,10 +291,10 @@ func Run() error {
 	// @Success 200 {object} handlers.UserResponse
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Router /user/me [get]
-	pr.GET("/user/me", h.Me)
+	api.GET("/user/me", auth.ScopeUserRead, h.Me)
 
 	// @Summary Обновить профиль пользователя
-	// @Description Обновляет информацию профиля текущего пользователя
+	// @Description Обновляет информацию профиля текущего пользователя. Новый email считается неподтвержденным, на него отправляется ссылка подтверждения
 	// @Tags user
 	// @Security BearerAuth
 	// @Accept json
@@ -148,8 +303,260 @@ func Run() error {
 	// @Success 200 {object} handlers.UserResponse
 	// @Failure 400 {object} handlers.ErrorResponse
 	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 409 {object} handlers.ErrorResponse
 	// @Router /user/me [put]
-	pr.PUT("/user/me", h.UpdateProfile)
+	api.PUT("/user/me", auth.ScopeUserWrite, h.UpdateProfile)
+
+	// @Summary Изменить статус присутствия
+	// @Description Меняет статус текущего пользователя. mode: auto — online или idle по активности клиентов, away и dnd показываются вместо них, пока пользователь подключен. text, emoji и expiresAt задают свой статус целиком: пропущенные поля очищаются, пустые text и emoji снимают статус, после expiresAt он снимается сам. hideOnline — другие видят пользователя офлайн и без lastSeen. Изменение сразу видно в presence_update комнат, а соединения пользователя получают событие status
+	// @Tags user
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param status body handlers.UpdateStatusRequest true "Новый статус"
+	// @Success 200 {object} handlers.PresenceResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /user/me/status [put]
+	api.PUT("/user/me/status", auth.ScopeUserWrite, h.UpdateStatus)
+
+	// @Summary Сбросить статус присутствия
+	// @Description Снимает свой статус и возвращает режим auto. Настройка hideOnline не меняется
+	// @Tags user
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {object} handlers.PresenceResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /user/me/status [delete]
+	api.DELETE("/user/me/status", auth.ScopeUserWrite, h.ClearStatus)
+
+	// @Summary Выгрузить мои данные
+	// @Description Возвращает zip-архив с персональными данными текущего пользователя: data.json (профиль, сообщения, реакции, голоса, упоминания, аналитика, достижения, файлы, сессии и др.) и загруженные файлы в каталоге files/
+	// @Tags user
+	// @Security BearerAuth
+	// @Produce application/zip
+	// @Success 200 {file} file
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /user/me/export [get]
+	pr.GET("/user/me/export", h.ExportMyData)
+
+	// @Summary Удалить мой аккаунт
+	// @Description Безвозвратно удаляет аккаунт текущего пользователя. Сообщения остаются в комнатах от имени «Deleted user», остальные персональные данные и загруженные файлы удаляются, все сессии и токены отзываются. Требует текущий пароль, а для аккаунтов без пароля — повтор логина в поле confirm
+	// @Tags user
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param request body handlers.DeleteAccountRequest true "Подтверждение удаления"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 429 {object} handlers.ErrorResponse
+	// @Router /user/me [delete]
+	pr.DELETE("/user/me", h.DeleteMyAccount)
+
+	// @Summary Отправить письмо подтверждения повторно
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 409 {object} handlers.ErrorResponse
+	// @Router /auth/email/verify/resend [post]
+	pr.POST("/auth/email/verify/resend", h.ResendVerification)
+
+	// ==================== СЕССИИ ====================
+	// @Summary Выйти из системы
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Router /auth/logout [post]
+	pr.POST("/auth/logout", h.Logout)
+
+	// @Summary Активные сессии
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {array} handlers.SessionResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Router /auth/sessions [get]
+	pr.GET("/auth/sessions", h.ListSessions)
+
+	// @Summary Отозвать все остальные сессии
+	// @Description Завершает все сессии пользователя, кроме текущей. Запрос с персональным токеном или токеном без сессии отклоняется: текущей сессии у него нет
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Router /auth/sessions [delete]
+	pr.DELETE("/auth/sessions", h.RevokeOtherSessions)
+
+	// @Summary Отозвать сессию
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Param id path string true "ID сессии"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /auth/sessions/{id} [delete]
+	pr.DELETE("/auth/sessions/:id", h.RevokeSession)
+
+	// @Summary Создать персональный токен
+	// @Description Создает токен доступа для ботов и скриптов с ограниченными областями (rooms:read, rooms:write, messages:read, messages:write, user:read, user:write). Токен с roomId действует только в этой комнате: ему доступны маршруты /rooms/{roomId}/..., список комнат, поиск, реакции, опросы и WebSocket этой комнаты, но не создание комнат, загрузка файлов и профиль. Значение токена возвращается только один раз
+	// @Tags auth
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param token body handlers.CreateTokenRequest true "Параметры токена"
+	// @Success 201 {object} handlers.CreateTokenResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Router /auth/tokens [post]
+	pr.POST("/auth/tokens", h.CreateToken)
+
+	// @Summary Персональные токены
+	// @Description Возвращает действующие персональные токены текущего пользователя без их значений
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {array} handlers.PersonalTokenResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Router /auth/tokens [get]
+	pr.GET("/auth/tokens", h.ListTokens)
+
+	// @Summary Отозвать персональный токен
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Param id path string true "ID токена"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /auth/tokens/{id} [delete]
+	pr.DELETE("/auth/tokens/:id", h.RevokeToken)
+
+	// @Summary Сменить пароль
+	// @Description Меняет пароль текущего пользователя. Требует текущий пароль; новый пароль проверяется парольной политикой. Остальные сессии пользователя завершаются, его персональные токены отзываются
+	// @Tags auth
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param request body handlers.ChangePasswordRequest true "Текущий и новый пароль"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 429 {object} handlers.ErrorResponse
+	// @Router /auth/password/change [post]
+	pr.POST("/auth/password/change", h.ChangePassword)
+
+	// @Summary Начать регистрацию passkey
+	// @Description Возвращает параметры для navigator.credentials.create() в JSON-представлении WebAuthn (бинарные поля в base64url)
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {object} handlers.WebAuthnCreationResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Router /auth/webauthn/register/begin [post]
+	pr.POST("/auth/webauthn/register/begin", h.BeginPasskeyRegistration)
+
+	// @Summary Завершить регистрацию passkey
+	// @Description Проверяет ответ аутентификатора и сохраняет ключ. После регистрации ключ можно использовать для входа без пароля и как второй фактор
+	// @Tags auth
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param credential body handlers.PasskeyRegisterRequest true "Название и ответ navigator.credentials.create()"
+	// @Success 201 {object} handlers.PasskeyResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 409 {object} handlers.ErrorResponse
+	// @Router /auth/webauthn/register/finish [post]
+	pr.POST("/auth/webauthn/register/finish", h.FinishPasskeyRegistration)
+
+	// @Summary Список passkeys
+	// @Description Возвращает ключи WebAuthn текущего пользователя
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {array} handlers.PasskeyResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Router /auth/webauthn/credentials [get]
+	pr.GET("/auth/webauthn/credentials", h.ListPasskeys)
+
+	// @Summary Переименовать passkey
+	// @Tags auth
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "ID ключа"
+	// @Param credential body handlers.RenamePasskeyRequest true "Новое название"
+	// @Success 200 {object} handlers.PasskeyResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /auth/webauthn/credentials/{id} [put]
+	pr.PUT("/auth/webauthn/credentials/:id", h.RenamePasskey)
+
+	// @Summary Удалить passkey
+	// @Description Удаляет ключ WebAuthn. Нельзя удалить последний способ входа аккаунта без пароля
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Param id path string true "ID ключа"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Failure 409 {object} handlers.ErrorResponse
+	// @Router /auth/webauthn/credentials/{id} [delete]
+	pr.DELETE("/auth/webauthn/credentials/:id", h.DeletePasskey)
+
+
+	// ==================== SSO ====================
+	// @Summary Привязать внешний аккаунт
+	// @Description Начинает вход у провайдера, по завершении которого внешняя учетная запись привязывается к текущему пользователю. Callback привязки нужно вызвать с токеном этого же пользователя
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Param provider path string true "Имя провайдера"
+	// @Success 200 {object} handlers.OIDCAuthorizeResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Failure 502 {object} handlers.ErrorResponse
+	// @Router /auth/oidc/{provider}/link [post]
+	pr.POST("/auth/oidc/:provider/link", h.OIDCLink)
+
+	// @Summary Привязанные внешние аккаунты
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {array} models.ExternalIdentity
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Router /auth/identities [get]
+	pr.GET("/auth/identities", h.ListIdentities)
+
+	// @Summary Отвязать внешний аккаунт
+	// @Description Нельзя отвязать последний способ входа у пользователя без пароля
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Param id path string true "ID привязки"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Failure 409 {object} handlers.ErrorResponse
+	// @Router /auth/identities/{id} [delete]
+	pr.DELETE("/auth/identities/:id", h.UnlinkIdentity)
 
 	
 	// @Summary Получить список комнат
@@ -160,7 +567,7 @@ func Run() error {
 	// @Success 200 {array} handlers.RoomResponse
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Router /rooms [get]
-	pr.GET("/rooms", h.ListRooms)
+	roomAPI.GET("/rooms", auth.ScopeRoomsRead, h.ListRooms)
 
 	// @Summary Создать комнату
 	// @Description Создает новую комнату для общения
@@ -173,7 +580,7 @@ func Run() error {
 	// @Failure 400 {object} handlers.ErrorResponse
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Router /rooms [post]
-	pr.POST("/rooms", h.CreateRoom)
+	api.POST("/rooms", auth.ScopeRoomsWrite, h.CreateRoom)
 
 	// @Summary Присоединиться к комнате
 	// @Description Добавляет текущего пользователя в указанную комнату
@@ -186,7 +593,7 @@ func Run() error {
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Failure 404 {object} handlers.ErrorResponse
 	// @Router /rooms/{id}/join [post]
-	pr.POST("/rooms/:id/join", h.JoinRoom)
+	api.POST("/rooms/:id/join", auth.ScopeRoomsWrite, h.JoinRoom)
 
 	// @Summary Покинуть комнату
 	// @Tags rooms
@@ -198,9 +605,10 @@ func Run() error {
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Failure 404 {object} handlers.ErrorResponse
 	// @Router /rooms/{id}/leave [post]
-	pr.POST("/rooms/:id/leave", h.LeaveRoom)
+	api.POST("/rooms/:id/leave", auth.ScopeRoomsWrite, h.LeaveRoom)
 
 	// @Summary Список пользователей в комнате
+	// @Description Возвращает список всех пользователей в указанной комнате с их присутствием: состояние, свой статус и lastSeen; скрывающие присутствие показываются офлайн без lastSeen
 	// @Tags rooms
 	// @Security BearerAuth
 	// @Produce json
@@ -209,7 +617,22 @@ func Run() error {
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Failure 404 {object} handlers.ErrorResponse
 	// @Router /rooms/{id}/users [get]
-	pr.GET("/rooms/:id/users", h.RoomMembers)
+	api.GET("/rooms/:id/users", auth.ScopeRoomsRead, h.RoomMembers)
+
+	// @Summary Передать владение комнатой
+	// @Description Назначает нового владельца комнаты. Доступно текущему владельцу или администратору с правом admin.rooms.transfer; новый владелец должен состоять в комнате
+	// @Tags rooms
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param id path string true "ID комнаты"
+	// @Param request body handlers.TransferRoomRequest true "Новый владелец"
+	// @Success 200 {object} handlers.RoomResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /rooms/{id}/owner [put]
+	api.PUT("/rooms/:id/owner", auth.ScopeRoomsWrite, h.TransferRoomOwnership)
 
 	// @Summary История сообщений комнаты
 	// @Tags messages
@@ -222,21 +645,57 @@ func Run() error {
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Failure 404 {object} handlers.ErrorResponse
 	// @Router /rooms/{id}/history [get]
-	pr.GET("/rooms/:id/history", h.MessageHistory)
+	api.GET("/rooms/:id/history", auth.ScopeMessagesRead, h.MessageHistory)
 
 	// @Summary Отправить сообщение
+	// @Description Отправляет новое сообщение в указанную комнату и возвращает его id и время создания. Необязательный clientMsgId, выбранный клиентом, делает отправку идемпотентной: повтор с тем же clientMsgId в ту же комнату возвращает уже сохраненное сообщение с duplicate=true и кодом 200, не создавая и не рассылая новое; в другой комнате тот же clientMsgId создает новое сообщение. Событие message в WebSocket повторяет clientMsgId, чтобы клиент сопоставил его с оптимистично показанным сообщением. Ошибка содержит машиночитаемый code: invalid_payload, room_not_found, forbidden или internal_error
 	// @Tags messages
 	// @Security BearerAuth
 	// @Accept json
 	// @Produce json
 	// @Param id path string true "ID комнаты"
 	// @Param message body handlers.SendMessageRequest true "Текст сообщения"
-	// @Success 201 {object} handlers.MessageResponse
+	// @Success 201 {object} handlers.MessageAckResponse
+	// @Success 200 {object} handlers.MessageAckResponse "Повтор: сообщение с этим clientMsgId уже сохранено"
+	// @Failure 400 {object} handlers.SendErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.SendErrorResponse
+	// @Failure 404 {object} handlers.SendErrorResponse
+	// @Failure 500 {object} handlers.SendErrorResponse
+	// @Router /rooms/{id}/messages [post]
+	api.POST("/rooms/:id/messages", auth.ScopeMessagesWrite, h.SendMessageREST)
+
+	// @Summary События комнаты (Server-Sent Events)
+	// @Description Поток text/event-stream с теми же событиями комнаты и в том же JSON, что и /ws/rooms/{id}, для клиентов, у которых прокси не пропускает WebSocket. Тип события — поле type в data; id события — его seq, у typing и presence_* id нет. Первым приходит пустое событие с id — текущим курсором, поэтому EventSource при переподключении всегда передает Last-Event-ID, и сервер досылает пропущенные события из журнала комнаты или присылает resync_required (после него историю нужно перечитать через REST; id этого события — номер, с которого поток продолжается). Курсор можно передать и параметром lastEventId. Каждые WS_PING_INTERVAL приходит комментарий-heartbeat. Соединение считается подключением пользователя к комнате для присутствия. Отправка сообщений — через POST /rooms/{id}/messages
+	// @Tags websocket
+	// @Security BearerAuth
+	// @Produce text/event-stream
+	// @Param id path string true "ID комнаты"
+	// @Param Last-Event-ID header string false "seq последнего полученного события"
+	// @Param lastEventId query string false "То же, что Last-Event-ID"
+	// @Success 200 {string} string "Поток событий"
 	// @Failure 400 {object} handlers.ErrorResponse
 	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
 	// @Failure 404 {object} handlers.ErrorResponse
-	// @Router /rooms/{id}/messages [post]
-	pr.POST("/rooms/:id/messages", h.SendMessageREST)
+	// @Router /rooms/{id}/events [get]
+	api.GET("/rooms/:id/events", auth.ScopeMessagesRead, h.RoomEventStream)
+
+	// @Summary События комнаты (long-poll)
+	// @Description Резервный транспорт для клиентов без WebSocket и SSE. Возвращает события комнаты после курсора lastEventId (или заголовка Last-Event-ID) — те же, что и /ws/rooms/{id}, — сразу, если они есть в журнале комнаты, или ждет новых до LONGPOLL_TIMEOUT (по умолчанию 25 с) и отвечает пустым списком. Следующий запрос передает lastEventId из ответа. Без курсора ожидание начинается с последнего события комнаты. Если разрыв больше журнала, в events приходит resync_required: историю нужно перечитать через REST. typing и presence_* приходят, только если произошли во время ожидания; сам опрос на присутствие не влияет. Отправка сообщений — через POST /rooms/{id}/messages
+	// @Tags websocket
+	// @Security BearerAuth
+	// @Produce json
+	// @Param id path string true "ID комнаты"
+	// @Param lastEventId query string false "seq последнего полученного события"
+	// @Param Last-Event-ID header string false "То же, что lastEventId"
+	// @Success 200 {object} handlers.RoomEventsResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /rooms/{id}/events/poll [get]
+	api.GET("/rooms/:id/events/poll", auth.ScopeMessagesRead, h.PollRoomEvents)
 
 	// @Summary Добавить реакцию к сообщению
 	// @Tags messages
@@ -250,7 +709,7 @@ func Run() error {
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Failure 404 {object} handlers.ErrorResponse
 	// @Router /messages/{id}/reactions [post]
-	pr.POST("/messages/:id/reactions", h.AddReaction)
+	roomAPI.POST("/messages/:id/reactions", auth.ScopeMessagesWrite, h.AddReaction)
 
 	// @Summary Удалить реакцию
 	// @Tags messages
@@ -263,7 +722,7 @@ func Run() error {
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Failure 404 {object} handlers.ErrorResponse
 	// @Router /messages/{id}/reactions/{reaction} [delete]
-	pr.DELETE("/messages/:id/reactions/:reaction", h.RemoveReaction)
+	roomAPI.DELETE("/messages/:id/reactions/:reaction", auth.ScopeMessagesWrite, h.RemoveReaction)
 
 	
 	// @Summary Загрузить файл
@@ -277,7 +736,7 @@ func Run() error {
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Failure 413 {object} handlers.ErrorResponse
 	// @Router /upload [post]
-	pr.POST("/upload", h.Upload)
+	api.POST("/upload", auth.ScopeMessagesWrite, h.Upload)
 
 	
 	// @Summary Поиск сообщений
@@ -292,7 +751,7 @@ func Run() error {
 	// @Failure 400 {object} handlers.ErrorResponse
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Router /search [get]
-	pr.GET("/search", h.SearchMessages)
+	roomAPI.GET("/search", auth.ScopeMessagesRead, h.SearchMessages)
 
 	// ==================== РОЛИ И РАЗРЕШЕНИЯ ====================
 	// @Summary Получить все роли
@@ -328,6 +787,152 @@ func Run() error {
 	// @Router /admin/assign-role [post]
 	pr.POST("/admin/assign-role", h.AssignRole)
 
+	// @Summary Разблокировать пользователя
+	// @Description Снимает блокировку входа, наложенную после неудачных попыток
+	// @Tags admin
+	// @Security BearerAuth
+	// @Produce json
+	// @Param id path string true "ID пользователя"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /admin/users/{id}/unlock [post]
+	pr.POST("/admin/users/:id/unlock", h.UnlockUser)
+
+	// @Summary Выгрузить данные пользователя
+	// @Description Администратор выгружает архив с персональными данными пользователя по его запросу. Формат тот же, что у /user/me/export
+	// @Tags admin
+	// @Security BearerAuth
+	// @Produce application/zip
+	// @Param id path int true "ID пользователя"
+	// @Success 200 {file} file
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /admin/users/{id}/export [get]
+	pr.GET("/admin/users/:id/export", h.AdminExportUser)
+
+	// @Summary Удалить аккаунт пользователя
+	// @Description Администратор удаляет аккаунт пользователя по его запросу. Действует так же, как DELETE /user/me, но без подтверждения паролем
+	// @Tags admin
+	// @Security BearerAuth
+	// @Produce json
+	// @Param id path int true "ID пользователя"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /admin/users/{id} [delete]
+	pr.DELETE("/admin/users/:id", h.AdminDeleteUser)
+
+	// @Summary Неудачные попытки входа
+	// @Description Журнал неудачных попыток входа для разбора инцидентов, новые сверху
+	// @Tags admin
+	// @Security BearerAuth
+	// @Produce json
+	// @Param login query string false "Фильтр по логину"
+	// @Param ip query string false "Фильтр по IP"
+	// @Param limit query int false "Лимит" default(50)
+	// @Param offset query int false "Смещение" default(0)
+	// @Success 200 {array} models.LoginAttempt
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Router /admin/login-attempts [get]
+	pr.GET("/admin/login-attempts", h.ListLoginAttempts)
+
+	// @Summary Журнал аудита
+	// @Description Входы, изменения учетных записей и административные действия, новые сверху. Общее число подходящих записей возвращается в заголовке X-Total-Count
+	// @Tags admin
+	// @Security BearerAuth
+	// @Produce json
+	// @Param actorId query int false "Кто выполнил действие"
+	// @Param action query string false "Действие или группа с * на конце (auth.*)"
+	// @Param targetType query string false "Тип объекта: user, role, room, session, token, passkey, identity"
+	// @Param targetId query int false "ID объекта"
+	// @Param ip query string false "IP клиента"
+	// @Param from query string false "Начало периода (RFC 3339)"
+	// @Param to query string false "Конец периода (RFC 3339), не включительно"
+	// @Param limit query int false "Лимит" default(50)
+	// @Param offset query int false "Смещение" default(0)
+	// @Success 200 {array} models.AuditEvent
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Router /admin/audit [get]
+	pr.GET("/admin/audit", h.ListAuditEvents)
+
+	// @Summary Выгрузить журнал аудита
+	// @Description Потоковая выгрузка журнала в формате NDJSON (одна запись JSON на строку) в порядке возрастания id. Фильтры те же, что у /admin/audit
+	// @Tags admin
+	// @Security BearerAuth
+	// @Produce application/x-ndjson
+	// @Param actorId query int false "Кто выполнил действие"
+	// @Param action query string false "Действие или группа с * на конце (auth.*)"
+	// @Param targetType query string false "Тип объекта"
+	// @Param targetId query int false "ID объекта"
+	// @Param ip query string false "IP клиента"
+	// @Param from query string false "Начало периода (RFC 3339)"
+	// @Param to query string false "Конец периода (RFC 3339), не включительно"
+	// @Success 200 {string} string "NDJSON"
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Router /admin/audit/export [get]
+	pr.GET("/admin/audit/export", h.ExportAuditEvents)
+
+	// @Summary Создать приглашение
+	// @Description Создает код приглашения на регистрацию с лимитом использований и сроком действия (по умолчанию одно использование и 7 дней). Новый пользователь может сразу получить участие в комнатах и глобальные роли; выдача ролей требует права admin.roles.assign. Код и ссылка возвращаются только один раз
+	// @Tags admin
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param invite body handlers.CreateInviteRequest true "Параметры приглашения"
+	// @Success 201 {object} handlers.CreateInviteResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Router /admin/invites [post]
+	pr.POST("/admin/invites", h.CreateInvite)
+
+	// @Summary Список приглашений
+	// @Description Возвращает приглашения без кодов, новые сверху. По умолчанию только действующие; all=true включает отозванные, истекшие и исчерпанные
+	// @Tags admin
+	// @Security BearerAuth
+	// @Produce json
+	// @Param all query bool false "Включая недействующие"
+	// @Param limit query int false "Лимит" default(50)
+	// @Param offset query int false "Смещение" default(0)
+	// @Success 200 {array} handlers.InviteResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Router /admin/invites [get]
+	pr.GET("/admin/invites", h.ListInvites)
+
+	// @Summary Отозвать приглашение
+	// @Description Отзывает приглашение; уже зарегистрированных по нему пользователей это не затрагивает
+	// @Tags admin
+	// @Security BearerAuth
+	// @Produce json
+	// @Param id path string true "ID приглашения"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /admin/invites/{id} [delete]
+	pr.DELETE("/admin/invites/:id", h.RevokeInvite)
+
+	// @Summary Хабы комнат
+	// @Description Возвращает запущенные на этом узле хабы комнат, число подключенных к каждому клиентов и счетчики событий соединений с момента запуска: истекшие heartbeat, слишком большие кадры, таймауты записи, отклоненные по лимиту частоты кадры и отключения за превышение лимита или переполнение очереди отправки
+	// @Tags admin
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {object} handlers.HubsResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Router /admin/ws/hubs [get]
+	pr.GET("/admin/ws/hubs", h.ListHubs)
+
 	// @Summary Получить дашборд администратора
 	// @Tags admin
 	// @Security BearerAuth
@@ -361,6 +966,42 @@ func Run() error {
 	// @Router /auth/2fa/verify [post]
 	pr.POST("/auth/2fa/verify", h.Verify2FA)
 
+	// @Summary Отключить 2FA
+	// @Tags auth
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param code body handlers.Verify2FARequest true "Код подтверждения"
+	// @Success 200 {object} handlers.SuccessResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /auth/2fa/disable [post]
+	pr.POST("/auth/2fa/disable", h.Disable2FA)
+
+	// @Summary Перевыпустить резервные коды
+	// @Tags auth
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param code body handlers.Verify2FARequest true "Код подтверждения"
+	// @Success 200 {object} handlers.RecoveryCodesResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /auth/2fa/recovery-codes [post]
+	pr.POST("/auth/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+
+	// @Summary Количество оставшихся резервных кодов
+	// @Tags auth
+	// @Security BearerAuth
+	// @Produce json
+	// @Success 200 {object} handlers.RecoveryCodesStatusResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /auth/2fa/recovery-codes [get]
+	pr.GET("/auth/2fa/recovery-codes", h.RecoveryCodesStatus)
+
 	// ==================== АНАЛИТИКА ====================
 	// @Summary Получить аналитику пользователя
 	// @Tags analytics
@@ -369,7 +1010,7 @@ func Run() error {
 	// @Success 200 {object} handlers.AnalyticsResponse
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Router /analytics/me [get]
-	pr.GET("/analytics/me", h.GetUserAnalytics)
+	api.GET("/analytics/me", auth.ScopeUserRead, h.GetUserAnalytics)
 
 	// ==================== ОПРОСЫ ====================
 	// @Summary Создать опрос
@@ -383,7 +1024,7 @@ func Run() error {
 	// @Failure 400 {object} handlers.ErrorResponse
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Router /rooms/{id}/polls [post]
-	pr.POST("/rooms/:id/polls", h.CreatePoll)
+	api.POST("/rooms/:id/polls", auth.ScopeMessagesWrite, h.CreatePoll)
 
 	// @Summary Голосовать в опросе
 	// @Tags messages
@@ -396,7 +1037,7 @@ func Run() error {
 	// @Failure 400 {object} handlers.ErrorResponse
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Router /polls/{id}/vote [post]
-	pr.POST("/polls/:id/vote", h.VotePoll)
+	roomAPI.POST("/polls/:id/vote", auth.ScopeMessagesWrite, h.VotePoll)
 
 	// ==================== УПОМИНАНИЯ ====================
 	// @Summary Получить упоминания пользователя
@@ -428,7 +1069,7 @@ func Run() error {
 	// @Success 200 {array} handlers.AchievementResponse
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Router /achievements [get]
-	pr.GET("/achievements", h.GetUserAchievements)
+	api.GET("/achievements", auth.ScopeUserRead, h.GetUserAchievements)
 
 	// @Summary Получить уровень пользователя
 	// @Tags achievements
@@ -437,11 +1078,58 @@ func Run() error {
 	// @Success 200 {object} handlers.UserLevelResponse
 	// @Failure 401 {object} handlers.ErrorResponse
 	// @Router /level [get]
-	pr.GET("/level", h.GetUserLevel)
+	api.GET("/level", auth.ScopeUserRead, h.GetUserLevel)
 
 
+	auth.RegisterScope(http.MethodGet, "/ws/rooms/:id", auth.ScopeMessagesRead)
 	r.GET("/ws/rooms/:id", auth.UpgradeWithJWT(h.RoomWebSocket))
 
+	auth.RegisterRoomScope(http.MethodGet, "/ws", auth.ScopeMessagesRead)
+	// @Summary Мультиплексное WebSocket-соединение
+	// @Description Одно соединение на пользователя вместо соединения на комнату. Клиент управляет подписками кадрами {"type":"subscribe","roomId":1} и {"type":"unsubscribe","roomId":1}; сервер отвечает subscribed, unsubscribed или error. Доступ проверяется при каждой подписке: приватные комнаты — только участникам, токен с ограничением комнатой — только эта комната. События комнат помечены roomId; кадры typing и message тоже указывают roomId и требуют подписки. На кадр message сервер отвечает ack с id и createdAt сохраненного сообщения или nack с машиночитаемым code (not_subscribed, read_only, rate_limited, invalid_payload, internal_error); payload.clientMsgId делает отправку идемпотентной и повторяется в ack, nack и событии message. Без подписок приходят события пользователя: dm (сообщение в приватной комнате, на которую соединение не подписано), mention, unread, membership и status (пользователь изменил свой статус присутствия). Кадр {"type":"activity"} сообщает об активности пользователя, {"type":"activity","payload":{"idle":true}} — что он отошел; соединение без activity, typing и message дольше WS_IDLE_AFTER бездействует, и presence_update показывает для каждого пользователя state (online, idle, away, dnd) и свой статус. Для возобновления сессии subscribe передает lastSeq — номер seq последнего полученного события комнаты: сервер досылает пропущенные события до живых или, если разрыв больше журнала, присылает resync_required, после которого историю нужно перечитать через REST. Версия протокола согласуется заголовком Sec-WebSocket-Protocol: linkup.v1 — JSON в текстовых кадрах, linkup.v1+msgpack и linkup.v1+cbor — те же кадры в MessagePack или CBOR в двоичных кадрах; сервер выбирает первый поддерживаемый в порядке клиента (клиент без заголовка получает linkup.v1, только неизвестные подпротоколы — 400). Каждый кадр проверяется по схеме из /ws/schema; отклоненный кадр получает error с code (malformed_frame, invalid_frame, unknown_type, unsupported_frame, room_not_found, forbidden, not_subscribed, rate_limited) и message, а requestId кадра повторяется в ответах на него. Токен передается заголовком Authorization; браузер, который не может задать заголовок, передает параметром ticket одноразовый билет из POST /ws/ticket. Параметр token с самим токеном попадает в журналы прокси и принимается, только если для старых клиентов включен WS_ALLOW_QUERY_TOKEN. Подключение со страницы, источник которой не входит в CORS_ORIGINS, отклоняется с 403
+	// @Tags websocket
+	// @Security BearerAuth
+	// @Param ticket query string false "Одноразовый билет из POST /ws/ticket"
+	// @Param token query string false "JWT или персональный токен (устаревший способ, только с WS_ALLOW_QUERY_TOKEN=true)"
+	// @Param Sec-WebSocket-Protocol header string false "Подпротоколы в порядке предпочтения" Enums(linkup.v1, linkup.v1+msgpack, linkup.v1+cbor)
+	// @Success 101 {string} string "Switching Protocols"
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Router /ws [get]
+	r.GET("/ws", auth.UpgradeWithJWT(h.UserWebSocket))
+
+	// @Summary Билет для подключения к WebSocket
+	// @Description Выдает одноразовый билет, с которым браузер подключается к /ws или /ws/rooms/{id} параметром ticket вместо токена: долгоживущий токен не попадает в URL и журналы прокси. Билет действует WS_TICKET_TTL (по умолчанию 30 секунд), гасится при подключении и дает те же права, что токен запроса. roomId привязывает билет к комнате: с ним можно подключиться только к /ws/rooms/{roomId} или подписаться на мультиплексном соединении только на эту комнату. Билет по персональному токену, ограниченному комнатой, всегда привязан к ней
+	// @Tags websocket
+	// @Security BearerAuth
+	// @Accept json
+	// @Produce json
+	// @Param ticket body handlers.WSTicketRequest false "Комната, к которой привязать билет"
+	// @Success 201 {object} handlers.WSTicketResponse
+	// @Failure 400 {object} handlers.ErrorResponse
+	// @Failure 401 {object} handlers.ErrorResponse
+	// @Failure 403 {object} handlers.ErrorResponse
+	// @Failure 404 {object} handlers.ErrorResponse
+	// @Router /ws/ticket [post]
+	roomAPI.POST("/ws/ticket", auth.ScopeMessagesRead, h.IssueWSTicket)
+
+	// @Summary JSON Schema протокола WebSocket
+	// @Description Возвращает JSON Schema (draft 2020-12) кадров протокола linkup.v1: $defs/clientFrame — кадры клиента, $defs/serverEvent и *Payload — события сервера. По этой схеме сервер проверяет каждый входящий кадр
+	// @Tags websocket
+	// @Produce json
+	// @Success 200 {object} map[string]interface{}
+	// @Router /ws/schema [get]
+	r.GET("/ws/schema", h.WSSchema)
+
+	// @Summary AsyncAPI протокола WebSocket
+	// @Description Возвращает описание каналов /ws и /ws/rooms/{roomId} в формате AsyncAPI 2.6, построенное из JSON Schema протокола linkup.v1, для генераторов клиентов
+	// @Tags websocket
+	// @Produce json
+	// @Success 200 {object} map[string]interface{}
+	// @Router /ws/asyncapi [get]
+	r.GET("/ws/asyncapi", h.WSAsyncAPI)
+
 	addr := ":" + port
 	log.Printf("🔥 LinkUp API listening on %s (CORS: %s)\n", addr, strings.TrimSpace(os.Getenv("CORS_ORIGINS")))
 	return r.Run(addr)
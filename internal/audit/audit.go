@@ -0,0 +1,233 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"LinkUp/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Действия, которые пишутся в журнал. Префикс задает группу: фильтр
+// action=auth.* выбирает все события входа и управления учетной записью.
+const (
+	ActionRegister        = "auth.register"
+	ActionLogin           = "auth.login"
+	ActionLogout          = "auth.logout"
+	ActionSessionRevoke   = "auth.session.revoke"
+	ActionPasswordChange  = "auth.password.change"
+	ActionPasswordReset   = "auth.password.reset"
+	ActionEmailChange     = "auth.email.change"
+	ActionEmailVerify     = "auth.email.verify"
+	Action2FAEnable       = "auth.2fa.enable"
+	Action2FADisable      = "auth.2fa.disable"
+	ActionRecoveryCodes   = "auth.2fa.recovery_codes"
+	ActionPasskeyAdd      = "auth.passkey.add"
+	ActionPasskeyRename   = "auth.passkey.rename"
+	ActionPasskeyRemove   = "auth.passkey.remove"
+	ActionTokenCreate     = "auth.token.create"
+	ActionTokenRevoke     = "auth.token.revoke"
+	ActionIdentityLink    = "auth.identity.link"
+	ActionIdentityUnlink  = "auth.identity.unlink"
+	ActionAccountDelete   = "auth.account.delete"
+	ActionRoleCreate      = "admin.role.create"
+	ActionRoleAssign      = "admin.role.assign"
+	ActionRoleRevoke      = "admin.role.revoke"
+	ActionUserUnlock      = "admin.user.unlock"
+	ActionInviteCreate    = "admin.invite.create"
+	ActionInviteRevoke    = "admin.invite.revoke"
+	ActionUserExport      = "admin.user.export"
+	ActionUserDelete      = "admin.user.delete"
+	ActionRoomCreate      = "room.create"
+	ActionRoomOwnerChange = "room.owner.change"
+)
+
+// Типы объектов, над которыми выполняется действие.
+const (
+	TargetUser     = "user"
+	TargetRole     = "role"
+	TargetRoom     = "room"
+	TargetSession  = "session"
+	TargetToken    = "token"
+	TargetPasskey  = "passkey"
+	TargetIdentity = "identity"
+	TargetInvite   = "invite"
+)
+
+// Change — значение поля до и после действия.
+type Change struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// Diff — изменения по полям. Add пропускает поля, значение которых не изменилось.
+type Diff map[string]Change
+
+// Add добавляет изменение поля и возвращает d для цепочки вызовов.
+func (d Diff) Add(field string, old, new interface{}) Diff {
+	if !reflect.DeepEqual(old, new) {
+		d[field] = Change{Old: old, New: new}
+	}
+	return d
+}
+
+// Log пишет и читает журнал аудита.
+type Log struct {
+	db        *gorm.DB
+	retention time.Duration
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// New создает журнал. retention — срок хранения записей; 0 — бессрочно.
+func New(db *gorm.DB, retention time.Duration) *Log {
+	return &Log{db: db, retention: retention}
+}
+
+// FromEnv создает журнал со сроком хранения AUDIT_RETENTION: длительность Go
+// ("2160h") или число дней ("90d"); по умолчанию 365 дней, 0 — хранить бессрочно.
+func FromEnv(db *gorm.DB) *Log {
+	retention := 365 * 24 * time.Hour
+	if v := strings.TrimSpace(os.Getenv("AUDIT_RETENTION")); v != "" {
+		if d, ok := parseRetention(v); ok {
+			retention = d
+		} else {
+			log.Printf("[audit] invalid AUDIT_RETENTION %q, using %s", v, retention)
+		}
+	}
+	return New(db, retention)
+}
+
+func parseRetention(v string) (time.Duration, bool) {
+	if v == "0" {
+		return 0, true
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err == nil && n >= 0
+	}
+	d, err := time.ParseDuration(v)
+	return d, err == nil && d >= 0
+}
+
+// Retention возвращает срок хранения записей (0 — бессрочно).
+func (l *Log) Retention() time.Duration { return l.retention }
+
+// Record добавляет событие. Раз в час заодно удаляет записи старше срока хранения.
+func (l *Log) Record(ctx context.Context, e models.AuditEvent) error {
+	e.ID = 0
+	if err := l.db.WithContext(ctx).Create(&e).Error; err != nil {
+		return err
+	}
+	l.maybePurge(ctx)
+	return nil
+}
+
+func (l *Log) maybePurge(ctx context.Context) {
+	if l.retention <= 0 {
+		return
+	}
+	now := time.Now()
+	l.mu.Lock()
+	if now.Sub(l.lastPurge) < time.Hour {
+		l.mu.Unlock()
+		return
+	}
+	l.lastPurge = now
+	l.mu.Unlock()
+	if _, err := l.Purge(ctx); err != nil {
+		log.Printf("[audit] purge: %v", err)
+	}
+}
+
+// Purge удаляет записи старше срока хранения и возвращает их число.
+func (l *Log) Purge(ctx context.Context) (int64, error) {
+	if l.retention <= 0 {
+		return 0, nil
+	}
+	res := l.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).
+		Where("created_at < ?", time.Now().Add(-l.retention)).
+		Delete(&models.AuditEvent{})
+	return res.RowsAffected, res.Error
+}
+
+// Filter отбирает записи журнала; пустые поля не ограничивают выборку.
+type Filter struct {
+	ActorID *uint
+	// Action — точное действие или группа с "*" на конце ("auth.*")
+	Action     string
+	TargetType string
+	TargetID   *uint
+	IP         string
+	From       *time.Time
+	To         *time.Time
+}
+
+func (l *Log) query(ctx context.Context, f Filter) *gorm.DB {
+	q := l.db.WithContext(ctx).Model(&models.AuditEvent{})
+	if f.ActorID != nil {
+		q = q.Where("actor_id = ?", *f.ActorID)
+	}
+	if prefix, ok := strings.CutSuffix(f.Action, "*"); ok {
+		q = q.Where("action LIKE ?", strings.NewReplacer("%", "", "_", "").Replace(prefix)+"%")
+	} else if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		q = q.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != nil {
+		q = q.Where("target_id = ?", *f.TargetID)
+	}
+	if f.IP != "" {
+		q = q.Where("ip = ?", f.IP)
+	}
+	if f.From != nil {
+		q = q.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		q = q.Where("created_at < ?", *f.To)
+	}
+	return q
+}
+
+// List возвращает страницу записей (новые сверху) и общее число подходящих записей.
+func (l *Log) List(ctx context.Context, f Filter, limit, offset int) ([]models.AuditEvent, int64, error) {
+	var total int64
+	if err := l.query(ctx, f).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []models.AuditEvent
+	err := l.query(ctx, f).Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error
+	return events, total, err
+}
+
+// Stream передает fn все подходящие записи в порядке возрастания id,
+// читая их пачками, чтобы выгрузка не держала весь журнал в памяти.
+func (l *Log) Stream(ctx context.Context, f Filter, fn func(models.AuditEvent) error) error {
+	const batch = 500
+	var lastID uint
+	for {
+		var events []models.AuditEvent
+		if err := l.query(ctx, f).Where("id > ?", lastID).Order("id").Limit(batch).Find(&events).Error; err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if len(events) < batch {
+			return nil
+		}
+		lastID = events[len(events)-1].ID
+	}
+}
@@ -12,9 +12,18 @@ import (
 )
 
 type Claims struct {
-	UserID uint `json:"uid"`
+	UserID    uint   `json:"uid"`
+	SessionID uint   `json:"sid,omitempty"`
+	Purpose   string `json:"pur,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// purpose2FA помечает промежуточный токен, выдаваемый /login пользователю с
+// включенной 2FA. Такой токен нельзя использовать как access-токен.
+const purpose2FA = "2fa"
+
+// ChallengeTTL — время жизни токена второго шага входа.
+const ChallengeTTL = 5 * time.Minute
 // Auto-generated swagger comments for jwtSecret
 // @Summary Auto-generated summary for jwtSecret
 // @Description Auto-generated description for jwtSecret — review and improve
@@ -24,21 +33,28 @@ type Claims struct {
 func jwtSecret() []byte {
 	sec := os.Getenv("JWT_SECRET")
 	if sec == "" {
-		sec = "dev-secret-change-me"
+		sec = defaultJWTSecret
 	}
 	return []byte(sec)
 }
 
-func GenerateToken(userID uint) (string, error) {
+// jwtIssuer — необязательный iss, по которому другие сервисы отличают токены LinkUp.
+func jwtIssuer() string {
+	return strings.TrimSpace(os.Getenv("JWT_ISSUER"))
+}
+
+// GenerateToken выдает короткоживущий access-токен, привязанный к сессии.
+func GenerateToken(userID, sessionID uint) (string, error) {
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    jwtIssuer(),
 		},
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString(jwtSecret())
+	return signToken(claims)
 }
 // Auto-generated swagger comments for parseToken
 // @Summary Auto-generated summary for parseToken
@@ -47,7 +63,11 @@ func GenerateToken(userID uint) (string, error) {
 // (internal function — not necessarily an HTTP handler)
 
 func parseToken(tokenStr string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) { return jwtSecret(), nil })
+	opts := []jwt.ParserOption{jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"})}
+	if iss := jwtIssuer(); iss != "" {
+		opts = append(opts, jwt.WithIssuer(iss))
+	}
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, lookupKey, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +76,56 @@ func parseToken(tokenStr string) (*Claims, error) {
 	}
 	return nil, errors.New("invalid token")
 }
+
+// parseAccessToken принимает только обычные access-токены, сессия которых
+// не отозвана.
+func parseAccessToken(tokenStr string) (*Claims, error) {
+	claims, err := parseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("not an access token")
+	}
+	if sessionValidator != nil && !sessionValidator(claims.UserID, claims.SessionID) {
+		return nil, errors.New("session revoked")
+	}
+	return claims, nil
+}
+
+// GenerateChallengeToken выдает короткоживущий токен, который можно обменять
+// на JWT только через /auth/2fa/login. jti позволяет серверу погасить токен
+// после успешного входа.
+func GenerateChallengeToken(userID uint) (string, error) {
+	jti, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	claims := &Claims{
+		UserID:  userID,
+		Purpose: purpose2FA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    jwtIssuer(),
+		},
+	}
+	return signToken(claims)
+}
+
+// ParseChallengeToken проверяет токен второго шага. Одноразовость токена
+// (claims.ID) проверяет вызывающий.
+func ParseChallengeToken(tokenStr string) (*Claims, error) {
+	claims, err := parseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose2FA || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("not a 2fa challenge token")
+	}
+	return claims, nil
+}
 // Auto-generated swagger comments for JWTMiddleware
 // @Summary Auto-generated summary for JWTMiddleware
 // @Description Auto-generated description for JWTMiddleware — review and improve
@@ -70,21 +140,45 @@ func JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 		tok := strings.TrimSpace(authz[len("Bearer "):])
-		claims, err := parseToken(tok)
+		if strings.HasPrefix(tok, PATPrefix) {
+			if authenticatePAT(c, tok) {
+				c.Next()
+			}
+			return
+		}
+		claims, err := parseAccessToken(tok)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
 		c.Set("userID", claims.UserID)
+		c.Set("sessionID", claims.SessionID)
 		c.Next()
 	}
 }
+// OptionalJWTMiddleware аутентифицирует запрос так же, как JWTMiddleware, если
+// передан заголовок Authorization, а запрос без него пропускает
+// неаутентифицированным. Для публичных маршрутов, поведение которых зависит от
+// того, кто их вызывает.
+func OptionalJWTMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		JWTMiddleware()(c)
+	}
+}
+
 // Auto-generated swagger comments for UpgradeWithJWT
 // @Summary Auto-generated summary for UpgradeWithJWT
 // @Description Auto-generated description for UpgradeWithJWT — review and improve
 // @Tags internal
 // (internal function — not necessarily an HTTP handler)
 
+// UpgradeWithJWT аутентифицирует подключение к WebSocket заголовком
+// Authorization, одноразовым билетом из параметра ticket (см. ticket.go) или,
+// если для старых клиентов включен WS_ALLOW_QUERY_TOKEN, токеном из параметра token.
 func UpgradeWithJWT(fn func(*gin.Context)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.GetHeader("Authorization") != "" {
@@ -92,18 +186,34 @@ func UpgradeWithJWT(fn func(*gin.Context)) gin.HandlerFunc {
 			if c.IsAborted() {
 				return
 			}
+		} else if ticket := c.Query("ticket"); ticket != "" {
+			if !authenticateTicket(c, ticket) {
+				return
+			}
 		} else {
+			if !queryTokenAllowed() {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "ticket required"})
+				return
+			}
 			tok := c.Query("token")
 			if tok == "" {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token required"})
 				return
 			}
-			claims, err := parseToken(tok)
+			if strings.HasPrefix(tok, PATPrefix) {
+				if !authenticatePAT(c, tok) {
+					return
+				}
+				fn(c)
+				return
+			}
+			claims, err := parseAccessToken(tok)
 			if err != nil {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 				return
 			}
 			c.Set("userID", claims.UserID)
+			c.Set("sessionID", claims.SessionID)
 		}
 		fn(c)
 	}
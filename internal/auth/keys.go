@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultJWTSecret используется только для локальной разработки.
+const defaultJWTSecret = "dev-secret-change-me"
+
+// verifyKey — ключ, которым принимаются токены с данным kid.
+type verifyKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    interface{} // []byte для HS256, *rsa.PublicKey или ed25519.PublicKey
+}
+
+// keySet — текущий ключ подписи и все ключи, которые еще принимаются при
+// проверке (окно ротации).
+type keySet struct {
+	signKID    string
+	signMethod jwt.SigningMethod
+	signKey    interface{}
+	verify     map[string]verifyKey
+	// legacy — HS256-ключ для токенов без kid, выпущенных до перехода на асимметричную подпись
+	legacy *verifyKey
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   *keySet
+)
+
+// IsProduction сообщает, запущен ли сервер в боевом режиме (APP_ENV=production или GIN_MODE=release).
+func IsProduction() bool {
+	env := strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV")))
+	return env == "production" || env == "prod" || gin.Mode() == gin.ReleaseMode
+}
+
+// LoadKeys читает конфигурацию ключей из окружения:
+//
+//	JWT_ALG               HS256 (по умолчанию), RS256 или EdDSA
+//	JWT_SECRET            секрет для HS256
+//	JWT_PRIVATE_KEY_FILE  PEM с закрытым ключом подписи для RS256/EdDSA
+//	JWT_KEY_ID            kid ключа подписи (по умолчанию — отпечаток по RFC 7638)
+//	JWT_VERIFY_KEY_FILES  дополнительные ключи проверки через запятую: "path" или "kid=path"
+//
+// В боевом режиме сервер не стартует с секретом по умолчанию.
+func LoadKeys() error {
+	ks, err := loadKeySet()
+	if err != nil {
+		return err
+	}
+	keysMu.Lock()
+	keys = ks
+	keysMu.Unlock()
+	return nil
+}
+
+func activeKeys() *keySet {
+	keysMu.RLock()
+	ks := keys
+	keysMu.RUnlock()
+	if ks != nil {
+		return ks
+	}
+	// LoadKeys не вызывался (например, в тестах) — загружаем из окружения.
+	// При ошибке конфигурации подпись и проверка отказывают, а не откатываются на секрет по умолчанию
+	if err := LoadKeys(); err != nil {
+		return &keySet{signMethod: jwt.SigningMethodHS256, verify: map[string]verifyKey{}}
+	}
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return keys
+}
+
+func loadKeySet() (*keySet, error) {
+	alg := strings.ToUpper(strings.TrimSpace(os.Getenv("JWT_ALG")))
+	secret := os.Getenv("JWT_SECRET")
+
+	if alg == "" || alg == "HS256" {
+		if IsProduction() && (secret == "" || secret == defaultJWTSecret) {
+			return nil, errors.New("refusing to start in production with the default JWT secret: set JWT_SECRET or configure JWT_ALG=RS256/EdDSA")
+		}
+		return hmacKeySet(jwtSecret()), nil
+	}
+
+	var method jwt.SigningMethod
+	switch alg {
+	case "RS256":
+		method = jwt.SigningMethodRS256
+	case "EDDSA", "ED25519":
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALG %q", alg)
+	}
+
+	path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	if path == "" {
+		return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", method.Alg())
+	}
+	priv, pub, err := readKeyFile(path, method)
+	if err != nil {
+		return nil, err
+	}
+	kid := strings.TrimSpace(os.Getenv("JWT_KEY_ID"))
+	if kid == "" {
+		if kid, err = thumbprint(pub); err != nil {
+			return nil, err
+		}
+	}
+
+	ks := &keySet{
+		signKID:    kid,
+		signMethod: method,
+		signKey:    priv,
+		verify:     map[string]verifyKey{kid: {kid: kid, method: method, key: pub}},
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_VERIFY_KEY_FILES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		vkid, vpath := "", entry
+		if i := strings.Index(entry, "="); i > 0 {
+			vkid, vpath = entry[:i], entry[i+1:]
+		}
+		vpub, vmethod, err := readPublicKeyFile(vpath)
+		if err != nil {
+			return nil, err
+		}
+		if vkid == "" {
+			if vkid, err = thumbprint(vpub); err != nil {
+				return nil, err
+			}
+		}
+		ks.verify[vkid] = verifyKey{kid: vkid, method: vmethod, key: vpub}
+	}
+
+	// Явно заданный JWT_SECRET продолжает принимать старые HS256-токены без kid
+	if secret != "" && secret != defaultJWTSecret {
+		ks.legacy = &verifyKey{method: jwt.SigningMethodHS256, key: []byte(secret)}
+	}
+	return ks, nil
+}
+
+func hmacKeySet(secret []byte) *keySet {
+	return &keySet{
+		signMethod: jwt.SigningMethodHS256,
+		signKey:    secret,
+		verify:     map[string]verifyKey{},
+		legacy:     &verifyKey{method: jwt.SigningMethodHS256, key: secret},
+	}
+}
+
+// signToken подписывает claims текущим ключом и проставляет kid.
+func signToken(claims jwt.Claims) (string, error) {
+	ks := activeKeys()
+	t := jwt.NewWithClaims(ks.signMethod, claims)
+	if ks.signKID != "" {
+		t.Header["kid"] = ks.signKID
+	}
+	return t.SignedString(ks.signKey)
+}
+
+// lookupKey выбирает ключ проверки по kid и не дает подменить алгоритм.
+func lookupKey(token *jwt.Token) (interface{}, error) {
+	ks := activeKeys()
+	kid, _ := token.Header["kid"].(string)
+	var vk *verifyKey
+	if kid == "" {
+		vk = ks.legacy
+	} else if k, ok := ks.verify[kid]; ok {
+		vk = &k
+	}
+	if vk == nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != vk.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return vk.key, nil
+}
+
+// JWK — открытый ключ в формате RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet — содержимое /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS возвращает все асимметричные ключи проверки. Секреты HS256
+// никогда не публикуются.
+func PublicJWKS() JWKSet {
+	ks := activeKeys()
+	set := JWKSet{Keys: []JWK{}}
+	for _, vk := range ks.verify {
+		if jwk, ok := toJWK(vk); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// JWKSHandler отдает публичные ключи для сторонних сервисов.
+func JWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, PublicJWKS())
+}
+
+func toJWK(vk verifyKey) (JWK, bool) {
+	b64 := base64.RawURLEncoding
+	switch k := vk.key.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", Kid: vk.kid, Use: "sig", Alg: vk.method.Alg(),
+			N: b64.EncodeToString(k.N.Bytes()), E: b64.EncodeToString(big.NewInt(int64(k.E)).Bytes())}, true
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Kid: vk.kid, Use: "sig", Alg: vk.method.Alg(), Crv: "Ed25519",
+			X: b64.EncodeToString(k)}, true
+	}
+	return JWK{}, false
+}
+
+// thumbprint вычисляет kid как JWK-отпечаток по RFC 7638.
+func thumbprint(pub crypto.PublicKey) (string, error) {
+	b64 := base64.RawURLEncoding
+	var canonical []byte
+	var err error
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		canonical, err = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{b64.EncodeToString(big.NewInt(int64(k.E)).Bytes()), "RSA", b64.EncodeToString(k.N.Bytes())})
+	case ed25519.PublicKey:
+		canonical, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{"Ed25519", "OKP", b64.EncodeToString(k)})
+	default:
+		return "", fmt.Errorf("unsupported key type %T", pub)
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return b64.EncodeToString(sum[:]), nil
+}
+
+// readKeyFile читает закрытый ключ подписи нужного типа.
+func readKeyFile(path string, method jwt.SigningMethod) (crypto.PrivateKey, crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch method {
+	case jwt.SigningMethodRS256:
+		k, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return k, &k.PublicKey, nil
+	default:
+		k, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ek := k.(ed25519.PrivateKey)
+		return ek, ek.Public(), nil
+	}
+}
+
+// readPublicKeyFile читает ключ проверки; подходит и PEM с закрытым ключом.
+func readPublicKeyFile(path string) (crypto.PublicKey, jwt.SigningMethod, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if k, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return k, jwt.SigningMethodRS256, nil
+	}
+	if k, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return &k.PublicKey, jwt.SigningMethodRS256, nil
+	}
+	if k, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return k, jwt.SigningMethodEdDSA, nil
+	}
+	if k, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		return k.(ed25519.PrivateKey).Public(), jwt.SigningMethodEdDSA, nil
+	}
+	return nil, nil, fmt.Errorf("%s: unsupported key format", path)
+}
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PATPrefix отличает персональные токены доступа от JWT.
+const PATPrefix = "lup_"
+
+// Области действия персональных токенов.
+const (
+	ScopeRoomsRead     = "rooms:read"
+	ScopeRoomsWrite    = "rooms:write"
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeUserRead      = "user:read"
+	ScopeUserWrite     = "user:write"
+)
+
+// Scopes перечисляет все допустимые области.
+var Scopes = []string{ScopeRoomsRead, ScopeRoomsWrite, ScopeMessagesRead, ScopeMessagesWrite, ScopeUserRead, ScopeUserWrite}
+
+// ValidScope сообщает, известна ли область.
+func ValidScope(s string) bool {
+	for _, sc := range Scopes {
+		if sc == s {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenInfo — проверенный персональный токен.
+type TokenInfo struct {
+	ID     uint
+	UserID uint
+	Scopes []string
+	// RoomID ограничивает токен одной комнатой
+	RoomID *uint
+}
+
+// PATResolver находит действующий персональный токен по его значению.
+type PATResolver func(token string) (*TokenInfo, error)
+
+var patResolver PATResolver
+
+// SetPATResolver регистрирует проверку персональных токенов. Пока он не задан,
+// такие токены отклоняются.
+func SetPATResolver(r PATResolver) { patResolver = r }
+
+// patRoute — маршрут, доступный персональным токенам.
+type patRoute struct {
+	scope string
+	// room — обработчик сам применяет ограничение комнатой (TokenRoom), и
+	// маршрут доступен токенам, ограниченным комнатой
+	room bool
+}
+
+var (
+	patRoutesMu sync.RWMutex
+	patRoutes   = map[string]patRoute{} // "GET /rooms/:id/history" -> область
+)
+
+// ScopedGroup регистрирует маршруты, доступные персональным токенам.
+// Остальные защищенные маршруты принимают только JWT.
+type ScopedGroup struct {
+	g    *gin.RouterGroup
+	room bool
+}
+
+// Scoped оборачивает группу маршрутов.
+func Scoped(g *gin.RouterGroup) *ScopedGroup { return &ScopedGroup{g: g} }
+
+// RoomAware возвращает группу для маршрутов вне /rooms/:id, обработчики
+// которых сами применяют ограничение комнатой. Только такие маршруты и
+// маршруты /rooms/:id/... доступны токенам, ограниченным комнатой.
+func (s *ScopedGroup) RoomAware() *ScopedGroup { return &ScopedGroup{g: s.g, room: true} }
+
+// Handle регистрирует маршрут и область, которую должен иметь персональный токен.
+func (s *ScopedGroup) Handle(method, relativePath, scope string, handlers ...gin.HandlerFunc) {
+	registerRoute(method, path.Join(s.g.BasePath(), relativePath), patRoute{scope: scope, room: s.room})
+	s.g.Handle(method, relativePath, handlers...)
+}
+
+// GET, POST, PUT и DELETE — сокращения для Handle.
+func (s *ScopedGroup) GET(p, scope string, h ...gin.HandlerFunc) {
+	s.Handle(http.MethodGet, p, scope, h...)
+}
+func (s *ScopedGroup) POST(p, scope string, h ...gin.HandlerFunc) {
+	s.Handle(http.MethodPost, p, scope, h...)
+}
+func (s *ScopedGroup) PUT(p, scope string, h ...gin.HandlerFunc) {
+	s.Handle(http.MethodPut, p, scope, h...)
+}
+func (s *ScopedGroup) DELETE(p, scope string, h ...gin.HandlerFunc) {
+	s.Handle(http.MethodDelete, p, scope, h...)
+}
+
+// RegisterScope разрешает персональным токенам с областью scope маршрут method fullPath.
+func RegisterScope(method, fullPath, scope string) {
+	registerRoute(method, fullPath, patRoute{scope: scope})
+}
+
+// RegisterRoomScope — RegisterScope для маршрута, обработчик которого сам
+// применяет ограничение комнатой (см. RoomAware).
+func RegisterRoomScope(method, fullPath, scope string) {
+	registerRoute(method, fullPath, patRoute{scope: scope, room: true})
+}
+
+func registerRoute(method, fullPath string, r patRoute) {
+	patRoutesMu.Lock()
+	patRoutes[method+" "+fullPath] = r
+	patRoutesMu.Unlock()
+}
+
+func routeRule(c *gin.Context) (patRoute, bool) {
+	patRoutesMu.RLock()
+	defer patRoutesMu.RUnlock()
+	r, ok := patRoutes[c.Request.Method+" "+c.FullPath()]
+	return r, ok
+}
+
+// HasScope сообщает, разрешена ли запросу область. JWT-сессии имеют все права.
+func HasScope(c *gin.Context, scope string) bool {
+	v, ok := c.Get("tokenScopes")
+	if !ok {
+		return true
+	}
+	for _, s := range v.([]string) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenRoom возвращает комнату, которой ограничен персональный токен запроса.
+func TokenRoom(c *gin.Context) (uint, bool) {
+	if v, ok := c.Get("tokenRoomID"); ok {
+		return v.(uint), true
+	}
+	return 0, false
+}
+
+// authenticatePAT проверяет персональный токен, его область для текущего маршрута
+// и ограничение комнатой (restrictToRoom).
+func authenticatePAT(c *gin.Context, tok string) bool {
+	if patResolver == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return false
+	}
+	info, err := patResolver(tok)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return false
+	}
+	rule, ok := routeRule(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "personal access tokens cannot be used for this endpoint"})
+		return false
+	}
+	c.Set("tokenScopes", info.Scopes)
+	if !HasScope(c, rule.scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token lacks scope " + rule.scope})
+		return false
+	}
+	if info.RoomID != nil && !restrictToRoom(c, *info.RoomID, rule, "token") {
+		return false
+	}
+	c.Set("userID", info.UserID)
+	c.Set("tokenID", info.ID)
+	return true
+}
+
+// restrictToRoom ограничивает запрос комнатой room: маршрут /rooms/:id/...
+// должен относиться к ней, а остальные маршруты доступны, только если их
+// обработчик сам проверяет комнату. Поэтому токен комнаты не может, например,
+// создавать комнаты, загружать файлы или менять профиль. what — «token» или
+// «ticket» для текста ошибки.
+func restrictToRoom(c *gin.Context, room uint, rule patRoute, what string) bool {
+	c.Set("tokenRoomID", room)
+	if isRoomRoute(c.FullPath()) {
+		if c.Param("id") != strconv.FormatUint(uint64(room), 10) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": what + " is restricted to another room"})
+			return false
+		}
+		return true
+	}
+	if !rule.room {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": what + " is restricted to a room and cannot be used for this endpoint"})
+		return false
+	}
+	return true
+}
+
+func isRoomRoute(fullPath string) bool {
+	return strings.HasPrefix(fullPath, "/rooms/:id") || strings.HasPrefix(fullPath, "/ws/rooms/:id")
+}
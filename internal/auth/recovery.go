@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	"LinkUp/internal/utils"
+)
+
+// RecoveryCodeCount — сколько резервных кодов выдается пользователю за раз.
+const RecoveryCodeCount = 10
+
+// GenerateRecoveryCodes возвращает коды для показа пользователю и их хэши
+// для хранения. Сами коды нигде не сохраняются.
+func GenerateRecoveryCodes() (codes []string, hashes []string, err error) {
+	codes = make([]string, RecoveryCodeCount)
+	hashes = make([]string, RecoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := base32.StdEncoding.EncodeToString(buf)[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode нормализует код (регистр, дефисы, пробелы) и хэширует его.
+func HashRecoveryCode(code string) string {
+	norm := strings.ToUpper(code)
+	norm = strings.NewReplacer("-", "", " ", "").Replace(norm)
+	return utils.HashToken(norm)
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"time"
+)
+
+// SessionValidator сообщает, активна ли серверная сессия. Устанавливается
+// приложением при старте; пока он не задан, проверка сессий пропускается.
+type SessionValidator func(userID, sessionID uint) bool
+
+var sessionValidator SessionValidator
+
+// SetSessionValidator регистрирует проверку сессий для JWTMiddleware и UpgradeWithJWT.
+func SetSessionValidator(v SessionValidator) { sessionValidator = v }
+
+// AccessTokenTTL — время жизни access-токена (ACCESS_TOKEN_TTL, по умолчанию 15m).
+func AccessTokenTTL() time.Duration {
+	return envDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL — время жизни refresh-токена и сессии (REFRESH_TOKEN_TTL, по умолчанию 30 дней).
+func RefreshTokenTTL() time.Duration {
+	return envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// EmailVerifyTTL — время жизни ссылки подтверждения email (EMAIL_VERIFY_TTL, по умолчанию 48h).
+func EmailVerifyTTL() time.Duration {
+	return envDuration("EMAIL_VERIFY_TTL", 48*time.Hour)
+}
+
+// PasswordResetTTL — время жизни ссылки сброса пароля (PASSWORD_RESET_TTL, по умолчанию 1h).
+func PasswordResetTTL() time.Duration {
+	return envDuration("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// GenerateOpaqueToken возвращает случайный URL-safe токен (256 бит).
+func GenerateOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
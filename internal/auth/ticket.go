@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Билеты WebSocket. Браузер не может передать заголовок Authorization при
+// подключении к WebSocket, а токен в параметре token попадает в журналы
+// прокси. Вместо него клиент получает через POST /ws/ticket одноразовый билет
+// на WS_TICKET_TTL и подключается с параметром ticket.
+
+// TicketInfo — права, с которыми выдан билет: пользователь, сессия JWT или
+// персональный токен с его областями и ограничение комнатой.
+type TicketInfo struct {
+	UserID    uint
+	SessionID uint
+	// TokenID не nil — билет выдан по персональному токену с областями Scopes
+	TokenID *uint
+	Scopes  []string
+	// RoomID ограничивает билет одной комнатой
+	RoomID *uint
+}
+
+// TicketRedeemer гасит билет и возвращает его права.
+type TicketRedeemer func(ticket string) (*TicketInfo, error)
+
+var ticketRedeemer TicketRedeemer
+
+// SetTicketRedeemer регистрирует погашение билетов. Пока оно не задано,
+// билеты отклоняются.
+func SetTicketRedeemer(r TicketRedeemer) { ticketRedeemer = r }
+
+// WSTicketTTL — время жизни билета WebSocket (WS_TICKET_TTL, по умолчанию 30s).
+func WSTicketTTL() time.Duration {
+	return envDuration("WS_TICKET_TTL", 30*time.Second)
+}
+
+// queryTokenAllowed сообщает, принимает ли подключение к WebSocket токен в
+// параметре token (WS_ALLOW_QUERY_TOKEN, по умолчанию false). Включается явно
+// для старых клиентов, пока они не перешли на билеты.
+func queryTokenAllowed() bool {
+	ok, _ := strconv.ParseBool(os.Getenv("WS_ALLOW_QUERY_TOKEN"))
+	return ok
+}
+
+// TicketFor возвращает права для билета, выдаваемого запросу c: те же, что у
+// его токена. room ограничивает билет комнатой; у персонального токена,
+// ограниченного комнатой, билет всегда ограничен ею.
+func TicketFor(c *gin.Context, room *uint) TicketInfo {
+	info := TicketInfo{RoomID: room}
+	if v, ok := c.Get("userID"); ok {
+		info.UserID, _ = v.(uint)
+	}
+	if v, ok := c.Get("sessionID"); ok {
+		info.SessionID, _ = v.(uint)
+	}
+	if v, ok := c.Get("tokenID"); ok {
+		id := v.(uint)
+		info.TokenID = &id
+		if v, ok := c.Get("tokenScopes"); ok {
+			info.Scopes, _ = v.([]string)
+		}
+	}
+	if id, ok := TokenRoom(c); ok {
+		info.RoomID = &id
+	}
+	return info
+}
+
+// authenticateTicket гасит билет и применяет его права к запросу так же, как
+// JWTMiddleware применяет токен: область маршрута для билетов персональных
+// токенов и ограничение комнатой для маршрутов вида /ws/rooms/:id.
+func authenticateTicket(c *gin.Context, ticket string) bool {
+	if ticketRedeemer == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid ticket"})
+		return false
+	}
+	info, err := ticketRedeemer(ticket)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired ticket"})
+		return false
+	}
+	if info.TokenID == nil && sessionValidator != nil && !sessionValidator(info.UserID, info.SessionID) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+		return false
+	}
+	rule, ok := routeRule(c)
+	if info.TokenID != nil {
+		c.Set("tokenScopes", info.Scopes)
+		c.Set("tokenID", *info.TokenID)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "personal access tokens cannot be used for this endpoint"})
+			return false
+		}
+		if !HasScope(c, rule.scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token lacks scope " + rule.scope})
+			return false
+		}
+	}
+	if info.RoomID != nil && !restrictToRoom(c, *info.RoomID, rule, "ticket") {
+		return false
+	}
+	c.Set("userID", info.UserID)
+	c.Set("sessionID", info.SessionID)
+	return true
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpgradeQueryToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tok, err := GenerateToken(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/ws", UpgradeWithJWT(func(c *gin.Context) { c.Status(http.StatusSwitchingProtocols) }))
+	upgrade := func(target, authz string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if authz != "" {
+			req.Header.Set("Authorization", authz)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Setenv("WS_ALLOW_QUERY_TOKEN", "")
+	if code := upgrade("/ws?token="+tok, ""); code != http.StatusUnauthorized {
+		t.Errorf("?token= accepted by default: %d", code)
+	}
+	if code := upgrade("/ws", "Bearer "+tok); code != http.StatusSwitchingProtocols {
+		t.Errorf("Authorization header rejected: %d", code)
+	}
+
+	t.Setenv("WS_ALLOW_QUERY_TOKEN", "true")
+	if code := upgrade("/ws?token="+tok, ""); code != http.StatusSwitchingProtocols {
+		t.Errorf("?token= rejected with WS_ALLOW_QUERY_TOKEN=true: %d", code)
+	}
+	if code := upgrade("/ws?token=bogus", ""); code != http.StatusUnauthorized {
+		t.Errorf("invalid ?token= accepted: %d", code)
+	}
+}
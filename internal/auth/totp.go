@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Параметры TOTP по RFC 6238: 30-секундный шаг, 6 цифр, HMAC-SHA1.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPIssuer возвращает имя издателя, которое показывается в приложении-аутентификаторе.
+func TOTPIssuer() string {
+	if iss := strings.TrimSpace(os.Getenv("TOTP_ISSUER")); iss != "" {
+		return iss
+	}
+	return "LinkUp"
+}
+
+// GenerateTOTPSecret генерирует криптостойкий 160-битный секрет в base32.
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPURI собирает otpauth:// URI для QR-кода.
+func TOTPURI(secret, account string) string {
+	issuer := TOTPIssuer()
+	label := url.PathEscape(issuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprintf("%d", totpDigits))
+	q.Set("period", fmt.Sprintf("%d", totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// TOTPCode вычисляет код для момента времени t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpCounter(t)), nil
+}
+
+// ValidateTOTP проверяет код в окне ±1 шаг. lastUsed — момент последнего
+// принятого кода: коды того же или более раннего шага отклоняются, чтобы
+// перехваченный код нельзя было использовать повторно. При успехе возвращает
+// время начала шага, которое нужно сохранить в TwoFactorAuth.LastUsed.
+func ValidateTOTP(secret, code string, now time.Time, lastUsed *time.Time) (time.Time, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return time.Time{}, false
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return time.Time{}, false
+	}
+	current := totpCounter(now)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		counter := current + uint64(int64(i))
+		if lastUsed != nil && counter <= totpCounter(*lastUsed) {
+			continue
+		}
+		if hmac.Equal([]byte(hotp(key, counter)), []byte(code)) {
+			return time.Unix(int64(counter)*totpPeriod, 0).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func totpCounter(t time.Time) uint64 {
+	return uint64(t.Unix() / totpPeriod)
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	return totpEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// hotp реализует RFC 4226 с динамическим усечением.
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, bin%1000000)
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// Секрет из приложения B RFC 6238 для HMAC-SHA1: ASCII "12345678901234567890".
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// В RFC коды восьмизначные; шестизначный код — их последние шесть цифр
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("T=%d: got %s, want %s", unix, got, want)
+		}
+		if _, ok := ValidateTOTP(rfc6238Secret, want, time.Unix(unix, 0), nil); !ok {
+			t.Errorf("T=%d: valid code rejected", unix)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	for shift, ok := range map[int]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code, _ := TOTPCode(rfc6238Secret, now.Add(time.Duration(shift)*totpPeriod*time.Second))
+		step, got := ValidateTOTP(rfc6238Secret, code, now, nil)
+		if got != ok {
+			t.Errorf("step %+d: accepted = %v", shift, got)
+		}
+		if got && step.Unix() != (now.Unix()/totpPeriod+int64(shift))*totpPeriod {
+			t.Errorf("step %+d: returned step %d", shift, step.Unix())
+		}
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "12345", now, nil); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestValidateTOTPReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := TOTPCode(rfc6238Secret, now)
+	step, ok := ValidateTOTP(rfc6238Secret, code, now, nil)
+	if !ok {
+		t.Fatal("valid code rejected")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, now, &step); ok {
+		t.Fatal("used code accepted again")
+	}
+	// код предыдущего шага тоже не проходит, хотя попадает в окно
+	prev, _ := TOTPCode(rfc6238Secret, now.Add(-totpPeriod*time.Second))
+	if _, ok := ValidateTOTP(rfc6238Secret, prev, now, &step); ok {
+		t.Fatal("code older than the last used one accepted")
+	}
+	next, _ := TOTPCode(rfc6238Secret, now.Add(totpPeriod*time.Second))
+	if _, ok := ValidateTOTP(rfc6238Secret, next, now, &step); !ok {
+		t.Fatal("next step rejected")
+	}
+}
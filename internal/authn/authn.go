@@ -0,0 +1,97 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUnknownUser — источник не знает такого логина; цепочка переходит к следующему.
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrInvalidCredentials — логин найден, но пароль неверен; цепочка останавливается.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity — результат успешной проверки пароля.
+type Identity struct {
+	// Provider — имя источника: "local", "ldap"
+	Provider string
+	// UserID заполняет локальный источник; внешние источники оставляют 0,
+	// и локальный пользователь находится или создается по Issuer + Subject.
+	UserID uint
+
+	Issuer  string
+	Subject string
+	Login   string
+	Name    string
+	Email   string
+
+	// Roles — глобальные роли, положенные пользователю по группам каталога.
+	// ManagedRoles — все роли из сопоставления групп: роли из этого списка,
+	// которых нет в Roles, у пользователя отзываются. Пустой ManagedRoles
+	// означает, что источник ролями не управляет.
+	Roles        []string
+	ManagedRoles []string
+}
+
+// Authenticator проверяет логин и пароль в одном источнике учетных записей.
+// При ErrInvalidCredentials может вернуть Identity с UserID для журнала попыток.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, login, password string) (*Identity, error)
+}
+
+// Chain опрашивает источники по порядку. Логин принадлежит первому источнику,
+// который его знает: неверный пароль там не передается следующим источникам.
+type Chain []Authenticator
+
+// Authenticate возвращает личность из первого источника, знающего логин.
+// Если логин не знает никто, возвращается ErrUnknownUser; ошибка связи с
+// источником прерывает цепочку, чтобы недоступный каталог не отдавал логин
+// следующему источнику.
+func (ch Chain) Authenticate(ctx context.Context, login, password string) (*Identity, error) {
+	for _, a := range ch {
+		id, err := a.Authenticate(ctx, login, password)
+		if errors.Is(err, ErrUnknownUser) {
+			continue
+		}
+		return id, err
+	}
+	return nil, ErrUnknownUser
+}
+
+// FromEnv собирает цепочку из AUTH_PROVIDERS — имен источников через запятую
+// в порядке опроса (local, ldap). По умолчанию local, а при заданном LDAP_URL —
+// local,ldap.
+func FromEnv(db *gorm.DB) Chain {
+	names := strings.Split(os.Getenv("AUTH_PROVIDERS"), ",")
+	if strings.TrimSpace(os.Getenv("AUTH_PROVIDERS")) == "" {
+		names = []string{"local"}
+		if os.Getenv("LDAP_URL") != "" {
+			names = append(names, "ldap")
+		}
+	}
+	var ch Chain
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "local":
+			ch = append(ch, NewLocal(db))
+		case "ldap":
+			cfg, err := LDAPConfigFromEnv()
+			if err != nil {
+				log.Printf("[authn] ldap disabled: %v", err)
+				continue
+			}
+			ch = append(ch, NewLDAP(cfg))
+		case "":
+		default:
+			log.Printf("[authn] unknown provider %q in AUTH_PROVIDERS", name)
+		}
+	}
+	return ch
+}
@@ -0,0 +1,342 @@
+package authn
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig — настройки подключения к каталогу и сопоставления атрибутов.
+type LDAPConfig struct {
+	URL                string // ldap://host:389 или ldaps://host:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+
+	// BindDN и BindPassword — служебная учетная запись для поиска; пустой
+	// BindDN означает анонимный поиск.
+	BindDN       string
+	BindPassword string
+
+	BaseDN string
+	// UserFilter — фильтр поиска пользователя; %s заменяется экранированным логином
+	UserFilter string
+
+	LoginAttr string
+	NameAttr  string
+	EmailAttr string
+	// IDAttr — неизменяемый идентификатор записи (entryUUID, objectGUID);
+	// если атрибута нет, идентификатором служит DN.
+	IDAttr    string
+	GroupAttr string
+
+	// GroupBaseDN и GroupFilter включают поиск групп для каталогов без
+	// memberOf; %s в фильтре заменяется экранированным DN пользователя.
+	GroupBaseDN string
+	GroupFilter string
+
+	// GroupRoles сопоставляет группу (полный DN или значение первого RDN,
+	// например cn) имени роли models.Role. Ключи в нижнем регистре.
+	GroupRoles map[string]string
+}
+
+// LDAPConfigFromEnv читает настройки каталога:
+//
+//	LDAP_URL, LDAP_START_TLS, LDAP_INSECURE_SKIP_VERIFY, LDAP_TIMEOUT (10s)
+//	LDAP_BIND_DN, LDAP_BIND_PASSWORD      служебная учетная запись для поиска
+//	LDAP_BASE_DN, LDAP_USER_FILTER        ((uid=%s))
+//	LDAP_ATTR_LOGIN (uid), LDAP_ATTR_NAME (cn), LDAP_ATTR_EMAIL (mail),
+//	LDAP_ATTR_ID (entryUUID), LDAP_ATTR_GROUPS (memberOf)
+//	LDAP_GROUP_BASE_DN, LDAP_GROUP_FILTER  поиск групп, например (member=%s)
+//	LDAP_GROUP_ROLES                      группа=роль через ";"
+func LDAPConfigFromEnv() (LDAPConfig, error) {
+	get := func(key, def string) string {
+		if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+			return v
+		}
+		return def
+	}
+	cfg := LDAPConfig{
+		URL:          get("LDAP_URL", ""),
+		BindDN:       get("LDAP_BIND_DN", ""),
+		BindPassword: os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:       get("LDAP_BASE_DN", ""),
+		UserFilter:   get("LDAP_USER_FILTER", "(uid=%s)"),
+		LoginAttr:    get("LDAP_ATTR_LOGIN", "uid"),
+		NameAttr:     get("LDAP_ATTR_NAME", "cn"),
+		EmailAttr:    get("LDAP_ATTR_EMAIL", "mail"),
+		IDAttr:       get("LDAP_ATTR_ID", "entryUUID"),
+		GroupAttr:    get("LDAP_ATTR_GROUPS", "memberOf"),
+		GroupBaseDN:  get("LDAP_GROUP_BASE_DN", ""),
+		GroupFilter:  get("LDAP_GROUP_FILTER", ""),
+		Timeout:      10 * time.Second,
+	}
+	cfg.StartTLS, _ = strconv.ParseBool(get("LDAP_START_TLS", "false"))
+	cfg.InsecureSkipVerify, _ = strconv.ParseBool(get("LDAP_INSECURE_SKIP_VERIFY", "false"))
+	if d, err := time.ParseDuration(get("LDAP_TIMEOUT", "")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return cfg, errors.New("LDAP_URL and LDAP_BASE_DN are required")
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return cfg, errors.New("LDAP_USER_FILTER must contain %s")
+	}
+	roles, err := ParseGroupRoles(os.Getenv("LDAP_GROUP_ROLES"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.GroupRoles = roles
+	return cfg, nil
+}
+
+// ParseGroupRoles разбирает "cn=admins,ou=groups,dc=example,dc=com=admin;moderators=moderator".
+// Имя роли отделяется последним "=", поэтому группа может быть полным DN.
+func ParseGroupRoles(s string) (map[string]string, error) {
+	roles := map[string]string{}
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, "=")
+		group, role := strings.TrimSpace(item[:max(i, 0)]), strings.TrimSpace(item[i+1:])
+		if i <= 0 || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid LDAP_GROUP_ROLES entry %q, want group=role", item)
+		}
+		roles[normalizeDN(group)] = role
+	}
+	return roles, nil
+}
+
+// ldapConn — часть ldap.Client, которой пользуется LDAP.
+type ldapConn interface {
+	StartTLS(*tls.Config) error
+	Bind(username, password string) error
+	Search(*ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAP проверяет пароль bind-ом в каталог: служебная учетная запись находит
+// DN пользователя по фильтру, затем выполняется bind под этим DN.
+type LDAP struct {
+	cfg  LDAPConfig
+	dial func(ctx context.Context) (ldapConn, error)
+}
+
+// NewLDAP создает источник LDAP.
+func NewLDAP(cfg LDAPConfig) *LDAP {
+	l := &LDAP{cfg: cfg}
+	l.dial = l.dialURL
+	return l
+}
+
+func (l *LDAP) Name() string { return ProviderLDAP }
+
+func (l *LDAP) tlsConfig() *tls.Config {
+	host := l.cfg.URL
+	if u, err := url.Parse(l.cfg.URL); err == nil {
+		host = u.Hostname()
+	}
+	return &tls.Config{ServerName: host, InsecureSkipVerify: l.cfg.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+}
+
+func (l *LDAP) dialURL(ctx context.Context) (ldapConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	conn, err := ldap.DialURL(l.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: l.cfg.Timeout}),
+		ldap.DialWithTLSConfig(l.tlsConfig()))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(l.cfg.Timeout)
+	return conn, nil
+}
+
+func (l *LDAP) bindService(conn ldapConn) error {
+	if l.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+		return fmt.Errorf("ldap service bind: %w", err)
+	}
+	return nil
+}
+
+// Authenticate ищет пользователя и проверяет пароль bind-ом под его DN.
+func (l *LDAP) Authenticate(ctx context.Context, login, password string) (*Identity, error) {
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	defer conn.Close()
+	if l.cfg.StartTLS {
+		if err := conn.StartTLS(l.tlsConfig()); err != nil {
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	if err := l.bindService(conn); err != nil {
+		return nil, err
+	}
+
+	attrs := []string{"dn", l.cfg.LoginAttr, l.cfg.NameAttr, l.cfg.EmailAttr, l.cfg.IDAttr, l.cfg.GroupAttr}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		l.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(l.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(l.cfg.UserFilter, "%s", ldap.EscapeFilter(login)),
+		attrs, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if res == nil || len(res.Entries) == 0 {
+		return nil, ErrUnknownUser
+	}
+	if len(res.Entries) > 1 {
+		return nil, fmt.Errorf("ldap search: login %q matches %d entries", login, len(res.Entries))
+	}
+	entry := res.Entries[0]
+
+	// Bind с пустым паролем — анонимный bind, который многие серверы принимают
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind: %w", err)
+	}
+
+	groups := entry.GetAttributeValues(l.cfg.GroupAttr)
+	if l.cfg.GroupFilter != "" {
+		found, err := l.searchGroups(conn, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, found...)
+	}
+
+	id := &Identity{
+		Provider: ProviderLDAP,
+		// Идентичность привязана к каталогу, а не к адресу сервера:
+		// смена хоста или реплики не должна плодить новые учетные записи.
+		Issuer:  "ldap:" + normalizeDN(l.cfg.BaseDN),
+		Subject: entryID(entry, l.cfg.IDAttr),
+		Login:   entry.GetAttributeValue(l.cfg.LoginAttr),
+		Name:    entry.GetAttributeValue(l.cfg.NameAttr),
+		Email:   strings.ToLower(entry.GetAttributeValue(l.cfg.EmailAttr)),
+	}
+	if id.Login == "" {
+		id.Login = login
+	}
+	id.Roles, id.ManagedRoles = l.mapRoles(groups)
+	return id, nil
+}
+
+func (l *LDAP) searchGroups(conn ldapConn, userDN string) ([]string, error) {
+	// Соединение сейчас привязано к пользователю, у которого может не быть
+	// прав на чтение групп
+	if err := l.bindService(conn); err != nil {
+		return nil, err
+	}
+	base := l.cfg.GroupBaseDN
+	if base == "" {
+		base = l.cfg.BaseDN
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(l.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(l.cfg.GroupFilter, "%s", ldap.EscapeFilter(userDN)),
+		[]string{"dn"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search: %w", err)
+	}
+	groups := make([]string, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		groups = append(groups, e.DN)
+	}
+	return groups, nil
+}
+
+// mapRoles возвращает роли по группам пользователя и все роли из сопоставления.
+func (l *LDAP) mapRoles(groups []string) (roles, managed []string) {
+	if len(l.cfg.GroupRoles) == 0 {
+		return nil, nil
+	}
+	granted := map[string]bool{}
+	for _, g := range groups {
+		dn := normalizeDN(g)
+		for _, key := range []string{dn, firstRDNValue(dn)} {
+			if role, ok := l.cfg.GroupRoles[key]; ok {
+				granted[role] = true
+			}
+		}
+	}
+	seen := map[string]bool{}
+	for _, role := range l.cfg.GroupRoles {
+		if !seen[role] {
+			seen[role] = true
+			managed = append(managed, role)
+		}
+	}
+	for role := range granted {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	sort.Strings(managed)
+	return roles, managed
+}
+
+// entryID возвращает неизменяемый идентификатор записи; бинарные значения
+// (objectGUID в Active Directory) кодируются в hex.
+func entryID(e *ldap.Entry, attr string) string {
+	raw := e.GetRawAttributeValue(attr)
+	if len(raw) == 0 {
+		return normalizeDN(e.DN)
+	}
+	if !utf8.Valid(raw) {
+		return hex.EncodeToString(raw)
+	}
+	return string(raw)
+}
+
+// normalizeDN приводит DN к каноническому виду для сравнения; строку, которая
+// не разбирается как DN (короткое имя группы), только переводит в нижний регистр.
+func normalizeDN(s string) string {
+	dn, err := ldap.ParseDN(s)
+	if err != nil || len(dn.RDNs) == 0 {
+		return strings.ToLower(strings.TrimSpace(s))
+	}
+	parts := make([]string, 0, len(dn.RDNs))
+	for _, rdn := range dn.RDNs {
+		attrs := make([]string, 0, len(rdn.Attributes))
+		for _, a := range rdn.Attributes {
+			attrs = append(attrs, strings.ToLower(a.Type)+"="+strings.ToLower(a.Value))
+		}
+		parts = append(parts, strings.Join(attrs, "+"))
+	}
+	return strings.Join(parts, ",")
+}
+
+func firstRDNValue(dn string) string {
+	first, _, _ := strings.Cut(dn, ",")
+	_, value, ok := strings.Cut(first, "=")
+	if !ok {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,72 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"LinkUp/internal/models"
+	"LinkUp/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// Имена источников; совпадают с ExternalIdentity.Provider внешних учетных записей.
+const (
+	ProviderLocal = "local"
+	ProviderLDAP  = "ldap"
+)
+
+// Local проверяет пароль по хэшу в models.User.
+type Local struct {
+	db *gorm.DB
+}
+
+// NewLocal создает локальный источник.
+func NewLocal(db *gorm.DB) *Local {
+	return &Local{db: db}
+}
+
+func (l *Local) Name() string { return ProviderLocal }
+
+// Authenticate находит пользователя с локальным паролем. Пользователи без
+// пароля (пришедшие через SSO) и учетные записи каталога LDAP для этого
+// источника неизвестны: пароль, заданный им, например, через сброс по email,
+// не должен обходить проверку в каталоге.
+func (l *Local) Authenticate(ctx context.Context, login, password string) (*Identity, error) {
+	var u models.User
+	err := l.db.WithContext(ctx).
+		Where("login = ? AND password <> ''", login).
+		Where("NOT EXISTS (SELECT 1 FROM external_identities ei WHERE ei.user_id = users.id AND ei.provider = ?)", ProviderLDAP).
+		First(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{Provider: ProviderLocal, UserID: u.ID, Login: u.Login}
+	if !utils.CheckPassword(u.Password, password) {
+		return id, ErrInvalidCredentials
+	}
+	l.rehash(ctx, u, password)
+	return id, nil
+}
+
+// rehash пересчитывает хэш, созданный bcrypt или с устаревшими параметрами
+// argon2id. Ошибка только логируется, вход она не прерывает.
+func (l *Local) rehash(ctx context.Context, u models.User, password string) {
+	if !utils.NeedsRehash(u.Password) {
+		return
+	}
+	hash, err := utils.HashPassword(password)
+	if err == nil {
+		// Условие по старому хэшу не дает затереть пароль, смененный параллельно
+		err = l.db.WithContext(ctx).Model(&models.User{}).
+			Where("id = ? AND password = ?", u.ID, u.Password).
+			Update("password", hash).Error
+	}
+	if err != nil {
+		log.Printf("[authn] rehash password for user %d: %v", u.ID, err)
+	}
+}
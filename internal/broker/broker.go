@@ -0,0 +1,89 @@
+// Package broker пересылает события между репликами сервера: сообщение,
+// опубликованное на одном узле, получают подписчики на всех узлах.
+package broker
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// Channel — канал Redis и канал LISTEN/NOTIFY Postgres, через который идут события.
+const Channel = "linkup_events"
+
+// Handler получает опубликованное сообщение. Брокер вызывает обработчики из
+// одной горутины, поэтому сообщения одного узла приходят в порядке публикации.
+type Handler func(payload []byte)
+
+// Broker — шина событий между узлами. Реализации безопасны для конкурентного
+// использования. Сообщение получают все узлы, включая отправителя: отличать
+// свои сообщения — забота вызывающего кода.
+type Broker interface {
+	// Publish отправляет сообщение всем подписчикам.
+	Publish(ctx context.Context, payload []byte) error
+	// Subscribe добавляет обработчик входящих сообщений.
+	Subscribe(h Handler)
+	// Close отключается от шины.
+	Close() error
+}
+
+// FromEnv выбирает брокер по окружению:
+//
+//	BROKER               memory (по умолчанию, одна реплика), redis или postgres
+//	REDIS_URL            адрес Redis (redis://[:password@]host:port/db); без него
+//	                     используются REDIS_HOST, REDIS_PORT и REDIS_PASSWORD
+//	BROKER_POSTGRES_URL  DSN для LISTEN/NOTIFY; по умолчанию DATABASE_URL
+//
+// Если выбранный брокер не настроен, используется memory.
+func FromEnv() Broker {
+	switch kind := strings.ToLower(strings.TrimSpace(os.Getenv("BROKER"))); kind {
+	case "", "memory":
+		return NewMemory()
+	case "redis":
+		b, err := NewRedis(redisURLFromEnv())
+		if err == nil {
+			return b
+		}
+		log.Printf("[BROKER] redis: %v; falling back to in-memory broker", err)
+	case "postgres":
+		dsn := os.Getenv("BROKER_POSTGRES_URL")
+		if dsn == "" {
+			dsn = os.Getenv("DATABASE_URL")
+		}
+		b, err := NewPostgres(dsn)
+		if err == nil {
+			return b
+		}
+		log.Printf("[BROKER] postgres: %v; falling back to in-memory broker", err)
+	default:
+		log.Printf("[BROKER] unknown BROKER=%q; falling back to in-memory broker", kind)
+	}
+	return NewMemory()
+}
+
+func redisURLFromEnv() string {
+	if u := os.Getenv("REDIS_URL"); u != "" {
+		return u
+	}
+	host, port := os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "6379"
+	}
+	auth := ""
+	if pw := os.Getenv("REDIS_PASSWORD"); pw != "" {
+		auth = ":" + pw + "@"
+	}
+	return "redis://" + auth + net.JoinHostPort(host, port)
+}
+
+// dispatch вызывает обработчики по очереди.
+func dispatch(hs []Handler, payload []byte) {
+	for _, h := range hs {
+		h(payload)
+	}
+}
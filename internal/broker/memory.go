@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// memoryBuffer — сколько сообщений Memory держит в очереди до блокировки Publish.
+const memoryBuffer = 1024
+
+var errClosed = errors.New("broker closed")
+
+// Memory доставляет сообщения подписчикам в пределах процесса. Подходит для
+// одной реплики; в тестах один экземпляр, разделенный несколькими узлами,
+// имитирует общую шину.
+type Memory struct {
+	hmu      sync.Mutex
+	handlers []Handler
+
+	// mu защищает queue от записи после закрытия
+	mu     sync.RWMutex
+	closed bool
+	queue  chan []byte
+	done   chan struct{}
+}
+
+// NewMemory создает брокер и запускает горутину доставки.
+func NewMemory() *Memory {
+	m := &Memory{queue: make(chan []byte, memoryBuffer), done: make(chan struct{})}
+	go m.run()
+	return m
+}
+
+func (m *Memory) run() {
+	defer close(m.done)
+	for payload := range m.queue {
+		m.hmu.Lock()
+		hs := m.handlers
+		m.hmu.Unlock()
+		dispatch(hs, payload)
+	}
+}
+
+// Publish реализует Broker.
+func (m *Memory) Publish(ctx context.Context, payload []byte) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return errClosed
+	}
+	select {
+	case m.queue <- payload:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe реализует Broker.
+func (m *Memory) Subscribe(h Handler) {
+	m.hmu.Lock()
+	defer m.hmu.Unlock()
+	// Копия: run читает срез без блокировки
+	m.handlers = append(m.handlers[:len(m.handlers):len(m.handlers)], h)
+}
+
+// Close реализует Broker; уже опубликованные сообщения доставляются.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+	<-m.done
+	return nil
+}
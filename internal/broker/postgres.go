@@ -0,0 +1,223 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresMaxPayload — предел NOTIFY: полезная нагрузка короче 8000 байт.
+const postgresMaxPayload = 7999
+
+// postgresPayloadTable хранит сообщения, не помещающиеся в NOTIFY. Таблица
+// нежурналируемая: строки нужны слушателям лишь несколько секунд, а после
+// сбоя базы их все равно некому дочитывать.
+const postgresPayloadTable = "linkup_event_payloads"
+
+// postgresPayloadTTL — сколько хранятся строки postgresPayloadTable.
+// Слушатель, отставший сильнее, теряет такие сообщения, как и при разрыве.
+const postgresPayloadTTL = 5 * time.Minute
+
+// Первый байт уведомления говорит, как читать остальное
+const (
+	notifyInline = '=' // само сообщение
+	notifyStored = '@' // id строки postgresPayloadTable с сообщением
+)
+
+// Postgres пересылает сообщения через LISTEN/NOTIFY. Слушатель держит
+// отдельное соединение и переподключается с нарастающей паузой; уведомления,
+// отправленные во время разрыва, теряются. Сообщения, которые не помещаются в
+// NOTIFY (до 8000 байт), например снимки присутствия большого узла,
+// записываются в postgresPayloadTable, а уведомление несет только id строки.
+type Postgres struct {
+	pool *pgxpool.Pool
+
+	mu       sync.Mutex
+	handlers []Handler
+	// tableReady — postgresPayloadTable уже создана; lastPrune — когда из нее
+	// последний раз удалялись старые строки
+	tableReady bool
+	lastPrune  time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPostgres создает брокер поверх базы dsn. Соединение устанавливается в
+// фоне, поэтому недоступная при старте база не мешает запуску сервера.
+func NewPostgres(dsn string) (*Postgres, error) {
+	if dsn == "" || strings.HasPrefix(dsn, "sqlite://") {
+		return nil, errors.New("postgres DSN required")
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Postgres{pool: pool, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	go p.listen()
+	return p, nil
+}
+
+func (p *Postgres) listen() {
+	defer close(p.done)
+	backoff := time.Second
+	for {
+		err := p.listenOnce(func() { backoff = time.Second })
+		if p.ctx.Err() != nil {
+			return
+		}
+		log.Printf("[BROKER] postgres listener: %v; reconnecting in %s", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			return
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// listenOnce слушает канал на одном соединении до ошибки.
+func (p *Postgres) listenOnce(connected func()) error {
+	pc, err := p.pool.Acquire(p.ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN привязан к соединению, поэтому оно не возвращается в пул
+	conn := pc.Hijack()
+	defer conn.Close(context.Background())
+
+	if err := p.ensureTable(p.ctx); err != nil {
+		return err
+	}
+	if _, err := conn.Exec(p.ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+	connected()
+	for {
+		n, err := conn.WaitForNotification(p.ctx)
+		if err != nil {
+			return err
+		}
+		payload, err := p.load(n.Payload)
+		if err != nil {
+			if p.ctx.Err() != nil {
+				return err
+			}
+			log.Printf("[BROKER] postgres: dropping notification: %v", err)
+			continue
+		}
+		p.mu.Lock()
+		hs := p.handlers
+		p.mu.Unlock()
+		dispatch(hs, payload)
+	}
+}
+
+// load возвращает сообщение из уведомления, при необходимости читая его из
+// postgresPayloadTable.
+func (p *Postgres) load(notification string) ([]byte, error) {
+	if notification == "" {
+		return nil, errors.New("empty notification")
+	}
+	body := notification[1:]
+	switch notification[0] {
+	case notifyInline:
+		return []byte(body), nil
+	case notifyStored:
+		id, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad payload id %q", body)
+		}
+		var payload []byte
+		err = p.pool.QueryRow(p.ctx, "SELECT payload FROM "+postgresPayloadTable+" WHERE id = $1", id).Scan(&payload)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("payload %d already pruned", id)
+		}
+		return payload, err
+	}
+	return nil, fmt.Errorf("unknown notification kind %q", notification[0])
+}
+
+// ensureTable создает postgresPayloadTable, если ее еще нет.
+func (p *Postgres) ensureTable(ctx context.Context) error {
+	p.mu.Lock()
+	ready := p.tableReady
+	p.mu.Unlock()
+	if ready {
+		return nil
+	}
+	_, err := p.pool.Exec(ctx, `CREATE UNLOGGED TABLE IF NOT EXISTS `+postgresPayloadTable+` (
+		id         BIGSERIAL PRIMARY KEY,
+		payload    BYTEA NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", postgresPayloadTable, err)
+	}
+	p.mu.Lock()
+	p.tableReady = true
+	p.mu.Unlock()
+	return nil
+}
+
+// Publish реализует Broker. Сообщение, не помещающееся в NOTIFY, сохраняется
+// в postgresPayloadTable; строка и уведомление о ней создаются одним запросом,
+// так что слушатели получают уведомление уже после фиксации строки.
+func (p *Postgres) Publish(ctx context.Context, payload []byte) error {
+	if len(payload)+1 <= postgresMaxPayload {
+		_, err := p.pool.Exec(ctx, "SELECT pg_notify($1, $2)", Channel, string(notifyInline)+string(payload))
+		return err
+	}
+	if err := p.ensureTable(ctx); err != nil {
+		return err
+	}
+	_, err := p.pool.Exec(ctx, `WITH m AS (INSERT INTO `+postgresPayloadTable+` (payload) VALUES ($2) RETURNING id)
+		SELECT pg_notify($1, $3::text || m.id::text) FROM m`, Channel, payload, string(notifyStored))
+	if err != nil {
+		return err
+	}
+	p.prune(ctx)
+	return nil
+}
+
+// prune не чаще раза в минуту удаляет строки старше postgresPayloadTTL.
+func (p *Postgres) prune(ctx context.Context) {
+	p.mu.Lock()
+	if time.Since(p.lastPrune) < time.Minute {
+		p.mu.Unlock()
+		return
+	}
+	p.lastPrune = time.Now()
+	p.mu.Unlock()
+	// Срок считается по часам базы, как и created_at
+	if _, err := p.pool.Exec(ctx, "DELETE FROM "+postgresPayloadTable+" WHERE created_at < now() - make_interval(secs => $1)", postgresPayloadTTL.Seconds()); err != nil {
+		log.Printf("[BROKER] postgres: prune %s: %v", postgresPayloadTable, err)
+	}
+}
+
+// Subscribe реализует Broker.
+func (p *Postgres) Subscribe(h Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers = append(p.handlers[:len(p.handlers):len(p.handlers)], h)
+}
+
+// Close реализует Broker.
+func (p *Postgres) Close() error {
+	p.cancel()
+	<-p.done
+	p.pool.Close()
+	return nil
+}
@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPostgresLargePayload нужна настоящая база: BROKER_TEST_POSTGRES_URL.
+func TestPostgresLargePayload(t *testing.T) {
+	dsn := os.Getenv("BROKER_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("BROKER_TEST_POSTGRES_URL not set")
+	}
+	a, err := NewPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := NewPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	got := make(chan []byte, 16)
+	b.Subscribe(func(payload []byte) { got <- payload })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// LISTEN устанавливается в фоне: шлем уникальные пробы, пока одна не
+	// дойдет, и вычитываем все пробы до нее, чтобы в канале не осталось лишних
+	probe := func(i int) []byte { return []byte(fmt.Sprintf(`{"probe":%d}`, i)) }
+	for i := 0; ; i++ {
+		if err := a.Publish(ctx, probe(i)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case p := <-got:
+			for !bytes.Equal(p, probe(i)) {
+				select {
+				case p = <-got:
+				case <-ctx.Done():
+					t.Fatal("probe lost")
+				}
+			}
+		case <-time.After(200 * time.Millisecond):
+			continue
+		case <-ctx.Done():
+			t.Fatal("listener did not connect")
+		}
+		break
+	}
+
+	sent := [][]byte{
+		[]byte(`{"kind":"room"}`),
+		bytes.Repeat([]byte("x"), postgresMaxPayload),
+		bytes.Repeat([]byte(`{"users":[1,2,3]}`), 4000),
+		[]byte(`{"kind":"user"}`),
+	}
+	for _, p := range sent {
+		if err := a.Publish(ctx, p); err != nil {
+			t.Fatalf("publish %d bytes: %v", len(p), err)
+		}
+	}
+	for i, want := range sent {
+		select {
+		case p := <-got:
+			if !bytes.Equal(p, want) {
+				t.Fatalf("message %d: got %d bytes, want %d", i, len(p), len(want))
+			}
+		case <-ctx.Done():
+			t.Fatalf("received %d of %d messages", i, len(sent))
+		}
+	}
+}
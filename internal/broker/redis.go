@@ -0,0 +1,65 @@
+package broker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis пересылает сообщения через Redis Pub/Sub. Клиент сам переподключается
+// и восстанавливает подписку; сообщения, опубликованные во время разрыва,
+// теряются.
+type Redis struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+
+	mu       sync.Mutex
+	handlers []Handler
+	done     chan struct{}
+}
+
+// NewRedis подключается к Redis по адресу вида redis://[:password@]host:port/db
+// и подписывается на Channel.
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	r := &Redis{client: client, pubsub: client.Subscribe(context.Background(), Channel), done: make(chan struct{})}
+	go r.run()
+	return r, nil
+}
+
+func (r *Redis) run() {
+	defer close(r.done)
+	for msg := range r.pubsub.Channel() {
+		r.mu.Lock()
+		hs := r.handlers
+		r.mu.Unlock()
+		dispatch(hs, []byte(msg.Payload))
+	}
+}
+
+// Publish реализует Broker.
+func (r *Redis) Publish(ctx context.Context, payload []byte) error {
+	return r.client.Publish(ctx, Channel, payload).Err()
+}
+
+// Subscribe реализует Broker.
+func (r *Redis) Subscribe(h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers[:len(r.handlers):len(r.handlers)], h)
+}
+
+// Close реализует Broker.
+func (r *Redis) Close() error {
+	err := r.pubsub.Close()
+	<-r.done
+	if cerr := r.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
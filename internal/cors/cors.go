@@ -0,0 +1,93 @@
+// Package cors хранит список источников, которым разрешено обращаться к
+// серверу из браузера (CORS_ORIGINS). По одному списку отвечают на CORS-запросы
+// к REST API и проверяют Origin при подключении к WebSocket, поэтому страница
+// чужого сайта не получает доступа ни к тому, ни к другому.
+package cors
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AllowHeaders — заголовки, которые браузер может передавать в запросах к API.
+const AllowHeaders = "Authorization, Content-Type, X-Device-Name, Last-Event-ID"
+
+// AllowMethods — методы, разрешенные в запросах к API.
+const AllowMethods = "GET,POST,PUT,PATCH,DELETE,OPTIONS"
+
+// Allowlist — разрешенные источники.
+type Allowlist struct {
+	// any — разрешен любой источник (CORS_ORIGINS пуст или *)
+	any     bool
+	origins map[string]bool
+}
+
+// FromEnv читает CORS_ORIGINS — источники через запятую, например
+// https://app.example.com,http://localhost:3000. Пусто или * — любой источник.
+func FromEnv() *Allowlist {
+	return Parse(os.Getenv("CORS_ORIGINS"))
+}
+
+// Parse разбирает список источников через запятую.
+func Parse(list string) *Allowlist {
+	a := &Allowlist{origins: map[string]bool{}}
+	for _, o := range strings.Split(list, ",") {
+		switch o = normalize(o); o {
+		case "":
+		case "*":
+			a.any = true
+		default:
+			a.origins[o] = true
+		}
+	}
+	if len(a.origins) == 0 {
+		a.any = true
+	}
+	return a
+}
+
+// normalize приводит источник к виду, в котором его присылает браузер:
+// схема и хост в нижнем регистре, без завершающего слэша.
+func normalize(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
+
+// Allowed сообщает, разрешен ли источник.
+func (a *Allowlist) Allowed(origin string) bool {
+	return a.any || a.origins[normalize(origin)]
+}
+
+// CheckOrigin — проверка для websocket.Upgrader. Запросы без Origin приходят
+// не из браузера и пропускаются: от них Origin не защищает.
+func (a *Allowlist) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || a.Allowed(origin)
+}
+
+// Middleware отвечает на CORS-запросы. Разрешенный источник возвращается в
+// Access-Control-Allow-Origin, остальным заголовок не отдается, и браузер
+// не показывает им ответ.
+func (a *Allowlist) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a.any {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Writer.Header().Add("Vary", "Origin")
+			if origin := c.GetHeader("Origin"); origin != "" && a.Allowed(origin) {
+				c.Header("Access-Control-Allow-Origin", origin)
+			}
+		}
+		c.Header("Access-Control-Allow-Credentials", "true")
+		c.Header("Access-Control-Allow-Headers", AllowHeaders)
+		c.Header("Access-Control-Allow-Methods", AllowMethods)
+		if c.Request.Method == http.MethodOptions {
+			c.Status(http.StatusNoContent)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package cors
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowlist(t *testing.T) {
+	a := Parse(" https://App.example.com/ , http://localhost:3000")
+	cases := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"http://localhost:3000", true},
+		{"https://evil.example.com", false},
+		{"http://app.example.com", false},
+		{"http://localhost:3001", false},
+	}
+	for _, tc := range cases {
+		if got := a.Allowed(tc.origin); got != tc.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tc.origin, got, tc.want)
+		}
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.Header.Set("Origin", tc.origin)
+		if got := a.CheckOrigin(r); got != tc.want {
+			t.Errorf("CheckOrigin(%q) = %v, want %v", tc.origin, got, tc.want)
+		}
+	}
+	if !a.CheckOrigin(httptest.NewRequest("GET", "/ws", nil)) {
+		t.Error("request without Origin rejected")
+	}
+	for _, list := range []string{"", "*", " , "} {
+		if !Parse(list).Allowed("https://any.example.com") {
+			t.Errorf("list %q should allow any origin", list)
+		}
+	}
+}
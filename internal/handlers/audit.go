@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"LinkUp/internal/audit"
+	"LinkUp/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginMethodByOp — способ входа для журнала аудита по имени операции completeLogin.
+var loginMethodByOp = map[string]string{
+	"Login":              "password",
+	"Login2FA":           "password+totp",
+	"OIDCCallback":       "oidc",
+	"FinishPasskeyLogin": "passkey",
+	"FinishPasskey2FA":   "password+passkey",
+}
+
+// recordAudit пишет событие журнала аудита от имени текущего пользователя.
+func (h *Handler) recordAudit(c *gin.Context, action, targetType string, targetID uint, diff audit.Diff) {
+	var actor *uint
+	if id := uid(c); id != 0 {
+		actor = &id
+	}
+	h.recordAuditAs(c, actor, action, targetType, targetID, diff)
+}
+
+// recordAuditAs пишет событие с явно указанным автором — для входа и
+// действий по ссылке из письма, когда в контексте еще нет пользователя.
+// Ошибка записи только логируется и не прерывает запрос.
+func (h *Handler) recordAuditAs(c *gin.Context, actor *uint, action, targetType string, targetID uint, diff audit.Diff) {
+	e := models.AuditEvent{
+		ActorID:    actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         c.ClientIP(),
+		UserAgent:  truncate(c.Request.UserAgent(), 255),
+	}
+	if len(diff) > 0 {
+		e.Diff = make(map[string]interface{}, len(diff))
+		for field, change := range diff {
+			e.Diff[field] = change
+		}
+	}
+	if err := h.audit.Record(c.Request.Context(), e); err != nil {
+		log.Printf("[API] audit %s: %v", action, err)
+	}
+}
+
+// auditFilter разбирает фильтры журнала из query-параметров.
+func auditFilter(c *gin.Context) (audit.Filter, bool) {
+	f := audit.Filter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		IP:         c.Query("ip"),
+	}
+	for _, p := range []struct {
+		name string
+		dest **uint
+	}{{"actorId", &f.ActorID}, {"targetId", &f.TargetID}} {
+		if v := c.Query(p.name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return f, false
+			}
+			id := uint(n)
+			*p.dest = &id
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dest **time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := c.Query(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, false
+			}
+			*p.dest = &t
+		}
+	}
+	return f, true
+}
+
+// ==================== ЖУРНАЛ АУДИТА ====================
+
+// @Summary Журнал аудита
+// @Description Входы, изменения учетных записей и административные действия, новые сверху. Общее число подходящих записей возвращается в заголовке X-Total-Count
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param actorId query int false "Кто выполнил действие"
+// @Param action query string false "Действие или группа с * на конце (auth.*)"
+// @Param targetType query string false "Тип объекта: user, role, room, session, token, passkey, identity"
+// @Param targetId query int false "ID объекта"
+// @Param ip query string false "IP клиента"
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339), не включительно"
+// @Param limit query int false "Лимит" default(50)
+// @Param offset query int false "Смещение" default(0)
+// @Success 200 {array} models.AuditEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/audit [get]
+func (h *Handler) ListAuditEvents(c *gin.Context) {
+	if !h.hasPermission(c, "admin.audit.read") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+
+	f, ok := auditFilter(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid filter"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	events, total, err := h.audit.List(c.Request.Context(), f, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch audit events"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, events)
+}
+
+// @Summary Выгрузить журнал аудита
+// @Description Потоковая выгрузка журнала в формате NDJSON (одна запись JSON на строку) в порядке возрастания id. Фильтры те же, что у /admin/audit
+// @Tags admin
+// @Security BearerAuth
+// @Produce application/x-ndjson
+// @Param actorId query int false "Кто выполнил действие"
+// @Param action query string false "Действие или группа с * на конце (auth.*)"
+// @Param targetType query string false "Тип объекта"
+// @Param targetId query int false "ID объекта"
+// @Param ip query string false "IP клиента"
+// @Param from query string false "Начало периода (RFC 3339)"
+// @Param to query string false "Конец периода (RFC 3339), не включительно"
+// @Success 200 {string} string "NDJSON"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/audit/export [get]
+func (h *Handler) ExportAuditEvents(c *gin.Context) {
+	if !h.hasPermission(c, "admin.audit.read") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+
+	f, ok := auditFilter(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid filter"})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit-`+time.Now().UTC().Format("20060102")+`.ndjson"`)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	n := 0
+	err := h.audit.Stream(c.Request.Context(), f, func(e models.AuditEvent) error {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		if n++; n%500 == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Заголовки уже отправлены: клиент увидит оборванный поток
+		log.Printf("[API] audit export: %v", err)
+	}
+}
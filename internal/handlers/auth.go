@@ -1,16 +1,28 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"strings"
 	"time"
 
+	"LinkUp/internal/audit"
 	"LinkUp/internal/auth"
+	"LinkUp/internal/authn"
+	"LinkUp/internal/broker"
+	"LinkUp/internal/cors"
 	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/lockout"
+	"LinkUp/internal/mail"
 	"LinkUp/internal/models"
+	"LinkUp/internal/oidc"
+	"LinkUp/internal/privacy"
 	"LinkUp/internal/utils"
+	"LinkUp/internal/webauthn"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Handler struct {
@@ -19,6 +31,20 @@ type Handler struct {
 	staticBase string
 	presence   *Presence
 	rooms      *RoomHubs
+	users      *UserChannels
+	ws         wsLimits
+	node       string
+	broker     broker.Broker
+	sso        *oidc.Registry
+	mailer     mail.Mailer
+	lockout    *lockout.Guard
+	webauthn   *webauthn.RelyingParty
+	passwords  *utils.PasswordPolicy
+	privacy    *privacy.Service
+	audit      *audit.Log
+	authn      authn.Chain
+	// origins — источники, которым разрешено подключаться к WebSocket (CORS_ORIGINS)
+	origins *cors.Allowlist
 }
 
 // Auto-generated swagger comments for New
@@ -28,7 +54,14 @@ type Handler struct {
 // (internal function — not necessarily an HTTP handler)
 
 func New(db *gorm.DB, uploadDir, staticBase string) *Handler {
-	return &Handler{db: db, uploadDir: uploadDir, staticBase: staticBase, presence: NewPresence(), rooms: NewRoomHubs()}
+	h := &Handler{db: db, uploadDir: uploadDir, staticBase: staticBase, presence: NewPresence(), rooms: NewRoomHubs(wsHubIdleTimeout()), users: NewUserChannels(), ws: wsLimitsFromEnv(), node: nodeID(), sso: oidc.FromEnv(), mailer: mail.FromEnv(), lockout: lockout.FromEnv(db), webauthn: webauthn.FromEnv(), passwords: utils.PasswordPolicyFromEnv(), privacy: privacy.New(db, uploadDir), audit: audit.FromEnv(db), authn: authn.FromEnv(db), origins: cors.FromEnv()}
+	// Номера событий комнат общие для всех узлов
+	h.rooms.seqs = dbSeq{db}
+	h.presence.load = h.loadPresenceStatus
+	h.rooms.describe = h.presence.describe
+	h.attachBroker(broker.FromEnv())
+	go h.watchPresence()
+	return h
 }
 
 type registerReq struct {
@@ -36,16 +69,19 @@ type registerReq struct {
 	Password  string `json:"password" binding:"required"`
 	Name      string `json:"name" binding:"required"`
 	AvatarURL string `json:"avatarUrl"`
+	Email     string `json:"email"`
+	Invite    string `json:"invite"`
 }
 
 // @Summary Регистрация пользователя
-// @Description Создает нового пользователя в системе
+// @Description Создает нового пользователя в системе. Пароль проверяется парольной политикой: минимальная длина, список распространенных паролей, запрет на логин в пароле. Если указан email, на него отправляется ссылка подтверждения. В режиме REGISTRATION_MODE=invite нужен код приглашения, в режиме closed регистрация недоступна; код, переданный в открытом режиме, тоже списывается и выдает комнаты и роли приглашения
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param user body RegisterRequest true "Данные пользователя"
 // @Success 201 {object} AuthResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 409 {object} ErrorResponse
 // @Router /register [post]
 func (h *Handler) Register(c *gin.Context) {
@@ -56,12 +92,37 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
+	switch mode := registrationMode(); {
+	case mode == registrationClosed:
+		apiErr := apiErrors.NewAPIError("Register.Mode", nil, "registration closed", 403)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Registration is closed.")
+		return
+	case mode == registrationInvite && req.Invite == "":
+		apiErr := apiErrors.NewAPIError("Register.Mode", nil, "invite required", 403)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Registration requires an invite.")
+		return
+	}
+
 	req.Login = strings.TrimSpace(req.Login)
 	if req.Login == "" || req.Password == "" || req.Name == "" {
 		apiErr := apiErrors.NewAPIError("Register.Validate", nil, "login, password, name required", 400)
 		apiErrors.LogAndRespondAPI(c, apiErr, "Login, password, and name are required.")
 		return
 	}
+	if !h.checkPasswordPolicy(c, "Register", req.Password, req.Login) {
+		return
+	}
+
+	var email *string
+	if strings.TrimSpace(req.Email) != "" {
+		normalized, emailErr := normalizeEmail(req.Email)
+		if emailErr != nil {
+			apiErr := apiErrors.NewAPIError("Register.ValidateEmail", emailErr, "invalid email", 400)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Invalid email address.")
+			return
+		}
+		email = &normalized
+	}
 
 	hash, hashErr := utils.HashPassword(req.Password)
 	if hashErr != nil {
@@ -75,30 +136,69 @@ func (h *Handler) Register(c *gin.Context) {
 		Password:  hash,
 		Name:      req.Name,
 		AvatarURL: req.AvatarURL,
+		Email:     email,
 	}
 
-	if createErr := h.db.Create(&u).Error; createErr != nil {
+	// Приглашение списывается в одной транзакции с созданием пользователя:
+	// при занятом логине использование не теряется
+	var (
+		inv       models.Invite
+		createErr error
+	)
+	txErr := h.db.Transaction(func(tx *gorm.DB) error {
+		if req.Invite != "" {
+			var err error
+			if inv, err = redeemInvite(tx, req.Invite); err != nil {
+				return err
+			}
+		}
+		if createErr = tx.Create(&u).Error; createErr != nil {
+			return createErr
+		}
+		return grantInvite(tx, inv, u.ID)
+	})
+	switch {
+	case errors.Is(txErr, errInvalidInvite):
+		apiErr := apiErrors.NewAPIError("Register.RedeemInvite", txErr, "invalid invite", 403)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invite is invalid, expired or used up.")
+		return
+	case createErr != nil:
 		apiErr := apiErrors.NewAPIError("Register.CreateUser", createErr, "user exists?", 409)
 		apiErrors.LogAndRespondAPI(c, apiErr, "User already exists.")
 		return
+	case txErr != nil:
+		apiErr := apiErrors.NewAPIError("Register.GrantInvite", txErr, "failed to apply invite", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	diff := audit.Diff{}.Add("login", nil, u.Login)
+	if inv.ID != 0 {
+		diff.Add("inviteId", nil, inv.ID)
 	}
+	h.recordAuditAs(c, &u.ID, audit.ActionRegister, audit.TargetUser, u.ID, diff)
 
-	tok, tokenErr := auth.GenerateToken(u.ID)
+	if u.Email != nil {
+		if sendErr := h.sendVerification(u); sendErr != nil {
+			apiErr := apiErrors.NewAPIError("Register.SendVerification", sendErr, "failed to send verification", 500)
+			log.Printf("[API] %v", apiErr)
+		}
+	}
+
+	resp, tokenErr := h.issueSessionTokens(c, u.ID)
 	if tokenErr != nil {
 		apiErr := apiErrors.NewAPIError("Register.GenerateToken", tokenErr, "failed to generate token", 500)
 		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
 		return
 	}
 
-	c.JSON(201, gin.H{
-		"token": tok,
-		"user": gin.H{
-			"id":        u.ID,
-			"login":     u.Login,
-			"name":      u.Name,
-			"avatarUrl": u.AvatarURL,
-		},
-	})
+	resp["user"] = gin.H{
+		"id":        u.ID,
+		"login":     u.Login,
+		"name":      u.Name,
+		"avatarUrl": u.AvatarURL,
+		"email":     u.Email,
+	}
+	c.JSON(201, resp)
 }
 
 type loginReq struct {
@@ -107,7 +207,7 @@ type loginReq struct {
 }
 
 // @Summary Авторизация пользователя
-// @Description Вход в систему с логином и паролем
+// @Description Вход в систему с логином и паролем. Пароль проверяется цепочкой источников из AUTH_PROVIDERS (локальные пароли, LDAP); при первом входе через LDAP пользователь создается автоматически, если это позволяет REGISTRATION_MODE (в режимах invite и closed — только с REGISTRATION_SSO_PROVISION=true, иначе 403). Если у пользователя включена 2FA или зарегистрированы passkeys, вместо JWT возвращается TwoFactorChallengeResponse для /auth/2fa/login или /auth/2fa/webauthn. После серии неудачных попыток логин и IP временно блокируются (429 с Retry-After)
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -115,6 +215,9 @@ type loginReq struct {
 // @Success 200 {object} AuthResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /login [post]
 func (h *Handler) Login(c *gin.Context) {
 
@@ -124,32 +227,128 @@ func (h *Handler) Login(c *gin.Context) {
 		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
 		return
 	}
-	var u models.User
-	if findErr := h.db.Where("login = ?", req.Login).First(&u).Error; findErr != nil {
-		apiErr := apiErrors.NewAPIError("Login.FindUser", findErr, "invalid credentials", 401)
-		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid credentials.")
+	if h.checkLockout(c, "Login", req.Login, nil) {
 		return
 	}
-	if !utils.CheckPassword(u.Password, req.Password) {
-		apiErr := apiErrors.NewAPIError("Login.CheckPassword", nil, "invalid credentials", 401)
+	id, authErr := h.authn.Authenticate(c.Request.Context(), req.Login, req.Password)
+	switch {
+	case errors.Is(authErr, authn.ErrUnknownUser):
+		if h.loginFailed(c, "Login", req.Login, nil, attemptUnknownUser) {
+			return
+		}
+		apiErr := apiErrors.NewAPIError("Login.Authenticate", authErr, "invalid credentials", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid credentials.")
+		return
+	case errors.Is(authErr, authn.ErrInvalidCredentials):
+		var userID *uint
+		if id != nil && id.UserID != 0 {
+			userID = &id.UserID
+		}
+		if h.loginFailed(c, "Login", req.Login, userID, attemptBadPassword) {
+			return
+		}
+		apiErr := apiErrors.NewAPIError("Login.Authenticate", authErr, "invalid credentials", 401)
 		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid credentials.")
 		return
+	case authErr != nil:
+		apiErr := apiErrors.NewAPIError("Login.Authenticate", authErr, "authentication backend failed", 503)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Authentication service unavailable.")
+		return
+	}
+	u, userErr := h.identityUser(c, id)
+	if errors.Is(userErr, errProvisioningClosed) {
+		apiErr := apiErrors.NewAPIError("Login.IdentityUser", userErr, "registration mode "+registrationMode(), 403)
+		apiErrors.LogAndRespondAPI(c, apiErr, "No LinkUp account exists for this user, and registration is not open.")
+		return
+	}
+	if userErr != nil {
+		apiErr := apiErrors.NewAPIError("Login.IdentityUser", userErr, "failed to resolve user", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
 	}
+
+	h.loginOrChallenge(c, "Login", u)
+}
+
+// loginOrChallenge завершает первый фактор входа: с включенной 2FA или
+// зарегистрированными passkeys вместо JWT выдает challenge-токен для
+// /auth/2fa/login или /auth/2fa/webauthn.
+func (h *Handler) loginOrChallenge(c *gin.Context, op string, u models.User) {
+	var methods []string
+	var twoFA models.TwoFactorAuth
+	if h.db.Where("user_id = ? AND enabled = ?", u.ID, true).First(&twoFA).Error == nil {
+		methods = append(methods, "totp")
+	}
+	var passkeys int64
+	h.db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", u.ID).Count(&passkeys)
+	if passkeys > 0 {
+		methods = append(methods, "webauthn")
+	}
+	if len(methods) > 0 {
+		challenge, challengeErr := auth.GenerateChallengeToken(u.ID)
+		if challengeErr != nil {
+			apiErr := apiErrors.NewAPIError(op+".GenerateChallengeToken", challengeErr, "failed to generate challenge", 500)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+			return
+		}
+		c.JSON(200, TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int(auth.ChallengeTTL.Seconds()),
+			Methods:           methods,
+		})
+		return
+	}
+
+	h.completeLogin(c, op, u)
+}
+
+// consumeChallenge гасит challenge-токен после успешной проверки второго
+// фактора, чтобы один токен не дал нескольких входов: без этого тот же токен
+// в течение ChallengeTTL принимал бы еще резервные коды или passkey. Гасится
+// только успешная попытка, поэтому ошибка в коде не заставляет входить заново.
+// false — токен уже использован или произошла ошибка; ответ отправлен.
+func (h *Handler) consumeChallenge(c *gin.Context, op string, claims *auth.Claims) bool {
+	now := time.Now()
+	h.db.Where("expires_at < ?", now).Delete(&models.UsedChallenge{})
+	res := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UsedChallenge{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if res.Error != nil {
+		apiErr := apiErrors.NewAPIError(op+".ConsumeChallenge", res.Error, "failed to consume challenge", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return false
+	}
+	if res.RowsAffected != 1 {
+		apiErr := apiErrors.NewAPIError(op+".ConsumeChallenge", nil, "challenge already used", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid or expired challenge.")
+		return false
+	}
+	return true
+}
+
+// completeLogin завершает успешный вход: сбрасывает счетчик неудач, обновляет
+// lastSeen, открывает сессию и выдает токены.
+func (h *Handler) completeLogin(c *gin.Context, op string, u models.User) {
+	h.lockout.Succeed(c.Request.Context(), u.Login)
 	now := time.Now()
 	u.LastSeen = &now
 	if updateErr := h.db.Model(&u).Update("last_seen", u.LastSeen).Error; updateErr != nil {
-		apiErr := apiErrors.NewAPIError("Login.UpdateLastSeen", updateErr, "failed to update last seen", 500)
+		apiErr := apiErrors.NewAPIError(op+".UpdateLastSeen", updateErr, "failed to update last seen", 500)
 		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
 		return
 	}
-	tok, tokenErr := auth.GenerateToken(u.ID)
+	resp, tokenErr := h.issueSessionTokens(c, u.ID)
 	if tokenErr != nil {
-		apiErr := apiErrors.NewAPIError("Login.GenerateToken", tokenErr, "failed to generate token", 500)
+		apiErr := apiErrors.NewAPIError(op+".GenerateToken", tokenErr, "failed to generate token", 500)
 		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
 		return
 	}
-	c.JSON(200, gin.H{"token": tok, "user": sanitizeUser(u)})
-
+	h.recordAuditAs(c, &u.ID, audit.ActionLogin, audit.TargetUser, u.ID, audit.Diff{}.Add("method", nil, loginMethodByOp[op]))
+	resp["user"] = sanitizeUser(u)
+	c.JSON(200, resp)
 }
 
 // Auto-generated swagger comments for sanitizeUser
@@ -159,7 +358,8 @@ func (h *Handler) Login(c *gin.Context) {
 // (internal function — not necessarily an HTTP handler)
 
 func sanitizeUser(u models.User) gin.H {
-	return gin.H{"id": u.ID, "login": u.Login, "name": u.Name, "avatarUrl": u.AvatarURL, "lastSeen": u.LastSeen}
+	return gin.H{"id": u.ID, "login": u.Login, "name": u.Name, "avatarUrl": u.AvatarURL, "lastSeen": u.LastSeen,
+		"email": u.Email, "emailVerified": u.EmailVerifiedAt != nil}
 }
 
 // @Summary Получить профиль текущего пользователя
@@ -179,16 +379,19 @@ func (h *Handler) Me(c *gin.Context) {
 		return
 	}
 	u.Online = h.presence.IsOnline(u.ID)
-	c.JSON(200, sanitizeUser(u))
+	res := sanitizeUser(u)
+	res["presence"] = h.presenceOf(u, u.ID)
+	c.JSON(200, res)
 }
 
 type updateProfileReq struct {
 	Name      string `json:"name"`
 	AvatarURL string `json:"avatarUrl"`
+	Email     string `json:"email"`
 }
 
 // @Summary Обновить профиль пользователя
-// @Description Обновляет информацию профиля текущего пользователя
+// @Description Обновляет информацию профиля текущего пользователя. Новый email считается неподтвержденным, на него отправляется ссылка подтверждения
 // @Tags user
 // @Security BearerAuth
 // @Accept json
@@ -198,6 +401,7 @@ type updateProfileReq struct {
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /user/me [put]
 func (h *Handler) UpdateProfile(c *gin.Context) {
 	// [COPILOT-END]
@@ -214,10 +418,39 @@ func (h *Handler) UpdateProfile(c *gin.Context) {
 	if req.AvatarURL != "" {
 		updates["avatar_url"] = req.AvatarURL
 	}
+	var current models.User
+	if findErr := h.db.First(&current, uid(c)).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("UpdateProfile.FindUser", findErr, "not found", 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "User not found.")
+		return
+	}
+	emailChanged := false
+	if strings.TrimSpace(req.Email) != "" {
+		email, emailErr := normalizeEmail(req.Email)
+		if emailErr != nil {
+			apiErr := apiErrors.NewAPIError("UpdateProfile.ValidateEmail", emailErr, "invalid email", 400)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Invalid email address.")
+			return
+		}
+		if current.Email == nil || *current.Email != email {
+			updates["email"] = email
+			updates["email_verified_at"] = nil
+			emailChanged = true
+		}
+	}
 	if len(updates) == 0 {
 		c.JSON(200, gin.H{"ok": true})
 		return
 	}
+	if emailChanged {
+		var taken int64
+		h.db.Model(&models.User{}).Where("email = ? AND id <> ?", updates["email"], uid(c)).Count(&taken)
+		if taken > 0 {
+			apiErr := apiErrors.NewAPIError("UpdateProfile.EmailTaken", nil, "email in use", 409)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Email is already in use.")
+			return
+		}
+	}
 	if updateErr := h.db.Model(&models.User{}).Where("id = ?", uid(c)).Updates(updates).Error; updateErr != nil {
 		apiErr := apiErrors.NewAPIError("UpdateProfile.Updates", updateErr, "update failed", 400)
 		apiErrors.LogAndRespondAPI(c, apiErr, "Failed to update profile.")
@@ -229,5 +462,14 @@ func (h *Handler) UpdateProfile(c *gin.Context) {
 		apiErrors.LogAndRespondAPI(c, apiErr, "User not found after update.")
 		return
 	}
+	if emailChanged {
+		h.recordAudit(c, audit.ActionEmailChange, audit.TargetUser, u.ID, audit.Diff{}.Add("email", current.Email, u.Email))
+		// Ссылки, отправленные на прежний адрес, больше не действуют
+		h.db.Where("user_id = ? AND used_at IS NULL", u.ID).Delete(&models.EmailToken{})
+		if sendErr := h.sendVerification(u); sendErr != nil {
+			apiErr := apiErrors.NewAPIError("UpdateProfile.SendVerification", sendErr, "failed to send verification", 500)
+			log.Printf("[API] %v", apiErr)
+		}
+	}
 	c.JSON(200, sanitizeUser(u))
 }
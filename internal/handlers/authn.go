@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"LinkUp/internal/audit"
+	"LinkUp/internal/authn"
+	"LinkUp/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// identityUser возвращает локального пользователя для личности из цепочки
+// аутентификации. Для внешних источников пользователь создается при первом
+// входе, если это позволяет режим регистрации (иначе errProvisioningClosed),
+// а имя, email и роли по группам обновляются при каждом входе.
+func (h *Handler) identityUser(c *gin.Context, id *authn.Identity) (models.User, error) {
+	var u models.User
+	if id.UserID != 0 {
+		err := h.db.First(&u, id.UserID).Error
+		return u, err
+	}
+
+	var (
+		ident            models.ExternalIdentity
+		created          bool
+		granted, revoked []models.Role
+	)
+	now := time.Now()
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		findErr := tx.Where("issuer = ? AND subject = ?", id.Issuer, id.Subject).First(&ident).Error
+		switch {
+		case errors.Is(findErr, gorm.ErrRecordNotFound):
+			if !provisioningAllowed() {
+				return errProvisioningClosed
+			}
+			login, err := freeLogin(tx, loginBase(id.Login))
+			if err != nil {
+				return err
+			}
+			name := strings.TrimSpace(id.Name)
+			if name == "" {
+				name = login
+			}
+			u = models.User{Login: login, Name: truncate(name, 120)}
+			if err := tx.Create(&u).Error; err != nil {
+				return err
+			}
+			ident = models.ExternalIdentity{UserID: u.ID, Provider: id.Provider, Issuer: id.Issuer, Subject: id.Subject}
+			created = true
+		case findErr != nil:
+			return findErr
+		default:
+			if err := tx.First(&u, ident.UserID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := syncDirectoryProfile(tx, &u, id); err != nil {
+			return err
+		}
+		ident.Email = truncate(id.Email, 255)
+		ident.LastLoginAt = &now
+		if err := tx.Save(&ident).Error; err != nil {
+			return err
+		}
+		var err error
+		granted, revoked, err = syncDirectoryRoles(tx, u.ID, id)
+		return err
+	})
+	if err != nil {
+		return u, err
+	}
+
+	if created {
+		h.recordAuditAs(c, &u.ID, audit.ActionRegister, audit.TargetUser, u.ID,
+			audit.Diff{}.Add("login", nil, u.Login).Add("provider", nil, id.Provider))
+	}
+	for _, r := range granted {
+		h.recordAuditAs(c, nil, audit.ActionRoleAssign, audit.TargetUser, u.ID,
+			audit.Diff{}.Add("roleId", nil, r.ID).Add("source", nil, id.Provider))
+	}
+	for _, r := range revoked {
+		h.recordAuditAs(c, nil, audit.ActionRoleRevoke, audit.TargetUser, u.ID,
+			audit.Diff{}.Add("roleId", r.ID, nil).Add("source", nil, id.Provider))
+	}
+	return u, nil
+}
+
+// syncDirectoryProfile переносит имя и email из каталога. Адрес из каталога
+// считается подтвержденным; занятый другим пользователем адрес пропускается.
+func syncDirectoryProfile(tx *gorm.DB, u *models.User, id *authn.Identity) error {
+	updates := map[string]interface{}{}
+	if name := truncate(strings.TrimSpace(id.Name), 120); name != "" && name != u.Name {
+		updates["name"] = name
+	}
+	if email := truncate(id.Email, 255); email != "" && (u.Email == nil || *u.Email != email) {
+		var n int64
+		if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", email, u.ID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			updates["email"] = email
+			updates["email_verified_at"] = time.Now()
+		} else {
+			log.Printf("[API] directory email %q of user %d belongs to another account", email, u.ID)
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(u).Updates(updates).Error
+}
+
+// syncDirectoryRoles выдает глобальные роли из id.Roles и отзывает остальные
+// роли из id.ManagedRoles. Роли, не упомянутые в сопоставлении групп, и роли
+// в комнатах не трогаются.
+func syncDirectoryRoles(tx *gorm.DB, userID uint, id *authn.Identity) (granted, revoked []models.Role, err error) {
+	if len(id.ManagedRoles) == 0 {
+		return nil, nil, nil
+	}
+	var roles []models.Role
+	if err := tx.Where("name IN ?", id.ManagedRoles).Find(&roles).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(roles) < len(id.ManagedRoles) {
+		log.Printf("[API] some of directory roles %v do not exist", id.ManagedRoles)
+	}
+	want := map[string]bool{}
+	for _, name := range id.Roles {
+		want[name] = true
+	}
+	for _, r := range roles {
+		var ur models.UserRole
+		findErr := tx.Where("user_id = ? AND role_id = ? AND room_id IS NULL", userID, r.ID).First(&ur).Error
+		if findErr != nil && !errors.Is(findErr, gorm.ErrRecordNotFound) {
+			return nil, nil, findErr
+		}
+		has := findErr == nil
+		switch {
+		case want[r.Name] && !has:
+			// Уникальный индекс (user_id, role_id) допускает одну строку на
+			// роль, поэтому роль, выданную в комнате, нельзя выдать глобально.
+			// Проверяем заранее: в Postgres ошибка вставки прервала бы всю
+			// транзакцию входа
+			var scoped models.UserRole
+			if err := tx.Where("user_id = ? AND role_id = ?", userID, r.ID).Limit(1).Find(&scoped).Error; err != nil {
+				return nil, nil, err
+			}
+			if scoped.ID != 0 {
+				log.Printf("[API] directory role %q not granted to user %d: the user already has it in room %d", r.Name, userID, *scoped.RoomID)
+				continue
+			}
+			if err := tx.Create(&models.UserRole{UserID: userID, RoleID: r.ID}).Error; err != nil {
+				return nil, nil, err
+			}
+			granted = append(granted, r)
+		case !want[r.Name] && has:
+			if err := tx.Delete(&ur).Error; err != nil {
+				return nil, nil, err
+			}
+			revoked = append(revoked, r)
+		}
+	}
+	return granted, revoked, nil
+}
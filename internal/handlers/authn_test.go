@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"testing"
+
+	"LinkUp/internal/authn"
+	"LinkUp/internal/models"
+)
+
+func TestSyncDirectoryRoles(t *testing.T) {
+	db := testDB(t)
+	staff, ops := models.Role{Name: "staff"}, models.Role{Name: "ops"}
+	for _, r := range []*models.Role{&staff, &ops} {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	room := uint(5)
+	if err := db.Create(&models.UserRole{UserID: 1, RoleID: staff.ID, RoomID: &room}).Error; err != nil {
+		t.Fatal(err)
+	}
+	id := &authn.Identity{Roles: []string{"staff", "ops"}, ManagedRoles: []string{"staff", "ops"}}
+
+	// staff уже выдана в комнате: уникальный индекс не даст выдать ее
+	// глобально, и это не должно срывать вход
+	granted, revoked, err := syncDirectoryRoles(db, 1, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(granted) != 1 || granted[0].Name != "ops" || len(revoked) != 0 {
+		t.Fatalf("granted %v, revoked %v", granted, revoked)
+	}
+
+	// роль в комнате не считается глобальной и не отзывается каталогом
+	id.Roles = nil
+	granted, revoked, err = syncDirectoryRoles(db, 1, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(granted) != 0 || len(revoked) != 1 || revoked[0].Name != "ops" {
+		t.Fatalf("granted %v, revoked %v", granted, revoked)
+	}
+	var left []models.UserRole
+	db.Where("user_id = ?", 1).Find(&left)
+	if len(left) != 1 || left[0].RoleID != staff.ID || left[0].RoomID == nil {
+		t.Fatalf("roles left: %+v", left)
+	}
+}
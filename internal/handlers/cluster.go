@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"LinkUp/internal/broker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// presenceSyncInterval — как часто узел рассылает снимок своих пользователей.
+// Узел без снимка дольше трех интервалов считается упавшим.
+const presenceSyncInterval = 10 * time.Second
+
+// Виды сообщений между узлами
+const (
+	clusterRoom         = "room"          // событие комнаты
+	clusterUser         = "user"          // событие пользовательского канала
+	clusterPresence     = "presence"      // изменение комнат или соединений пользователя на узле
+	clusterPresenceSync = "presence_sync" // снимок пользователей узла
+	clusterRevoke       = "revoke"        // отписать пользователя от комнаты, доступ к которой он потерял
+	clusterStatus       = "status"        // пользователь изменил статус присутствия
+)
+
+// clusterEnvelope — сообщение, которое узел публикует в брокер.
+type clusterEnvelope struct {
+	Node string `json:"node"`
+	Kind string `json:"kind"`
+
+	RoomID uint   `json:"roomId,omitempty"`
+	UserID uint   `json:"userId,omitempty"`
+	Event  *Event `json:"event,omitempty"`
+	// SkipRoom — событие пользователя не отправляется соединениям, подписанным на эту комнату
+	SkipRoom uint `json:"skipRoom,omitempty"`
+
+	Online bool            `json:"online,omitempty"`
+	Rooms  []uint          `json:"rooms,omitempty"`
+	Users  map[uint][]uint `json:"users,omitempty"`
+	// Idle — все соединения пользователя на узле бездействуют; IdleUsers — такие пользователи в снимке
+	Idle      bool   `json:"idle,omitempty"`
+	IdleUsers []uint `json:"idleUsers,omitempty"`
+}
+
+// nodeID возвращает имя узла: NODE_ID или имя хоста со случайным суффиксом,
+// чтобы перезапущенный узел не принимал чужие сообщения за свои.
+func nodeID() string {
+	if id := os.Getenv("NODE_ID"); id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// attachBroker подключает узел к брокеру: локальные события комнат и
+// пользователей публикуются, а события других узлов доставляются локальным
+// клиентам.
+func (h *Handler) attachBroker(b broker.Broker) {
+	h.broker = b
+	h.rooms.relay = func(roomID uint, ev Event) {
+		h.publish(clusterEnvelope{Kind: clusterRoom, RoomID: roomID, Event: &ev})
+	}
+	h.rooms.remote = h.presence.remoteRoomUsers
+	h.rooms.changed = h.presenceChanged
+	h.users.relay = func(userID, skipRoom uint, ev Event) {
+		h.publish(clusterEnvelope{Kind: clusterUser, UserID: userID, SkipRoom: skipRoom, Event: &ev})
+	}
+	b.Subscribe(h.receive)
+	go h.syncPresence()
+}
+
+func (h *Handler) publish(env clusterEnvelope) {
+	env.Node = h.node
+	payload, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("[BROKER] encode %s: %v", env.Kind, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.broker.Publish(ctx, payload); err != nil {
+		log.Printf("[BROKER] publish %s: %v", env.Kind, err)
+	}
+}
+
+// receive обрабатывает сообщение другого узла. Свои сообщения пропускаются:
+// локальные клиенты получили событие напрямую.
+func (h *Handler) receive(payload []byte) {
+	var env clusterEnvelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		log.Printf("[BROKER] decode: %v", err)
+		return
+	}
+	if env.Node == h.node {
+		return
+	}
+	switch env.Kind {
+	case clusterRoom:
+		if env.Event != nil {
+			h.rooms.record(env.RoomID, *env.Event)
+			h.rooms.deliver(env.RoomID, *env.Event)
+		}
+	case clusterUser:
+		if env.Event != nil {
+			h.users.deliver(env.UserID, env.SkipRoom, *env.Event)
+		}
+	case clusterPresence:
+		joined, left, idleChanged := h.presence.setRemoteUser(env.Node, env.UserID, env.Rooms, env.Online, env.Idle)
+		if env.Online {
+			h.presence.loadStatus(env.UserID)
+		}
+		visible := h.presence.visible(env.UserID)
+		for _, id := range joined {
+			if visible {
+				h.rooms.deliver(id, Event{Type: "presence_join", Payload: gin.H{"userId": env.UserID}})
+			}
+			h.rooms.refreshPresence(id)
+		}
+		for _, id := range left {
+			if visible {
+				h.rooms.deliver(id, Event{Type: "presence_leave", Payload: gin.H{"userId": env.UserID}})
+			}
+			h.rooms.refreshPresence(id)
+		}
+		if idleChanged {
+			for _, id := range env.Rooms {
+				h.rooms.refreshPresence(id)
+			}
+		}
+	case clusterPresenceSync:
+		h.presence.setRemoteNode(env.Node, env.Users, env.IdleUsers)
+		for _, id := range h.presence.unknownStatuses() {
+			h.presence.loadStatus(id)
+		}
+	case clusterStatus:
+		h.presence.reloadStatus(env.UserID)
+		h.presenceUpdated(env.UserID)
+	case clusterRevoke:
+		h.revokeLocal(env.UserID, env.RoomID)
+	}
+}
+
+// presenceChanged публикует комнаты и наличие соединений пользователя на узле.
+func (h *Handler) presenceChanged(userID uint) {
+	h.publish(clusterEnvelope{
+		Kind:   clusterPresence,
+		UserID: userID,
+		Online: h.presence.isLocal(userID),
+		Idle:   h.presence.isIdle(userID),
+		Rooms:  h.userRooms(userID),
+	})
+}
+
+// userRooms возвращает комнаты, на которые подписаны соединения пользователя на узле.
+func (h *Handler) userRooms(userID uint) []uint {
+	set := map[uint]bool{}
+	for _, c := range h.users.of(userID) {
+		for _, id := range c.rooms() {
+			set[id] = true
+		}
+	}
+	return sortedIDs(set)
+}
+
+// syncPresence периодически рассылает снимок пользователей узла, чтобы другие
+// узлы исправили пропущенные дельты и забыли упавшие узлы.
+func (h *Handler) syncPresence() {
+	t := time.NewTicker(presenceSyncInterval)
+	defer t.Stop()
+	for range t.C {
+		users := map[uint][]uint{}
+		var idle []uint
+		for _, id := range h.presence.localUsers() {
+			users[id] = h.userRooms(id)
+			if h.presence.isIdle(id) {
+				idle = append(idle, id)
+			}
+		}
+		h.publish(clusterEnvelope{Kind: clusterPresenceSync, Users: users, IdleUsers: idle})
+		h.presence.prune()
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"LinkUp/internal/broker"
+	"LinkUp/internal/models"
+)
+
+// clusterNodes поднимает два узла над общей базой и общим брокером.
+func clusterNodes(t *testing.T) (*Handler, *Handler) {
+	t.Helper()
+	db := testDB(t)
+	bus := broker.NewMemory()
+	t.Cleanup(func() { bus.Close() })
+	nodes := make([]*Handler, 2)
+	for i := range nodes {
+		h := New(db, t.TempDir(), "http://x")
+		h.broker.Close()
+		h.attachBroker(bus)
+		t.Cleanup(h.rooms.Close)
+		nodes[i] = h
+	}
+	if nodes[0].node == nodes[1].node {
+		t.Fatal("nodes share an id")
+	}
+	return nodes[0], nodes[1]
+}
+
+func TestClusterRoomEvents(t *testing.T) {
+	a, b := clusterNodes(t)
+	// номера событий выдает общая база, поэтому комната должна в ней быть
+	if err := a.db.Create(&models.Room{Slug: "general", Name: "general", OwnerID: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	ca, cb := testClient(1, 64), testClient(2, 64)
+	a.rooms.join(1, ca)
+	b.rooms.join(1, cb)
+
+	a.rooms.Emit(1, Event{Type: "message", Payload: map[string]interface{}{"text": "from a"}})
+	b.rooms.Emit(1, Event{Type: "message", Payload: map[string]interface{}{"text": "from b"}})
+
+	// каждый клиент получает оба события по одному разу. Порядок между узлами
+	// не гарантирован: свое событие узел доставляет, не дожидаясь брокера
+	for _, c := range []*Client{ca, cb} {
+		var seqs []uint64
+		for len(seqs) < 2 {
+			select {
+			case f := <-c.send:
+				if f.ev.Type == "message" {
+					seqs = append(seqs, f.ev.Seq)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("client %d got %d of 2 events", c.userID, len(seqs))
+			}
+		}
+		if !(seqs[0] == 1 && seqs[1] == 2 || seqs[0] == 2 && seqs[1] == 1) {
+			t.Fatalf("client %d seqs = %v", c.userID, seqs)
+		}
+		select {
+		case f := <-c.send:
+			if f.ev.Type == "message" {
+				t.Fatalf("client %d got a duplicate: %+v", c.userID, f.ev)
+			}
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// Снимок присутствия занятого узла намного больше предела NOTIFY в Postgres;
+// другой узел должен получить его целиком.
+func TestClusterPresenceSnapshot(t *testing.T) {
+	a, b := clusterNodes(t)
+	users := map[uint][]uint{}
+	for id := uint(1); id <= 2000; id++ {
+		users[id] = []uint{1, id%7 + 2}
+	}
+	env := clusterEnvelope{Node: a.node, Kind: clusterPresenceSync, Users: users}
+	if payload, _ := json.Marshal(env); len(payload) < 8000 {
+		t.Fatalf("snapshot of %d bytes is too small for this test", len(payload))
+	}
+	a.publish(env)
+
+	waitFor(t, "snapshot on the other node", func() bool { return len(b.presence.remoteRoomUsers(1)) == len(users) })
+	if got := len(b.presence.remoteRoomUsers(3)); got != 286 {
+		t.Fatalf("room 3 users on b = %d", got)
+	}
+	if got := len(a.presence.remoteRoomUsers(1)); got != 0 {
+		t.Fatalf("node applied its own snapshot: %d users", got)
+	}
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"LinkUp/internal/audit"
+	"LinkUp/internal/auth"
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/mail"
+	"LinkUp/internal/models"
+	"LinkUp/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Назначение одноразовых токенов из писем
+const (
+	emailTokenVerify = "verify"
+	emailTokenReset  = "reset"
+)
+
+var (
+	errInvalidEmail      = errors.New("invalid email address")
+	errInvalidEmailToken = errors.New("invalid or expired token")
+)
+
+// normalizeEmail проверяет адрес и приводит его к нижнему регистру.
+// Адреса с отображаемым именем ("Bob <bob@x>") не принимаются.
+func normalizeEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	addr, err := netmail.ParseAddress(s)
+	if err != nil || addr.Address != s || len(s) > 255 {
+		return "", errInvalidEmail
+	}
+	return strings.ToLower(s), nil
+}
+
+// appURL — адрес клиентского приложения для ссылок в письмах (APP_URL).
+func appURL() string {
+	if u := strings.TrimSpace(os.Getenv("APP_URL")); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// issueEmailToken выпускает новый токен и гасит прежние неиспользованные
+// токены того же назначения, так что действует только последняя ссылка.
+func (h *Handler) issueEmailToken(userID uint, purpose, email string, ttl time.Duration) (string, error) {
+	tok, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Delete(&models.EmailToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			Email:     email,
+			TokenHash: utils.HashToken(tok),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	return tok, err
+}
+
+// consumeEmailToken атомарно помечает токен использованным и возвращает его.
+func consumeEmailToken(tx *gorm.DB, token, purpose string) (models.EmailToken, error) {
+	var et models.EmailToken
+	now := time.Now()
+	res := tx.Model(&models.EmailToken{}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(token), purpose, now).
+		Update("used_at", &now)
+	if res.Error != nil {
+		return et, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return et, errInvalidEmailToken
+	}
+	err := tx.Where("token_hash = ?", utils.HashToken(token)).First(&et).Error
+	return et, err
+}
+
+// formatTTL выводит срок действия ссылки для текста письма.
+func formatTTL(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d ч.", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%d мин.", int(d.Round(time.Minute)/time.Minute))
+}
+
+// sendMail отправляет письмо в фоне, чтобы время ответа не зависело от почтового
+// сервера и не выдавало, существует ли адрес.
+func (h *Handler) sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			log.Printf("mail: send to %s failed: %v", msg.To, err)
+		}
+	}()
+}
+
+// sendVerification отправляет ссылку подтверждения на текущий адрес пользователя.
+func (h *Handler) sendVerification(u models.User) error {
+	if u.Email == nil {
+		return errInvalidEmail
+	}
+	tok, err := h.issueEmailToken(u.ID, emailTokenVerify, *u.Email, auth.EmailVerifyTTL())
+	if err != nil {
+		return err
+	}
+	h.sendMail(mail.Message{
+		To:      *u.Email,
+		Subject: "Подтвердите email в LinkUp",
+		Text: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы подтвердить адрес, перейдите по ссылке:\n%s/verify-email?token=%s\n\n"+
+			"Ссылка действует %s. Если вы не указывали этот адрес в LinkUp, просто проигнорируйте письмо.\n",
+			u.Name, appURL(), tok, formatTTL(auth.EmailVerifyTTL())),
+	})
+	return nil
+}
+
+// @Summary Подтвердить email
+// @Description Принимает токен из письма и отмечает адрес подтвержденным
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body EmailTokenRequest true "Токен из письма"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /auth/email/verify [post]
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req EmailTokenRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("VerifyEmail.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+
+	var et models.EmailToken
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if et, err = consumeEmailToken(tx, req.Token, emailTokenVerify); err != nil {
+			return err
+		}
+		// Адрес могли сменить после отправки письма — тогда ссылка уже не подходит
+		res := tx.Model(&models.User{}).Where("id = ? AND email = ?", et.UserID, et.Email).
+			Update("email_verified_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return errInvalidEmailToken
+		}
+		return nil
+	})
+	if err != nil {
+		apiErr := apiErrors.NewAPIError("VerifyEmail.Consume", err, "verification failed", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid or expired verification link.")
+		return
+	}
+	h.recordAuditAs(c, nil, audit.ActionEmailVerify, audit.TargetUser, et.UserID, audit.Diff{}.Add("email", nil, et.Email))
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// @Summary Отправить письмо подтверждения повторно
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /auth/email/verify/resend [post]
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var u models.User
+	if findErr := h.db.First(&u, uid(c)).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("ResendVerification.FindUser", findErr, "not found", 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "User not found.")
+		return
+	}
+	if u.Email == nil {
+		apiErr := apiErrors.NewAPIError("ResendVerification.NoEmail", nil, "no email", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "No email address set.")
+		return
+	}
+	if u.EmailVerifiedAt != nil {
+		apiErr := apiErrors.NewAPIError("ResendVerification.Verified", nil, "already verified", 409)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Email is already verified.")
+		return
+	}
+	if sendErr := h.sendVerification(u); sendErr != nil {
+		apiErr := apiErrors.NewAPIError("ResendVerification.Send", sendErr, "failed to issue token", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// @Summary Запросить сброс пароля
+// @Description Отправляет ссылку сброса на подтвержденный email. Ответ одинаков независимо от того, найден ли адрес
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Email"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /auth/password/forgot [post]
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("ForgotPassword.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	email, emailErr := normalizeEmail(req.Email)
+	if emailErr != nil {
+		apiErr := apiErrors.NewAPIError("ForgotPassword.Validate", emailErr, "invalid email", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid email address.")
+		return
+	}
+
+	var u models.User
+	if h.db.Where("email = ? AND email_verified_at IS NOT NULL", email).First(&u).Error == nil {
+		tok, tokErr := h.issueEmailToken(u.ID, emailTokenReset, email, auth.PasswordResetTTL())
+		if tokErr != nil {
+			apiErr := apiErrors.NewAPIError("ForgotPassword.IssueToken", tokErr, "failed to issue token", 500)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+			return
+		}
+		h.sendMail(mail.Message{
+			To:      email,
+			Subject: "Сброс пароля LinkUp",
+			Text: fmt.Sprintf("Здравствуйте, %s!\n\nКто-то запросил сброс пароля для аккаунта %s. Чтобы задать новый пароль, перейдите по ссылке:\n"+
+				"%s/reset-password?token=%s\n\nСсылка одноразовая и действует %s. После сброса все активные сессии будут завершены, а персональные токены отозваны.\n"+
+				"Если вы не запрашивали сброс, просто проигнорируйте письмо.\n",
+				u.Name, u.Login, appURL(), tok, formatTTL(auth.PasswordResetTTL())),
+		})
+	}
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// @Summary Сбросить пароль
+// @Description Задает новый пароль по одноразовому токену из письма, завершает все сессии пользователя и отзывает его персональные токены. Новый пароль проверяется парольной политикой
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Токен и новый пароль"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /auth/password/reset [post]
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("ResetPassword.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+
+	var (
+		et        models.EmailToken
+		policyErr error
+	)
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if et, err = consumeEmailToken(tx, req.Token, emailTokenReset); err != nil {
+			return err
+		}
+		var u models.User
+		if err := tx.First(&u, et.UserID).Error; err != nil {
+			return err
+		}
+		// Отказ политики откатывает транзакцию: ссылка остается действительной
+		if policyErr = h.passwords.Validate(req.Password, u.Login); policyErr != nil {
+			return policyErr
+		}
+		hash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&u).Update("password", hash).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", et.UserID, emailTokenReset).
+			Delete(&models.EmailToken{}).Error; err != nil {
+			return err
+		}
+		// Сброс пароля может означать, что аккаунт был захвачен: доступ
+		// теряют все сессии, персональные токены и выданные по ним билеты
+		now := time.Now()
+		if err := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", u.ID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PersonalAccessToken{}).Where("user_id = ? AND revoked_at IS NULL", u.ID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", u.ID).Delete(&models.WSTicket{}).Error
+	})
+	if policyErr != nil {
+		apiErr := apiErrors.NewAPIError("ResetPassword.PasswordPolicy", policyErr, "weak password", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Password rejected: "+policyErr.Error()+".")
+		return
+	}
+	if err != nil {
+		apiErr := apiErrors.NewAPIError("ResetPassword.Consume", err, "reset failed", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid or expired reset link.")
+		return
+	}
+	h.recordAuditAs(c, nil, audit.ActionPasswordReset, audit.TargetUser, et.UserID, nil)
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
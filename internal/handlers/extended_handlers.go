@@ -1,15 +1,20 @@
 package handlers
 
 import (
-	"fmt"
+	"crypto/subtle"
+	"encoding/base64"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
+	"LinkUp/internal/audit"
+	"LinkUp/internal/auth"
 	"LinkUp/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ==================== РОЛИ И РАЗРЕШЕНИЯ ====================
@@ -64,6 +69,8 @@ func (h *Handler) CreateRole(c *gin.Context) {
 		c.JSON(http.StatusConflict, ErrorResponse{Error: "Role already exists"})
 		return
 	}
+	h.recordAudit(c, audit.ActionRoleCreate, audit.TargetRole, role.ID,
+		audit.Diff{}.Add("name", nil, role.Name).Add("permissions", nil, role.Permissions))
 
 	c.JSON(http.StatusCreated, role)
 }
@@ -109,6 +116,14 @@ func (h *Handler) AssignRole(c *gin.Context) {
 		c.JSON(http.StatusConflict, ErrorResponse{Error: "Role assignment failed"})
 		return
 	}
+	diff := audit.Diff{}.Add("roleId", nil, req.RoleID)
+	if req.RoomID != nil {
+		diff.Add("roomId", nil, *req.RoomID)
+	}
+	if req.ExpiresAt != nil {
+		diff.Add("expiresAt", nil, *req.ExpiresAt)
+	}
+	h.recordAudit(c, audit.ActionRoleAssign, audit.TargetUser, req.UserID, diff)
 
 	c.JSON(http.StatusOK, SuccessResponse{OK: true})
 }
@@ -116,38 +131,68 @@ func (h *Handler) AssignRole(c *gin.Context) {
 // ==================== ДВУХФАКТОРНАЯ АУТЕНТИФИКАЦИЯ ====================
 
 // @Summary Настроить 2FA
-// @Description Настраивает двухфакторную аутентификацию для пользователя
+// @Description Генерирует новый TOTP-секрет и QR-код. 2FA включается только после подтверждения кодом
 // @Tags auth
 // @Security BearerAuth
 // @Accept json
 // @Produce json
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} Setup2FAResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /auth/2fa/setup [post]
 func (h *Handler) Setup2FA(c *gin.Context) {
 	userID := uid(c)
-	
-	// Генерируем секрет для 2FA
-	secret := generateSecret()
-	backupCodes := generateBackupCodes()
 
-	twoFA := models.TwoFactorAuth{
-		UserID:      userID,
-		Secret:      secret,
-		Enabled:     false,
-		BackupCodes: backupCodes,
+	var u models.User
+	if err := h.db.First(&u, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
 	}
 
-	if err := h.db.Create(&twoFA).Error; err != nil {
+	var twoFA models.TwoFactorAuth
+	if err := h.db.Where("user_id = ?", userID).First(&twoFA).Error; err == nil && twoFA.Enabled {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "2FA already enabled"})
+		return
+	}
+
+	// Генерируем секрет для 2FA
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to setup 2FA"})
+		return
+	}
+	// Резервные коды показываются один раз, в базе хранятся только хэши
+	backupCodes, backupHashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to setup 2FA"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"secret":      secret,
-		"backupCodes": backupCodes,
-		"qrCode":      generateQRCode(secret, fmt.Sprintf("%d", userID)),
+	// Повторная настройка до подтверждения перезаписывает неподтвержденный секрет
+	twoFA.UserID = userID
+	twoFA.Secret = secret
+	twoFA.Enabled = false
+	twoFA.BackupCodes = backupHashes
+	twoFA.LastUsed = nil
+
+	if err := h.db.Save(&twoFA).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to setup 2FA"})
+		return
+	}
+
+	uri := auth.TOTPURI(secret, u.Login)
+	qr, err := generateQRCode(uri)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate QR code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Setup2FAResponse{
+		Secret:      secret,
+		BackupCodes: backupCodes,
+		OTPAuthURL:  uri,
+		QRCode:      qr,
 	})
 }
 
@@ -157,18 +202,16 @@ func (h *Handler) Setup2FA(c *gin.Context) {
 // @Security BearerAuth
 // @Accept json
 // @Produce json
-// @Param code body map[string]string true "Код подтверждения"
+// @Param code body Verify2FARequest true "Код подтверждения"
 // @Success 200 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Router /auth/2fa/verify [post]
 func (h *Handler) Verify2FA(c *gin.Context) {
 	userID := uid(c)
-	
-	var req struct {
-		Code string `json:"code" binding:"required"`
-	}
 
+	var req Verify2FARequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
@@ -180,23 +223,184 @@ func (h *Handler) Verify2FA(c *gin.Context) {
 		return
 	}
 
-	if !verifyTOTPCode(twoFA.Secret, req.Code) {
+	if !h.checkTOTP(&twoFA, req.Code) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid code"})
 		return
 	}
 
-	twoFA.Enabled = true
-	twoFA.LastUsed = &time.Time{}
-	*twoFA.LastUsed = time.Now()
-
-	if err := h.db.Save(&twoFA).Error; err != nil {
+	if err := h.db.Model(&twoFA).Update("enabled", true).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to enable 2FA"})
 		return
 	}
+	h.recordAudit(c, audit.Action2FAEnable, audit.TargetUser, userID, nil)
+
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// @Summary Отключить 2FA
+// @Description Отключает двухфакторную аутентификацию. Требует действующий TOTP-код
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param code body Verify2FARequest true "Код подтверждения"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/2fa/disable [post]
+func (h *Handler) Disable2FA(c *gin.Context) {
+	userID := uid(c)
+
+	var req Verify2FARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	var twoFA models.TwoFactorAuth
+	if err := h.db.Where("user_id = ? AND enabled = ?", userID, true).First(&twoFA).Error; err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "2FA not enabled"})
+		return
+	}
+
+	if !h.checkTOTP(&twoFA, req.Code) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid code"})
+		return
+	}
+
+	if err := h.db.Delete(&twoFA).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to disable 2FA"})
+		return
+	}
+	h.recordAudit(c, audit.Action2FADisable, audit.TargetUser, userID, nil)
 
 	c.JSON(http.StatusOK, SuccessResponse{OK: true})
 }
 
+// @Summary Второй шаг входа с 2FA
+// @Description Обменивает challenge-токен из /login и TOTP-код (или одноразовый резервный код) на JWT. Challenge-токен одноразовый: после успешного входа он больше не принимается ни здесь, ни в /auth/2fa/webauthn
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body Login2FARequest true "Challenge-токен и код"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /auth/2fa/login [post]
+func (h *Handler) Login2FA(c *gin.Context) {
+	var req Login2FARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	challenge, err := auth.ParseChallengeToken(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired challenge"})
+		return
+	}
+	userID := challenge.UserID
+
+	var u models.User
+	if err := h.db.First(&u, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired challenge"})
+		return
+	}
+
+	var twoFA models.TwoFactorAuth
+	if err := h.db.Where("user_id = ? AND enabled = ?", userID, true).First(&twoFA).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired challenge"})
+		return
+	}
+
+	if h.checkLockout(c, "Login2FA", u.Login, &u.ID) {
+		return
+	}
+
+	if !h.checkTOTP(&twoFA, req.Code) && !h.useRecoveryCode(&twoFA, req.Code) {
+		if h.loginFailed(c, "Login2FA", u.Login, &u.ID, attemptBad2FA) {
+			return
+		}
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid code"})
+		return
+	}
+	if !h.consumeChallenge(c, "Login2FA", challenge) {
+		return
+	}
+
+	h.completeLogin(c, "Login2FA", u)
+}
+
+// @Summary Перевыпустить резервные коды
+// @Description Генерирует новый набор одноразовых резервных кодов. Старые коды перестают действовать. Требует действующий TOTP-код
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param code body Verify2FARequest true "Код подтверждения"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/2fa/recovery-codes [post]
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := uid(c)
+
+	var req Verify2FARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	var twoFA models.TwoFactorAuth
+	if err := h.db.Where("user_id = ? AND enabled = ?", userID, true).First(&twoFA).Error; err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "2FA not enabled"})
+		return
+	}
+
+	if !h.checkTOTP(&twoFA, req.Code) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate recovery codes"})
+		return
+	}
+	twoFA.BackupCodes = hashes
+	if err := h.db.Model(&twoFA).Select("BackupCodes").Updates(&twoFA).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save recovery codes"})
+		return
+	}
+	h.recordAudit(c, audit.ActionRecoveryCodes, audit.TargetUser, userID, nil)
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{Codes: codes})
+}
+
+// @Summary Количество оставшихся резервных кодов
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} RecoveryCodesStatusResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/2fa/recovery-codes [get]
+func (h *Handler) RecoveryCodesStatus(c *gin.Context) {
+	var twoFA models.TwoFactorAuth
+	if err := h.db.Where("user_id = ? AND enabled = ?", uid(c), true).First(&twoFA).Error; err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "2FA not enabled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesStatusResponse{
+		Remaining: len(twoFA.BackupCodes),
+		Total:     auth.RecoveryCodeCount,
+	})
+}
+
 // ==================== АНАЛИТИКА ====================
 
 // @Summary Получить аналитику пользователя
@@ -381,6 +585,14 @@ func (h *Handler) VotePoll(c *gin.Context) {
 		return
 	}
 
+	if _, restricted := auth.TokenRoom(c); restricted {
+		var msg models.Message
+		if err := h.db.First(&msg, poll.MessageID).Error; err != nil || !roomAllowed(c, msg.RoomID) {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Token is restricted to another room"})
+			return
+		}
+	}
+
 	// Проверяем, не истек ли опрос
 	if poll.ExpiresAt != nil && poll.ExpiresAt.Before(time.Now()) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Poll has expired"})
@@ -578,29 +790,60 @@ func (h *Handler) hasPermission(c *gin.Context, permission string) bool {
 	return false
 }
 
-// generateSecret генерирует секрет для 2FA
-func generateSecret() string {
-	return fmt.Sprintf("%016d", time.Now().UnixNano()%10000000000000000)
-}
-
-// generateBackupCodes генерирует резервные коды для 2FA
-func generateBackupCodes() []string {
-	codes := make([]string, 10)
-	for i := range codes {
-		codes[i] = fmt.Sprintf("%08d", i*1000000+i*100000+i*10000+i*1000+i*100+i*10+i)
-	}
-	return codes
+// checkTOTP проверяет код и атомарно сдвигает LastUsed, чтобы один и тот же
+// код нельзя было принять дважды даже при параллельных запросах.
+func (h *Handler) checkTOTP(twoFA *models.TwoFactorAuth, code string) bool {
+	step, ok := auth.ValidateTOTP(twoFA.Secret, code, time.Now(), twoFA.LastUsed)
+	if !ok {
+		return false
+	}
+	res := h.db.Model(&models.TwoFactorAuth{}).
+		Where("id = ? AND (last_used IS NULL OR last_used < ?)", twoFA.ID, step).
+		Update("last_used", step)
+	if res.Error != nil || res.RowsAffected != 1 {
+		return false
+	}
+	twoFA.LastUsed = &step
+	return true
 }
 
-// generateQRCode генерирует QR код для 2FA
-func generateQRCode(secret, userID string) string {
-	// В реальном приложении здесь будет генерация QR кода
-	return fmt.Sprintf("otpauth://totp/LinkUp:%s?secret=%s&issuer=LinkUp", userID, secret)
+// useRecoveryCode сжигает резервный код, если он есть среди неиспользованных.
+// Строка блокируется на время транзакции, поэтому один код нельзя
+// использовать дважды параллельными запросами.
+func (h *Handler) useRecoveryCode(twoFA *models.TwoFactorAuth, code string) bool {
+	hash := auth.HashRecoveryCode(code)
+	used := false
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var cur models.TwoFactorAuth
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&cur, twoFA.ID).Error; err != nil {
+			return err
+		}
+		remaining := make([]string, 0, len(cur.BackupCodes))
+		for _, stored := range cur.BackupCodes {
+			if !used && subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+				used = true
+				continue
+			}
+			remaining = append(remaining, stored)
+		}
+		if !used {
+			return nil
+		}
+		cur.BackupCodes = remaining
+		if err := tx.Model(&cur).Select("BackupCodes").Updates(&cur).Error; err != nil {
+			return err
+		}
+		twoFA.BackupCodes = remaining
+		return nil
+	})
+	return err == nil && used
 }
 
-// verifyTOTPCode проверяет TOTP код
-func verifyTOTPCode(secret, code string) bool {
-	// В реальном приложении здесь будет проверка TOTP кода
-	// Для демонстрации принимаем любой код длиной 6 цифр
-	return len(code) == 6 && strings.ContainsAny(code, "0123456789")
+// generateQRCode кодирует otpauth URI в PNG и возвращает его как data URI
+func generateQRCode(uri string) (string, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
 }
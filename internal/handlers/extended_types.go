@@ -1,6 +1,10 @@
 package handlers
 
-import "time"
+import (
+	"time"
+
+	"LinkUp/internal/webauthn"
+)
 
 // ==================== РОЛИ И РАЗРЕШЕНИЯ ====================
 
@@ -24,9 +28,10 @@ type AssignRoleRequest struct {
 
 // Setup2FAResponse представляет ответ при настройке 2FA
 type Setup2FAResponse struct {
-	Secret      string   `json:"secret" example:"ABCD1234EFGH5678"`
-	BackupCodes []string `json:"backupCodes" example:"[\"12345678\", \"87654321\"]"`
-	QRCode      string   `json:"qrCode" example:"otpauth://totp/LinkUp:1?secret=ABCD1234EFGH5678&issuer=LinkUp"`
+	Secret      string   `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	BackupCodes []string `json:"backupCodes" example:"[\"K7QXM-2PD4A\", \"ZR5TB-NW3HE\"]"`
+	OTPAuthURL  string   `json:"otpauthUrl" example:"otpauth://totp/LinkUp:john_doe?issuer=LinkUp&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	QRCode      string   `json:"qrCode" example:"data:image/png;base64,iVBORw0KGgo..."`
 }
 
 // Verify2FARequest представляет запрос для подтверждения 2FA
@@ -34,6 +39,86 @@ type Verify2FARequest struct {
 	Code string `json:"code" binding:"required" example:"123456"`
 }
 
+// Login2FARequest представляет второй шаг входа для пользователя с 2FA
+type Login2FARequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Code           string `json:"code" binding:"required" example:"123456"` // TOTP-код или резервный код
+}
+
+// RecoveryCodesResponse содержит новые резервные коды. Они показываются только один раз
+type RecoveryCodesResponse struct {
+	Codes []string `json:"codes" example:"[\"K7QXM-2PD4A\", \"ZR5TB-NW3HE\"]"`
+}
+
+// RecoveryCodesStatusResponse показывает, сколько резервных кодов еще не использовано
+type RecoveryCodesStatusResponse struct {
+	Remaining int `json:"remaining" example:"8"`
+	Total     int `json:"total" example:"10"`
+}
+
+// TwoFactorChallengeResponse возвращается /login, если у пользователя включена 2FA
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired" example:"true"`
+	ChallengeToken    string `json:"challengeToken" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresIn         int    `json:"expiresIn" example:"300"`
+	// Methods — доступные способы подтверждения: totp (/auth/2fa/login) и webauthn (/auth/2fa/webauthn/*)
+	Methods []string `json:"methods" example:"totp,webauthn"`
+}
+
+// ==================== PASSKEYS (WEBAUTHN) ====================
+
+// WebAuthnCreationResponse содержит параметры для navigator.credentials.create()
+type WebAuthnCreationResponse struct {
+	PublicKey *webauthn.CreationOptions `json:"publicKey"`
+}
+
+// WebAuthnRequestResponse содержит параметры для navigator.credentials.get()
+type WebAuthnRequestResponse struct {
+	PublicKey *webauthn.RequestOptions `json:"publicKey"`
+}
+
+// PasskeyRegisterRequest представляет ответ аутентификатора при регистрации ключа
+type PasskeyRegisterRequest struct {
+	Name       string                        `json:"name" example:"MacBook Touch ID"`
+	Credential webauthn.RegistrationResponse `json:"credential" binding:"required"`
+}
+
+// RenamePasskeyRequest представляет запрос на переименование ключа
+type RenamePasskeyRequest struct {
+	Name string `json:"name" binding:"required" example:"YubiKey 5C"`
+}
+
+// PasskeyLoginBeginRequest представляет начало входа по ключу. Логин необязателен
+type PasskeyLoginBeginRequest struct {
+	Login string `json:"login" example:"john_doe"`
+}
+
+// PasskeyLoginRequest представляет ответ аутентификатора при входе без пароля
+type PasskeyLoginRequest struct {
+	Credential webauthn.AssertionResponse `json:"credential" binding:"required"`
+}
+
+// Passkey2FABeginRequest представляет начало проверки второго фактора ключом
+type Passkey2FABeginRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+// Passkey2FARequest представляет второй шаг входа, подтвержденный ключом
+type Passkey2FARequest struct {
+	ChallengeToken string                     `json:"challengeToken" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Credential     webauthn.AssertionResponse `json:"credential" binding:"required"`
+}
+
+// PasskeyResponse представляет зарегистрированный ключ
+type PasskeyResponse struct {
+	ID             uint       `json:"id" example:"4"`
+	Name           string     `json:"name" example:"MacBook Touch ID"`
+	CreatedAt      time.Time  `json:"createdAt" example:"2024-01-15T10:30:00Z"`
+	LastUsedAt     *time.Time `json:"lastUsedAt" example:"2024-01-16T08:00:00Z"`
+	Transports     []string   `json:"transports" example:"internal,hybrid"`
+	BackupEligible bool       `json:"backupEligible" example:"true"`
+}
+
 // ==================== АНАЛИТИКА ====================
 
 // AnalyticsResponse представляет ответ с аналитикой пользователя
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Резервные транспорты для клиентов, у которых прокси не пропускает
+// WebSocket. Server-Sent Events (/rooms/:id/events) и long-poll
+// (/rooms/:id/events/poll) подключают к хабу комнаты такой же Client, как
+// /ws/rooms/:id, только без соединения: события приходят те же и в том же
+// JSON, а отправка идет через REST. Курсор — Last-Event-ID, это seq последнего
+// полученного события (0 — до первого события комнаты); по нему сессия
+// возобновляется из журнала комнаты так же, как по lastSeq, или приходит
+// resync_required.
+
+// fallbackQueue — длина очереди клиентов SSE и long-poll: в нее помещается
+// весь журнал комнаты, чтобы возобновление после долгого перерыва не
+// заканчивалось resync_required только из-за размера очереди.
+func (h *Handler) fallbackQueue() int {
+	return max(h.ws.SendBuffer, h.rooms.logSize) + 1
+}
+
+// fallbackClient проверяет доступ к комнате и читает курсор запроса. Без
+// курсора клиент начинает с последнего события комнаты. false — ответ уже
+// отправлен.
+func (h *Handler) fallbackClient(c *gin.Context) (*Client, uint64, bool) {
+	rid, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		respondErr(c, 400, "invalid room id")
+		return nil, 0, false
+	}
+	roomID := uint(rid)
+	if code, msg := h.roomAccess(roomID, uid(c)); msg != "" {
+		respondErr(c, code, msg)
+		return nil, 0, false
+	}
+	cursor := c.GetHeader("Last-Event-ID")
+	if cursor == "" {
+		cursor = c.Query("lastEventId")
+	}
+	var lastSeq uint64
+	if cursor != "" {
+		if lastSeq, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			respondErr(c, 400, "invalid Last-Event-ID")
+			return nil, 0, false
+		}
+	} else {
+		lastSeq = h.rooms.head(roomID)
+	}
+	cl := &Client{
+		send:    make(chan *wsFrame, h.fallbackQueue()),
+		codec:   jsonCodec,
+		userID:  uid(c),
+		handler: h,
+		room:    roomID,
+		// Писать в комнату через этот клиент нельзя: кадров от него нет
+		readOnly: true,
+	}
+	return cl, lastSeq, true
+}
+
+// eventID возвращает курсор клиента после события: seq события, номер, с
+// которого продолжать после resync_required, или 0, если событие курсор не
+// меняет (typing, presence_*).
+func eventID(ev Event) uint64 {
+	if p, ok := ev.Payload.(resyncPayload); ok {
+		return p.Seq
+	}
+	return ev.Seq
+}
+
+// writeSSE пишет событие SSE. id != 0 обновляет Last-Event-ID клиента; поле
+// event не задается, поэтому все события приходят в onmessage, а тип — в data.
+func writeSSE(w io.Writer, id uint64, data []byte) error {
+	msg := make([]byte, 0, len(data)+32)
+	if id != 0 {
+		msg = fmt.Appendf(msg, "id: %d\n", id)
+	}
+	msg = append(msg, "data: "...)
+	msg = append(msg, data...)
+	msg = append(msg, "\n\n"...)
+	_, err := w.Write(msg)
+	return err
+}
+
+// @Summary События комнаты (Server-Sent Events)
+// @Description Поток text/event-stream с теми же событиями комнаты и в том же JSON, что и /ws/rooms/{id}, для клиентов, у которых прокси не пропускает WebSocket. Тип события — поле type в data; id события — его seq, у typing и presence_* id нет. Первым приходит пустое событие с id — текущим курсором, поэтому EventSource при переподключении всегда передает Last-Event-ID, и сервер досылает пропущенные события из журнала комнаты или присылает resync_required (после него историю нужно перечитать через REST; id этого события — номер, с которого поток продолжается). Курсор можно передать и параметром lastEventId. Каждые WS_PING_INTERVAL приходит комментарий-heartbeat. Соединение считается подключением пользователя к комнате для присутствия. Отправка сообщений — через POST /rooms/{id}/messages
+// @Tags websocket
+// @Security BearerAuth
+// @Produce text/event-stream
+// @Param id path string true "ID комнаты"
+// @Param Last-Event-ID header string false "seq последнего полученного события"
+// @Param lastEventId query string false "То же, что Last-Event-ID"
+// @Success 200 {string} string "Поток событий"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /rooms/{id}/events [get]
+func (h *Handler) RoomEventStream(c *gin.Context) {
+	cl, cursor, ok := h.fallbackClient(c)
+	if !ok {
+		return
+	}
+	w := c.Writer
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Не буферизовать поток в nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Как у соединения /ws/rooms/:id: клиент подключен к комнате для присутствия
+	h.presence.Online(cl)
+	h.users.add(cl)
+	h.rooms.resumeFrom(cl.room, cl, cursor)
+	defer cl.disconnect()
+	ticker := time.NewTicker(h.ws.PingInterval)
+	defer ticker.Stop()
+	write := func(msg func() error) bool {
+		rc.SetWriteDeadline(time.Now().Add(h.ws.WriteTimeout))
+		if err := msg(); err != nil {
+			wsStats.countWriteError(err)
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	if !write(func() error {
+		_, err := fmt.Fprintf(w, "id: %d\n\n", cursor)
+		return err
+	}) {
+		return
+	}
+	for {
+		select {
+		case f, ok := <-cl.send:
+			// Очередь закрыта: клиент не успевал читать или сервер
+			// останавливается. EventSource переподключится с Last-Event-ID.
+			if !ok {
+				return
+			}
+			data, err := f.encoded(jsonCodec)
+			if err != nil {
+				log.Printf("sse: encode %s: %v", f.ev.Type, err)
+				continue
+			}
+			if !write(func() error { return writeSSE(w, eventID(f.ev), data) }) {
+				return
+			}
+		case <-ticker.C:
+			if !write(func() error {
+				_, err := io.WriteString(w, ": ping\n\n")
+				return err
+			}) {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// @Summary События комнаты (long-poll)
+// @Description Резервный транспорт для клиентов без WebSocket и SSE. Возвращает события комнаты после курсора lastEventId (или заголовка Last-Event-ID) — те же, что и /ws/rooms/{id}, — сразу, если они есть в журнале комнаты, или ждет новых до LONGPOLL_TIMEOUT (по умолчанию 25 с) и отвечает пустым списком. Следующий запрос передает lastEventId из ответа. Без курсора ожидание начинается с последнего события комнаты. Если разрыв больше журнала, в events приходит resync_required: историю нужно перечитать через REST. typing и presence_* приходят, только если произошли во время ожидания; сам опрос на присутствие не влияет. Отправка сообщений — через POST /rooms/{id}/messages
+// @Tags websocket
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID комнаты"
+// @Param lastEventId query string false "seq последнего полученного события"
+// @Param Last-Event-ID header string false "То же, что lastEventId"
+// @Success 200 {object} RoomEventsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /rooms/{id}/events/poll [get]
+func (h *Handler) PollRoomEvents(c *gin.Context) {
+	cl, cursor, ok := h.fallbackClient(c)
+	if !ok {
+		return
+	}
+	cl.quiet = true
+	h.rooms.resumeFrom(cl.room, cl, cursor)
+	defer func() {
+		h.rooms.leave(cl.room, cl)
+		cl.closeSend()
+	}()
+
+	res := RoomEventsResponse{Events: []Event{}, LastEventID: cursor}
+	add := func(f *wsFrame) {
+		res.Events = append(res.Events, f.ev)
+		if id := eventID(f.ev); id != 0 {
+			res.LastEventID = id
+		}
+	}
+	timer := time.NewTimer(h.ws.PollTimeout)
+	defer timer.Stop()
+	select {
+	case f, ok := <-cl.send:
+		if ok {
+			add(f)
+		}
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+		return
+	}
+	// Остальное, что уже в очереди, уходит тем же ответом
+	for drained := len(res.Events) == 0; !drained; {
+		select {
+		case f, ok := <-cl.send:
+			if ok {
+				add(f)
+			} else {
+				drained = true
+			}
+		default:
+			drained = true
+		}
+	}
+	c.JSON(200, res)
+}
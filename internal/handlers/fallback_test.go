@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"LinkUp/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fallbackRouter поднимает резервные транспорты комнаты 1, в которой уже
+// есть события 1..3. Запросы идут от пользователя 1.
+func fallbackRouter(t *testing.T) (*gin.Engine, *Handler) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := testDB(t)
+	h := New(db, t.TempDir(), "http://x")
+	t.Cleanup(h.rooms.Close)
+	h.ws.PollTimeout = 50 * time.Millisecond
+	if err := db.Create(&models.Room{Slug: "general", Name: "general", OwnerID: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Room{Slug: "secret", Name: "secret", OwnerID: 2, IsPrivate: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		h.rooms.Emit(1, Event{Type: "message", Payload: gin.H{"text": "old"}})
+	}
+
+	r := gin.New()
+	g := r.Group("", func(c *gin.Context) { c.Set("userID", uint(1)) })
+	g.GET("/rooms/:id/events", h.RoomEventStream)
+	g.GET("/rooms/:id/events/poll", h.PollRoomEvents)
+	return r, h
+}
+
+func poll(t *testing.T, r http.Handler, query string) (int, RoomEventsResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/rooms/1/events/poll"+query, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var res RoomEventsResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, res
+}
+
+func TestPollRoomEvents(t *testing.T) {
+	r, h := fallbackRouter(t)
+
+	code, res := poll(t, r, "?lastEventId=1")
+	if code != http.StatusOK || res.LastEventID != 3 || len(res.Events) != 2 || res.Events[0].Seq != 2 || res.Events[1].Seq != 3 {
+		t.Fatalf("resume: %d %+v", code, res)
+	}
+	// новых событий нет: пустой ответ по таймауту с тем же курсором
+	if _, res := poll(t, r, "?lastEventId=3"); len(res.Events) != 0 || res.LastEventID != 3 {
+		t.Fatalf("timeout: %+v", res)
+	}
+	// без курсора ожидание начинается с последнего события
+	h.ws.PollTimeout = 2 * time.Second
+	pollers := func() int {
+		for _, st := range h.rooms.Stats() {
+			if st.RoomID == 1 {
+				return st.Clients
+			}
+		}
+		return 0
+	}
+	waitFor(t, "previous polls to leave", func() bool { return pollers() == 0 })
+	live := make(chan RoomEventsResponse, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/rooms/1/events/poll", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var res RoomEventsResponse
+		json.Unmarshal(w.Body.Bytes(), &res)
+		live <- res
+	}()
+	waitFor(t, "poll to wait", func() bool { return pollers() == 1 })
+	h.rooms.Emit(1, Event{Type: "message", Payload: gin.H{"text": "new"}})
+	if res := <-live; len(res.Events) != 1 || res.Events[0].Seq != 4 || res.LastEventID != 4 {
+		t.Fatalf("live: %+v", res)
+	}
+
+	// курсор, которого сервер не знает: resync_required, и курсор ответа —
+	// номер, с которого продолжать
+	_, res = poll(t, r, "?lastEventId=99")
+	if len(res.Events) != 1 || res.Events[0].Type != "resync_required" || res.LastEventID != 4 {
+		t.Fatalf("resync: %+v", res)
+	}
+	if p, ok := res.Events[0].Payload.(map[string]interface{}); !ok || p["lastSeq"] != float64(99) || p["seq"] != float64(4) {
+		t.Fatalf("resync payload: %#v", res.Events[0].Payload)
+	}
+
+	if code, _ := poll(t, r, "?lastEventId=x"); code != http.StatusBadRequest {
+		t.Fatalf("bad cursor: %d", code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/rooms/2/events/poll", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("private room: %d", w.Code)
+	}
+}
+
+// sseStream читает события text/event-stream: каждое — строки до пустой.
+type sseStream struct {
+	t  *testing.T
+	sc *bufio.Scanner
+}
+
+func openSSE(t *testing.T, url, lastEventID string) *sseStream {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return &sseStream{t: t, sc: bufio.NewScanner(resp.Body)}
+}
+
+// next возвращает id и data очередного события; комментарии пропускает.
+func (s *sseStream) next() (id string, ev Event) {
+	s.t.Helper()
+	lines := []string{}
+	for s.sc.Scan() {
+		line := s.sc.Text()
+		if line == "" {
+			if len(lines) > 0 {
+				break
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = line[len("id: "):]
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(line[len("data: "):]), &ev); err != nil {
+				s.t.Fatalf("data %q: %v", line, err)
+			}
+		default:
+			s.t.Fatalf("unexpected line %q", line)
+		}
+	}
+	return id, ev
+}
+
+// nextRoomEvent пропускает события присутствия.
+func (s *sseStream) nextRoomEvent() (string, Event) {
+	s.t.Helper()
+	for {
+		id, ev := s.next()
+		if !strings.HasPrefix(ev.Type, "presence_") {
+			return id, ev
+		}
+	}
+}
+
+func TestRoomEventStream(t *testing.T) {
+	r, h := fallbackRouter(t)
+	srv := httptest.NewServer(r)
+	// потоки закрываются раньше сервера: Cleanup выполняются в обратном порядке
+	t.Cleanup(srv.Close)
+
+	s := openSSE(t, srv.URL+"/rooms/1/events", "1")
+	// первое событие пустое, с текущим курсором
+	if id, ev := s.next(); id != "1" || ev.Type != "" {
+		t.Fatalf("cursor event: id %q %+v", id, ev)
+	}
+	for _, want := range []string{"2", "3"} {
+		if id, ev := s.nextRoomEvent(); id != want || ev.Type != "message" || ev.RoomID != 1 {
+			t.Fatalf("replayed: id %q %+v, want id %s", id, ev, want)
+		}
+	}
+	h.rooms.Emit(1, Event{Type: "typing", Payload: gin.H{"userId": 2}})
+	h.rooms.Emit(1, Event{Type: "message", Payload: gin.H{"text": "live"}})
+	// typing не меняет курсор, поэтому приходит без id
+	if id, ev := s.nextRoomEvent(); id != "" || ev.Type != "typing" {
+		t.Fatalf("typing: id %q %+v", id, ev)
+	}
+	if id, ev := s.nextRoomEvent(); id != "4" || ev.Seq != 4 {
+		t.Fatalf("live: id %q %+v", id, ev)
+	}
+
+	// без Last-Event-ID поток начинается с последнего события
+	if id, _ := openSSE(t, srv.URL+"/rooms/1/events", "").next(); id != "4" {
+		t.Fatalf("cursor without Last-Event-ID: %q", id)
+	}
+	// параметр lastEventId — для клиентов, которые не могут задать заголовок
+	q := openSSE(t, srv.URL+"/rooms/1/events?lastEventId=3", "")
+	q.next()
+	if id, _ := q.nextRoomEvent(); id != "4" {
+		t.Fatalf("lastEventId query: %q", id)
+	}
+
+	// id события resync_required — номер, с которого продолжается поток
+	s = openSSE(t, srv.URL+"/rooms/1/events", "99")
+	s.next()
+	if id, ev := s.nextRoomEvent(); id != "4" || ev.Type != "resync_required" {
+		t.Fatalf("resync: id %q %+v", id, ev)
+	}
+}
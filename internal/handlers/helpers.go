@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"unicode/utf8"
+
 	"github.com/gin-gonic/gin"
 )
 // Auto-generated swagger comments for respondErr
@@ -23,3 +25,22 @@ func uid(c *gin.Context) uint {
 	}
 	return 0
 }
+
+func sid(c *gin.Context) uint {
+	v, _ := c.Get("sessionID")
+	if id, ok := v.(uint); ok {
+		return id
+	}
+	return 0
+}
+
+// truncate обрезает строку до n байт, не разрывая UTF-8 символы.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
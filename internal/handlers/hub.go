@@ -0,0 +1,520 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// hubBroadcastBuffer — очередь событий комнаты; Broadcast ждет, только если
+// она заполнена, а Run никогда не блокируется на отправке клиентам.
+const hubBroadcastBuffer = 64
+
+// wsHubIdleTimeout — сколько хаб комнаты живет без клиентов (WS_HUB_IDLE_TIMEOUT, 1m).
+func wsHubIdleTimeout() time.Duration {
+	return envDuration("WS_HUB_IDLE_TIMEOUT", time.Minute)
+}
+
+// ------------------- RoomHubs -------------------
+
+// RoomHubs — реестр хабов комнат. Хаб запускается с первым клиентом комнаты и
+// останавливается, если после ухода последнего клиента в течение idle никто
+// не подключился. Безопасен для конкурентного использования.
+type RoomHubs struct {
+	idle time.Duration
+
+	mu   sync.Mutex
+	hubs map[uint]*Hub
+
+	// Связь с другими узлами (см. attachBroker); nil — один узел.
+	// relay публикует событие комнаты, remote возвращает пользователей других
+	// узлов в комнате, changed вызывается при подписке и отписке пользователя.
+	relay   func(roomID uint, ev Event)
+	remote  func(roomID uint) []uint
+	changed func(userID uint)
+	// describe возвращает присутствие пользователя для presence_update
+	// (см. Presence.describe); nil — только online и lastSeen
+	describe func(userID uint) (map[string]interface{}, bool)
+
+	// Журналы комнат для возобновления сессий (см. replay.go); logs защищен mu.
+	// Журнал переживает остановку хаба.
+	seqs      seqSource
+	logs      map[uint]*roomLog
+	logSize   int
+	logWindow time.Duration
+	swept     time.Time
+}
+
+// HubStats — состояние хаба для диагностики.
+type HubStats struct {
+	RoomID  uint `json:"roomId" example:"1"`
+	Clients int  `json:"clients" example:"3"`
+}
+
+// NewRoomHubs создает реестр; idle — задержка остановки хаба без клиентов.
+func NewRoomHubs(idle time.Duration) *RoomHubs {
+	return &RoomHubs{
+		idle:      idle,
+		hubs:      map[uint]*Hub{},
+		seqs:      &memorySeq{},
+		logs:      map[uint]*roomLog{},
+		logSize:   wsReplayBuffer(),
+		logWindow: wsReplayWindow(),
+	}
+}
+
+// join подписывает клиента на комнату, при необходимости запуская хаб.
+// Повторная подписка на ту же комнату ничего не меняет.
+func (r *RoomHubs) join(roomID uint, c *Client) *Hub {
+	return r.resume(roomID, c, 0)
+}
+
+// resume — как join, но lastSeq != 0 сначала досылает клиенту события комнаты
+// после lastSeq или resync_required.
+func (r *RoomHubs) resume(roomID uint, c *Client, lastSeq uint64) *Hub {
+	return r.subscribe(roomID, c, subscription{c, lastSeq, lastSeq != 0})
+}
+
+// resumeFrom — как resume, но досылает события и при lastSeq 0: для клиентов
+// SSE и long-poll это курсор до первого события комнаты.
+func (r *RoomHubs) resumeFrom(roomID uint, c *Client, lastSeq uint64) *Hub {
+	return r.subscribe(roomID, c, subscription{c, lastSeq, true})
+}
+
+func (r *RoomHubs) subscribe(roomID uint, c *Client, sub subscription) *Hub {
+	c.subMu.Lock()
+	if h, ok := c.subs[roomID]; ok {
+		c.subMu.Unlock()
+		return h
+	}
+	r.mu.Lock()
+	h, ok := r.hubs[roomID]
+	if !ok {
+		h = NewHub(roomID)
+		h.remote = r.remote
+		h.describe = r.describe
+		h.replay = r.replay
+		r.hubs[roomID] = h
+		go h.Run()
+	}
+	h.refs++
+	h.idleGen++ // отменяет отложенную остановку
+	r.mu.Unlock()
+	if c.subs == nil {
+		c.subs = map[uint]*Hub{}
+	}
+	c.subs[roomID] = h
+	c.subMu.Unlock()
+
+	// Пока refs > 0, хаб останавливается только через Close
+	select {
+	case h.register <- sub:
+	case <-h.done:
+		c.closeSend()
+	}
+	if r.changed != nil && !c.quiet {
+		r.changed(c.userID)
+	}
+	return h
+}
+
+// leave отписывает клиента от комнаты и откладывает остановку хаба, если
+// клиент был последним. false — клиент не был подписан.
+func (r *RoomHubs) leave(roomID uint, c *Client) bool {
+	c.subMu.Lock()
+	h, ok := c.subs[roomID]
+	delete(c.subs, roomID)
+	c.subMu.Unlock()
+	if !ok {
+		return false
+	}
+	select {
+	case h.unregister <- c:
+	case <-h.done:
+	}
+
+	r.mu.Lock()
+	h.refs--
+	if h.refs == 0 {
+		h.idleGen++
+		gen := h.idleGen
+		time.AfterFunc(r.idle, func() { r.stopIdle(h, gen) })
+	}
+	r.mu.Unlock()
+	if r.changed != nil && !c.quiet {
+		r.changed(c.userID)
+	}
+	return true
+}
+
+// leaveAll отписывает клиента от всех комнат.
+func (r *RoomHubs) leaveAll(c *Client) {
+	for _, id := range c.rooms() {
+		r.leave(id, c)
+	}
+}
+
+// stopIdle останавливает хаб, если с момента ухода последнего клиента никто не подключился.
+func (r *RoomHubs) stopIdle(h *Hub, gen uint64) {
+	r.mu.Lock()
+	if h.refs > 0 || h.idleGen != gen || r.hubs[h.roomID] != h {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.hubs, h.roomID)
+	r.mu.Unlock()
+	h.stop()
+}
+
+// Emit нумерует событие и рассылает его клиентам комнаты на всех узлах. Если
+// на узле в комнате никого нет, хаб не создается и событие остается только в
+// журнале. Пронумерованные события комнаты передаются хабу по одному, в
+// порядке номеров: иначе при одновременной отправке клиент мог бы получить
+// seq 6 раньше 5 и пропустить 5 или запросить лишний resync. Другим узлам
+// событие публикуется уже без блокировки: медленный брокер не должен
+// задерживать комнату, а порядок там восстанавливается по seq.
+func (r *RoomHubs) Emit(roomID uint, ev Event) {
+	if sequenced(ev.Type) {
+		l := r.roomLog(roomID)
+		l.emit.Lock()
+		ev = r.sequence(roomID, l, ev)
+		r.deliver(roomID, ev)
+		l.emit.Unlock()
+	} else {
+		r.deliver(roomID, ev)
+	}
+	if r.relay != nil {
+		r.relay(roomID, ev)
+	}
+}
+
+// deliver рассылает событие только клиентам этого узла.
+func (r *RoomHubs) deliver(roomID uint, ev Event) {
+	r.mu.Lock()
+	h := r.hubs[roomID]
+	r.mu.Unlock()
+	if h != nil {
+		h.Broadcast(ev)
+	}
+}
+
+// refreshPresence просит хаб комнаты разослать presence_update, например
+// после входа или выхода пользователя на другом узле.
+func (r *RoomHubs) refreshPresence(roomID uint) {
+	r.mu.Lock()
+	h := r.hubs[roomID]
+	r.mu.Unlock()
+	if h == nil {
+		return
+	}
+	select {
+	case h.refresh <- struct{}{}:
+	default: // обновление уже запрошено
+	}
+}
+
+// Stats возвращает запущенные хабы по возрастанию id комнаты.
+func (r *RoomHubs) Stats() []HubStats {
+	r.mu.Lock()
+	stats := make([]HubStats, 0, len(r.hubs))
+	for id, h := range r.hubs {
+		stats = append(stats, HubStats{RoomID: id, Clients: h.Clients()})
+	}
+	r.mu.Unlock()
+	sort.Slice(stats, func(i, j int) bool { return stats[i].RoomID < stats[j].RoomID })
+	return stats
+}
+
+// Close останавливает все хабы. Подключенные клиенты отключаются.
+func (r *RoomHubs) Close() {
+	r.mu.Lock()
+	hubs := r.hubs
+	r.hubs = map[uint]*Hub{}
+	r.mu.Unlock()
+	for _, h := range hubs {
+		h.stop()
+	}
+}
+
+// ------------------- UserChannels -------------------
+
+// UserChannels — реестр соединений по пользователям. Через него идут события,
+// адресованные пользователю, а не комнате: личные сообщения, упоминания,
+// счетчики непрочитанного и изменения участия в комнатах.
+type UserChannels struct {
+	mu      sync.Mutex
+	clients map[uint]map[*Client]bool
+
+	// relay публикует событие для других узлов (см. attachBroker)
+	relay func(userID, skipRoom uint, ev Event)
+}
+
+// NewUserChannels создает пустой реестр.
+func NewUserChannels() *UserChannels {
+	return &UserChannels{clients: map[uint]map[*Client]bool{}}
+}
+
+func (u *UserChannels) add(c *Client) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.clients[c.userID] == nil {
+		u.clients[c.userID] = map[*Client]bool{}
+	}
+	u.clients[c.userID][c] = true
+}
+
+func (u *UserChannels) remove(c *Client) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.clients[c.userID], c)
+	if len(u.clients[c.userID]) == 0 {
+		delete(u.clients, c.userID)
+	}
+}
+
+// of возвращает соединения пользователя на этом узле.
+func (u *UserChannels) of(userID uint) []*Client {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	cs := make([]*Client, 0, len(u.clients[userID]))
+	for c := range u.clients[userID] {
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// Emit отправляет событие во все мультиплексные соединения пользователя на
+// всех узлах. Как и в хабе, клиент с переполненной очередью отключается.
+func (u *UserChannels) Emit(userID uint, ev Event) {
+	u.EmitOutside(userID, 0, ev)
+}
+
+// EmitOutside — как Emit, но пропускает соединения, подписанные на комнату
+// roomID: они получают событие от хаба комнаты.
+func (u *UserChannels) EmitOutside(userID, roomID uint, ev Event) {
+	u.deliver(userID, roomID, ev)
+	if u.relay != nil {
+		u.relay(userID, roomID, ev)
+	}
+}
+
+// deliver отправляет событие только соединениям этого узла.
+func (u *UserChannels) deliver(userID, skipRoom uint, ev Event) {
+	f := newFrame(ev)
+	for _, c := range u.of(userID) {
+		if c.mux && (skipRoom == 0 || !c.subscribed(skipRoom)) {
+			c.enqueue(f)
+		}
+	}
+}
+
+// ------------------- Hub -------------------
+
+// Hub рассылает события клиентам одной комнаты и помечает их roomId. Набор клиентов принадлежит
+// горутине Run; остальные обращаются к хабу только через каналы.
+type Hub struct {
+	roomID     uint
+	register   chan subscription
+	unregister chan *Client
+	broadcast  chan Event
+	quit       chan struct{}
+	done       chan struct{}
+	stopOnce   sync.Once
+	refresh    chan struct{}
+	// clients — подключенные клиенты и номер, до которого каждый получил
+	// события при возобновлении
+	clients map[*Client]uint64
+	size    atomic.Int64
+	// remote возвращает пользователей комнаты на других узлах; может быть nil
+	remote func(roomID uint) []uint
+	// describe — см. RoomHubs.describe; может быть nil
+	describe func(userID uint) (map[string]interface{}, bool)
+	// replay возвращает события журнала комнаты (см. RoomHubs.replay)
+	replay func(roomID uint, lastSeq uint64) ([]Event, uint64, bool)
+
+	// refs и idleGen защищены RoomHubs.mu
+	refs    int
+	idleGen uint64
+}
+
+// subscription — запрос на подключение клиента к хабу; resume — клиент
+// возобновляет сессию после lastSeq.
+type subscription struct {
+	client  *Client
+	lastSeq uint64
+	resume  bool
+}
+
+// NewHub создает хаб комнаты; запускается вызовом Run.
+func NewHub(roomID uint) *Hub {
+	return &Hub{
+		roomID:     roomID,
+		register:   make(chan subscription),
+		unregister: make(chan *Client),
+		broadcast:  make(chan Event, hubBroadcastBuffer),
+		refresh:    make(chan struct{}, 1),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+		clients:    map[*Client]uint64{},
+	}
+}
+
+// Run обрабатывает подключения и рассылку до остановки хаба.
+func (h *Hub) Run() {
+	defer close(h.done)
+	for {
+		select {
+		case sub := <-h.register:
+			c := sub.client
+			var mark uint64
+			if sub.resume && h.replay != nil {
+				mark = h.resume(c, sub.lastSeq)
+			}
+			h.clients[c] = mark
+			h.size.Store(int64(len(h.clients)))
+			if c.quiet {
+				continue
+			}
+			if h.visible(c.userID) {
+				h.fanout(Event{Type: "presence_join", Payload: gin.H{"userId": c.userID}})
+			}
+			h.fanout(Event{Type: "presence_update", Payload: h.clientsStatus()})
+		case c := <-h.unregister:
+			// Отписка не закрывает очередь: клиент может быть подписан на другие комнаты
+			delete(h.clients, c)
+			h.size.Store(int64(len(h.clients)))
+			if c.quiet {
+				continue
+			}
+			if h.visible(c.userID) {
+				h.fanout(Event{Type: "presence_leave", Payload: gin.H{"userId": c.userID}})
+			}
+			h.fanout(Event{Type: "presence_update", Payload: h.clientsStatus()})
+		case ev := <-h.broadcast:
+			h.fanout(ev)
+		case <-h.refresh:
+			h.fanout(Event{Type: "presence_update", Payload: h.clientsStatus()})
+		case <-h.quit:
+			for c := range h.clients {
+				c.evict(websocket.CloseGoingAway, "server shutting down")
+				h.drop(c)
+			}
+			return
+		}
+	}
+}
+
+// fanout отправляет событие всем клиентам, не блокируясь: клиент с
+// переполненной очередью отключается (см. Client.trySend). Клиент, уже
+// получивший событие при возобновлении, его пропускает. Все клиенты получают
+// один кадр, поэтому событие кодируется один раз на кодировку.
+func (h *Hub) fanout(ev Event) {
+	ev.RoomID = h.roomID
+	f := newFrame(ev)
+	for c, mark := range h.clients {
+		if ev.Seq != 0 && ev.Seq <= mark {
+			continue
+		}
+		if !c.enqueue(f) {
+			h.drop(c)
+		}
+	}
+}
+
+func (h *Hub) drop(c *Client) {
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		c.closeSend()
+		h.size.Store(int64(len(h.clients)))
+	}
+}
+
+// clientsStatus возвращает статусы подключенных к комнате пользователей,
+// включая подключенных к другим узлам; скрывающие присутствие и клиенты
+// long-poll пропускаются.
+// Ключи — id пользователей строками, как в JSON: так событие одинаково
+// читается во всех кодировках (см. ws_codec.go).
+func (h *Hub) clientsStatus() map[string]map[string]interface{} {
+	status := map[string]map[string]interface{}{}
+	now := time.Now()
+	add := func(uid uint) {
+		key := userKey(uid)
+		if _, ok := status[key]; ok {
+			return
+		}
+		if h.describe == nil {
+			status[key] = map[string]interface{}{"online": true, "lastSeen": now}
+		} else if d, ok := h.describe(uid); ok {
+			status[key] = d
+		}
+	}
+	for c := range h.clients {
+		if !c.quiet {
+			add(c.userID)
+		}
+	}
+	if h.remote != nil {
+		for _, uid := range h.remote(h.roomID) {
+			add(uid)
+		}
+	}
+	return status
+}
+
+// visible сообщает, рассылаются ли presence_join и presence_leave пользователя.
+func (h *Hub) visible(userID uint) bool {
+	if h.describe == nil {
+		return true
+	}
+	_, ok := h.describe(userID)
+	return ok
+}
+
+func userKey(id uint) string { return strconv.FormatUint(uint64(id), 10) }
+
+// Broadcast ставит событие в очередь рассылки. После остановки хаба событие отбрасывается.
+func (h *Hub) Broadcast(ev Event) {
+	select {
+	case h.broadcast <- ev:
+	case <-h.done:
+	}
+}
+
+// Clients возвращает число подключенных клиентов.
+func (h *Hub) Clients() int { return int(h.size.Load()) }
+
+func (h *Hub) stop() {
+	h.stopOnce.Do(func() { close(h.quit) })
+	<-h.done
+}
+
+// ==================== ДИАГНОСТИКА WEBSOCKET ====================
+
+// @Summary Хабы комнат
+// @Description Возвращает запущенные на этом узле хабы комнат, число подключенных к каждому клиентов и счетчики событий соединений с момента запуска: истекшие heartbeat, слишком большие кадры, таймауты записи, отклоненные по лимиту частоты кадры и отключения за превышение лимита или переполнение очереди отправки
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} HubsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/ws/hubs [get]
+func (h *Handler) ListHubs(c *gin.Context) {
+	if !h.hasPermission(c, "admin.dashboard.read") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+
+	res := HubsResponse{Node: h.node, Hubs: h.rooms.Stats(), Events: wsStats.snapshot()}
+	res.ActiveHubs = len(res.Hubs)
+	for _, s := range res.Hubs {
+		res.Clients += s.Clients
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testClient(userID uint, buf int) *Client {
+	return &Client{send: make(chan *wsFrame, buf), codec: jsonCodec, userID: userID}
+}
+
+// drain читает очередь клиента, пока хаб ее не закроет.
+func drain(c *Client, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for range c.send {
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRoomHubsConcurrentJoinLeaveEmit(t *testing.T) {
+	r := NewRoomHubs(5 * time.Millisecond)
+	defer r.Close()
+
+	var clients, drains sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		clients.Add(1)
+		go func(i int) {
+			defer clients.Done()
+			roomID := uint(i%4 + 1)
+			for j := 0; j < 20; j++ {
+				c := testClient(uint(i), 256)
+				drains.Add(1)
+				go drain(c, &drains)
+				r.join(roomID, c)
+				r.Emit(roomID, Event{Type: "message"})
+				r.Emit(roomID+10, Event{Type: "message"})
+				_ = r.Stats()
+				r.leave(roomID, c)
+				c.closeSend() // как readPump при разрыве соединения
+			}
+		}(i)
+	}
+	clients.Wait()
+
+	waitFor(t, "idle hubs to stop", func() bool { return len(r.Stats()) == 0 })
+	drains.Wait()
+}
+
+func TestRoomHubsIdleShutdown(t *testing.T) {
+	r := NewRoomHubs(20 * time.Millisecond)
+	defer r.Close()
+
+	c := testClient(1, 16)
+	h := r.join(1, c)
+	if got := r.Stats(); len(got) != 1 || got[0].RoomID != 1 {
+		t.Fatalf("stats = %+v", got)
+	}
+	waitFor(t, "client registered", func() bool { return h.Clients() == 1 })
+	r.leave(1, c)
+
+	// Повторное подключение до таймаута сохраняет хаб
+	c2 := testClient(2, 16)
+	if h2 := r.join(1, c2); h2 != h {
+		t.Fatal("rejoin before idle timeout started a new hub")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if len(r.Stats()) != 1 {
+		t.Fatal("hub with a client was stopped")
+	}
+
+	r.leave(1, c2)
+	waitFor(t, "idle hub to stop", func() bool { return len(r.Stats()) == 0 })
+	select {
+	case <-h.done:
+	case <-time.After(time.Second):
+		t.Fatal("hub goroutine still running")
+	}
+}
+
+func TestHubFanoutSkipsSlowClients(t *testing.T) {
+	r := NewRoomHubs(time.Minute)
+	defer r.Close()
+
+	// Медленный клиент не читает очередь; раньше Run блокировался на
+	// собственном канале broadcast после 64 событий
+	slow := testClient(1, 1)
+	h := r.join(1, slow)
+
+	var wg sync.WaitGroup
+	fast := testClient(2, 4096)
+	wg.Add(1)
+	go drain(fast, &wg)
+	r.join(1, fast)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			r.Emit(1, Event{Type: "message", Payload: i})
+		}
+		for i := 0; i < 100; i++ {
+			c := testClient(uint(100+i), 0)
+			r.join(1, c)
+			r.leave(1, c)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast blocked")
+	}
+
+	waitFor(t, "slow client dropped", func() bool { return h.Clients() == 1 })
+	slow.sendMu.Lock()
+	closed, code := slow.closed, slow.closeCode
+	slow.sendMu.Unlock()
+	if !closed {
+		t.Fatal("slow client queue not closed")
+	}
+	if code != closeSlowConsumer {
+		t.Fatalf("slow client close code = %d, want %d", code, closeSlowConsumer)
+	}
+	r.leaveAll(slow)
+	r.leaveAll(fast)
+	fast.closeSend()
+	r.Close()
+	wg.Wait()
+}
+
+func TestRoomHubsEmitWithoutClients(t *testing.T) {
+	r := NewRoomHubs(time.Minute)
+	defer r.Close()
+
+	r.Emit(7, Event{Type: "message"})
+	if n := len(r.Stats()); n != 0 {
+		t.Fatalf("emit to an empty room started %d hubs", n)
+	}
+}
+
+func TestRoomHubsCloseWithConnectedClients(t *testing.T) {
+	r := NewRoomHubs(time.Minute)
+	var wg sync.WaitGroup
+	var cs []*Client
+	for i := 0; i < 10; i++ {
+		c := testClient(uint(i), 64)
+		wg.Add(1)
+		go drain(c, &wg)
+		r.join(uint(i%3), c)
+		cs = append(cs, c)
+	}
+	r.Close()
+	wg.Wait() // Close закрыл очереди всех клиентов
+	for _, c := range cs {
+		r.leaveAll(c) // уход после остановки хаба не блокируется
+	}
+	if n := len(r.Stats()); n != 0 {
+		t.Fatalf("stats after close = %d hubs", n)
+	}
+}
+
+func TestClientSubscribesToSeveralRooms(t *testing.T) {
+	r := NewRoomHubs(time.Minute)
+	defer r.Close()
+
+	c := testClient(1, 64)
+	h1, h2 := r.join(1, c), r.join(2, c)
+	if r.join(1, c) != h1 {
+		t.Fatal("repeated subscribe returned another hub")
+	}
+	waitFor(t, "client registered", func() bool { return h1.Clients() == 1 && h2.Clients() == 1 })
+
+	// next пропускает события присутствия
+	next := func() Event {
+		t.Helper()
+		for {
+			select {
+			case f, ok := <-c.send:
+				if !ok {
+					t.Fatal("unsubscribe closed the client queue")
+				}
+				if f.ev.Type == "message" {
+					return f.ev
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no message event")
+			}
+		}
+	}
+	r.Emit(2, Event{Type: "message"})
+	if ev := next(); ev.RoomID != 2 {
+		t.Fatalf("event tagged with room %d, want 2", ev.RoomID)
+	}
+
+	if !r.leave(1, c) || r.leave(1, c) {
+		t.Fatal("leave should report the subscription only once")
+	}
+	waitFor(t, "client unregistered", func() bool { return h1.Clients() == 0 })
+	r.Emit(1, Event{Type: "message"})
+	r.Emit(2, Event{Type: "message"})
+	if ev := next(); ev.RoomID != 2 {
+		t.Fatalf("event from unsubscribed room %d", ev.RoomID)
+	}
+	if got := c.rooms(); len(got) != 1 || got[0] != 2 {
+		t.Fatalf("subscriptions = %v", got)
+	}
+	r.leaveAll(c)
+}
+
+func TestRoomHubsResume(t *testing.T) {
+	r := NewRoomHubs(time.Minute)
+	r.logSize = 3
+	defer r.Close()
+
+	for i := 0; i < 5; i++ {
+		r.Emit(1, Event{Type: "message"})
+		r.Emit(1, Event{Type: "typing"}) // не нумеруется
+	}
+
+	// first возвращает первое событие, кроме событий присутствия
+	first := func(c *Client) Event {
+		t.Helper()
+		for {
+			select {
+			case f := <-c.send:
+				if sequenced(f.ev.Type) {
+					return f.ev
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no event")
+			}
+		}
+	}
+
+	c := testClient(1, 64)
+	r.resume(1, c, 3)
+	for _, want := range []uint64{4, 5} {
+		if ev := first(c); ev.Type != "message" || ev.Seq != want || ev.RoomID != 1 {
+			t.Fatalf("replayed %+v, want message #%d", ev, want)
+		}
+	}
+	r.Emit(1, Event{Type: "message"})
+	if ev := first(c); ev.Seq != 6 {
+		t.Fatalf("live event seq = %d, want 6", ev.Seq)
+	}
+
+	// Событие 2 вытеснено из журнала, 9 серверу неизвестно
+	for _, lastSeq := range []uint64{1, 9} {
+		c := testClient(2, 64)
+		r.resume(1, c, lastSeq)
+		if ev := first(c); ev.Type != "resync_required" {
+			t.Fatalf("lastSeq %d: got %s, want resync_required", lastSeq, ev.Type)
+		}
+	}
+
+	// События других узлов встают в журнал по порядку номеров
+	r.record(1, Event{Type: "message", Seq: 8})
+	r.record(1, Event{Type: "message", Seq: 7})
+	c2 := testClient(3, 64)
+	r.resume(1, c2, 6)
+	for _, want := range []uint64{7, 8} {
+		if ev := first(c2); ev.Seq != want {
+			t.Fatalf("replayed #%d, want #%d", ev.Seq, want)
+		}
+	}
+}
+
+func TestRoomHubsEmitOrder(t *testing.T) {
+	r := NewRoomHubs(time.Minute)
+	defer r.Close()
+	const senders, each = 32, 100
+	c := testClient(1, senders*each+16)
+	r.join(1, c)
+
+	// Stats занимает r.mu, за которым события ждут передачи хабу
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = r.Stats()
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				r.Emit(1, Event{Type: "message"})
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+
+	var last uint64
+	for n := 0; n < senders*each; {
+		select {
+		case f := <-c.send:
+			if f.ev.Seq == 0 {
+				continue
+			}
+			if f.ev.Seq != last+1 {
+				t.Fatalf("got seq %d after %d", f.ev.Seq, last)
+			}
+			last = f.ev.Seq
+			n++
+		case <-time.After(time.Second):
+			t.Fatalf("received %d of %d events", n, senders*each)
+		}
+	}
+}
+
+func TestRoomHubsFallbackClients(t *testing.T) {
+	r := NewRoomHubs(time.Minute)
+	defer r.Close()
+	ws := testClient(1, 64)
+	r.join(1, ws)
+
+	// Курсор 0 у SSE и long-poll — до первого события комнаты
+	r.Emit(1, Event{Type: "message"})
+	poll := testClient(2, 64)
+	poll.quiet = true
+	r.resumeFrom(1, poll, 0)
+	select {
+	case f := <-poll.send:
+		if f.ev.Seq != 1 {
+			t.Fatalf("replayed %+v, want message #1", f.ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event before the first poll not replayed")
+	}
+	r.leave(1, poll)
+
+	// Клиент long-poll не появляется в присутствии комнаты
+	r.Emit(1, Event{Type: "message"})
+	for {
+		f := <-ws.send
+		if f.ev.Type == "presence_join" && f.ev.Payload.(gin.H)["userId"] == uint(2) {
+			t.Fatal("long-poll client announced in presence")
+		}
+		if f.ev.Type == "message" && f.ev.Seq == 2 {
+			break
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"LinkUp/internal/audit"
+	"LinkUp/internal/auth"
+	"LinkUp/internal/models"
+	"LinkUp/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Режимы регистрации (REGISTRATION_MODE)
+const (
+	registrationOpen   = "open"
+	registrationInvite = "invite"
+	registrationClosed = "closed"
+)
+
+const (
+	inviteDefaultTTL = 7 * 24 * time.Hour
+	inviteMaxUses    = 10000
+)
+
+var (
+	errInvalidInvite      = errors.New("invalid, expired or used up invite")
+	errProvisioningClosed = errors.New("registration mode does not allow provisioning new users")
+)
+
+// registrationMode возвращает режим регистрации: open (по умолчанию) — любой
+// желающий, invite — только по приглашению, closed — регистрация выключена.
+// Режим ограничивает и создание пользователей при первом входе через SSO и
+// LDAP (см. provisioningAllowed).
+func registrationMode() string {
+	switch m := strings.ToLower(strings.TrimSpace(os.Getenv("REGISTRATION_MODE"))); m {
+	case registrationInvite, registrationClosed:
+		return m
+	default:
+		return registrationOpen
+	}
+}
+
+// provisioningAllowed сообщает, можно ли создать локального пользователя при
+// первом входе через SSO или LDAP. В режимах invite и closed это разрешает
+// только REGISTRATION_SSO_PROVISION=true: иначе любой аккаунт провайдера или
+// каталога получал бы доступ в обход приглашений.
+func provisioningAllowed() bool {
+	if registrationMode() == registrationOpen {
+		return true
+	}
+	ok, _ := strconv.ParseBool(os.Getenv("REGISTRATION_SSO_PROVISION"))
+	return ok
+}
+
+// redeemInvite атомарно списывает одно использование приглашения. Условный
+// UPDATE не дает двум параллельным регистрациям превысить лимит.
+func redeemInvite(tx *gorm.DB, code string) (models.Invite, error) {
+	var inv models.Invite
+	if err := tx.Where("code_hash = ?", utils.HashToken(code)).First(&inv).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return inv, errInvalidInvite
+		}
+		return inv, err
+	}
+	res := tx.Model(&models.Invite{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND uses < max_uses", inv.ID, time.Now()).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if res.Error != nil {
+		return inv, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return inv, errInvalidInvite
+	}
+	inv.Uses++
+	return inv, nil
+}
+
+// grantInvite добавляет нового пользователя в комнаты и выдает роли приглашения.
+// Удаленные после создания приглашения комнаты и роли пропускаются.
+func grantInvite(tx *gorm.DB, inv models.Invite, userID uint) error {
+	if len(inv.RoomIDs) > 0 {
+		var roomIDs []uint
+		if err := tx.Model(&models.Room{}).Where("id IN ?", inv.RoomIDs).Pluck("id", &roomIDs).Error; err != nil {
+			return err
+		}
+		for _, id := range roomIDs {
+			if err := tx.Create(&models.RoomMember{RoomID: id, UserID: userID}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	if len(inv.RoleIDs) > 0 {
+		var roleIDs []uint
+		if err := tx.Model(&models.Role{}).Where("id IN ?", inv.RoleIDs).Pluck("id", &roleIDs).Error; err != nil {
+			return err
+		}
+		for _, id := range roleIDs {
+			if err := tx.Create(&models.UserRole{UserID: userID, RoleID: id, GrantedBy: inv.CreatedBy}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func inviteResponse(inv models.Invite) InviteResponse {
+	return InviteResponse{
+		ID:        inv.ID,
+		Prefix:    inv.Prefix,
+		CreatedBy: inv.CreatedBy,
+		MaxUses:   inv.MaxUses,
+		Uses:      inv.Uses,
+		RoomIDs:   inv.RoomIDs,
+		RoleIDs:   inv.RoleIDs,
+		CreatedAt: inv.CreatedAt,
+		ExpiresAt: inv.ExpiresAt,
+		RevokedAt: inv.RevokedAt,
+	}
+}
+
+// dedupIDs убирает повторы, сохраняя порядок.
+func dedupIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	out := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// ==================== ПРИГЛАШЕНИЯ ====================
+
+// @Summary Создать приглашение
+// @Description Создает код приглашения на регистрацию с лимитом использований и сроком действия (по умолчанию одно использование и 7 дней). Новый пользователь может сразу получить участие в комнатах и глобальные роли; выдача ролей требует права admin.roles.assign. Код и ссылка возвращаются только один раз
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param invite body CreateInviteRequest true "Параметры приглашения"
+// @Success 201 {object} CreateInviteResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/invites [post]
+func (h *Handler) CreateInvite(c *gin.Context) {
+	if !h.hasPermission(c, "admin.invites.create") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 0 || req.MaxUses > inviteMaxUses {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "maxUses must be between 1 and " + strconv.Itoa(inviteMaxUses)})
+		return
+	}
+	expiresAt := time.Now().Add(inviteDefaultTTL)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Expiry must be in the future"})
+			return
+		}
+		expiresAt = *req.ExpiresAt
+	}
+	roomIDs, roleIDs := dedupIDs(req.RoomIDs), dedupIDs(req.RoleIDs)
+	if len(roleIDs) > 0 && !h.hasPermission(c, "admin.roles.assign") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions to grant roles"})
+		return
+	}
+	var n int64
+	h.db.Model(&models.Room{}).Where("id IN ?", roomIDs).Count(&n)
+	if int(n) != len(roomIDs) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Room not found"})
+		return
+	}
+	h.db.Model(&models.Role{}).Where("id IN ?", roleIDs).Count(&n)
+	if int(n) != len(roleIDs) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Role not found"})
+		return
+	}
+
+	code, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate invite"})
+		return
+	}
+	inv := models.Invite{
+		CreatedBy: uid(c),
+		Prefix:    code[:8],
+		CodeHash:  utils.HashToken(code),
+		MaxUses:   req.MaxUses,
+		RoomIDs:   roomIDs,
+		RoleIDs:   roleIDs,
+		ExpiresAt: expiresAt,
+	}
+	if err := h.db.Create(&inv).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create invite"})
+		return
+	}
+
+	h.recordAudit(c, audit.ActionInviteCreate, audit.TargetInvite, inv.ID,
+		audit.Diff{}.Add("maxUses", nil, inv.MaxUses).Add("roomIds", nil, inv.RoomIDs).Add("roleIds", nil, inv.RoleIDs))
+	c.JSON(http.StatusCreated, CreateInviteResponse{
+		InviteResponse: inviteResponse(inv),
+		Code:           code,
+		URL:            appURL() + "/register?invite=" + url.QueryEscape(code),
+	})
+}
+
+// @Summary Список приглашений
+// @Description Возвращает приглашения без кодов, новые сверху. По умолчанию только действующие; all=true включает отозванные, истекшие и исчерпанные
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param all query bool false "Включая недействующие"
+// @Param limit query int false "Лимит" default(50)
+// @Param offset query int false "Смещение" default(0)
+// @Success 200 {array} InviteResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/invites [get]
+func (h *Handler) ListInvites(c *gin.Context) {
+	if !h.hasPermission(c, "admin.invites.read") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	q := h.db.Model(&models.Invite{})
+	if all, _ := strconv.ParseBool(c.Query("all")); !all {
+		q = q.Where("revoked_at IS NULL AND expires_at > ? AND uses < max_uses", time.Now())
+	}
+	var invites []models.Invite
+	if err := q.Order("created_at DESC").Limit(limit).Offset(offset).Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch invites"})
+		return
+	}
+
+	res := make([]InviteResponse, 0, len(invites))
+	for _, inv := range invites {
+		res = append(res, inviteResponse(inv))
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// @Summary Отозвать приглашение
+// @Description Отзывает приглашение; уже зарегистрированных по нему пользователей это не затрагивает
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID приглашения"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/invites/{id} [delete]
+func (h *Handler) RevokeInvite(c *gin.Context) {
+	if !h.hasPermission(c, "admin.invites.revoke") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+
+	res := h.db.Model(&models.Invite{}).
+		Where("id = ? AND revoked_at IS NULL", c.Param("id")).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke invite"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Invite not found"})
+		return
+	}
+
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	h.recordAudit(c, audit.ActionInviteRevoke, audit.TargetInvite, uint(id), nil)
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"LinkUp/internal/audit"
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Причины неудачных попыток входа в журнале LoginAttempt
+const (
+	attemptBadPassword = "bad_password"
+	attemptUnknownUser = "unknown_user"
+	attemptBad2FA      = "bad_2fa"
+	attemptLocked      = "locked"
+)
+
+// checkLockout отвечает 429 с Retry-After, если логин или IP клиента заблокированы.
+func (h *Handler) checkLockout(c *gin.Context, op, login string, userID *uint) bool {
+	wait := h.lockout.Check(c.Request.Context(), login, c.ClientIP())
+	if wait <= 0 {
+		return false
+	}
+	h.recordLoginAttempt(c, login, userID, attemptLocked)
+	respondLocked(c, op, wait)
+	return true
+}
+
+// loginFailed записывает неудачную попытку и учитывает ее в счетчиках блокировки.
+// Если попытка заблокировала логин или IP, сразу отвечает 429 с Retry-After,
+// чтобы клиент показал блокировку без лишней попытки, и возвращает true.
+func (h *Handler) loginFailed(c *gin.Context, op, login string, userID *uint, reason string) bool {
+	h.recordLoginAttempt(c, login, userID, reason)
+	wait := h.lockout.Fail(c.Request.Context(), login, c.ClientIP())
+	if wait <= 0 {
+		return false
+	}
+	respondLocked(c, op, wait)
+	return true
+}
+
+func respondLocked(c *gin.Context, op string, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	apiErr := apiErrors.NewAPIError(op+".Locked", nil, "locked for "+wait.Round(time.Second).String(), http.StatusTooManyRequests)
+	apiErrors.LogAndRespondAPI(c, apiErr, "Too many failed attempts. Try again later.")
+}
+
+func (h *Handler) recordLoginAttempt(c *gin.Context, login string, userID *uint, reason string) {
+	h.db.Create(&models.LoginAttempt{
+		Login:     truncate(login, 64),
+		UserID:    userID,
+		IP:        c.ClientIP(),
+		UserAgent: truncate(c.Request.UserAgent(), 255),
+		Reason:    reason,
+	})
+}
+
+// ==================== БЕЗОПАСНОСТЬ ВХОДА ====================
+
+// @Summary Разблокировать пользователя
+// @Description Снимает блокировку входа, наложенную после неудачных попыток
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID пользователя"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/unlock [post]
+func (h *Handler) UnlockUser(c *gin.Context) {
+	if !h.hasPermission(c, "admin.users.unlock") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+
+	var u models.User
+	if err := h.db.First(&u, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
+
+	if err := h.lockout.Unlock(c.Request.Context(), u.Login); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to unlock user"})
+		return
+	}
+	h.recordAudit(c, audit.ActionUserUnlock, audit.TargetUser, u.ID, nil)
+
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// @Summary Неудачные попытки входа
+// @Description Журнал неудачных попыток входа для разбора инцидентов, новые сверху
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param login query string false "Фильтр по логину"
+// @Param ip query string false "Фильтр по IP"
+// @Param limit query int false "Лимит" default(50)
+// @Param offset query int false "Смещение" default(0)
+// @Success 200 {array} models.LoginAttempt
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/login-attempts [get]
+func (h *Handler) ListLoginAttempts(c *gin.Context) {
+	if !h.hasPermission(c, "admin.security.read") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	q := h.db.Model(&models.LoginAttempt{})
+	if login := c.Query("login"); login != "" {
+		q = q.Where("login = ?", login)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		q = q.Where("ip = ?", ip)
+	}
+
+	var attempts []models.LoginAttempt
+	if err := q.Order("created_at DESC").Limit(limit).Offset(offset).Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch login attempts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attempts)
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 
+	"LinkUp/internal/auth"
 	"LinkUp/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -58,30 +60,88 @@ func (h *Handler) MessageHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+// Коды отказа в отправке сообщения: поле code ответа REST и кадра nack
+const (
+	sendInvalid       = "invalid_payload"
+	sendRoomNotFound  = "room_not_found"
+	sendForbidden     = "forbidden"
+	sendNotSubscribed = "not_subscribed"
+	sendReadOnly      = "read_only"
+	sendRateLimited   = "rate_limited"
+	sendFailed        = "internal_error"
+)
+
+// maxClientMsgIDLen — предел длины clientMsgId (размер колонки).
+const maxClientMsgIDLen = 64
+
+// sendError — отказ в отправке сообщения: HTTP-статус для REST, код и текст
+// для ответа REST и кадра nack.
+type sendError struct {
+	status int
+	code   string
+	msg    string
+}
+
+// sendMessage проверяет clientMsgId и сохраняет сообщение (см. postMessage).
+// Доступ к комнате проверяет вызывающий.
+func (h *Handler) sendMessage(msg *models.Message, clientMsgID string) (bool, *sendError) {
+	if len(clientMsgID) > maxClientMsgIDLen {
+		return false, &sendError{400, sendInvalid, "clientMsgId is too long"}
+	}
+	if clientMsgID != "" {
+		msg.ClientMsgID = &clientMsgID
+	}
+	dup, err := h.postMessage(msg)
+	if err != nil {
+		log.Printf("[MSG] save message in room %d: %v", msg.RoomID, err)
+		return false, &sendError{500, sendFailed, "db error"}
+	}
+	return dup, nil
+}
+
+func messageAck(msg *models.Message, duplicate bool) MessageAckResponse {
+	ack := MessageAckResponse{ID: msg.ID, CreatedAt: msg.CreatedAt, Duplicate: duplicate}
+	if msg.ClientMsgID != nil {
+		ack.ClientMsgID = *msg.ClientMsgID
+	}
+	return ack
+}
+
+func respondSendErr(c *gin.Context, e *sendError) {
+	c.AbortWithStatusJSON(e.status, SendErrorResponse{Error: e.msg, Code: e.code})
+}
+
 // @Summary Отправить сообщение
-// @Description Отправляет новое сообщение в указанную комнату
+// @Description Отправляет новое сообщение в указанную комнату и возвращает его id и время создания. Необязательный clientMsgId, выбранный клиентом, делает отправку идемпотентной: повтор с тем же clientMsgId в ту же комнату возвращает уже сохраненное сообщение с duplicate=true и кодом 200, не создавая и не рассылая новое; в другой комнате тот же clientMsgId создает новое сообщение. Событие message в WebSocket повторяет clientMsgId, чтобы клиент сопоставил его с оптимистично показанным сообщением. Ошибка содержит машиночитаемый code: invalid_payload, room_not_found, forbidden или internal_error
 // @Tags messages
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "ID комнаты"
 // @Param message body SendMessageRequest true "Текст сообщения"
-// @Success 201 {object} MessageResponse
-// @Failure 400 {object} ErrorResponse
+// @Success 201 {object} MessageAckResponse
+// @Success 200 {object} MessageAckResponse "Повтор: сообщение с этим clientMsgId уже сохранено"
+// @Failure 400 {object} SendErrorResponse
 // @Failure 401 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
+// @Failure 403 {object} SendErrorResponse
+// @Failure 404 {object} SendErrorResponse
+// @Failure 500 {object} SendErrorResponse
 // @Router /rooms/{id}/messages [post]
 func (h *Handler) SendMessageREST(c *gin.Context) {
 	roomID64, _ := strconv.ParseUint(c.Param("id"), 10, 64)
 	roomID := uint(roomID64)
 
-	var req struct {
-		Type     string `json:"type"`
-		Text     string `json:"text"`
-		ImageURL string `json:"imageUrl"`
-	}
+	var req SendMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		respondErr(c, 400, "invalid payload")
+		respondSendErr(c, &sendError{400, sendInvalid, "invalid payload"})
+		return
+	}
+	if status, msg := h.roomAccess(roomID, uid(c)); msg != "" {
+		code := sendForbidden
+		if status == 404 {
+			code = sendRoomNotFound
+		}
+		respondSendErr(c, &sendError{status, code, msg})
 		return
 	}
 
@@ -92,29 +152,16 @@ func (h *Handler) SendMessageREST(c *gin.Context) {
 		Text:     req.Text,
 		ImageURL: req.ImageURL,
 	}
-	if msg.Type == "" {
-		msg.Type = "text"
-	}
-
-	if err := h.db.Create(&msg).Error; err != nil {
-		respondErr(c, 500, "db error")
+	dup, serr := h.sendMessage(&msg, req.ClientMsgID)
+	if serr != nil {
+		respondSendErr(c, serr)
 		return
 	}
-
-	h.rooms.Emit(msg.RoomID, Event{
-		Type: "message",
-		Payload: gin.H{
-			"id":        msg.ID,
-			"roomId":    msg.RoomID,
-			"userId":    msg.UserID,
-			"type":      msg.Type,
-			"text":      msg.Text,
-			"imageUrl":  msg.ImageURL,
-			"createdAt": msg.CreatedAt,
-		},
-	})
-
-	c.JSON(200, gin.H{"ok": true})
+	status := http.StatusCreated
+	if dup {
+		status = http.StatusOK
+	}
+	c.JSON(status, messageAck(&msg, dup))
 }
 
 type reactionReq struct {
@@ -142,6 +189,10 @@ func (h *Handler) AddReaction(c *gin.Context) {
 		respondErr(c, 404, "сооооообщение не найдено")
 		return
 	}
+	if !roomAllowed(c, msg.RoomID) {
+		respondErr(c, 403, "token is restricted to another room")
+		return
+	}
 	var req reactionReq
 	if err := c.ShouldBindJSON(&req); err != nil {
 		respondErr(c, 400, "Инвалид пейлоад")
@@ -173,6 +224,13 @@ func (h *Handler) AddReaction(c *gin.Context) {
 func (h *Handler) RemoveReaction(c *gin.Context) {
 	mid := c.Param("id")
 	reac := c.Param("reaction")
+	if _, ok := auth.TokenRoom(c); ok {
+		var msg models.Message
+		if err := h.db.First(&msg, mid).Error; err != nil || !roomAllowed(c, msg.RoomID) {
+			respondErr(c, 403, "token is restricted to another room")
+			return
+		}
+	}
 	h.db.Where("message_id = ? AND user_id = ? AND reaction = ?", mid, uid(c), reac).Delete(&models.Reaction{})
 	var msg models.Message
 	if err := h.db.First(&msg, mid).Error; err == nil {
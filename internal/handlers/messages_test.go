@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"LinkUp/internal/models"
+)
+
+func TestSendMessageClientMsgID(t *testing.T) {
+	db := testDB(t)
+	h := New(db, t.TempDir(), "http://x")
+	t.Cleanup(h.rooms.Close)
+	for _, slug := range []string{"a", "b"} {
+		if err := db.Create(&models.Room{Slug: slug, Name: slug, OwnerID: 1}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := testClient(2, 16)
+	h.rooms.join(1, c)
+	send := func(roomID uint, text string) (models.Message, bool) {
+		t.Helper()
+		msg := models.Message{RoomID: roomID, UserID: 1, Text: text}
+		dup, serr := h.sendMessage(&msg, "m-1")
+		if serr != nil {
+			t.Fatalf("send to room %d: %+v", roomID, serr)
+		}
+		return msg, dup
+	}
+	broadcasts := func() int {
+		n := 0
+		for {
+			select {
+			case f := <-c.send:
+				if f.ev.Type == "message" {
+					n++
+				}
+			case <-time.After(50 * time.Millisecond):
+				return n
+			}
+		}
+	}
+
+	first, dup := send(1, "hi")
+	if dup || broadcasts() != 1 {
+		t.Fatalf("first send: duplicate=%v", dup)
+	}
+	// повтор в ту же комнату возвращает сохраненное сообщение и ничего не рассылает
+	retry, dup := send(1, "hi again")
+	if !dup || retry.ID != first.ID || retry.Text != "hi" || broadcasts() != 0 {
+		t.Fatalf("retry: duplicate=%v %+v", dup, retry)
+	}
+	// тот же clientMsgId в другой комнате — новое сообщение этой комнаты
+	other, dup := send(2, "elsewhere")
+	if dup || other.ID == first.ID || other.RoomID != 2 || other.Text != "elsewhere" {
+		t.Fatalf("other room: duplicate=%v %+v", dup, other)
+	}
+	var n int64
+	db.Model(&models.Message{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("messages stored: %d", n)
+	}
+}
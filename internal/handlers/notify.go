@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"LinkUp/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// mentionPattern находит упоминания вида @login.
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9._-]+)`)
+
+func messagePayload(msg *models.Message) gin.H {
+	p := gin.H{
+		"id":        msg.ID,
+		"roomId":    msg.RoomID,
+		"userId":    msg.UserID,
+		"type":      msg.Type,
+		"text":      msg.Text,
+		"imageUrl":  msg.ImageURL,
+		"createdAt": msg.CreatedAt,
+	}
+	if msg.ClientMsgID != nil {
+		p["clientMsgId"] = *msg.ClientMsgID
+	}
+	return p
+}
+
+// postMessage сохраняет сообщение, рассылает его подписчикам комнаты и
+// уведомляет участников комнаты через пользовательские каналы. Повтор с уже
+// сохраненным в этой комнате clientMsgId ничего не рассылает: msg заполняется
+// сохраненным сообщением, и duplicate=true. В другой комнате тот же
+// clientMsgId — новое сообщение.
+func (h *Handler) postMessage(msg *models.Message) (duplicate bool, err error) {
+	if msg.Type == "" {
+		msg.Type = "text"
+	}
+	if msg.ClientMsgID != nil && h.findClientMessage(msg) {
+		return true, nil
+	}
+	if err := h.db.Create(msg).Error; err != nil {
+		// Параллельный повтор успел раньше, и вставку отклонил уникальный индекс
+		if msg.ClientMsgID != nil && h.findClientMessage(msg) {
+			return true, nil
+		}
+		return false, err
+	}
+	payload := messagePayload(msg)
+	h.rooms.Emit(msg.RoomID, Event{Type: "message", Payload: payload})
+	h.notifyMessage(msg, payload)
+	return false, nil
+}
+
+// findClientMessage ищет сообщение автора в той же комнате с тем же
+// clientMsgId и при успехе заменяет им msg.
+func (h *Handler) findClientMessage(msg *models.Message) bool {
+	var prev models.Message
+	res := h.db.Where("room_id = ? AND user_id = ? AND client_msg_id = ?", msg.RoomID, msg.UserID, *msg.ClientMsgID).
+		Limit(1).Find(&prev)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false
+	}
+	*msg = prev
+	return true
+}
+
+// notifyMessage создает упоминания и рассылает участникам комнаты, кроме
+// автора, события mention, unread и — для приватных комнат — dm.
+func (h *Handler) notifyMessage(msg *models.Message, payload gin.H) {
+	var members []uint
+	if err := h.db.Model(&models.RoomMember{}).Where("room_id = ? AND user_id <> ?", msg.RoomID, msg.UserID).
+		Pluck("user_id", &members).Error; err != nil {
+		log.Printf("[WS] load members of room %d: %v", msg.RoomID, err)
+		return
+	}
+	h.recordMentions(msg, members)
+
+	online := h.presence.OnlineOf(members)
+	if len(online) == 0 {
+		return
+	}
+	var room models.Room
+	h.db.Select("id", "is_private").First(&room, msg.RoomID)
+	for _, userID := range online {
+		h.users.Emit(userID, Event{Type: "unread", RoomID: msg.RoomID, Payload: gin.H{"unread": h.unreadCount(msg.RoomID, userID)}})
+		if !room.IsPrivate {
+			continue
+		}
+		// Подписанные на комнату соединения уже получили message
+		h.users.EmitOutside(userID, msg.RoomID, Event{Type: "dm", RoomID: msg.RoomID, Payload: payload})
+	}
+}
+
+// recordMentions сохраняет упоминания участников комнаты в тексте сообщения
+// и отправляет каждому событие mention.
+func (h *Handler) recordMentions(msg *models.Message, members []uint) {
+	if msg.Type != "text" || len(members) == 0 {
+		return
+	}
+	var logins []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(msg.Text, -1) {
+		if login := strings.TrimRight(m[1], "."); login != "" {
+			logins = append(logins, login)
+		}
+	}
+	if len(logins) == 0 {
+		return
+	}
+	var userIDs []uint
+	if err := h.db.Model(&models.User{}).Where("login IN ? AND id IN ?", logins, members).
+		Pluck("id", &userIDs).Error; err != nil {
+		log.Printf("[WS] resolve mentions in message %d: %v", msg.ID, err)
+		return
+	}
+	for _, userID := range userIDs {
+		mention := models.Mention{MessageID: msg.ID, UserID: userID, MentionedBy: msg.UserID}
+		if err := h.db.Create(&mention).Error; err != nil {
+			log.Printf("[WS] save mention: %v", err)
+			continue
+		}
+		h.users.Emit(userID, Event{Type: "mention", RoomID: msg.RoomID, Payload: gin.H{
+			"id":          mention.ID,
+			"messageId":   msg.ID,
+			"mentionedBy": msg.UserID,
+			"text":        truncate(msg.Text, 200),
+		}})
+	}
+}
+
+// notifyMembership сообщает пользователю об изменении его участия в комнате:
+// joined, left или owner (пользователь стал владельцем).
+func (h *Handler) notifyMembership(userID, roomID uint, change string) {
+	h.users.Emit(userID, Event{Type: "membership", RoomID: roomID, Payload: gin.H{"change": change}})
+}
+
+// revokeRoomAccess отписывает соединения пользователя на всех узлах от
+// приватной комнаты, в которой он больше не участник.
+func (h *Handler) revokeRoomAccess(userID, roomID uint) {
+	if code, _ := h.roomAccess(roomID, userID); code != 403 {
+		return
+	}
+	h.revokeLocal(userID, roomID)
+	h.publish(clusterEnvelope{Kind: clusterRevoke, UserID: userID, RoomID: roomID})
+}
+
+// revokeLocal отписывает соединения пользователя на этом узле; соединение
+// /ws/rooms/:id закрывается.
+func (h *Handler) revokeLocal(userID, roomID uint) {
+	for _, cl := range h.users.of(userID) {
+		switch {
+		case !cl.mux && cl.room == roomID:
+			cl.evict(websocket.ClosePolicyViolation, "membership revoked")
+		case cl.mux && h.rooms.leave(roomID, cl):
+			cl.trySend(Event{Type: "unsubscribed", RoomID: roomID, Payload: gin.H{"reason": "membership revoked"}})
+		}
+	}
+}
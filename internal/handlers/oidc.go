@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"LinkUp/internal/audit"
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/models"
+	"LinkUp/internal/oidc"
+	"LinkUp/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// oidcStateTTL — сколько живет незавершенный вход через провайдера.
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	errOIDCState  = errors.New("invalid or expired state")
+	loginSanitize = regexp.MustCompile(`[^a-z0-9._-]+`)
+)
+
+// @Summary Список SSO-провайдеров
+// @Description Возвращает имена настроенных OIDC-провайдеров для кнопок входа
+// @Tags auth
+// @Produce json
+// @Success 200 {array} string
+// @Router /auth/oidc/providers [get]
+func (h *Handler) OIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, h.sso.Names())
+}
+
+// @Summary Начать вход через SSO
+// @Description Возвращает адрес авторизации у провайдера (authorization code + PKCE). Клиент должен сохранить state и сверить его при возврате
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Имя провайдера"
+// @Success 200 {object} OIDCAuthorizeResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /auth/oidc/{provider}/authorize [get]
+func (h *Handler) OIDCAuthorize(c *gin.Context) {
+	h.startOIDC(c, "OIDCAuthorize", nil)
+}
+
+// @Summary Привязать внешний аккаунт
+// @Description Начинает вход у провайдера, по завершении которого внешняя учетная запись привязывается к текущему пользователю. Callback привязки нужно вызвать с токеном этого же пользователя
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Имя провайдера"
+// @Success 200 {object} OIDCAuthorizeResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /auth/oidc/{provider}/link [post]
+func (h *Handler) OIDCLink(c *gin.Context) {
+	userID := uid(c)
+	h.startOIDC(c, "OIDCLink", &userID)
+}
+
+func (h *Handler) startOIDC(c *gin.Context, op string, linkUserID *uint) {
+	p, ok := h.sso.Get(c.Param("provider"))
+	if !ok {
+		apiErr := apiErrors.NewAPIError(op+".Provider", nil, "unknown provider "+c.Param("provider"), 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Unknown SSO provider.")
+		return
+	}
+
+	state, stateErr := oidc.RandomString(24)
+	nonce, nonceErr := oidc.RandomString(24)
+	verifier, challenge, pkceErr := oidc.NewPKCE()
+	if err := errors.Join(stateErr, nonceErr, pkceErr); err != nil {
+		apiErr := apiErrors.NewAPIError(op+".Random", err, "failed to generate state", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+
+	authURL, urlErr := p.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if urlErr != nil {
+		apiErr := apiErrors.NewAPIError(op+".Discover", urlErr, "provider discovery failed", 502)
+		apiErrors.LogAndRespondAPI(c, apiErr, "SSO provider is unavailable.")
+		return
+	}
+
+	st := models.OIDCLoginState{
+		StateHash:    utils.HashToken(state),
+		Provider:     p.Config().Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if createErr := h.db.Create(&st).Error; createErr != nil {
+		apiErr := apiErrors.NewAPIError(op+".SaveState", createErr, "failed to save state", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	// Заодно чистим брошенные попытки входа
+	h.db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+
+	c.JSON(http.StatusOK, OIDCAuthorizeResponse{AuthorizationURL: authURL, State: state})
+}
+
+// @Summary Завершить вход через SSO
+// @Description Принимает code и state из редиректа провайдера. Для входа возвращает токены (или challenge 2FA), для привязки — связанную учетную запись; привязку принимает только с токеном пользователя, который ее начал (иначе 403), чтобы чужая ссылка не привязала аккаунт провайдера к чужому пользователю. Пользователь без привязанного аккаунта создается, только если у провайдера включен AUTO_PROVISION и это позволяет REGISTRATION_MODE (в режимах invite и closed — только с REGISTRATION_SSO_PROVISION=true)
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Имя провайдера"
+// @Param callback body OIDCCallbackRequest true "Code и state"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /auth/oidc/{provider}/callback [post]
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	p, ok := h.sso.Get(c.Param("provider"))
+	if !ok {
+		apiErr := apiErrors.NewAPIError("OIDCCallback.Provider", nil, "unknown provider "+c.Param("provider"), 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Unknown SSO provider.")
+		return
+	}
+	var req OIDCCallbackRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("OIDCCallback.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+
+	st, stateErr := h.consumeOIDCState(req.State, p.Config().Name)
+	if stateErr != nil {
+		apiErr := apiErrors.NewAPIError("OIDCCallback.State", stateErr, "invalid state", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid or expired login attempt.")
+		return
+	}
+	// Привязку завершает только тот, кто ее начал. State сам по себе никого не
+	// аутентифицирует: иначе можно начать привязку у себя, дать жертве пройти
+	// вход у провайдера, и ее внешний аккаунт привязался бы к чужому пользователю.
+	// State уже погашен, поэтому повторить такую попытку нельзя.
+	if st.LinkUserID != nil && uid(c) != *st.LinkUserID {
+		apiErr := apiErrors.NewAPIError("OIDCCallback.Link", nil, "link callback from another user", 403)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Linking must be completed by the user who started it.")
+		return
+	}
+
+	ctx := c.Request.Context()
+	tokens, exchangeErr := p.Exchange(ctx, req.Code, st.CodeVerifier)
+	if exchangeErr != nil {
+		apiErr := apiErrors.NewAPIError("OIDCCallback.Exchange", exchangeErr, "code exchange failed", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "SSO login failed.")
+		return
+	}
+	claims, verifyErr := p.VerifyIDToken(ctx, tokens.IDToken, st.Nonce)
+	if verifyErr != nil {
+		apiErr := apiErrors.NewAPIError("OIDCCallback.VerifyIDToken", verifyErr, "id token rejected", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "SSO login failed.")
+		return
+	}
+
+	var ident models.ExternalIdentity
+	findErr := h.db.Where("issuer = ? AND subject = ?", claims.Issuer, claims.Subject).First(&ident).Error
+	if findErr != nil && !errors.Is(findErr, gorm.ErrRecordNotFound) {
+		apiErr := apiErrors.NewAPIError("OIDCCallback.FindIdentity", findErr, "identity lookup failed", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	found := findErr == nil
+
+	// Привязка к текущему аккаунту
+	if st.LinkUserID != nil {
+		if found && ident.UserID != *st.LinkUserID {
+			apiErr := apiErrors.NewAPIError("OIDCCallback.Link", nil, "identity already linked to another user", 409)
+			apiErrors.LogAndRespondAPI(c, apiErr, "This account is already linked to another user.")
+			return
+		}
+		if !found {
+			ident = models.ExternalIdentity{
+				UserID:   *st.LinkUserID,
+				Provider: p.Config().Name,
+				Issuer:   claims.Issuer,
+				Subject:  claims.Subject,
+				Email:    truncate(claims.String("email"), 255),
+			}
+			if createErr := h.db.Create(&ident).Error; createErr != nil {
+				apiErr := apiErrors.NewAPIError("OIDCCallback.Link", createErr, "failed to link identity", 409)
+				apiErrors.LogAndRespondAPI(c, apiErr, "This account is already linked.")
+				return
+			}
+			h.recordAuditAs(c, st.LinkUserID, audit.ActionIdentityLink, audit.TargetIdentity, ident.ID,
+				audit.Diff{}.Add("provider", nil, ident.Provider))
+		}
+		c.JSON(http.StatusOK, gin.H{"linked": true, "identity": ident})
+		return
+	}
+
+	var u models.User
+	switch {
+	case found:
+		if userErr := h.db.First(&u, ident.UserID).Error; userErr != nil {
+			apiErr := apiErrors.NewAPIError("OIDCCallback.FindUser", userErr, "linked user missing", 401)
+			apiErrors.LogAndRespondAPI(c, apiErr, "SSO login failed.")
+			return
+		}
+	case p.Config().AutoProvision && !provisioningAllowed():
+		apiErr := apiErrors.NewAPIError("OIDCCallback.Provision", errProvisioningClosed, "registration mode "+registrationMode(), 403)
+		apiErrors.LogAndRespondAPI(c, apiErr, "No LinkUp account is linked to this identity, and registration is not open.")
+		return
+	case p.Config().AutoProvision:
+		var provisionErr error
+		u, ident, provisionErr = h.provisionOIDCUser(p.Config(), claims)
+		if provisionErr != nil {
+			apiErr := apiErrors.NewAPIError("OIDCCallback.Provision", provisionErr, "failed to provision user", 500)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+			return
+		}
+		h.recordAuditAs(c, &u.ID, audit.ActionRegister, audit.TargetUser, u.ID,
+			audit.Diff{}.Add("login", nil, u.Login).Add("provider", nil, ident.Provider))
+	default:
+		apiErr := apiErrors.NewAPIError("OIDCCallback.NoAccount", nil, "no linked account for "+claims.Subject, 403)
+		apiErrors.LogAndRespondAPI(c, apiErr, "No LinkUp account is linked to this identity.")
+		return
+	}
+
+	now := time.Now()
+	h.db.Model(&ident).Update("last_login_at", &now)
+	h.loginOrChallenge(c, "OIDCCallback", u)
+}
+
+// consumeOIDCState находит и удаляет state; повторно он не принимается.
+func (h *Handler) consumeOIDCState(state, provider string) (models.OIDCLoginState, error) {
+	var st models.OIDCLoginState
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("state_hash = ? AND provider = ?", utils.HashToken(state), provider).
+			First(&st).Error; err != nil {
+			return errOIDCState
+		}
+		res := tx.Delete(&st)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 || time.Now().After(st.ExpiresAt) {
+			return errOIDCState
+		}
+		return nil
+	})
+	return st, err
+}
+
+// provisionOIDCUser создает локального пользователя по claims ID-токена.
+// Локального пароля у такого пользователя нет.
+func (h *Handler) provisionOIDCUser(cfg oidc.Config, claims *oidc.IDTokenClaims) (models.User, models.ExternalIdentity, error) {
+	base := claims.String(cfg.LoginClaim)
+	if base == "" {
+		base, _, _ = strings.Cut(claims.String("email"), "@")
+	}
+	base = loginBase(base)
+
+	name := strings.TrimSpace(claims.String(cfg.NameClaim))
+	if name == "" {
+		name = base
+	}
+
+	u := models.User{
+		Name:      truncate(name, 120),
+		AvatarURL: truncate(claims.String(cfg.AvatarClaim), 255),
+	}
+	ident := models.ExternalIdentity{
+		Provider: cfg.Name,
+		Issuer:   claims.Issuer,
+		Subject:  claims.Subject,
+		Email:    truncate(claims.String("email"), 255),
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		login, err := freeLogin(tx, base)
+		if err != nil {
+			return err
+		}
+		u.Login = login
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		ident.UserID = u.ID
+		return tx.Create(&ident).Error
+	})
+	return u, ident, err
+}
+
+// @Summary Привязанные внешние аккаунты
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.ExternalIdentity
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/identities [get]
+func (h *Handler) ListIdentities(c *gin.Context) {
+	var idents []models.ExternalIdentity
+	if findErr := h.db.Where("user_id = ?", uid(c)).Order("created_at asc").Find(&idents).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("ListIdentities.Find", findErr, "failed to load identities", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	c.JSON(http.StatusOK, idents)
+}
+
+// @Summary Отвязать внешний аккаунт
+// @Description Нельзя отвязать последний способ входа у пользователя без пароля
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID привязки"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /auth/identities/{id} [delete]
+func (h *Handler) UnlinkIdentity(c *gin.Context) {
+	var ident models.ExternalIdentity
+	if findErr := h.db.Where("id = ? AND user_id = ?", c.Param("id"), uid(c)).First(&ident).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("UnlinkIdentity.Find", findErr, "identity not found", 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Linked account not found.")
+		return
+	}
+
+	var u models.User
+	h.db.First(&u, uid(c))
+	if h.loginMethods(u) <= 1 {
+		apiErr := apiErrors.NewAPIError("UnlinkIdentity.LastMethod", nil, "last login method", 409)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Cannot unlink the only way to sign in.")
+		return
+	}
+
+	if deleteErr := h.db.Delete(&ident).Error; deleteErr != nil {
+		apiErr := apiErrors.NewAPIError("UnlinkIdentity.Delete", deleteErr, "failed to unlink", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	h.recordAudit(c, audit.ActionIdentityUnlink, audit.TargetIdentity, ident.ID, audit.Diff{}.Add("provider", ident.Provider, nil))
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// loginBase делает из внешнего имени основу для login: нижний регистр,
+// только [a-z0-9._-], не длиннее 56 байт.
+func loginBase(s string) string {
+	base := truncate(loginSanitize.ReplaceAllString(strings.ToLower(s), ""), 56)
+	if base == "" {
+		base = "user"
+	}
+	return base
+}
+
+// freeLogin подбирает свободный login: base, base-2, base-3...
+func freeLogin(tx *gorm.DB, base string) (string, error) {
+	login := base
+	for i := 2; ; i++ {
+		var n int64
+		if err := tx.Model(&models.User{}).Where("login = ?", login).Count(&n).Error; err != nil {
+			return "", err
+		}
+		if n == 0 {
+			return login, nil
+		}
+		if i > 1000 {
+			return "", fmt.Errorf("no free login for %q", base)
+		}
+		login = base + "-" + strconv.Itoa(i)
+	}
+}
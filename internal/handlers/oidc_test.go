@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"LinkUp/internal/auth"
+	"LinkUp/internal/models"
+	"LinkUp/internal/oidc"
+	"LinkUp/internal/oidc/oidctest"
+	"LinkUp/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB — отдельная SQLite в памяти на каждый тест.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := storage.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// doJSON выполняет запрос к роутеру и разбирает JSON-ответ.
+func doJSON(t *testing.T, r http.Handler, method, path, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	out := map[string]interface{}{}
+	_ = json.Unmarshal(w.Body.Bytes(), &out)
+	return w.Code, out
+}
+
+func oidcRouter(t *testing.T) (*gin.Engine, *oidctest.Issuer, *gorm.DB) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	iss, err := oidctest.NewIssuer("linkup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(iss.Close)
+	t.Setenv("REGISTRATION_MODE", "open")
+
+	db := testDB(t)
+	h := New(db, t.TempDir(), "http://x")
+	h.sso = oidc.NewRegistry(oidc.NewProvider(oidc.Config{Name: "mock", Issuer: iss.URL, ClientID: "linkup", RedirectURL: "http://app/cb", AutoProvision: true}, nil))
+	auth.SetSessionValidator(h.SessionActive)
+	t.Cleanup(func() { auth.SetSessionValidator(nil) })
+
+	r := gin.New()
+	r.POST("/register", h.Register)
+	r.GET("/auth/oidc/:provider/authorize", h.OIDCAuthorize)
+	r.POST("/auth/oidc/:provider/callback", auth.OptionalJWTMiddleware(), h.OIDCCallback)
+	pr := r.Group("", auth.JWTMiddleware())
+	pr.POST("/auth/oidc/:provider/link", h.OIDCLink)
+	return r, iss, db
+}
+
+// oidcFlow начинает вход (token == "") или привязку, «входит» у издателя с
+// claims и возвращает тело callback-запроса.
+func oidcFlow(t *testing.T, r http.Handler, iss *oidctest.Issuer, token string, claims jwt.MapClaims) map[string]string {
+	t.Helper()
+	method, path := http.MethodGet, "/auth/oidc/mock/authorize"
+	if token != "" {
+		method, path = http.MethodPost, "/auth/oidc/mock/link"
+	}
+	code, out := doJSON(t, r, method, path, token, nil)
+	if code != http.StatusOK {
+		t.Fatalf("%s: %d %v", path, code, out)
+	}
+	authCode, state, err := iss.Authorize(out["authorizationUrl"].(string), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != out["state"] {
+		t.Fatalf("state %q not passed to the provider", out["state"])
+	}
+	return map[string]string{"code": authCode, "state": state}
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	r, iss, db := oidcRouter(t)
+	alice := jwt.MapClaims{"sub": "sub-1", "preferred_username": "Alice Smith!", "name": "Alice", "email": "a@x.io", "picture": "http://p/a.png"}
+
+	cb := oidcFlow(t, r, iss, "", alice)
+	code, out := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb)
+	if code != http.StatusOK || out["token"] == nil {
+		t.Fatalf("callback: %d %v", code, out)
+	}
+	u := out["user"].(map[string]interface{})
+	if u["login"] != "alicesmith" || u["name"] != "Alice" || u["avatarUrl"] != "http://p/a.png" {
+		t.Fatalf("claim mapping: %v", u)
+	}
+	var ident models.ExternalIdentity
+	if err := db.Where("subject = ?", "sub-1").First(&ident).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ident.Issuer != iss.URL || ident.Provider != "mock" || ident.Email != "a@x.io" || ident.UserID != uint(u["id"].(float64)) {
+		t.Fatalf("identity: %+v", ident)
+	}
+
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb); code != http.StatusBadRequest {
+		t.Fatalf("state replay: %d", code)
+	}
+
+	// тот же sub входит в того же пользователя, а не создает второго
+	cb = oidcFlow(t, r, iss, "", alice)
+	if _, out := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb); out["user"].(map[string]interface{})["id"] != u["id"] {
+		t.Fatalf("second login: %v", out)
+	}
+	// занятый login получает суффикс
+	cb = oidcFlow(t, r, iss, "", jwt.MapClaims{"sub": "sub-2", "preferred_username": "alicesmith"})
+	if _, out := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb); out["user"].(map[string]interface{})["login"] != "alicesmith-2" {
+		t.Fatalf("login collision: %v", out)
+	}
+	var n int64
+	db.Model(&models.User{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("users: %d", n)
+	}
+
+	t.Setenv("REGISTRATION_MODE", "invite")
+	cb = oidcFlow(t, r, iss, "", jwt.MapClaims{"sub": "sub-3"})
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb); code != http.StatusForbidden {
+		t.Fatalf("provisioned in invite mode: %d", code)
+	}
+	cb = oidcFlow(t, r, iss, "", alice)
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb); code != http.StatusOK {
+		t.Fatalf("linked user in invite mode: %d", code)
+	}
+}
+
+func TestOIDCCallbackRejectsBadIDToken(t *testing.T) {
+	r, iss, db := oidcRouter(t)
+	for name, claims := range map[string]jwt.MapClaims{
+		"nonce": {"sub": "sub-1", "nonce": "forged"},
+		"iss":   {"sub": "sub-1", "iss": "https://evil.example"},
+		"aud":   {"sub": "sub-1", "aud": "other-client"},
+		"exp":   {"sub": "sub-1", "exp": 1},
+	} {
+		cb := oidcFlow(t, r, iss, "", claims)
+		if code, _ := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb); code != http.StatusUnauthorized {
+			t.Errorf("%s: %d", name, code)
+		}
+	}
+	// code от чужой попытки входа не подходит к этому state: verifier другой
+	cb := oidcFlow(t, r, iss, "", jwt.MapClaims{"sub": "sub-1"})
+	other := oidcFlow(t, r, iss, "", jwt.MapClaims{"sub": "sub-1"})
+	cb["code"] = other["code"]
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb); code != http.StatusUnauthorized {
+		t.Errorf("foreign code: %d", code)
+	}
+	var n int64
+	db.Model(&models.User{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("users created from rejected tokens: %d", n)
+	}
+}
+
+func TestOIDCLink(t *testing.T) {
+	r, iss, db := oidcRouter(t)
+	cb := oidcFlow(t, r, iss, "", jwt.MapClaims{"sub": "sub-1", "preferred_username": "alice"})
+	_, out := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb)
+	tokA := out["token"].(string)
+	_, out = doJSON(t, r, http.MethodPost, "/register", "", map[string]string{"login": "bob", "password": "Str0ng-pass", "name": "Bob"})
+	tokB := out["token"].(string)
+	bobID := uint(out["user"].(map[string]interface{})["id"].(float64))
+
+	// завершить привязку Боба может только Боб
+	cb = oidcFlow(t, r, iss, tokB, jwt.MapClaims{"sub": "sub-2"})
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", tokA, cb); code != http.StatusForbidden {
+		t.Fatalf("link completed by another user: %d", code)
+	}
+	cb = oidcFlow(t, r, iss, tokB, jwt.MapClaims{"sub": "sub-2"})
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb); code != http.StatusForbidden {
+		t.Fatalf("link completed anonymously: %d", code)
+	}
+
+	cb = oidcFlow(t, r, iss, tokB, jwt.MapClaims{"sub": "sub-2"})
+	code, out := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", tokB, cb)
+	if code != http.StatusOK || out["linked"] != true {
+		t.Fatalf("link: %d %v", code, out)
+	}
+	var ident models.ExternalIdentity
+	if err := db.Where("subject = ?", "sub-2").First(&ident).Error; err != nil || ident.UserID != bobID {
+		t.Fatalf("identity: %+v %v", ident, err)
+	}
+
+	// внешний аккаунт Алисы уже привязан к ней
+	cb = oidcFlow(t, r, iss, tokB, jwt.MapClaims{"sub": "sub-1"})
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", tokB, cb); code != http.StatusConflict {
+		t.Fatalf("already linked: %d", code)
+	}
+
+	cb = oidcFlow(t, r, iss, "", jwt.MapClaims{"sub": "sub-2"})
+	if _, out := doJSON(t, r, http.MethodPost, "/auth/oidc/mock/callback", "", cb); out["user"].(map[string]interface{})["login"] != "bob" {
+		t.Fatalf("login through linked identity: %v", out)
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"LinkUp/internal/audit"
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/models"
+	"LinkUp/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// checkPasswordPolicy отвечает 400 с причиной, если пароль не проходит политику.
+func (h *Handler) checkPasswordPolicy(c *gin.Context, op, password, login string) bool {
+	if policyErr := h.passwords.Validate(password, login); policyErr != nil {
+		apiErr := apiErrors.NewAPIError(op+".PasswordPolicy", policyErr, "weak password", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Password rejected: "+policyErr.Error()+".")
+		return false
+	}
+	return true
+}
+
+// @Summary Сменить пароль
+// @Description Меняет пароль текущего пользователя. Требует текущий пароль; новый пароль проверяется парольной политикой. Остальные сессии пользователя завершаются, его персональные токены отзываются
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body ChangePasswordRequest true "Текущий и новый пароль"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /auth/password/change [post]
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("ChangePassword.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	var u models.User
+	if findErr := h.db.First(&u, uid(c)).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("ChangePassword.FindUser", findErr, "user not found", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Unauthorized.")
+		return
+	}
+	if u.Password == "" {
+		apiErr := apiErrors.NewAPIError("ChangePassword.NoPassword", nil, "account has no password", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "This account has no password. Use password reset to set one.")
+		return
+	}
+	if h.checkLockout(c, "ChangePassword", u.Login, &u.ID) {
+		return
+	}
+	if !utils.CheckPassword(u.Password, req.CurrentPassword) {
+		if h.loginFailed(c, "ChangePassword", u.Login, &u.ID, attemptBadPassword) {
+			return
+		}
+		apiErr := apiErrors.NewAPIError("ChangePassword.CheckPassword", nil, "wrong current password", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Current password is incorrect.")
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		apiErr := apiErrors.NewAPIError("ChangePassword.Validate", nil, "password unchanged", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "New password must differ from the current one.")
+		return
+	}
+	if !h.checkPasswordPolicy(c, "ChangePassword", req.NewPassword, u.Login) {
+		return
+	}
+
+	hash, hashErr := utils.HashPassword(req.NewPassword)
+	if hashErr != nil {
+		apiErr := apiErrors.NewAPIError("ChangePassword.HashPassword", hashErr, "failed to hash password", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	// Как и при сбросе: кто знал старый пароль, мог выпустить себе
+	// персональный токен, поэтому отзываются и они, и выданные по ним билеты.
+	// Текущая сессия остается
+	txErr := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&u).Update("password", hash).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&models.Session{}).Where("user_id = ? AND id <> ? AND revoked_at IS NULL", u.ID, sid(c)).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PersonalAccessToken{}).Where("user_id = ? AND revoked_at IS NULL", u.ID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND (session_id <> ? OR token_id IS NOT NULL)", u.ID, sid(c)).
+			Delete(&models.WSTicket{}).Error
+	})
+	if txErr != nil {
+		apiErr := apiErrors.NewAPIError("ChangePassword.Update", txErr, "failed to update password", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	h.lockout.Succeed(c.Request.Context(), u.Login)
+	h.recordAudit(c, audit.ActionPasswordChange, audit.TargetUser, u.ID, nil)
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
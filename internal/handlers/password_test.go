@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"LinkUp/internal/auth"
+	"LinkUp/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChangePasswordRevokesCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("REGISTRATION_MODE", "open")
+	db := testDB(t)
+	h := New(db, t.TempDir(), "http://x")
+	auth.SetSessionValidator(h.SessionActive)
+	t.Cleanup(func() { auth.SetSessionValidator(nil) })
+
+	r := gin.New()
+	r.POST("/register", h.Register)
+	r.POST("/login", h.Login)
+	pr := r.Group("", auth.JWTMiddleware())
+	pr.GET("/me", h.Me)
+	pr.POST("/auth/password/change", h.ChangePassword)
+
+	_, out := doJSON(t, r, http.MethodPost, "/register", "", map[string]string{"login": "alice", "password": "Str0ng-pass", "name": "Alice"})
+	current := out["token"].(string)
+	_, out = doJSON(t, r, http.MethodPost, "/login", "", map[string]string{"login": "alice", "password": "Str0ng-pass"})
+	other := out["token"].(string)
+	if err := db.Create(&models.PersonalAccessToken{UserID: 1, Name: "bot", TokenHash: "hash", Scopes: []string{auth.ScopeUserRead}}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if code, out := doJSON(t, r, http.MethodPost, "/auth/password/change", current, ChangePasswordRequest{CurrentPassword: "Str0ng-pass", NewPassword: "An0ther-pass"}); code != http.StatusOK {
+		t.Fatalf("change: %d %v", code, out)
+	}
+	if code, _ := doJSON(t, r, http.MethodGet, "/me", current, nil); code != http.StatusOK {
+		t.Fatalf("current session: %d", code)
+	}
+	if code, _ := doJSON(t, r, http.MethodGet, "/me", other, nil); code != http.StatusUnauthorized {
+		t.Fatalf("other session: %d", code)
+	}
+	var pat models.PersonalAccessToken
+	db.First(&pat)
+	if pat.RevokedAt == nil {
+		t.Fatal("personal access token survived the password change")
+	}
+}
@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Состояния присутствия. online и idle определяются активностью соединений,
+// away и dnd пользователь выбирает сам, offline — соединений нет или
+// пользователь скрывает присутствие.
+const (
+	stateOnline  = "online"
+	stateIdle    = "idle"
+	stateAway    = "away"
+	stateDND     = "dnd"
+	stateOffline = "offline"
+)
+
+// wsIdleAfter — через сколько без активности соединение считается
+// бездействующим (WS_IDLE_AFTER, 5m).
+func wsIdleAfter() time.Duration {
+	return envDuration("WS_IDLE_AFTER", 5*time.Minute)
+}
+
+// Presence — кто онлайн во всем кластере. Соединения этого узла учитываются
+// по отдельности: пользователь онлайн, пока открыто хотя бы одно, и бездействует,
+// когда бездействуют все. Состояние других узлов приходит через брокер дельтами
+// и периодическими снимками. Узел, от которого давно нет снимка, считается
+// упавшим, и его пользователи — офлайн.
+type Presence struct {
+	mu     sync.Mutex
+	local  map[uint]*localUser
+	remote map[string]*nodePresence
+	// statuses — заданные пользователями статусы тех, кто онлайн на любом узле
+	statuses  map[uint]presenceStatus
+	ttl       time.Duration
+	idleAfter time.Duration
+	// load читает статус пользователя из БД; nil — статусов нет
+	load func(uid uint) presenceStatus
+}
+
+// localUser — соединения пользователя на этом узле.
+type localUser struct {
+	since time.Time
+	conns map[*Client]activity
+	// idle — состояние, о котором уже сообщено (см. idleChanges)
+	idle bool
+}
+
+// activity — последняя активность соединения; idle — клиент сам сообщил,
+// что пользователь отошел.
+type activity struct {
+	at   time.Time
+	idle bool
+}
+
+// nodePresence — пользователи другого узла, комнаты, на которые подписаны
+// их соединения, и бездействующие пользователи.
+type nodePresence struct {
+	seen  time.Time
+	users map[uint][]uint
+	idle  map[uint]bool
+}
+
+// presenceStatus — статус, заданный пользователем (поля models.User).
+type presenceStatus struct {
+	mode      string
+	text      string
+	emoji     string
+	expiresAt *time.Time
+	hidden    bool
+}
+
+// custom сообщает, задан ли свой статус и не истек ли он.
+func (s presenceStatus) custom(now time.Time) bool {
+	return (s.text != "" || s.emoji != "") && (s.expiresAt == nil || now.Before(*s.expiresAt))
+}
+
+// NewPresence создает пустое состояние.
+func NewPresence() *Presence {
+	return &Presence{
+		local:     map[uint]*localUser{},
+		remote:    map[string]*nodePresence{},
+		statuses:  map[uint]presenceStatus{},
+		ttl:       3 * presenceSyncInterval,
+		idleAfter: wsIdleAfter(),
+	}
+}
+
+// Online отмечает новое соединение на этом узле и загружает статус
+// пользователя, если его еще нет.
+func (p *Presence) Online(c *Client) {
+	p.mu.Lock()
+	u := p.local[c.userID]
+	if u == nil {
+		u = &localUser{since: time.Now(), conns: map[*Client]activity{}}
+		p.local[c.userID] = u
+	}
+	u.conns[c] = activity{at: time.Now()}
+	p.mu.Unlock()
+	p.loadStatus(c.userID)
+}
+
+// Offline отмечает закрытие соединения. true — это было последнее
+// соединение пользователя на узле.
+func (p *Presence) Offline(c *Client) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u := p.local[c.userID]
+	if u == nil {
+		return false
+	}
+	delete(u.conns, c)
+	if len(u.conns) > 0 {
+		return false
+	}
+	delete(p.local, c.userID)
+	p.forgetLocked(c.userID)
+	return true
+}
+
+// Touch отмечает активность соединения; idle=true — клиент сообщил, что
+// пользователь отошел. true — бездействие пользователя на узле изменилось.
+func (p *Presence) Touch(c *Client, idle bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u := p.local[c.userID]
+	if u == nil {
+		return false
+	}
+	if _, ok := u.conns[c]; !ok {
+		return false
+	}
+	u.conns[c] = activity{at: time.Now(), idle: idle}
+	cur := p.idleLocked(u, time.Now())
+	if cur == u.idle {
+		return false
+	}
+	u.idle = cur
+	return true
+}
+
+// idleLocked сообщает, бездействуют ли все соединения пользователя. Вызывается под p.mu.
+func (p *Presence) idleLocked(u *localUser, now time.Time) bool {
+	for _, a := range u.conns {
+		if !a.idle && now.Sub(a.at) <= p.idleAfter {
+			return false
+		}
+	}
+	return true
+}
+
+// idleChanges возвращает локальных пользователей, у которых с прошлого вызова
+// изменилось бездействие, и тех, чей свой статус истек. Вызывается периодически.
+func (p *Presence) idleChanges() []uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var ids []uint
+	for uid, u := range p.local {
+		if idle := p.idleLocked(u, now); idle != u.idle {
+			u.idle = idle
+			ids = append(ids, uid)
+		}
+	}
+	for uid, s := range p.statuses {
+		if s.expiresAt != nil && !now.Before(*s.expiresAt) {
+			s.text, s.emoji, s.expiresAt = "", "", nil
+			p.statuses[uid] = s
+			if p.local[uid] != nil {
+				ids = append(ids, uid)
+			}
+		}
+	}
+	return ids
+}
+
+// LastSeen возвращает время подключения для локального пользователя или
+// время последнего снимка узла для удаленного.
+func (p *Presence) LastSeen(uid uint) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if u, ok := p.local[uid]; ok {
+		return u.since, true
+	}
+	var last time.Time
+	for _, n := range p.fresh() {
+		if _, ok := n.users[uid]; ok && n.seen.After(last) {
+			last = n.seen
+		}
+	}
+	return last, !last.IsZero()
+}
+
+// IsOnline сообщает, есть ли у пользователя соединение на любом узле.
+func (p *Presence) IsOnline(uid uint) bool {
+	_, ok := p.LastSeen(uid)
+	return ok
+}
+
+// OnlineOf возвращает тех из ids, кто онлайн на любом узле.
+func (p *Presence) OnlineOf(ids []uint) []uint {
+	var out []uint
+	for _, id := range ids {
+		if p.IsOnline(id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// state возвращает состояние пользователя по его соединениям на всех узлах:
+// online, idle или offline.
+func (p *Presence) state(uid uint) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stateLocked(uid)
+}
+
+func (p *Presence) stateLocked(uid uint) string {
+	st := stateOffline
+	if u, ok := p.local[uid]; ok {
+		if !u.idle {
+			return stateOnline
+		}
+		st = stateIdle
+	}
+	for _, n := range p.fresh() {
+		if _, ok := n.users[uid]; ok {
+			if !n.idle[uid] {
+				return stateOnline
+			}
+			st = stateIdle
+		}
+	}
+	return st
+}
+
+// effectiveState учитывает выбранный пользователем away или dnd: они
+// показываются, пока у пользователя есть соединения.
+func effectiveState(conn, mode string) string {
+	if conn != stateOffline && (mode == stateAway || mode == stateDND) {
+		return mode
+	}
+	return conn
+}
+
+// describe возвращает присутствие пользователя для presence_update.
+// false — пользователь скрывает присутствие.
+func (p *Presence) describe(uid uint) (map[string]interface{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.statuses[uid]
+	if s.hidden {
+		return nil, false
+	}
+	now := time.Now()
+	d := map[string]interface{}{
+		"online":   true,
+		"lastSeen": now,
+		"state":    effectiveState(p.stateLocked(uid), s.mode),
+	}
+	if s.custom(now) {
+		d["text"], d["emoji"] = s.text, s.emoji
+		if s.expiresAt != nil {
+			d["expiresAt"] = *s.expiresAt
+		}
+	}
+	return d, true
+}
+
+// visible сообщает, показывается ли присутствие пользователя другим.
+func (p *Presence) visible(uid uint) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.statuses[uid].hidden
+}
+
+// ------------------- Статусы -------------------
+
+// loadStatus загружает статус пользователя, если его еще нет.
+func (p *Presence) loadStatus(uid uint) {
+	p.mu.Lock()
+	_, ok := p.statuses[uid]
+	p.mu.Unlock()
+	if !ok {
+		p.reloadStatus(uid)
+	}
+}
+
+// reloadStatus перечитывает статус пользователя, например после его
+// изменения на другом узле.
+func (p *Presence) reloadStatus(uid uint) {
+	if p.load != nil {
+		p.setStatus(uid, p.load(uid))
+	}
+}
+
+// setStatus запоминает статус пользователя, если он онлайн.
+func (p *Presence) setStatus(uid uint, s presenceStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Пока статус читался, пользователь мог уйти со всех узлов
+	if p.stateLocked(uid) != stateOffline {
+		p.statuses[uid] = s
+	}
+}
+
+// forgetLocked забывает статус пользователя, у которого не осталось
+// соединений ни на одном узле. Вызывается под p.mu.
+func (p *Presence) forgetLocked(uid uint) {
+	if p.stateLocked(uid) == stateOffline {
+		delete(p.statuses, uid)
+	}
+}
+
+// ------------------- Узлы кластера -------------------
+
+// localUsers возвращает пользователей с соединениями на этом узле.
+func (p *Presence) localUsers() []uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids := make([]uint, 0, len(p.local))
+	for uid := range p.local {
+		ids = append(ids, uid)
+	}
+	return ids
+}
+
+func (p *Presence) isLocal(uid uint) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.local[uid] != nil
+}
+
+// isIdle сообщает, бездействуют ли все соединения пользователя на узле.
+func (p *Presence) isIdle(uid uint) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u := p.local[uid]
+	return u != nil && u.idle
+}
+
+// remoteRoomUsers возвращает пользователей других узлов, подписанных на комнату.
+func (p *Presence) remoteRoomUsers(roomID uint) []uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seen := map[uint]bool{}
+	var ids []uint
+	for _, n := range p.fresh() {
+		for uid, rooms := range n.users {
+			if !seen[uid] && containsID(rooms, roomID) {
+				seen[uid] = true
+				ids = append(ids, uid)
+			}
+		}
+	}
+	return ids
+}
+
+// remoteRooms возвращает комнаты, на которые подписан пользователь на других узлах.
+func (p *Presence) remoteRooms(uid uint) []uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ids []uint
+	for _, n := range p.fresh() {
+		ids = append(ids, n.users[uid]...)
+	}
+	return ids
+}
+
+// setRemoteUser применяет дельту узла node: rooms — все комнаты пользователя на
+// узле, online=false — у него там не осталось соединений, idle — все его
+// соединения там бездействуют. Возвращает комнаты, в которые пользователь
+// вошел и из которых вышел, и изменилось ли его бездействие на узле.
+func (p *Presence) setRemoteUser(node string, uid uint, rooms []uint, online, idle bool) (joined, left []uint, idleChanged bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := p.remote[node]
+	if n == nil {
+		n = &nodePresence{users: map[uint][]uint{}, idle: map[uint]bool{}}
+		p.remote[node] = n
+	}
+	n.seen = time.Now()
+	before := n.users[uid]
+	idleChanged = online && n.idle[uid] != idle
+	if online {
+		n.users[uid] = rooms
+		n.idle[uid] = idle
+	} else {
+		delete(n.users, uid)
+		delete(n.idle, uid)
+		rooms = nil
+		p.forgetLocked(uid)
+	}
+	for _, id := range rooms {
+		if !containsID(before, id) {
+			joined = append(joined, id)
+		}
+	}
+	for _, id := range before {
+		if !containsID(rooms, id) {
+			left = append(left, id)
+		}
+	}
+	return joined, left, idleChanged
+}
+
+// setRemoteNode заменяет состояние узла его снимком; idle — бездействующие
+// пользователи узла.
+func (p *Presence) setRemoteNode(node string, users map[uint][]uint, idle []uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if users == nil {
+		users = map[uint][]uint{}
+	}
+	n := &nodePresence{seen: time.Now(), users: users, idle: map[uint]bool{}}
+	for _, uid := range idle {
+		n.idle[uid] = true
+	}
+	p.remote[node] = n
+}
+
+// unknownStatuses возвращает пользователей других узлов, чьи статусы еще не загружены.
+func (p *Presence) unknownStatuses() []uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ids []uint
+	for _, n := range p.fresh() {
+		for uid := range n.users {
+			if _, ok := p.statuses[uid]; !ok {
+				ids = append(ids, uid)
+			}
+		}
+	}
+	return ids
+}
+
+// prune забывает узлы, от которых давно нет снимков, и статусы
+// пользователей, которые после этого офлайн.
+func (p *Presence) prune() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for node, n := range p.remote {
+		if time.Since(n.seen) > p.ttl {
+			delete(p.remote, node)
+		}
+	}
+	for uid := range p.statuses {
+		p.forgetLocked(uid)
+	}
+}
+
+// fresh возвращает узлы с актуальным состоянием; вызывается под p.mu.
+func (p *Presence) fresh() []*nodePresence {
+	nodes := make([]*nodePresence, 0, len(p.remote))
+	for _, n := range p.remote {
+		if time.Since(n.seen) <= p.ttl {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedIDs возвращает ключи множества по возрастанию.
+func sortedIDs(set map[uint]bool) []uint {
+	ids := make([]uint, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"log"
+	"time"
+	"unicode/utf8"
+
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Расширенное присутствие. online и idle сервер определяет сам: соединение
+// бездействует, если клиент дольше WS_IDLE_AFTER не присылал кадров activity,
+// typing или message (или сам сообщил idle), а пользователь — если
+// бездействуют все его соединения. Поверх этого пользователь может выбрать
+// away или dnd, задать свой статус с эмодзи и сроком и скрыть присутствие:
+// тогда другие видят его офлайн, а lastSeen не показывается.
+
+// presenceModeAuto — режим, в котором состояние определяется активностью.
+const presenceModeAuto = "auto"
+
+// Ограничения своего статуса
+const (
+	maxStatusTextLen  = 100 // символов
+	maxStatusEmojiLen = 32  // байт
+)
+
+// statusOf возвращает статус, заданный пользователем.
+func statusOf(u models.User) presenceStatus {
+	return presenceStatus{
+		mode:      u.PresenceMode,
+		text:      u.StatusText,
+		emoji:     u.StatusEmoji,
+		expiresAt: u.StatusExpiresAt,
+		hidden:    u.HideOnline,
+	}
+}
+
+// loadPresenceStatus читает статус пользователя из БД (см. Presence.load).
+func (h *Handler) loadPresenceStatus(userID uint) presenceStatus {
+	var u models.User
+	if err := h.db.Select("id", "presence_mode", "status_text", "status_emoji", "status_expires_at", "hide_online").
+		First(&u, userID).Error; err != nil {
+		log.Printf("[PRESENCE] load status of user %d: %v", userID, err)
+	}
+	return statusOf(u)
+}
+
+// presenceOf возвращает присутствие пользователя u так, как его видит viewer.
+func (h *Handler) presenceOf(u models.User, viewer uint) PresenceResponse {
+	s := statusOf(u)
+	res := PresenceResponse{
+		State:    effectiveState(h.presence.state(u.ID), s.mode),
+		LastSeen: u.LastSeen,
+	}
+	if s.custom(time.Now()) {
+		res.Text, res.Emoji, res.ExpiresAt = s.text, s.emoji, s.expiresAt
+	}
+	switch {
+	case viewer == u.ID:
+		res.Mode, res.HideOnline = presenceModeAuto, s.hidden
+		if s.mode != "" {
+			res.Mode = s.mode
+		}
+	case s.hidden:
+		res.State, res.LastSeen = stateOffline, nil
+	}
+	return res
+}
+
+// persistLastSeen сохраняет время закрытия последнего соединения пользователя на узле.
+func (h *Handler) persistLastSeen(userID uint) {
+	if err := h.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("last_seen", time.Now()).Error; err != nil {
+		log.Printf("[PRESENCE] save last seen of user %d: %v", userID, err)
+	}
+}
+
+// presenceUpdated просит хабы комнат пользователя на этом узле разослать
+// presence_update.
+func (h *Handler) presenceUpdated(userID uint) {
+	rooms := map[uint]bool{}
+	for _, id := range h.userRooms(userID) {
+		rooms[id] = true
+	}
+	for _, id := range h.presence.remoteRooms(userID) {
+		rooms[id] = true
+	}
+	for id := range rooms {
+		h.rooms.refreshPresence(id)
+	}
+}
+
+// statusChanged применяет новый статус пользователя на всех узлах и
+// сообщает о нем его соединениям событием status.
+func (h *Handler) statusChanged(u models.User) {
+	h.presence.setStatus(u.ID, statusOf(u))
+	h.presenceUpdated(u.ID)
+	h.users.Emit(u.ID, Event{Type: "status", Payload: h.presenceOf(u, u.ID)})
+	if h.broker != nil {
+		h.publish(clusterEnvelope{Kind: clusterStatus, UserID: u.ID})
+	}
+}
+
+// watchPresence периодически находит пользователей, которые начали или
+// перестали бездействовать или у которых истек свой статус, и рассылает
+// изменения.
+func (h *Handler) watchPresence() {
+	tick := min(h.presence.idleAfter/4, 15*time.Second)
+	if tick <= 0 {
+		return
+	}
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	for range t.C {
+		for _, id := range h.presence.idleChanges() {
+			h.presenceUpdated(id)
+			h.presenceChanged(id)
+		}
+	}
+}
+
+// activity обрабатывает кадр activity: отмечает активность соединения и
+// рассылает изменение, если пользователь перестал или начал бездействовать.
+func (c *Client) activity(idle bool) {
+	if c.handler.presence.Touch(c, idle) {
+		c.handler.presenceUpdated(c.userID)
+		c.handler.presenceChanged(c.userID)
+	}
+}
+
+// ==================== СТАТУС ====================
+
+// @Summary Изменить статус присутствия
+// @Description Меняет статус текущего пользователя. mode: auto — online или idle по активности клиентов, away и dnd показываются вместо них, пока пользователь подключен. text, emoji и expiresAt задают свой статус целиком: пропущенные поля очищаются, пустые text и emoji снимают статус, после expiresAt он снимается сам. hideOnline — другие видят пользователя офлайн и без lastSeen. Изменение сразу видно в presence_update комнат, а соединения пользователя получают событие status
+// @Tags user
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param status body UpdateStatusRequest true "Новый статус"
+// @Success 200 {object} PresenceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /user/me/status [put]
+func (h *Handler) UpdateStatus(c *gin.Context) {
+	var req UpdateStatusRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("UpdateStatus.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	updates := map[string]interface{}{}
+	if req.Mode != nil {
+		switch *req.Mode {
+		case presenceModeAuto:
+			updates["presence_mode"] = ""
+		case stateAway, stateDND:
+			updates["presence_mode"] = *req.Mode
+		default:
+			apiErr := apiErrors.NewAPIError("UpdateStatus.ValidateMode", nil, "invalid mode", 400)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Mode must be auto, away or dnd.")
+			return
+		}
+	}
+	if req.Text != nil || req.Emoji != nil || req.ExpiresAt != nil {
+		var text, emoji string
+		if req.Text != nil {
+			text = *req.Text
+		}
+		if req.Emoji != nil {
+			emoji = *req.Emoji
+		}
+		if utf8.RuneCountInString(text) > maxStatusTextLen || len(emoji) > maxStatusEmojiLen {
+			apiErr := apiErrors.NewAPIError("UpdateStatus.ValidateText", nil, "status too long", 400)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Status text or emoji is too long.")
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			apiErr := apiErrors.NewAPIError("UpdateStatus.ValidateExpiry", nil, "expiry in the past", 400)
+			apiErrors.LogAndRespondAPI(c, apiErr, "expiresAt must be in the future.")
+			return
+		}
+		updates["status_text"] = text
+		updates["status_emoji"] = emoji
+		updates["status_expires_at"] = req.ExpiresAt
+		if text == "" && emoji == "" {
+			updates["status_expires_at"] = nil
+		}
+	}
+	if req.HideOnline != nil {
+		updates["hide_online"] = *req.HideOnline
+	}
+	h.applyStatus(c, "UpdateStatus", updates)
+}
+
+// @Summary Сбросить статус присутствия
+// @Description Снимает свой статус и возвращает режим auto. Настройка hideOnline не меняется
+// @Tags user
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} PresenceResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /user/me/status [delete]
+func (h *Handler) ClearStatus(c *gin.Context) {
+	h.applyStatus(c, "ClearStatus", map[string]interface{}{
+		"presence_mode":     "",
+		"status_text":       "",
+		"status_emoji":      "",
+		"status_expires_at": nil,
+	})
+}
+
+// applyStatus сохраняет изменения статуса, рассылает их и отвечает новым присутствием.
+func (h *Handler) applyStatus(c *gin.Context, op string, updates map[string]interface{}) {
+	if len(updates) > 0 {
+		if updateErr := h.db.Model(&models.User{}).Where("id = ?", uid(c)).Updates(updates).Error; updateErr != nil {
+			apiErr := apiErrors.NewAPIError(op+".Updates", updateErr, "update failed", 500)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Failed to update status.")
+			return
+		}
+	}
+	var u models.User
+	if findErr := h.db.First(&u, uid(c)).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError(op+".FindUser", findErr, "not found", 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "User not found.")
+		return
+	}
+	if len(updates) > 0 {
+		h.statusChanged(u)
+	}
+	c.JSON(200, h.presenceOf(u, u.ID))
+}
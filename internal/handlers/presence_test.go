@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresencePerConnection(t *testing.T) {
+	p := NewPresence()
+	p.load = func(uint) presenceStatus { return presenceStatus{mode: stateDND, hidden: true} }
+	tab1, tab2 := testClient(1, 1), testClient(1, 1)
+	p.Online(tab1)
+	p.Online(tab2)
+
+	if p.Touch(tab1, true) {
+		t.Fatal("user idle while another tab is active")
+	}
+	if !p.Touch(tab2, true) || p.state(1) != stateIdle {
+		t.Fatalf("state %s, want idle once every tab is idle", p.state(1))
+	}
+	if !p.Touch(tab1, false) || p.state(1) != stateOnline {
+		t.Fatal("activity in one tab should make the user online")
+	}
+	if _, ok := p.describe(1); ok {
+		t.Fatal("hidden user described in presence_update")
+	}
+
+	if p.Offline(tab1) || !p.IsOnline(1) {
+		t.Fatal("closing one tab took the user offline")
+	}
+	if !p.Offline(tab2) || p.IsOnline(1) {
+		t.Fatal("user online after the last tab closed")
+	}
+	if _, ok := p.statuses[1]; ok {
+		t.Fatal("status of an offline user kept")
+	}
+	if got := effectiveState(stateOffline, stateDND); got != stateOffline {
+		t.Fatalf("offline user shown as %s", got)
+	}
+}
+
+func TestPresenceIdleTimeout(t *testing.T) {
+	p := NewPresence()
+	p.idleAfter = time.Millisecond
+	c := testClient(1, 1)
+	p.Online(c)
+	time.Sleep(5 * time.Millisecond)
+	if got := p.idleChanges(); len(got) != 1 || got[0] != 1 || p.state(1) != stateIdle {
+		t.Fatalf("idleChanges = %v, state %s", got, p.state(1))
+	}
+	if got := p.idleChanges(); len(got) != 0 {
+		t.Fatalf("idle change reported twice: %v", got)
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"LinkUp/internal/audit"
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/models"
+	"LinkUp/internal/privacy"
+	"LinkUp/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamExport отдает архив как вложение. Заголовки уже отправлены, поэтому
+// ошибка записи только логируется.
+func streamExport(c *gin.Context, op string, export *privacy.Export) {
+	name := fmt.Sprintf("linkup-export-%d-%s.zip", export.User.ID, export.ExportedAt.Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	if writeErr := export.WriteArchive(c.Writer); writeErr != nil {
+		log.Printf("[API] %v", apiErrors.NewAPIError(op+".WriteArchive", writeErr, "export interrupted", 500))
+	}
+}
+
+// eraseUser удаляет аккаунт и сбрасывает счетчики блокировки его логина.
+func (h *Handler) eraseUser(c *gin.Context, u models.User) error {
+	if eraseErr := h.privacy.Erase(c.Request.Context(), u.ID); eraseErr != nil {
+		return eraseErr
+	}
+	if unlockErr := h.lockout.Unlock(c.Request.Context(), u.Login); unlockErr != nil {
+		log.Printf("[API] unlock erased login %q: %v", u.Login, unlockErr)
+	}
+	return nil
+}
+
+// @Summary Выгрузить мои данные
+// @Description Возвращает zip-архив с персональными данными текущего пользователя: data.json (профиль, сообщения, реакции, голоса, упоминания, аналитика, достижения, файлы, сессии и др.) и загруженные файлы в каталоге files/
+// @Tags user
+// @Security BearerAuth
+// @Produce application/zip
+// @Success 200 {file} file
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /user/me/export [get]
+func (h *Handler) ExportMyData(c *gin.Context) {
+	export, collectErr := h.privacy.Collect(c.Request.Context(), uid(c))
+	if collectErr != nil {
+		code, msg := 500, "Internal server error."
+		if errors.Is(collectErr, privacy.ErrNotFound) {
+			code, msg = 404, "User not found."
+		}
+		apiErr := apiErrors.NewAPIError("ExportMyData.Collect", collectErr, "export failed", code)
+		apiErrors.LogAndRespondAPI(c, apiErr, msg)
+		return
+	}
+	streamExport(c, "ExportMyData", export)
+}
+
+// @Summary Удалить мой аккаунт
+// @Description Безвозвратно удаляет аккаунт текущего пользователя. Сообщения остаются в комнатах от имени «Deleted user», остальные персональные данные и загруженные файлы удаляются, все сессии и токены отзываются. Требует текущий пароль, а для аккаунтов без пароля — повтор логина в поле confirm
+// @Tags user
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body DeleteAccountRequest true "Подтверждение удаления"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /user/me [delete]
+func (h *Handler) DeleteMyAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("DeleteMyAccount.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	var u models.User
+	if findErr := h.db.Where("erased_at IS NULL").First(&u, uid(c)).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("DeleteMyAccount.FindUser", findErr, "user not found", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Unauthorized.")
+		return
+	}
+	if u.Password != "" {
+		if h.checkLockout(c, "DeleteMyAccount", u.Login, &u.ID) {
+			return
+		}
+		if !utils.CheckPassword(u.Password, req.Password) {
+			if h.loginFailed(c, "DeleteMyAccount", u.Login, &u.ID, attemptBadPassword) {
+				return
+			}
+			apiErr := apiErrors.NewAPIError("DeleteMyAccount.CheckPassword", nil, "wrong password", 401)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Password is incorrect.")
+			return
+		}
+	} else if req.Confirm != u.Login {
+		apiErr := apiErrors.NewAPIError("DeleteMyAccount.Confirm", nil, "confirmation mismatch", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Type your login in the confirm field to delete the account.")
+		return
+	}
+
+	if eraseErr := h.eraseUser(c, u); eraseErr != nil {
+		apiErr := apiErrors.NewAPIError("DeleteMyAccount.Erase", eraseErr, "failed to erase account", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	h.recordAudit(c, audit.ActionAccountDelete, audit.TargetUser, u.ID, nil)
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// ==================== ЗАПРОСЫ ПО ПЕРСОНАЛЬНЫМ ДАННЫМ ====================
+
+// @Summary Выгрузить данные пользователя
+// @Description Администратор выгружает архив с персональными данными пользователя по его запросу. Формат тот же, что у /user/me/export
+// @Tags admin
+// @Security BearerAuth
+// @Produce application/zip
+// @Param id path int true "ID пользователя"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/export [get]
+func (h *Handler) AdminExportUser(c *gin.Context) {
+	if !h.hasPermission(c, "admin.users.export") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	export, err := h.privacy.Collect(c.Request.Context(), uint(userID))
+	if errors.Is(err, privacy.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("[API] export user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export user data"})
+		return
+	}
+	h.recordAudit(c, audit.ActionUserExport, audit.TargetUser, uint(userID), nil)
+	streamExport(c, "AdminExportUser", export)
+}
+
+// @Summary Удалить аккаунт пользователя
+// @Description Администратор удаляет аккаунт пользователя по его запросу. Действует так же, как DELETE /user/me, но без подтверждения паролем
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id} [delete]
+func (h *Handler) AdminDeleteUser(c *gin.Context) {
+	if !h.hasPermission(c, "admin.users.delete") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions"})
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	var u models.User
+	if err := h.db.Where("erased_at IS NULL").First(&u, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
+	err = h.eraseUser(c, u)
+	if errors.Is(err, privacy.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("[API] erase user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete user"})
+		return
+	}
+	h.recordAudit(c, audit.ActionUserDelete, audit.TargetUser, u.ID, nil)
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"LinkUp/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Возобновление сессий. Каждое событие комнаты, кроме эфемерных (typing и
+// presence_*), получает номер seq, который растет на единицу в пределах
+// комнаты. Узел хранит последние события каждой комнаты в ограниченном журнале;
+// клиент, переподключаясь, передает lastSeq — последний полученный номер — и
+// получает пропущенные события до живых. Если журнал уже не покрывает разрыв,
+// клиент получает resync_required и должен перечитать историю через REST.
+
+// wsReplayBuffer — сколько событий журнал хранит на комнату (WS_REPLAY_BUFFER, 500).
+func wsReplayBuffer() int {
+	return envInt("WS_REPLAY_BUFFER", 500)
+}
+
+// wsReplayWindow — сколько событие живет в журнале (WS_REPLAY_WINDOW, 5m).
+func wsReplayWindow() time.Duration {
+	return envDuration("WS_REPLAY_WINDOW", 5*time.Minute)
+}
+
+// sequenced сообщает, нумеруется ли событие и попадает ли в журнал.
+func sequenced(typ string) bool {
+	switch typ {
+	case "typing", "presence_join", "presence_leave", "presence_update":
+		return false
+	}
+	return true
+}
+
+// ------------------- Номера событий -------------------
+
+// seqSource выдает номера событий комнаты.
+type seqSource interface {
+	// next выделяет следующий номер; 0 — комнаты нет
+	next(roomID uint) (uint64, error)
+	// current возвращает последний выделенный номер
+	current(roomID uint) (uint64, error)
+}
+
+// memorySeq — счетчики в памяти: годятся для одного узла и тестов, после
+// перезапуска нумерация начинается заново.
+type memorySeq struct {
+	mu   sync.Mutex
+	last map[uint]uint64
+}
+
+func (m *memorySeq) next(roomID uint) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last == nil {
+		m.last = map[uint]uint64{}
+	}
+	m.last[roomID]++
+	return m.last[roomID], nil
+}
+
+func (m *memorySeq) current(roomID uint) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last[roomID], nil
+}
+
+// dbSeq хранит счетчик в rooms.last_seq: номера общие для всех узлов и
+// переживают перезапуск.
+type dbSeq struct{ db *gorm.DB }
+
+func (s dbSeq) next(roomID uint) (uint64, error) {
+	var seq uint64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Room{}).Where("id = ?", roomID).
+			UpdateColumn("last_seq", gorm.Expr("last_seq + 1"))
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Model(&models.Room{}).Where("id = ?", roomID).Select("last_seq").Scan(&seq).Error
+	})
+	return seq, err
+}
+
+func (s dbSeq) current(roomID uint) (uint64, error) {
+	var seq uint64
+	err := s.db.Model(&models.Room{}).Where("id = ?", roomID).Select("last_seq").Scan(&seq).Error
+	return seq, err
+}
+
+// ------------------- Журнал комнаты -------------------
+
+// roomLog — последние события комнаты по возрастанию seq.
+type roomLog struct {
+	mu sync.Mutex
+	// emit Emit держит от выделения номера до передачи события хабу, поэтому
+	// клиенты узла получают события комнаты в порядке номеров. Это не mu:
+	// хаб читает журнал при возобновлении, пока Emit ждет места в его очереди.
+	emit   sync.Mutex
+	events []loggedEvent
+	// last — наибольший известный номер; known — last уже прочитан из seqSource
+	last  uint64
+	known bool
+}
+
+type loggedEvent struct {
+	at time.Time
+	ev Event
+}
+
+// add вставляет событие по порядку номеров: события с других узлов могут
+// прийти не по порядку. Вызывается под l.mu.
+func (l *roomLog) add(ev Event, now time.Time, size int, window time.Duration) {
+	i := len(l.events)
+	for i > 0 && l.events[i-1].ev.Seq > ev.Seq {
+		i--
+	}
+	if i > 0 && l.events[i-1].ev.Seq == ev.Seq {
+		return
+	}
+	l.events = append(l.events, loggedEvent{})
+	copy(l.events[i+1:], l.events[i:])
+	l.events[i] = loggedEvent{at: now, ev: ev}
+	if ev.Seq > l.last {
+		l.last = ev.Seq
+	}
+	l.trim(now, size, window)
+}
+
+// trim удаляет события сверх size и старше window. Вызывается под l.mu.
+func (l *roomLog) trim(now time.Time, size int, window time.Duration) {
+	drop := len(l.events) - size
+	if drop < 0 {
+		drop = 0
+	}
+	for drop < len(l.events) && now.Sub(l.events[drop].at) > window {
+		drop++
+	}
+	if drop > 0 {
+		l.events = append(l.events[:0:0], l.events[drop:]...)
+	}
+}
+
+// since возвращает события после lastSeq. ok=false — журнал не покрывает
+// разрыв: события удалены или номер клиента больше известного серверу
+// (например, после перезапуска с нумерацией в памяти). Вызывается под l.mu.
+func (l *roomLog) since(lastSeq uint64) (events []Event, ok bool) {
+	if lastSeq == l.last {
+		return nil, true
+	}
+	if lastSeq > l.last || len(l.events) == 0 || l.events[0].ev.Seq > lastSeq+1 {
+		return nil, false
+	}
+	i := sort.Search(len(l.events), func(i int) bool { return l.events[i].ev.Seq > lastSeq })
+	events = make([]Event, 0, len(l.events)-i)
+	for _, e := range l.events[i:] {
+		events = append(events, e.ev)
+	}
+	return events, true
+}
+
+// ------------------- RoomHubs -------------------
+
+// roomLog возвращает журнал комнаты, создавая его при необходимости.
+func (r *RoomHubs) roomLog(roomID uint) *roomLog {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	// Журналы комнат без событий дольше окна больше не нужны
+	if now.Sub(r.swept) > r.logWindow {
+		r.swept = now
+		for id, l := range r.logs {
+			l.mu.Lock()
+			l.trim(now, r.logSize, r.logWindow)
+			empty := len(l.events) == 0
+			l.mu.Unlock()
+			if empty && r.hubs[id] == nil {
+				delete(r.logs, id)
+			}
+		}
+	}
+	l := r.logs[roomID]
+	if l == nil {
+		l = &roomLog{}
+		r.logs[roomID] = l
+	}
+	return l
+}
+
+// sequence нумерует событие и записывает его в журнал l. Номер выделяется под
+// блокировкой журнала, поэтому события одного узла попадают в журнал по порядку.
+func (r *RoomHubs) sequence(roomID uint, l *roomLog, ev Event) Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seq, err := r.seqs.next(roomID)
+	if err != nil || seq == 0 {
+		return ev
+	}
+	ev.RoomID, ev.Seq = roomID, seq
+	l.add(ev, time.Now(), r.logSize, r.logWindow)
+	return ev
+}
+
+// record записывает в журнал событие, пронумерованное другим узлом.
+func (r *RoomHubs) record(roomID uint, ev Event) {
+	if ev.Seq == 0 {
+		return
+	}
+	l := r.roomLog(roomID)
+	l.mu.Lock()
+	ev.RoomID = roomID
+	l.add(ev, time.Now(), r.logSize, r.logWindow)
+	l.mu.Unlock()
+}
+
+// replay возвращает события комнаты после lastSeq и наибольший известный
+// номер комнаты. ok=false — разрыв не покрыт журналом.
+func (r *RoomHubs) replay(roomID uint, lastSeq uint64) (events []Event, last uint64, ok bool) {
+	l := r.roomLog(roomID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.loadLast(roomID, l)
+	events, ok = l.since(lastSeq)
+	return events, l.last, ok
+}
+
+// head возвращает наибольший известный номер события комнаты.
+func (r *RoomHubs) head(roomID uint) uint64 {
+	l := r.roomLog(roomID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.loadLast(roomID, l)
+	return l.last
+}
+
+// loadLast при первом обращении к журналу берет последний номер комнаты из
+// источника номеров. Вызывается под l.mu.
+func (r *RoomHubs) loadLast(roomID uint, l *roomLog) {
+	if !l.known {
+		if cur, err := r.seqs.current(roomID); err == nil && cur > l.last {
+			l.last = cur
+		}
+		l.known = true
+	}
+}
+
+// resume отправляет клиенту пропущенные события или resync_required, если
+// разрыв не покрыт журналом или не помещается в очередь отправки. Возвращает
+// номер, до которого клиент догнал комнату: более ранние события хаб ему не
+// рассылает, чтобы они не пришли дважды. Вызывается из Hub.Run.
+func (h *Hub) resume(c *Client, lastSeq uint64) uint64 {
+	events, last, ok := h.replay(h.roomID, lastSeq)
+	if ok && len(events) < cap(c.send)-len(c.send) {
+		mark := lastSeq
+		for _, ev := range events {
+			c.trySend(ev)
+			mark = ev.Seq
+		}
+		return mark
+	}
+	c.trySend(Event{Type: "resync_required", RoomID: h.roomID, Payload: resyncPayload{LastSeq: lastSeq, Seq: last}})
+	return last
+}
+
+// resyncPayload — payload события resync_required: клиент пропустил события
+// после LastSeq, живые события продолжаются после Seq.
+type resyncPayload struct {
+	LastSeq uint64 `json:"lastSeq"`
+	Seq     uint64 `json:"seq"`
+}
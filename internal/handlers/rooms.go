@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"LinkUp/internal/audit"
+	"LinkUp/internal/auth"
 	"LinkUp/internal/models"
 )
 
@@ -39,9 +42,55 @@ func (h *Handler) CreateRoom(c *gin.Context) {
 	}
 
 	h.db.Where(models.RoomMember{RoomID: r.ID, UserID: uid(c)}).FirstOrCreate(&models.RoomMember{})
+	h.recordAudit(c, audit.ActionRoomCreate, audit.TargetRoom, r.ID, audit.Diff{}.Add("ownerId", nil, r.OwnerID))
 	c.JSON(201, r)
 }
 
+// @Summary Передать владение комнатой
+// @Description Назначает нового владельца комнаты. Доступно текущему владельцу или администратору с правом admin.rooms.transfer; новый владелец должен состоять в комнате
+// @Tags rooms
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID комнаты"
+// @Param request body TransferRoomRequest true "Новый владелец"
+// @Success 200 {object} RoomResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /rooms/{id}/owner [put]
+func (h *Handler) TransferRoomOwnership(c *gin.Context) {
+	var req TransferRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErr(c, 400, "invalid body")
+		return
+	}
+	var r models.Room
+	if err := h.db.First(&r, c.Param("id")).Error; err != nil {
+		respondErr(c, 404, "room not found")
+		return
+	}
+	if r.OwnerID != uid(c) && !h.hasPermission(c, "admin.rooms.transfer") {
+		respondErr(c, 403, "only the owner can transfer the room")
+		return
+	}
+	var n int64
+	h.db.Model(&models.RoomMember{}).Where("room_id = ? AND user_id = ?", r.ID, req.UserID).Count(&n)
+	if n == 0 {
+		respondErr(c, 400, "new owner must be a room member")
+		return
+	}
+
+	oldOwner := r.OwnerID
+	if err := h.db.Model(&r).Update("owner_id", req.UserID).Error; err != nil {
+		respondErr(c, 500, "failed to transfer room")
+		return
+	}
+	h.recordAudit(c, audit.ActionRoomOwnerChange, audit.TargetRoom, r.ID, audit.Diff{}.Add("ownerId", oldOwner, req.UserID))
+	h.notifyMembership(req.UserID, r.ID, "owner")
+	c.JSON(200, r)
+}
+
 // @Summary Получить список комнат
 // @Description Возвращает список всех доступных комнат
 // @Tags rooms
@@ -52,11 +101,15 @@ func (h *Handler) CreateRoom(c *gin.Context) {
 // @Router /rooms [get]
 func (h *Handler) ListRooms(c *gin.Context) {
 	var rooms []models.Room
-	h.db.Order("created_at asc").Find(&rooms)
+	q := h.db.Order("created_at asc")
+	if id, ok := auth.TokenRoom(c); ok {
+		q = q.Where("id = ?", id)
+	}
+	q.Find(&rooms)
 
 	res := []gin.H{}
 	for _, r := range rooms {
-		cnt := h.unreadCount(c, r.ID, uid(c))
+		cnt := h.unreadCount(r.ID, uid(c))
 		res = append(res, gin.H{"id": r.ID, "slug": r.Slug, "name": r.Name, "isPrivate": r.IsPrivate, "unread": cnt})
 	}
 	c.JSON(200, res)
@@ -68,7 +121,7 @@ func (h *Handler) ListRooms(c *gin.Context) {
 // @Tags internal
 // (internal function — not necessarily an HTTP handler)
 
-func (h *Handler) unreadCount(c *gin.Context, roomID, userID uint) int64 {
+func (h *Handler) unreadCount(roomID, userID uint) int64 {
 	var m models.RoomMember
 	if err := h.db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&m).Error; err != nil {
 		return 0
@@ -101,6 +154,7 @@ func (h *Handler) JoinRoom(c *gin.Context) {
 	}
 
 	h.db.Where(models.RoomMember{RoomID: r.ID, UserID: uid(c)}).FirstOrCreate(&models.RoomMember{})
+	h.notifyMembership(uid(c), r.ID, "joined")
 	c.JSON(200, gin.H{"ok": true})
 }
 
@@ -116,12 +170,17 @@ func (h *Handler) JoinRoom(c *gin.Context) {
 // @Router /rooms/{id}/leave [post]
 func (h *Handler) LeaveRoom(c *gin.Context) {
 	roomID := c.Param("id")
-	h.db.Where("room_id = ? AND user_id = ?", roomID, uid(c)).Delete(&models.RoomMember{})
+	res := h.db.Where("room_id = ? AND user_id = ?", roomID, uid(c)).Delete(&models.RoomMember{})
+	if res.RowsAffected > 0 {
+		id, _ := strconv.ParseUint(roomID, 10, 64)
+		h.revokeRoomAccess(uid(c), uint(id))
+		h.notifyMembership(uid(c), uint(id), "left")
+	}
 	c.JSON(200, gin.H{"ok": true})
 }
 
 // @Summary Список пользователей в комнате
-// @Description Возвращает список всех пользователей в указанной комнате
+// @Description Возвращает список всех пользователей в указанной комнате с их присутствием: состояние, свой статус и lastSeen; скрывающие присутствие показываются офлайн без lastSeen
 // @Tags rooms
 // @Security BearerAuth
 // @Produce json
@@ -145,8 +204,9 @@ func (h *Handler) RoomMembers(c *gin.Context) {
 	h.db.Where("id IN ?", userIDs).Find(&users)
 	res := []gin.H{}
 	for _, u := range users {
-		u.Online = h.presence.IsOnline(u.ID)
-		res = append(res, gin.H{"id": u.ID, "name": u.Name, "login": u.Login, "avatarUrl": u.AvatarURL, "online": u.Online, "lastSeen": u.LastSeen})
+		p := h.presenceOf(u, uid(c))
+		u.Online = p.State != stateOffline
+		res = append(res, gin.H{"id": u.ID, "name": u.Name, "login": u.Login, "avatarUrl": u.AvatarURL, "online": u.Online, "lastSeen": p.LastSeen, "presence": p})
 	}
 	c.JSON(200, res)
 }
@@ -170,5 +230,6 @@ func (h *Handler) MarkRoomRead(c *gin.Context) {
 	}
 	now := time.Now()
 	h.db.Model(&m).Update("last_read_at", &now)
+	h.users.Emit(m.UserID, Event{Type: "unread", RoomID: m.RoomID, Payload: gin.H{"unread": 0}})
 	c.JSON(200, gin.H{"ok": true})
 }
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
+	"LinkUp/internal/auth"
 	"LinkUp/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -30,6 +32,13 @@ func (h *Handler) SearchMessages(c *gin.Context) {
 		return
 	}
 	roomID := c.Query("roomId")
+	if id, ok := auth.TokenRoom(c); ok {
+		if roomID != "" && roomID != strconv.FormatUint(uint64(id), 10) {
+			respondErr(c, 403, "token is restricted to another room")
+			return
+		}
+		roomID = strconv.FormatUint(uint64(id), 10)
+	}
 	query := h.db.Model(&models.Message{}).Where("type = ?", "text").Where("text LIKE ?", "%"+q+"%")
 	if roomID != "" {
 		query = query.Where("room_id = ?", roomID)
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"LinkUp/internal/audit"
+	"LinkUp/internal/auth"
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/models"
+	"LinkUp/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInvalidRefresh = errors.New("invalid refresh token")
+
+// issueSessionTokens открывает новую сессию и выдает пару access/refresh токенов.
+func (h *Handler) issueSessionTokens(c *gin.Context, userID uint) (gin.H, error) {
+	now := time.Now()
+	s := models.Session{
+		UserID:     userID,
+		Device:     truncate(c.GetHeader("X-Device-Name"), 120),
+		IP:         c.ClientIP(),
+		UserAgent:  truncate(c.Request.UserAgent(), 255),
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(auth.RefreshTokenTTL()),
+	}
+	var refresh string
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&s).Error; err != nil {
+			return err
+		}
+		var err error
+		refresh, err = issueRefreshToken(tx, s)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	access, err := auth.GenerateToken(userID, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":        access,
+		"refreshToken": refresh,
+		"expiresIn":    int(auth.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// issueRefreshToken сохраняет хэш нового refresh-токена сессии.
+func issueRefreshToken(tx *gorm.DB, s models.Session) (string, error) {
+	tok, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	rt := models.RefreshToken{SessionID: s.ID, TokenHash: utils.HashToken(tok), ExpiresAt: s.ExpiresAt}
+	if err := tx.Create(&rt).Error; err != nil {
+		return "", err
+	}
+	return tok, nil
+}
+
+// SessionActive проверяет, что сессия принадлежит пользователю, не отозвана и не истекла.
+func (h *Handler) SessionActive(userID, sessionID uint) bool {
+	if sessionID == 0 {
+		return false
+	}
+	var n int64
+	h.db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
+		Count(&n)
+	return n > 0
+}
+
+// revokeSessions отзывает сессии по условию; access-токены этих сессий
+// перестают приниматься сразу.
+func (h *Handler) revokeSessions(query interface{}, args ...interface{}) (int64, error) {
+	res := h.db.Model(&models.Session{}).
+		Where("revoked_at IS NULL").
+		Where(query, args...).
+		Update("revoked_at", time.Now())
+	return res.RowsAffected, res.Error
+}
+
+// @Summary Обновить токены
+// @Description Обменивает refresh-токен на новую пару токенов. Refresh-токен одноразовый: повторное использование отзывает всю сессию
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body RefreshRequest true "Refresh-токен"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/refresh [post]
+func (h *Handler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("Refresh.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+
+	var (
+		sess       models.Session
+		newRefresh string
+		reused     bool
+	)
+	txErr := h.db.Transaction(func(tx *gorm.DB) error {
+		var rt models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(req.RefreshToken)).
+			First(&rt).Error; err != nil {
+			return errInvalidRefresh
+		}
+		if err := tx.First(&sess, rt.SessionID).Error; err != nil {
+			return errInvalidRefresh
+		}
+		now := time.Now()
+		if sess.RevokedAt != nil || now.After(sess.ExpiresAt) || now.After(rt.ExpiresAt) {
+			return errInvalidRefresh
+		}
+		if rt.UsedAt != nil {
+			reused = true
+			return nil
+		}
+		res := tx.Model(&rt).Where("used_at IS NULL").Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			reused = true
+			return nil
+		}
+
+		sess.LastUsedAt = now
+		sess.ExpiresAt = now.Add(auth.RefreshTokenTTL())
+		if err := tx.Model(&sess).Updates(map[string]interface{}{
+			"last_used_at": sess.LastUsedAt,
+			"expires_at":   sess.ExpiresAt,
+			"ip":           c.ClientIP(),
+			"user_agent":   truncate(c.Request.UserAgent(), 255),
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		newRefresh, err = issueRefreshToken(tx, sess)
+		return err
+	})
+
+	if reused {
+		// Старый токен предъявлен повторно — вероятна кража, отзываем все семейство
+		h.revokeSessions("id = ?", sess.ID)
+		h.recordAuditAs(c, nil, audit.ActionSessionRevoke, audit.TargetSession, sess.ID, audit.Diff{}.Add("reason", nil, "refresh_token_reuse"))
+		apiErr := apiErrors.NewAPIError("Refresh.Reuse", nil, "refresh token reuse, session revoked", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid refresh token.")
+		return
+	}
+	if errors.Is(txErr, errInvalidRefresh) {
+		apiErr := apiErrors.NewAPIError("Refresh.Lookup", txErr, "invalid refresh token", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid refresh token.")
+		return
+	}
+	if txErr != nil {
+		apiErr := apiErrors.NewAPIError("Refresh.Rotate", txErr, "failed to rotate refresh token", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+
+	access, tokenErr := auth.GenerateToken(sess.UserID, sess.ID)
+	if tokenErr != nil {
+		apiErr := apiErrors.NewAPIError("Refresh.GenerateToken", tokenErr, "failed to generate token", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	c.JSON(200, TokenResponse{
+		Token:        access,
+		RefreshToken: newRefresh,
+		ExpiresIn:    int(auth.AccessTokenTTL().Seconds()),
+	})
+}
+
+// @Summary Выйти из системы
+// @Description Отзывает текущую сессию вместе со всеми ее токенами
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/logout [post]
+func (h *Handler) Logout(c *gin.Context) {
+	if _, revokeErr := h.revokeSessions("id = ? AND user_id = ?", sid(c), uid(c)); revokeErr != nil {
+		apiErr := apiErrors.NewAPIError("Logout.Revoke", revokeErr, "failed to revoke session", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	h.recordAudit(c, audit.ActionLogout, audit.TargetSession, sid(c), nil)
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// @Summary Активные сессии
+// @Description Возвращает активные сессии текущего пользователя
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} SessionResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/sessions [get]
+func (h *Handler) ListSessions(c *gin.Context) {
+	var sessions []models.Session
+	if findErr := h.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", uid(c), time.Now()).
+		Order("last_used_at desc").
+		Find(&sessions).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("ListSessions.Find", findErr, "failed to load sessions", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	res := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, SessionResponse{
+			ID:         s.ID,
+			Device:     s.Device,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == sid(c),
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// @Summary Отозвать сессию
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID сессии"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/sessions/{id} [delete]
+func (h *Handler) RevokeSession(c *gin.Context) {
+	sessionID, parseErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if parseErr != nil {
+		apiErr := apiErrors.NewAPIError("RevokeSession.ParseID", parseErr, "invalid session id", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid session ID.")
+		return
+	}
+	n, revokeErr := h.revokeSessions("id = ? AND user_id = ?", sessionID, uid(c))
+	if revokeErr != nil {
+		apiErr := apiErrors.NewAPIError("RevokeSession.Revoke", revokeErr, "failed to revoke session", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	if n == 0 {
+		apiErr := apiErrors.NewAPIError("RevokeSession.Revoke", nil, "session not found", 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Session not found.")
+		return
+	}
+	h.recordAudit(c, audit.ActionSessionRevoke, audit.TargetSession, uint(sessionID), nil)
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// @Summary Отозвать все остальные сессии
+// @Description Завершает все сессии пользователя, кроме текущей. Запрос с персональным токеном или токеном без сессии отклоняется: текущей сессии у него нет
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/sessions [delete]
+func (h *Handler) RevokeOtherSessions(c *gin.Context) {
+	// Без текущей сессии «остальные» — это все сессии пользователя
+	if sid(c) == 0 {
+		apiErr := apiErrors.NewAPIError("RevokeOtherSessions.Session", nil, "no current session", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "This request is not bound to a session.")
+		return
+	}
+	n, revokeErr := h.revokeSessions("user_id = ? AND id <> ?", uid(c), sid(c))
+	if revokeErr != nil {
+		apiErr := apiErrors.NewAPIError("RevokeOtherSessions.Revoke", revokeErr, "failed to revoke sessions", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	h.recordAudit(c, audit.ActionSessionRevoke, audit.TargetUser, uid(c), audit.Diff{}.Add("revoked", nil, n))
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
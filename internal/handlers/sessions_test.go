@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"LinkUp/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func sessionsRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("REGISTRATION_MODE", "open")
+	h := New(testDB(t), t.TempDir(), "http://x")
+	auth.SetSessionValidator(h.SessionActive)
+	t.Cleanup(func() { auth.SetSessionValidator(nil) })
+
+	r := gin.New()
+	r.POST("/register", h.Register)
+	r.POST("/login", h.Login)
+	r.POST("/auth/refresh", h.Refresh)
+	pr := r.Group("", auth.JWTMiddleware())
+	pr.GET("/me", h.Me)
+	pr.DELETE("/auth/sessions", h.RevokeOtherSessions)
+	return r
+}
+
+func TestRefreshRotation(t *testing.T) {
+	r := sessionsRouter(t)
+	_, out := doJSON(t, r, http.MethodPost, "/register", "", map[string]string{"login": "alice", "password": "Str0ng-pass", "name": "Alice"})
+	first := out["refreshToken"].(string)
+	_, out = doJSON(t, r, http.MethodPost, "/login", "", map[string]string{"login": "alice", "password": "Str0ng-pass"})
+	other := out["token"].(string)
+
+	code, out := doJSON(t, r, http.MethodPost, "/auth/refresh", "", RefreshRequest{RefreshToken: first})
+	if code != http.StatusOK || out["refreshToken"] == nil || out["refreshToken"] == first {
+		t.Fatalf("refresh: %d %v", code, out)
+	}
+	access, second := out["token"].(string), out["refreshToken"].(string)
+	if code, _ := doJSON(t, r, http.MethodGet, "/me", access, nil); code != http.StatusOK {
+		t.Fatalf("rotated access token: %d", code)
+	}
+	code, out = doJSON(t, r, http.MethodPost, "/auth/refresh", "", RefreshRequest{RefreshToken: second})
+	if code != http.StatusOK {
+		t.Fatalf("rotated refresh token: %d", code)
+	}
+	third := out["refreshToken"].(string)
+
+	// старый токен предъявлен повторно: отзывается вся сессия, включая
+	// выданные после него access- и refresh-токены
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/refresh", "", RefreshRequest{RefreshToken: second}); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: %d", code)
+	}
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/refresh", "", RefreshRequest{RefreshToken: third}); code != http.StatusUnauthorized {
+		t.Fatalf("refresh token of a revoked session: %d", code)
+	}
+	if code, _ := doJSON(t, r, http.MethodGet, "/me", out["token"].(string), nil); code != http.StatusUnauthorized {
+		t.Fatalf("access token of a revoked session: %d", code)
+	}
+	// другая сессия того же пользователя не затронута
+	if code, _ := doJSON(t, r, http.MethodGet, "/me", other, nil); code != http.StatusOK {
+		t.Fatalf("unrelated session: %d", code)
+	}
+}
+
+func TestRevokeOtherSessionsWithoutSession(t *testing.T) {
+	r := sessionsRouter(t)
+	_, out := doJSON(t, r, http.MethodPost, "/register", "", map[string]string{"login": "alice", "password": "Str0ng-pass", "name": "Alice"})
+	if code, _ := doJSON(t, r, http.MethodDelete, "/auth/sessions", out["token"].(string), nil); code != http.StatusOK {
+		t.Fatalf("with session: %d", code)
+	}
+
+	// токен без sid (так же выглядит запрос с персональным токеном) не
+	// должен отзывать все сессии пользователя
+	auth.SetSessionValidator(nil)
+	tok, _ := auth.GenerateToken(uint(out["user"].(map[string]interface{})["id"].(float64)), 0)
+	if code, _ := doJSON(t, r, http.MethodDelete, "/auth/sessions", tok, nil); code != http.StatusBadRequest {
+		t.Fatalf("without session: %d", code)
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"LinkUp/internal/audit"
+	"LinkUp/internal/auth"
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/models"
+	"LinkUp/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidPAT = errors.New("invalid personal access token")
+
+// patTouchInterval ограничивает частоту записи last_used_at,
+// чтобы активный бот не обновлял строку на каждый запрос.
+const patTouchInterval = time.Minute
+
+// ResolvePAT находит действующий персональный токен и отмечает его использование.
+func (h *Handler) ResolvePAT(token string) (*auth.TokenInfo, error) {
+	var t models.PersonalAccessToken
+	if err := h.db.Where("token_hash = ?", utils.HashToken(token)).First(&t).Error; err != nil {
+		return nil, errInvalidPAT
+	}
+	now := time.Now()
+	if t.RevokedAt != nil || (t.ExpiresAt != nil && now.After(*t.ExpiresAt)) {
+		return nil, errInvalidPAT
+	}
+	var n int64
+	h.db.Model(&models.User{}).Where("id = ?", t.UserID).Count(&n)
+	if n == 0 {
+		return nil, errInvalidPAT
+	}
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > patTouchInterval {
+		h.db.Model(&t).UpdateColumn("last_used_at", now)
+	}
+	return &auth.TokenInfo{ID: t.ID, UserID: t.UserID, Scopes: t.Scopes, RoomID: t.RoomID}, nil
+}
+
+// roomAllowed проверяет ограничение персонального токена комнатой.
+// Для JWT-сессий всегда true.
+func roomAllowed(c *gin.Context, roomID uint) bool {
+	if id, ok := auth.TokenRoom(c); ok {
+		return id == roomID
+	}
+	return true
+}
+
+func tokenResponse(t models.PersonalAccessToken) PersonalTokenResponse {
+	return PersonalTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		RoomID:     t.RoomID,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
+
+// ==================== ПЕРСОНАЛЬНЫЕ ТОКЕНЫ ====================
+
+// @Summary Создать персональный токен
+// @Description Создает токен доступа для ботов и скриптов с ограниченными областями (rooms:read, rooms:write, messages:read, messages:write, user:read, user:write). Токен с roomId действует только в этой комнате: ему доступны маршруты /rooms/{roomId}/..., список комнат, поиск, реакции, опросы и WebSocket этой комнаты, но не создание комнат, загрузка файлов и профиль. Значение токена возвращается только один раз
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param token body CreateTokenRequest true "Параметры токена"
+// @Success 201 {object} CreateTokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /auth/tokens [post]
+func (h *Handler) CreateToken(c *gin.Context) {
+	var req CreateTokenRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("CreateToken.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	if len(req.Name) > 100 {
+		apiErr := apiErrors.NewAPIError("CreateToken.Validate", nil, "name too long", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Token name is too long.")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		apiErr := apiErrors.NewAPIError("CreateToken.Validate", nil, "no scopes", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "At least one scope is required.")
+		return
+	}
+	seen := map[string]bool{}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, s := range req.Scopes {
+		if !auth.ValidScope(s) {
+			apiErr := apiErrors.NewAPIError("CreateToken.Validate", nil, "unknown scope "+s, 400)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Unknown scope: "+s)
+			return
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		apiErr := apiErrors.NewAPIError("CreateToken.Validate", nil, "expiry in the past", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Expiry must be in the future.")
+		return
+	}
+	if req.RoomID != nil {
+		var n int64
+		h.db.Model(&models.RoomMember{}).Where("room_id = ? AND user_id = ?", *req.RoomID, uid(c)).Count(&n)
+		if n == 0 {
+			apiErr := apiErrors.NewAPIError("CreateToken.Room", nil, "not a member of the room", 403)
+			apiErrors.LogAndRespondAPI(c, apiErr, "You are not a member of this room.")
+			return
+		}
+	}
+
+	secret, genErr := auth.GenerateOpaqueToken()
+	if genErr != nil {
+		apiErr := apiErrors.NewAPIError("CreateToken.Generate", genErr, "failed to generate token", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	value := auth.PATPrefix + secret
+	t := models.PersonalAccessToken{
+		UserID:    uid(c),
+		Name:      req.Name,
+		Prefix:    value[:len(auth.PATPrefix)+8],
+		TokenHash: utils.HashToken(value),
+		Scopes:    scopes,
+		RoomID:    req.RoomID,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if createErr := h.db.Create(&t).Error; createErr != nil {
+		apiErr := apiErrors.NewAPIError("CreateToken.Create", createErr, "failed to save token", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+
+	h.recordAudit(c, audit.ActionTokenCreate, audit.TargetToken, t.ID,
+		audit.Diff{}.Add("name", nil, t.Name).Add("scopes", nil, t.Scopes))
+	c.JSON(http.StatusCreated, CreateTokenResponse{PersonalTokenResponse: tokenResponse(t), Token: value})
+}
+
+// @Summary Персональные токены
+// @Description Возвращает действующие персональные токены текущего пользователя без их значений
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} PersonalTokenResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/tokens [get]
+func (h *Handler) ListTokens(c *gin.Context) {
+	var tokens []models.PersonalAccessToken
+	if findErr := h.db.Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", uid(c), time.Now()).
+		Order("created_at desc").
+		Find(&tokens).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("ListTokens.Find", findErr, "failed to load tokens", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	res := make([]PersonalTokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		res = append(res, tokenResponse(t))
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// @Summary Отозвать персональный токен
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID токена"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/tokens/{id} [delete]
+func (h *Handler) RevokeToken(c *gin.Context) {
+	tokenID, parseErr := strconv.ParseUint(c.Param("id"), 10, 64)
+	if parseErr != nil {
+		apiErr := apiErrors.NewAPIError("RevokeToken.ParseID", parseErr, "invalid token id", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid token ID.")
+		return
+	}
+	res := h.db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, uid(c)).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		apiErr := apiErrors.NewAPIError("RevokeToken.Revoke", res.Error, "failed to revoke token", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	if res.RowsAffected == 0 {
+		apiErr := apiErrors.NewAPIError("RevokeToken.Revoke", nil, "token not found", 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Token not found.")
+		return
+	}
+	h.recordAudit(c, audit.ActionTokenRevoke, audit.TargetToken, uint(tokenID), nil)
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
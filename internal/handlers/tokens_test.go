@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"LinkUp/internal/auth"
+	"LinkUp/internal/models"
+	"LinkUp/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPATAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testDB(t)
+	h := New(db, t.TempDir(), "http://x")
+	auth.SetPATResolver(h.ResolvePAT)
+	t.Cleanup(func() { auth.SetPATResolver(nil) })
+	if err := db.Create(&models.User{Login: "bot", Name: "Bot"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r := gin.New()
+	pr := r.Group("", auth.JWTMiddleware())
+	api := auth.Scoped(pr)
+	api.GET("/user/me", auth.ScopeUserRead, ok)
+	api.GET("/rooms/:id/history", auth.ScopeMessagesRead, ok)
+	api.RoomAware().GET("/search", auth.ScopeMessagesRead, ok)
+	pr.GET("/auth/sessions", ok)
+
+	room := uint(1)
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	token := func(name string, row models.PersonalAccessToken) string {
+		tok := auth.PATPrefix + name
+		row.UserID, row.Name, row.TokenHash = 1, name, utils.HashToken(tok)
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	all := []string{auth.ScopeUserRead, auth.ScopeMessagesRead}
+	full := token("full", models.PersonalAccessToken{Scopes: all, ExpiresAt: &future})
+	reader := token("reader", models.PersonalAccessToken{Scopes: []string{auth.ScopeMessagesRead}})
+	scoped := token("room", models.PersonalAccessToken{Scopes: all, RoomID: &room})
+	revoked := token("revoked", models.PersonalAccessToken{Scopes: all, RevokedAt: &past})
+	expired := token("expired", models.PersonalAccessToken{Scopes: all, ExpiresAt: &past})
+
+	for _, tc := range []struct {
+		name, token, path string
+		want              int
+	}{
+		{"scope granted", full, "/user/me", http.StatusOK},
+		{"missing scope", reader, "/user/me", http.StatusForbidden},
+		{"route not open to tokens", full, "/auth/sessions", http.StatusForbidden},
+		{"room token in its room", scoped, "/rooms/1/history", http.StatusOK},
+		{"room token in another room", scoped, "/rooms/2/history", http.StatusForbidden},
+		{"room token on a room-aware route", scoped, "/search", http.StatusOK},
+		{"room token on a route without room checks", scoped, "/user/me", http.StatusForbidden},
+		{"revoked token", revoked, "/user/me", http.StatusUnauthorized},
+		{"expired token", expired, "/user/me", http.StatusUnauthorized},
+		{"unknown token", auth.PATPrefix + "unknown", "/user/me", http.StatusUnauthorized},
+	} {
+		if code, _ := doJSON(t, r, http.MethodGet, tc.path, tc.token, nil); code != tc.want {
+			t.Errorf("%s: GET %s = %d, want %d", tc.name, tc.path, code, tc.want)
+		}
+	}
+}
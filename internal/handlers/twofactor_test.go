@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"LinkUp/internal/auth"
+	"LinkUp/internal/models"
+	"LinkUp/internal/webauthn"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// twoFactorRouter регистрирует alice с включенной 2FA и возвращает ее
+// резервные коды.
+func twoFactorRouter(t *testing.T) (*gin.Engine, *gorm.DB, []string) {
+	r, h, codes := twoFactorHandler(t)
+	return r, h.db, codes
+}
+
+func twoFactorHandler(t *testing.T) (*gin.Engine, *Handler, []string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("REGISTRATION_MODE", "open")
+	db := testDB(t)
+	h := New(db, t.TempDir(), "http://x")
+	h.webauthn = webauthn.New(webauthn.Config{RPID: "chat.example.com", RPName: "LinkUp", Origins: []string{passkeyOrigin}})
+	auth.SetSessionValidator(h.SessionActive)
+	t.Cleanup(func() { auth.SetSessionValidator(nil) })
+
+	r := gin.New()
+	r.POST("/register", h.Register)
+	r.POST("/login", h.Login)
+	r.POST("/auth/2fa/login", h.Login2FA)
+	r.POST("/auth/2fa/webauthn/begin", h.BeginPasskey2FA)
+	r.POST("/auth/2fa/webauthn/finish", h.FinishPasskey2FA)
+
+	_, out := doJSON(t, r, http.MethodPost, "/register", "", map[string]string{"login": "alice", "password": "Str0ng-pass", "name": "Alice"})
+	secret, _ := auth.GenerateTOTPSecret()
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uint(out["user"].(map[string]interface{})["id"].(float64))
+	if err := db.Create(&models.TwoFactorAuth{UserID: userID, Secret: secret, Enabled: true, BackupCodes: hashes}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return r, h, codes
+}
+
+// challenge проходит первый шаг входа и возвращает challenge-токен.
+func challenge(t *testing.T, r http.Handler) string {
+	t.Helper()
+	code, out := doJSON(t, r, http.MethodPost, "/login", "", map[string]string{"login": "alice", "password": "Str0ng-pass"})
+	if code != http.StatusOK || out["twoFactorRequired"] != true {
+		t.Fatalf("login: %d %v", code, out)
+	}
+	return out["challengeToken"].(string)
+}
+
+func TestLogin2FARecoveryCodeBurned(t *testing.T) {
+	r, db, codes := twoFactorRouter(t)
+	login := func(code string) int {
+		status, _ := doJSON(t, r, http.MethodPost, "/auth/2fa/login", "", Login2FARequest{ChallengeToken: challenge(t, r), Code: code})
+		return status
+	}
+	// код принимается в любом регистре и без дефиса
+	if status := login(strings.ToLower(codes[0][:5] + codes[0][6:])); status != http.StatusOK {
+		t.Fatalf("recovery code: %d", status)
+	}
+	if status := login(codes[0]); status != http.StatusUnauthorized {
+		t.Fatalf("burned recovery code accepted: %d", status)
+	}
+	if status := login(codes[1]); status != http.StatusOK {
+		t.Fatalf("second recovery code: %d", status)
+	}
+	var twoFA models.TwoFactorAuth
+	db.First(&twoFA)
+	if len(twoFA.BackupCodes) != auth.RecoveryCodeCount-2 {
+		t.Fatalf("%d recovery codes left", len(twoFA.BackupCodes))
+	}
+}
+
+// Один challenge-токен дает не больше одного входа, каким бы способом ни
+// подтверждался второй фактор.
+func TestTwoFactorChallengeSingleUse(t *testing.T) {
+	r, h, codes := twoFactorHandler(t)
+	a := webauthn.NewSoftAuthenticator(passkeyOrigin)
+	ceremony, _ := webauthn.NewChallenge()
+	reg, err := a.Create(h.webauthn.CreationOptions(ceremony, webauthn.UserEntity{ID: webauthnUserHandle(1), Name: "alice"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := h.webauthn.VerifyRegistration(reg, ceremony, webauthn.UVPreferred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.db.Create(&models.WebAuthnCredential{UserID: 1, Name: "soft", CredentialID: webauthn.EncodeID(cred.ID), PublicKey: cred.PublicKey, Algorithm: cred.Algorithm}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	recovery := func(tok, code string) int {
+		status, _ := doJSON(t, r, http.MethodPost, "/auth/2fa/login", "", Login2FARequest{ChallengeToken: tok, Code: code})
+		return status
+	}
+	passkey := func(tok string) int {
+		_, out := doJSON(t, r, http.MethodPost, "/auth/2fa/webauthn/begin", "", Passkey2FABeginRequest{ChallengeToken: tok})
+		var opts webauthn.RequestOptions
+		publicKeyOptions(t, out, &opts)
+		resp, err := a.Get(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, _ := doJSON(t, r, http.MethodPost, "/auth/2fa/webauthn/finish", "", Passkey2FARequest{ChallengeToken: tok, Credential: *resp})
+		return status
+	}
+
+	// неверный код не гасит токен
+	tok := challenge(t, r)
+	if status := recovery(tok, "AAAAA-AAAAA"); status != http.StatusUnauthorized {
+		t.Fatalf("wrong code: %d", status)
+	}
+	if status := recovery(tok, codes[0]); status != http.StatusOK {
+		t.Fatalf("recovery code: %d", status)
+	}
+	if status := recovery(tok, codes[1]); status != http.StatusUnauthorized {
+		t.Fatalf("challenge reused with another recovery code: %d", status)
+	}
+	if status := passkey(tok); status != http.StatusUnauthorized {
+		t.Fatalf("challenge reused with a passkey: %d", status)
+	}
+
+	tok = challenge(t, r)
+	if status := passkey(tok); status != http.StatusOK {
+		t.Fatalf("passkey: %d", status)
+	}
+	if status := passkey(tok); status != http.StatusUnauthorized {
+		t.Fatalf("challenge reused with the passkey: %d", status)
+	}
+	if status := recovery(tok, codes[2]); status != http.StatusUnauthorized {
+		t.Fatalf("challenge reused with a recovery code: %d", status)
+	}
+}
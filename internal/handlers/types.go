@@ -10,6 +10,9 @@ type RegisterRequest struct {
 	Password  string `json:"password" binding:"required" example:"securepassword123"`
 	Name      string `json:"name" binding:"required" example:"John Doe"`
 	AvatarURL string `json:"avatarUrl" example:"https://example.com/avatar.jpg"`
+	Email     string `json:"email" example:"john@example.com"`
+	// Invite is required when REGISTRATION_MODE=invite
+	Invite string `json:"invite" example:"Zk3mP9qL2xWv7cR4tY8bN1sD6fH0jA5e"`
 }
 
 // LoginRequest represents the request body for user login
@@ -22,6 +25,7 @@ type LoginRequest struct {
 type UpdateProfileRequest struct {
 	Name      string `json:"name" example:"John Smith"`
 	AvatarURL string `json:"avatarUrl" example:"https://example.com/new-avatar.jpg"`
+	Email     string `json:"email" example:"john.smith@example.com"`
 }
 
 // CreateRoomRequest represents the request body for room creation
@@ -31,11 +35,18 @@ type CreateRoomRequest struct {
 	IsPrivate bool   `json:"isPrivate" example:"false"`
 }
 
+// TransferRoomRequest represents the request body for room ownership transfer
+type TransferRoomRequest struct {
+	UserID uint `json:"userId" binding:"required" example:"2"`
+}
+
 // SendMessageRequest represents the request body for sending messages
 type SendMessageRequest struct {
 	Type     string `json:"type" example:"text"`
 	Text     string `json:"text" example:"Hello everyone!"`
 	ImageURL string `json:"imageUrl" example:"https://example.com/image.jpg"`
+	// ClientMsgID deduplicates retries of the same send
+	ClientMsgID string `json:"clientMsgId" example:"7f3c2a9e-5b1d-4c8e-9a0f-2d6b8e1c4f7a"`
 }
 
 // AddReactionRequest represents the request body for adding reactions
@@ -45,8 +56,163 @@ type AddReactionRequest struct {
 
 // AuthResponse represents the response for authentication endpoints
 type AuthResponse struct {
-	Token string       `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
-	User  UserResponse `json:"user"`
+	Token        string       `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string       `json:"refreshToken" example:"3q2-7wZ1nV0c9Xb1m0oYt7fJx1qk8y2dLr4uQm5HcTs"`
+	ExpiresIn    int          `json:"expiresIn" example:"900"`
+	User         UserResponse `json:"user"`
+}
+
+// RefreshRequest represents the request body for token refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required" example:"3q2-7wZ1nV0c9Xb1m0oYt7fJx1qk8y2dLr4uQm5HcTs"`
+}
+
+// TokenResponse represents a rotated access/refresh token pair
+type TokenResponse struct {
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string `json:"refreshToken" example:"3q2-7wZ1nV0c9Xb1m0oYt7fJx1qk8y2dLr4uQm5HcTs"`
+	ExpiresIn    int    `json:"expiresIn" example:"900"`
+}
+
+// SessionResponse represents an active login session
+type SessionResponse struct {
+	ID         uint      `json:"id" example:"12"`
+	Device     string    `json:"device" example:"John's laptop"`
+	IP         string    `json:"ip" example:"203.0.113.7"`
+	UserAgent  string    `json:"userAgent" example:"Mozilla/5.0"`
+	CreatedAt  time.Time `json:"createdAt" example:"2024-01-15T10:30:00Z"`
+	LastUsedAt time.Time `json:"lastUsedAt" example:"2024-01-15T12:00:00Z"`
+	ExpiresAt  time.Time `json:"expiresAt" example:"2024-02-14T12:00:00Z"`
+	Current    bool      `json:"current" example:"true"`
+}
+
+// EmailTokenRequest represents a single-use token from an email link
+type EmailTokenRequest struct {
+	Token string `json:"token" binding:"required" example:"Xr0nW3d9yq1kz7cT2bVQm8sPpL4eJfHaGiU6oNwDx5E"`
+}
+
+// ForgotPasswordRequest represents the request body for requesting a password reset
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required" example:"john@example.com"`
+}
+
+// ResetPasswordRequest represents the request body for setting a new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required" example:"Xr0nW3d9yq1kz7cT2bVQm8sPpL4eJfHaGiU6oNwDx5E"`
+	Password string `json:"password" binding:"required" example:"newsecurepassword123"`
+}
+
+// CreateTokenRequest represents the request body for creating a personal access token
+type CreateTokenRequest struct {
+	Name      string     `json:"name" binding:"required" example:"deploy bot"`
+	Scopes    []string   `json:"scopes" binding:"required" example:"messages:write,rooms:read"`
+	RoomID    *uint      `json:"roomId" example:"1"`
+	ExpiresAt *time.Time `json:"expiresAt" example:"2025-01-15T00:00:00Z"`
+}
+
+// CreateTokenResponse represents a newly created personal access token.
+// The token value is returned only once.
+type CreateTokenResponse struct {
+	PersonalTokenResponse
+	Token string `json:"token" example:"lup_Xr0nW3d9yq1kz7cT2bVQm8sPpL4eJfHaGiU6oNwDx5E"`
+}
+
+// WSTicketRequest represents the request body for issuing a WebSocket ticket
+type WSTicketRequest struct {
+	// RoomID binds the ticket to one room
+	RoomID *uint `json:"roomId" example:"1"`
+}
+
+// WSTicketResponse represents a single-use WebSocket ticket
+type WSTicketResponse struct {
+	Ticket    string    `json:"ticket" example:"3q2-7wEjRkq8ZyVbQ1x0mN5tLcP4sHgUaJd9oIeKfW6"`
+	ExpiresAt time.Time `json:"expiresAt" example:"2024-01-15T10:30:30Z"`
+}
+
+// PersonalTokenResponse represents a personal access token without its secret value
+type PersonalTokenResponse struct {
+	ID         uint       `json:"id" example:"3"`
+	Name       string     `json:"name" example:"deploy bot"`
+	Prefix     string     `json:"prefix" example:"lup_Xr0nW3d9"`
+	Scopes     []string   `json:"scopes" example:"messages:write,rooms:read"`
+	RoomID     *uint      `json:"roomId" example:"1"`
+	CreatedAt  time.Time  `json:"createdAt" example:"2024-01-15T10:30:00Z"`
+	ExpiresAt  *time.Time `json:"expiresAt" example:"2025-01-15T00:00:00Z"`
+	LastUsedAt *time.Time `json:"lastUsedAt" example:"2024-01-16T08:00:00Z"`
+}
+
+// CreateInviteRequest represents the request body for creating a registration invite
+type CreateInviteRequest struct {
+	MaxUses   int        `json:"maxUses" example:"10"`
+	ExpiresAt *time.Time `json:"expiresAt" example:"2025-01-22T00:00:00Z"`
+	RoomIDs   []uint     `json:"roomIds" example:"1,2"`
+	RoleIDs   []uint     `json:"roleIds" example:"3"`
+}
+
+// InviteResponse represents a registration invite without its code
+type InviteResponse struct {
+	ID        uint       `json:"id" example:"5"`
+	Prefix    string     `json:"prefix" example:"Zk3mP9qL"`
+	CreatedBy uint       `json:"createdBy" example:"1"`
+	MaxUses   int        `json:"maxUses" example:"10"`
+	Uses      int        `json:"uses" example:"2"`
+	RoomIDs   []uint     `json:"roomIds" example:"1,2"`
+	RoleIDs   []uint     `json:"roleIds" example:"3"`
+	CreatedAt time.Time  `json:"createdAt" example:"2024-01-15T10:30:00Z"`
+	ExpiresAt time.Time  `json:"expiresAt" example:"2024-01-22T10:30:00Z"`
+	RevokedAt *time.Time `json:"revokedAt" example:"2024-01-16T08:00:00Z"`
+}
+
+// CreateInviteResponse represents a newly created invite.
+// The code and link are returned only once.
+type CreateInviteResponse struct {
+	InviteResponse
+	Code string `json:"code" example:"Zk3mP9qL2xWv7cR4tY8bN1sD6fH0jA5e"`
+	URL  string `json:"url" example:"https://chat.example.com/register?invite=Zk3mP9qL2xWv7cR4tY8bN1sD6fH0jA5e"`
+}
+
+// HubsResponse represents room hubs running on one node and their connected clients
+type HubsResponse struct {
+	Node       string     `json:"node" example:"backend-1-3f9a2c01"`
+	ActiveHubs int        `json:"activeHubs" example:"2"`
+	Clients    int        `json:"clients" example:"5"`
+	Hubs       []HubStats `json:"hubs"`
+	Events     WSCounters `json:"events"`
+}
+
+// WSCounters represents WebSocket connection health events since server start
+type WSCounters struct {
+	PingTimeouts          int64 `json:"pingTimeouts" example:"3"`
+	OversizedFrames       int64 `json:"oversizedFrames" example:"0"`
+	WriteTimeouts         int64 `json:"writeTimeouts" example:"1"`
+	RateLimitedFrames     int64 `json:"rateLimitedFrames" example:"12"`
+	RateLimitEvictions    int64 `json:"rateLimitEvictions" example:"0"`
+	SlowConsumerEvictions int64 `json:"slowConsumerEvictions" example:"2"`
+}
+
+// ChangePasswordRequest represents the request body for changing the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required" example:"securepassword123"`
+	NewPassword     string `json:"newPassword" binding:"required" example:"correct-horse-battery-staple"`
+}
+
+// DeleteAccountRequest represents the confirmation for deleting the current account.
+// Password is required when the account has one; otherwise Confirm must repeat the login
+type DeleteAccountRequest struct {
+	Password string `json:"password" example:"securepassword123"`
+	Confirm  string `json:"confirm" example:"john_doe"`
+}
+
+// OIDCAuthorizeResponse represents the start of an SSO login
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorizationUrl" example:"https://idp.example.com/authorize?response_type=code&client_id=linkup"`
+	State            string `json:"state" example:"b3JpZ2luYWwtc3RhdGU"`
+}
+
+// OIDCCallbackRequest represents the request body for finishing an SSO login
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required" example:"SplxlOBeZQQYbYS6WxSbIA"`
+	State string `json:"state" binding:"required" example:"b3JpZ2luYWwtc3RhdGU"`
 }
 
 // UserResponse represents user data in responses
@@ -57,6 +223,36 @@ type UserResponse struct {
 	AvatarURL string     `json:"avatarUrl" example:"https://example.com/avatar.jpg"`
 	Online    bool       `json:"online" example:"true"`
 	LastSeen  *time.Time `json:"lastSeen" example:"2024-01-15T10:30:00Z"`
+	// Email and EmailVerified are only returned for the current user
+	Email         *string `json:"email,omitempty" example:"john@example.com"`
+	EmailVerified bool    `json:"emailVerified,omitempty" example:"true"`
+	// Presence is returned for the current user and in room member lists
+	Presence *PresenceResponse `json:"presence,omitempty"`
+}
+
+// PresenceResponse represents the presence of a user as seen by the caller
+type PresenceResponse struct {
+	// State is online, idle, away, dnd or offline; users hiding their online state appear offline to others
+	State     string     `json:"state" example:"online" enums:"online,idle,away,dnd,offline"`
+	Text      string     `json:"text,omitempty" example:"In a meeting"`
+	Emoji     string     `json:"emoji,omitempty" example:"📅"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" example:"2024-01-15T12:00:00Z"`
+	LastSeen  *time.Time `json:"lastSeen" example:"2024-01-15T10:30:00Z"`
+	// Mode and HideOnline are only returned for the current user
+	Mode       string `json:"mode,omitempty" example:"auto" enums:"auto,away,dnd"`
+	HideOnline bool   `json:"hideOnline,omitempty" example:"false"`
+}
+
+// UpdateStatusRequest represents a presence status change; omitted fields are left unchanged
+type UpdateStatusRequest struct {
+	// Mode auto derives online or idle from client activity; away and dnd override it while connected
+	Mode *string `json:"mode" example:"dnd" enums:"auto,away,dnd"`
+	// Text, Emoji and ExpiresAt replace the custom status together; empty text and emoji clear it
+	Text      *string    `json:"text" example:"In a meeting"`
+	Emoji     *string    `json:"emoji" example:"📅"`
+	ExpiresAt *time.Time `json:"expiresAt" example:"2024-01-15T12:00:00Z"`
+	// HideOnline makes the user appear offline to others
+	HideOnline *bool `json:"hideOnline" example:"false"`
 }
 
 // RoomResponse represents room data in responses
@@ -81,6 +277,28 @@ type MessageResponse struct {
 	Reactions map[string][]uint `json:"reactions"`
 }
 
+// MessageAckResponse represents the acknowledgement of a sent message
+type MessageAckResponse struct {
+	ID          uint      `json:"id" example:"42"`
+	ClientMsgID string    `json:"clientMsgId,omitempty" example:"7f3c2a9e-5b1d-4c8e-9a0f-2d6b8e1c4f7a"`
+	CreatedAt   time.Time `json:"createdAt" example:"2024-01-15T10:30:00Z"`
+	Duplicate   bool      `json:"duplicate" example:"false"`
+}
+
+// SendErrorResponse represents a rejected message send
+type SendErrorResponse struct {
+	Error string `json:"error" example:"not a member of private room"`
+	Code  string `json:"code" example:"forbidden"`
+}
+
+// RoomEventsResponse represents a batch of room events returned by long-polling
+type RoomEventsResponse struct {
+	// Events are the same frames the room WebSocket delivers, oldest first
+	Events []Event `json:"events"`
+	// LastEventID is the cursor for the next poll
+	LastEventID uint64 `json:"lastEventId" example:"42"`
+}
+
 // UploadResponse represents the response for file upload
 type UploadResponse struct {
 	URL string `json:"url" example:"http://localhost:8080/uploads/1_1642234567890.jpg"`
@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"LinkUp/internal/audit"
+	"LinkUp/internal/auth"
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/models"
+	"LinkUp/internal/webauthn"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Назначение церемоний WebAuthn
+const (
+	ceremonyRegister = "register"
+	ceremonyLogin    = "login"
+	ceremony2FA      = "2fa"
+)
+
+const attemptBadPasskey = "bad_passkey"
+
+var errWebAuthnChallenge = errors.New("invalid or expired webauthn challenge")
+
+// webauthnUserHandle — user.id для WebAuthn. Не содержит персональных данных.
+func webauthnUserHandle(userID uint) string {
+	return webauthn.EncodeID([]byte(strconv.FormatUint(uint64(userID), 10)))
+}
+
+// userCredentials возвращает дескрипторы ключей пользователя для
+// excludeCredentials/allowCredentials.
+func (h *Handler) userCredentials(userID uint) []webauthn.CredentialDescriptor {
+	var creds []models.WebAuthnCredential
+	h.db.Where("user_id = ?", userID).Find(&creds)
+	out := make([]webauthn.CredentialDescriptor, 0, len(creds))
+	for _, cr := range creds {
+		out = append(out, webauthn.CredentialDescriptor{Type: "public-key", ID: cr.CredentialID, Transports: cr.Transports})
+	}
+	return out
+}
+
+// beginCeremony сохраняет новый challenge церемонии.
+func (h *Handler) beginCeremony(purpose string, userID *uint) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	st := models.WebAuthnChallenge{
+		Challenge: challenge,
+		Purpose:   purpose,
+		UserID:    userID,
+		ExpiresAt: now.Add(h.webauthn.Config().Timeout),
+	}
+	if err := h.db.Create(&st).Error; err != nil {
+		return "", err
+	}
+	h.db.Where("expires_at < ?", now).Delete(&models.WebAuthnChallenge{})
+	return challenge, nil
+}
+
+// consumeCeremony атомарно забирает challenge из clientDataJSON.
+// Повторное предъявление того же ответа не пройдет.
+func (h *Handler) consumeCeremony(clientDataJSON, purpose string) (models.WebAuthnChallenge, error) {
+	var st models.WebAuthnChallenge
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return st, errWebAuthnChallenge
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("challenge = ? AND purpose = ?", challenge, purpose).
+			First(&st).Error; err != nil {
+			return errWebAuthnChallenge
+		}
+		res := tx.Delete(&st)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 || time.Now().After(st.ExpiresAt) {
+			return errWebAuthnChallenge
+		}
+		return nil
+	})
+	return st, err
+}
+
+// verifyPasskey проверяет ответ ключа cred и обновляет его счетчик подписей.
+func (h *Handler) verifyPasskey(cred *models.WebAuthnCredential, resp *webauthn.AssertionResponse, challenge, userVerification string) error {
+	if resp.Response.UserHandle != "" && resp.Response.UserHandle != webauthnUserHandle(cred.UserID) {
+		return webauthn.ErrInvalidResponse
+	}
+	res, err := h.webauthn.VerifyAssertion(resp, challenge, userVerification, cred.PublicKey, cred.SignCount)
+	if err != nil {
+		return err
+	}
+	// Счетчик сдвигается только вперед и только одним запросом: из двух
+	// одновременных ответов с одинаковым счетчиком (клон ключа) пройдет один.
+	// Аутентификаторы без счетчика всегда присылают 0 — для них условия нет.
+	q := h.db.Model(cred)
+	updates := map[string]interface{}{"last_used_at": time.Now()}
+	if res.SignCount != 0 {
+		q = q.Where("sign_count < ?", res.SignCount)
+		updates["sign_count"] = res.SignCount
+	}
+	upd := q.Updates(updates)
+	if upd.Error != nil {
+		return upd.Error
+	}
+	if upd.RowsAffected == 0 {
+		return webauthn.ErrSignCount
+	}
+	return nil
+}
+
+func passkeyResponse(cr models.WebAuthnCredential) PasskeyResponse {
+	return PasskeyResponse{
+		ID:             cr.ID,
+		Name:           cr.Name,
+		CreatedAt:      cr.CreatedAt,
+		LastUsedAt:     cr.LastUsedAt,
+		Transports:     cr.Transports,
+		BackupEligible: cr.BackupEligible,
+	}
+}
+
+// loginMethods считает способы входа пользователя: пароль, привязанные
+// SSO-аккаунты и passkeys. Последний способ удалить нельзя.
+func (h *Handler) loginMethods(u models.User) int64 {
+	var identities, passkeys int64
+	h.db.Model(&models.ExternalIdentity{}).Where("user_id = ?", u.ID).Count(&identities)
+	h.db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", u.ID).Count(&passkeys)
+	n := identities + passkeys
+	if u.Password != "" {
+		n++
+	}
+	return n
+}
+
+// ==================== PASSKEYS (WEBAUTHN) ====================
+
+// @Summary Начать регистрацию passkey
+// @Description Возвращает параметры для navigator.credentials.create() в JSON-представлении WebAuthn (бинарные поля в base64url)
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} WebAuthnCreationResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/webauthn/register/begin [post]
+func (h *Handler) BeginPasskeyRegistration(c *gin.Context) {
+	var u models.User
+	if findErr := h.db.First(&u, uid(c)).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("BeginPasskeyRegistration.FindUser", findErr, "user not found", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Unauthorized.")
+		return
+	}
+	userID := u.ID
+	challenge, beginErr := h.beginCeremony(ceremonyRegister, &userID)
+	if beginErr != nil {
+		apiErr := apiErrors.NewAPIError("BeginPasskeyRegistration.Challenge", beginErr, "failed to start ceremony", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	user := webauthn.UserEntity{ID: webauthnUserHandle(u.ID), Name: u.Login, DisplayName: u.Name}
+	c.JSON(http.StatusOK, WebAuthnCreationResponse{
+		PublicKey: h.webauthn.CreationOptions(challenge, user, h.userCredentials(u.ID)),
+	})
+}
+
+// @Summary Завершить регистрацию passkey
+// @Description Проверяет ответ аутентификатора и сохраняет ключ. После регистрации ключ можно использовать для входа без пароля и как второй фактор
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param credential body PasskeyRegisterRequest true "Название и ответ navigator.credentials.create()"
+// @Success 201 {object} PasskeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /auth/webauthn/register/finish [post]
+func (h *Handler) FinishPasskeyRegistration(c *gin.Context) {
+	var req PasskeyRegisterRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("FinishPasskeyRegistration.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	st, stErr := h.consumeCeremony(req.Credential.Response.ClientDataJSON, ceremonyRegister)
+	if stErr != nil || st.UserID == nil || *st.UserID != uid(c) {
+		apiErr := apiErrors.NewAPIError("FinishPasskeyRegistration.Challenge", stErr, "invalid challenge", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Registration expired. Please try again.")
+		return
+	}
+	cred, verifyErr := h.webauthn.VerifyRegistration(&req.Credential, st.Challenge, webauthn.UVPreferred)
+	if verifyErr != nil {
+		apiErr := apiErrors.NewAPIError("FinishPasskeyRegistration.Verify", verifyErr, "verification failed", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Passkey verification failed.")
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Passkey"
+	}
+	row := models.WebAuthnCredential{
+		UserID:         uid(c),
+		Name:           truncate(name, 100),
+		CredentialID:   webauthn.EncodeID(cred.ID),
+		PublicKey:      cred.PublicKey,
+		Algorithm:      cred.Algorithm,
+		SignCount:      cred.SignCount,
+		AAGUID:         cred.AAGUID,
+		Transports:     cred.Transports,
+		BackupEligible: cred.BackupEligible,
+	}
+	var exists int64
+	h.db.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", row.CredentialID).Count(&exists)
+	if exists > 0 {
+		apiErr := apiErrors.NewAPIError("FinishPasskeyRegistration.Duplicate", nil, "credential already registered", 409)
+		apiErrors.LogAndRespondAPI(c, apiErr, "This passkey is already registered.")
+		return
+	}
+	if createErr := h.db.Create(&row).Error; createErr != nil {
+		apiErr := apiErrors.NewAPIError("FinishPasskeyRegistration.Create", createErr, "failed to save credential", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	h.recordAudit(c, audit.ActionPasskeyAdd, audit.TargetPasskey, row.ID, audit.Diff{}.Add("name", nil, row.Name))
+	c.JSON(http.StatusCreated, passkeyResponse(row))
+}
+
+// @Summary Список passkeys
+// @Description Возвращает ключи WebAuthn текущего пользователя
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} PasskeyResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/webauthn/credentials [get]
+func (h *Handler) ListPasskeys(c *gin.Context) {
+	var creds []models.WebAuthnCredential
+	if findErr := h.db.Where("user_id = ?", uid(c)).Order("created_at asc").Find(&creds).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("ListPasskeys.Find", findErr, "failed to load credentials", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	res := make([]PasskeyResponse, 0, len(creds))
+	for _, cr := range creds {
+		res = append(res, passkeyResponse(cr))
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// @Summary Переименовать passkey
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID ключа"
+// @Param credential body RenamePasskeyRequest true "Новое название"
+// @Success 200 {object} PasskeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/webauthn/credentials/{id} [put]
+func (h *Handler) RenamePasskey(c *gin.Context) {
+	var req RenamePasskeyRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil || len(req.Name) > 100 {
+		apiErr := apiErrors.NewAPIError("RenamePasskey.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	var cred models.WebAuthnCredential
+	if findErr := h.db.Where("id = ? AND user_id = ?", c.Param("id"), uid(c)).First(&cred).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("RenamePasskey.Find", findErr, "credential not found", 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Passkey not found.")
+		return
+	}
+	oldName := cred.Name
+	if updateErr := h.db.Model(&cred).Update("name", req.Name).Error; updateErr != nil {
+		apiErr := apiErrors.NewAPIError("RenamePasskey.Update", updateErr, "failed to rename", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	h.recordAudit(c, audit.ActionPasskeyRename, audit.TargetPasskey, cred.ID, audit.Diff{}.Add("name", oldName, cred.Name))
+	c.JSON(http.StatusOK, passkeyResponse(cred))
+}
+
+// @Summary Удалить passkey
+// @Description Удаляет ключ WebAuthn. Нельзя удалить последний способ входа аккаунта без пароля
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID ключа"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /auth/webauthn/credentials/{id} [delete]
+func (h *Handler) DeletePasskey(c *gin.Context) {
+	var cred models.WebAuthnCredential
+	if findErr := h.db.Where("id = ? AND user_id = ?", c.Param("id"), uid(c)).First(&cred).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError("DeletePasskey.Find", findErr, "credential not found", 404)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Passkey not found.")
+		return
+	}
+	var u models.User
+	h.db.First(&u, uid(c))
+	if h.loginMethods(u) <= 1 {
+		apiErr := apiErrors.NewAPIError("DeletePasskey.LastMethod", nil, "last login method", 409)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Cannot delete the only way to sign in.")
+		return
+	}
+	if deleteErr := h.db.Delete(&cred).Error; deleteErr != nil {
+		apiErr := apiErrors.NewAPIError("DeletePasskey.Delete", deleteErr, "failed to delete", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	h.recordAudit(c, audit.ActionPasskeyRemove, audit.TargetPasskey, cred.ID, audit.Diff{}.Add("name", cred.Name, nil))
+	c.JSON(http.StatusOK, SuccessResponse{OK: true})
+}
+
+// @Summary Начать вход по passkey
+// @Description Возвращает параметры для navigator.credentials.get(). Без логина используется discoverable-ключ, который сам сообщает пользователя
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body PasskeyLoginBeginRequest false "Логин (необязательно)"
+// @Success 200 {object} WebAuthnRequestResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /auth/webauthn/login/begin [post]
+func (h *Handler) BeginPasskeyLogin(c *gin.Context) {
+	var req PasskeyLoginBeginRequest
+	if c.Request.ContentLength != 0 {
+		if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+			apiErr := apiErrors.NewAPIError("BeginPasskeyLogin.BindJSON", bindErr, "invalid body", 400)
+			apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+			return
+		}
+	}
+	var (
+		userID *uint
+		allow  []webauthn.CredentialDescriptor
+	)
+	if req.Login != "" {
+		// Для неизвестного логина отвечаем так же, как для известного без ключей,
+		// чтобы не раскрывать существование аккаунта
+		var u models.User
+		if h.db.Where("login = ?", req.Login).First(&u).Error == nil {
+			userID = &u.ID
+			allow = h.userCredentials(u.ID)
+		}
+	}
+	challenge, beginErr := h.beginCeremony(ceremonyLogin, userID)
+	if beginErr != nil {
+		apiErr := apiErrors.NewAPIError("BeginPasskeyLogin.Challenge", beginErr, "failed to start ceremony", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	c.JSON(http.StatusOK, WebAuthnRequestResponse{
+		PublicKey: h.webauthn.RequestOptions(challenge, allow, webauthn.UVRequired),
+	})
+}
+
+// @Summary Войти по passkey
+// @Description Вход без пароля. Ключ с проверкой пользователя (PIN, биометрия) заменяет оба фактора, поэтому 2FA не запрашивается
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credential body PasskeyLoginRequest true "Ответ navigator.credentials.get()"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /auth/webauthn/login/finish [post]
+func (h *Handler) FinishPasskeyLogin(c *gin.Context) {
+	var req PasskeyLoginRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("FinishPasskeyLogin.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	st, stErr := h.consumeCeremony(req.Credential.Response.ClientDataJSON, ceremonyLogin)
+	if stErr != nil {
+		apiErr := apiErrors.NewAPIError("FinishPasskeyLogin.Challenge", stErr, "invalid challenge", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid or expired passkey challenge.")
+		return
+	}
+	h.finishPasskey(c, "FinishPasskeyLogin", &req.Credential, st, webauthn.UVRequired, nil)
+}
+
+// finishPasskey проверяет ключ для уже найденной церемонии и завершает вход.
+// challenge — токен второго шага, если ключ подтверждает 2FA: он гасится
+// перед входом.
+func (h *Handler) finishPasskey(c *gin.Context, op string, resp *webauthn.AssertionResponse, st models.WebAuthnChallenge, userVerification string, challenge *auth.Claims) {
+	var cred models.WebAuthnCredential
+	rawID, _ := webauthn.DecodeID(resp.RawID)
+	if findErr := h.db.Where("credential_id = ?", webauthn.EncodeID(rawID)).First(&cred).Error; findErr != nil ||
+		(st.UserID != nil && *st.UserID != cred.UserID) {
+		apiErr := apiErrors.NewAPIError(op+".FindCredential", findErr, "unknown credential", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid passkey.")
+		return
+	}
+	var u models.User
+	if findErr := h.db.First(&u, cred.UserID).Error; findErr != nil {
+		apiErr := apiErrors.NewAPIError(op+".FindUser", findErr, "user not found", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid passkey.")
+		return
+	}
+	if h.checkLockout(c, op, u.Login, &u.ID) {
+		return
+	}
+	if verifyErr := h.verifyPasskey(&cred, resp, st.Challenge, userVerification); verifyErr != nil {
+		if h.loginFailed(c, op, u.Login, &u.ID, attemptBadPasskey) {
+			return
+		}
+		apiErr := apiErrors.NewAPIError(op+".Verify", verifyErr, "assertion verification failed", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid passkey.")
+		return
+	}
+	if challenge != nil && !h.consumeChallenge(c, op, challenge) {
+		return
+	}
+	h.completeLogin(c, op, u)
+}
+
+// @Summary Начать проверку второго фактора по passkey
+// @Description Вместо TOTP-кода второй фактор можно подтвердить зарегистрированным ключом. Принимает challenge-токен из /login
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body Passkey2FABeginRequest true "Challenge-токен"
+// @Success 200 {object} WebAuthnRequestResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/2fa/webauthn/begin [post]
+func (h *Handler) BeginPasskey2FA(c *gin.Context) {
+	var req Passkey2FABeginRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("BeginPasskey2FA.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	challenge, parseErr := auth.ParseChallengeToken(req.ChallengeToken)
+	if parseErr != nil {
+		apiErr := apiErrors.NewAPIError("BeginPasskey2FA.ParseChallenge", parseErr, "invalid challenge token", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid or expired challenge.")
+		return
+	}
+	userID := challenge.UserID
+	allow := h.userCredentials(userID)
+	if len(allow) == 0 {
+		apiErr := apiErrors.NewAPIError("BeginPasskey2FA.NoCredentials", nil, "user has no passkeys", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "No passkeys registered.")
+		return
+	}
+	ceremony, beginErr := h.beginCeremony(ceremony2FA, &userID)
+	if beginErr != nil {
+		apiErr := apiErrors.NewAPIError("BeginPasskey2FA.Challenge", beginErr, "failed to start ceremony", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	c.JSON(http.StatusOK, WebAuthnRequestResponse{
+		PublicKey: h.webauthn.RequestOptions(ceremony, allow, webauthn.UVPreferred),
+	})
+}
+
+// @Summary Подтвердить второй фактор passkey
+// @Description Завершает вход с 2FA ключом WebAuthn вместо TOTP-кода
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credential body Passkey2FARequest true "Challenge-токен и ответ navigator.credentials.get()"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /auth/2fa/webauthn/finish [post]
+func (h *Handler) FinishPasskey2FA(c *gin.Context) {
+	var req Passkey2FARequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil {
+		apiErr := apiErrors.NewAPIError("FinishPasskey2FA.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	challenge, parseErr := auth.ParseChallengeToken(req.ChallengeToken)
+	if parseErr != nil {
+		apiErr := apiErrors.NewAPIError("FinishPasskey2FA.ParseChallenge", parseErr, "invalid challenge token", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid or expired challenge.")
+		return
+	}
+	st, stErr := h.consumeCeremony(req.Credential.Response.ClientDataJSON, ceremony2FA)
+	if stErr != nil || st.UserID == nil || *st.UserID != challenge.UserID {
+		apiErr := apiErrors.NewAPIError("FinishPasskey2FA.Challenge", stErr, "invalid challenge", 401)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid or expired passkey challenge.")
+		return
+	}
+	h.finishPasskey(c, "FinishPasskey2FA", &req.Credential, st, webauthn.UVPreferred, challenge)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"LinkUp/internal/auth"
+	"LinkUp/internal/models"
+	"LinkUp/internal/webauthn"
+
+	"github.com/gin-gonic/gin"
+)
+
+const passkeyOrigin = "https://chat.example.com"
+
+// publicKeyOptions достает publicKey из ответа begin-ручки в нужный тип.
+func publicKeyOptions(t *testing.T, out map[string]interface{}, opts interface{}) {
+	t.Helper()
+	b, _ := json.Marshal(out["publicKey"])
+	if err := json.Unmarshal(b, opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasskeyCeremonies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testDB(t)
+	h := New(db, t.TempDir(), "http://x")
+	h.webauthn = webauthn.New(webauthn.Config{RPID: "chat.example.com", RPName: "LinkUp", Origins: []string{passkeyOrigin}})
+	auth.SetSessionValidator(h.SessionActive)
+	t.Cleanup(func() { auth.SetSessionValidator(nil) })
+
+	r := gin.New()
+	r.POST("/register", h.Register)
+	r.POST("/auth/webauthn/login/begin", h.BeginPasskeyLogin)
+	r.POST("/auth/webauthn/login/finish", h.FinishPasskeyLogin)
+	pr := r.Group("", auth.JWTMiddleware())
+	pr.POST("/auth/webauthn/register/begin", h.BeginPasskeyRegistration)
+	pr.POST("/auth/webauthn/register/finish", h.FinishPasskeyRegistration)
+
+	_, out := doJSON(t, r, http.MethodPost, "/register", "", map[string]string{"login": "alice", "password": "Str0ng-pass", "name": "Alice"})
+	tok := out["token"].(string)
+	a := webauthn.NewSoftAuthenticator(passkeyOrigin)
+
+	register := func(a *webauthn.SoftAuthenticator) (int, map[string]interface{}) {
+		_, out := doJSON(t, r, http.MethodPost, "/auth/webauthn/register/begin", tok, nil)
+		var opts webauthn.CreationOptions
+		publicKeyOptions(t, out, &opts)
+		resp, err := a.Create(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doJSON(t, r, http.MethodPost, "/auth/webauthn/register/finish", tok, PasskeyRegisterRequest{Name: "soft", Credential: *resp})
+	}
+	if code, out := register(webauthn.NewSoftAuthenticator("https://evil.example")); code != http.StatusBadRequest {
+		t.Fatalf("registered from a foreign origin: %d %v", code, out)
+	}
+	if code, out := register(a); code != http.StatusCreated {
+		t.Fatalf("register: %d %v", code, out)
+	}
+
+	// assertion начинает вход без логина и отвечает ключом a
+	assertion := func(a *webauthn.SoftAuthenticator) PasskeyLoginRequest {
+		_, out := doJSON(t, r, http.MethodPost, "/auth/webauthn/login/begin", "", nil)
+		var opts webauthn.RequestOptions
+		publicKeyOptions(t, out, &opts)
+		resp, err := a.Get(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return PasskeyLoginRequest{Credential: *resp}
+	}
+	login := assertion(a)
+	code, out := doJSON(t, r, http.MethodPost, "/auth/webauthn/login/finish", "", login)
+	if code != http.StatusOK || out["token"] == nil || out["user"].(map[string]interface{})["login"] != "alice" {
+		t.Fatalf("login: %d %v", code, out)
+	}
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/webauthn/login/finish", "", login); code != http.StatusUnauthorized {
+		t.Fatalf("replayed assertion: %d", code)
+	}
+
+	// ответ с меньшим счетчиком, чем уже принятый, — признак клона
+	older, newer := assertion(a), assertion(a)
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/webauthn/login/finish", "", newer); code != http.StatusOK {
+		t.Fatalf("newer assertion: %d", code)
+	}
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/webauthn/login/finish", "", older); code != http.StatusUnauthorized {
+		t.Fatalf("sign count regression: %d", code)
+	}
+
+	// ключ, созданный для того же сайта, но не зарегистрированный у нас
+	stranger := webauthn.NewSoftAuthenticator(passkeyOrigin)
+	challenge, _ := webauthn.NewChallenge()
+	if _, err := stranger.Create(h.webauthn.CreationOptions(challenge, webauthn.UserEntity{ID: webauthnUserHandle(1)}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := doJSON(t, r, http.MethodPost, "/auth/webauthn/login/finish", "", assertion(stranger)); code != http.StatusUnauthorized {
+		t.Fatalf("unknown credential: %d", code)
+	}
+}
+
+// Две проверки одного ключа, прочитавшие один и тот же счетчик, не должны
+// пройти обе: счетчик обновляется условием в самом UPDATE.
+func TestVerifyPasskeySignCountRace(t *testing.T) {
+	db := testDB(t)
+	h := New(db, t.TempDir(), "http://x")
+	rp := webauthn.New(webauthn.Config{RPID: "chat.example.com", Origins: []string{passkeyOrigin}})
+	h.webauthn = rp
+	a := webauthn.NewSoftAuthenticator(passkeyOrigin)
+
+	challenge, _ := webauthn.NewChallenge()
+	reg, err := a.Create(rp.CreationOptions(challenge, webauthn.UserEntity{ID: webauthnUserHandle(1), Name: "alice"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := rp.VerifyRegistration(reg, challenge, webauthn.UVPreferred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := models.WebAuthnCredential{UserID: 1, Name: "soft", CredentialID: webauthn.EncodeID(cred.ID), PublicKey: cred.PublicKey, Algorithm: cred.Algorithm}
+	if err := db.Create(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() (*webauthn.AssertionResponse, string) {
+		challenge, _ := webauthn.NewChallenge()
+		resp, err := a.Get(rp.RequestOptions(challenge, nil, webauthn.UVRequired))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, challenge
+	}
+	first, firstChallenge := get()
+	second, secondChallenge := get()
+
+	// обе проверки видят счетчик 0, как если бы шли одновременно
+	stale := row
+	if err := h.verifyPasskey(&stale, second, secondChallenge, webauthn.UVRequired); err != nil {
+		t.Fatal(err)
+	}
+	stale = row
+	if err := h.verifyPasskey(&stale, first, firstChallenge, webauthn.UVRequired); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Fatalf("stale assertion accepted: %v", err)
+	}
+	var got models.WebAuthnCredential
+	db.First(&got, row.ID)
+	if got.SignCount != 2 {
+		t.Fatalf("sign_count = %d", got.SignCount)
+	}
+}
@@ -1,291 +1,259 @@
 package handlers
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"LinkUp/internal/auth"
 	"LinkUp/internal/models"
+	"LinkUp/internal/wsproto"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
+// upgrader — общие настройки; Origin проверяется по списку CORS_ORIGINS (см. initWS).
+var upgrader = websocket.Upgrader{}
 
+// Event — кадр, отправляемый клиенту. RoomID задан у событий комнаты и у
+// ответов на кадры управления подпиской; Seq — номер события комнаты для
+// возобновления сессии (у typing и presence_* не задан); RequestID повторяет
+// requestId кадра, на который отвечает событие. Схема — wsproto.
 type Event struct {
-	Type    string      `json:"type"`
-	Payload interface{} `json:"payload"`
+	Type      string      `json:"type"`
+	RoomID    uint        `json:"roomId,omitempty"`
+	Seq       uint64      `json:"seq,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+	Payload   interface{} `json:"payload"`
 }
 
-type wsIncoming struct {
-	Type    string                 `json:"type"`
-	Payload map[string]interface{} `json:"payload"`
-}
+// ------------------- Client -------------------
 
-type Presence struct {
-	mu     sync.Mutex
-	online map[uint]time.Time
-}
-// Auto-generated swagger comments for NewPresence
-// @Summary Auto-generated summary for NewPresence
-// @Description Auto-generated description for NewPresence — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
+type Client struct {
+	conn    *websocket.Conn
+	send    chan *wsFrame
+	// codec — кодировка кадров согласованного подпротокола
+	codec   *wsCodec
+	userID  uint
+	handler *Handler
+	// readOnly — клиент подключен персональным токеном без messages:write
+	readOnly bool
+	// room — комната соединения /ws/rooms/:id; у мультиплексного соединения /ws
+	// (mux) комнаты задаются подписками
+	room uint
+	mux  bool
+	// tokenRoom — комната, которой ограничен персональный токен (0 — без ограничения)
+	tokenRoom uint
+	// quiet — клиент long-poll: подключен к хабу на время одного запроса и не
+	// влияет на присутствие (см. fallback.go). У клиентов SSE и long-poll нет conn
+	quiet bool
 
-func NewPresence() *Presence { return &Presence{online: map[uint]time.Time{}} }
-func (p *Presence) Online(uid uint) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.online[uid] = time.Now()
-}
-func (p *Presence) Offline(uid uint) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	delete(p.online, uid)
-}
-// Auto-generated swagger comments for LastSeen
-// @Summary Auto-generated summary for LastSeen
-// @Description Auto-generated description for LastSeen — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
-func (p *Presence) LastSeen(uid uint) (time.Time, bool) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	t, ok := p.online[uid]
-	return t, ok
-}
-func (p *Presence) IsOnline(uid uint) bool {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	_, ok := p.online[uid]
-	return ok
-}
+	// subs — хабы комнат, на которые подписан клиент
+	subMu sync.Mutex
+	subs  map[uint]*Hub
 
-// Возвращает короче все короче статусы короче  для короче  ws короче клиентов
-// Auto-generated swagger comments for AllStatuses
-// @Summary Auto-generated summary for AllStatuses
-// @Description Auto-generated description for AllStatuses — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
-func (p *Presence) AllStatuses() map[uint]map[string]interface{} {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	status := map[uint]map[string]interface{}{}
-	for uid, t := range p.online {
-		status[uid] = map[string]interface{}{
-			"online":   true,
-			"lastSeen": t,
-		}
-	}
-	return status
+	// sendMu защищает send от записи после закрытия хабом
+	sendMu sync.Mutex
+	closed bool
+	// closeCode и closeReason уходят клиенту в кадре закрытия
+	closeCode   int
+	closeReason string
 }
 
-// ------------------- RoomHubs -------------------
-
-type RoomHubs struct {
-	hubs map[uint]*Hub
+// trySend кладет событие в очередь клиента, не блокируясь. Клиент с
+// переполненной очередью отключается с кодом 1013. false — событие не доставлено.
+func (c *Client) trySend(ev Event) bool {
+	return c.enqueue(newFrame(ev))
 }
-// Auto-generated swagger comments for NewRoomHubs
-// @Summary Auto-generated summary for NewRoomHubs
-// @Description Auto-generated description for NewRoomHubs — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
 
-func NewRoomHubs() *RoomHubs { return &RoomHubs{hubs: map[uint]*Hub{}} }
-func (r *RoomHubs) hub(roomID uint) *Hub {
-	if h, ok := r.hubs[roomID]; ok {
-		return h
+// enqueue — как trySend, но для кадра, который разделяют несколько получателей.
+func (c *Client) enqueue(f *wsFrame) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- f:
+		return true
+	default:
+		wsStats.slowEvictions.Add(1)
+		c.closeLocked(closeSlowConsumer, "send queue overflow")
+		return false
 	}
-	h := NewHub(roomID)
-	r.hubs[roomID] = h
-	go h.Run()
-	return h
 }
-// Auto-generated swagger comments for Emit
-// @Summary Auto-generated summary for Emit
-// @Description Auto-generated description for Emit — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
-func (r *RoomHubs) Emit(roomID uint, ev Event) { r.hub(roomID).Broadcast(ev) }
 
-// ------------------- Hub -------------------
+// closeSend закрывает очередь; writePump после этого закрывает соединение.
+func (c *Client) closeSend() {
+	c.evict(websocket.CloseNormalClosure, "")
+}
 
-type Hub struct {
-	roomID     uint
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan Event
-	clients    map[*Client]bool
+// evict закрывает очередь с указанным кодом и причиной закрытия соединения.
+func (c *Client) evict(code int, reason string) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.closeLocked(code, reason)
 }
-// Auto-generated swagger comments for NewHub
-// @Summary Auto-generated summary for NewHub
-// @Description Auto-generated description for NewHub — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
 
-func NewHub(roomID uint) *Hub {
-	return &Hub{
-		roomID:     roomID,
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan Event, 64),
-		clients:    map[*Client]bool{},
+func (c *Client) closeLocked(code int, reason string) {
+	if !c.closed {
+		c.closed = true
+		c.closeCode, c.closeReason = code, reason
+		close(c.send)
 	}
 }
-// Auto-generated swagger comments for Run
-// @Summary Auto-generated summary for Run
-// @Description Auto-generated description for Run — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
 
-func (h *Hub) Run() {
-	for {
-		select {
-		case c := <-h.register:
-			h.clients[c] = true
-			h.Broadcast(Event{Type: "presence_join", Payload: gin.H{"userId": c.userID}})
-			h.broadcastPresenceUpdate()
-		case c := <-h.unregister:
-			if _, ok := h.clients[c]; ok {
-				delete(h.clients, c)
-				close(c.send)
-			}
-			h.Broadcast(Event{Type: "presence_leave", Payload: gin.H{"userId": c.userID}})
-			h.broadcastPresenceUpdate()
-		case ev := <-h.broadcast:
-			for c := range h.clients {
-				select {
-				case c.send <- ev:
-				default:
-					close(c.send)
-					delete(h.clients, c)
-				}
-			}
-		}
+// rooms возвращает комнаты, на которые подписан клиент.
+func (c *Client) rooms() []uint {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	ids := make([]uint, 0, len(c.subs))
+	for id := range c.subs {
+		ids = append(ids, id)
 	}
+	return ids
 }
 
-// Отправка статусов всех пользователей
-// Auto-generated swagger comments for broadcastPresenceUpdate
-// @Summary Auto-generated summary for broadcastPresenceUpdate
-// @Description Auto-generated description for broadcastPresenceUpdate — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
-func (h *Hub) broadcastPresenceUpdate() {
-	status := h.clientsStatus()
-	ev := Event{Type: "presence_update", Payload: status}
-	for c := range h.clients {
-		select {
-		case c.send <- ev:
-		default:
-			close(c.send)
-			delete(h.clients, c)
-		}
-	}
+func (c *Client) subscribed(roomID uint) bool {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	_, ok := c.subs[roomID]
+	return ok
 }
 
-// Получаем статусы пользователей из Presence
-// Auto-generated swagger comments for clientsStatus
-// @Summary Auto-generated summary for clientsStatus
-// @Description Auto-generated description for clientsStatus — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
-func (h *Hub) clientsStatus() map[uint]map[string]interface{} {
-	status := map[uint]map[string]interface{}{}
-	for c := range h.clients {
-		status[c.userID] = map[string]interface{}{
-			"online":   true,
-			"lastSeen": time.Now(), // Здесь можно заменить на c.handler.presence.LastSeen(c.userID)
+// subscribe проверяет доступ к комнате так же, как /ws/rooms/:id, и подписывает
+// клиента. Подтверждение уходит до пропущенных событий (lastSeq != 0) и
+// событий присутствия комнаты.
+func (c *Client) subscribe(in wsIncoming) {
+	if c.tokenRoom != 0 && c.tokenRoom != in.RoomID {
+		c.fail(in, wsForbidden, "token is restricted to another room")
+		return
+	}
+	if status, msg := c.handler.roomAccess(in.RoomID, c.userID); msg != "" {
+		code := wsForbidden
+		if status == http.StatusNotFound {
+			code = wsRoomNotFound
 		}
+		c.fail(in, code, msg)
+		return
 	}
-	return status
+	c.trySend(Event{Type: "subscribed", RoomID: in.RoomID, RequestID: in.RequestID})
+	c.handler.rooms.resume(in.RoomID, c, in.LastSeq) // повторная подписка ничего не меняет
 }
-// Auto-generated swagger comments for Broadcast
-// @Summary Auto-generated summary for Broadcast
-// @Description Auto-generated description for Broadcast — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
 
-func (h *Hub) Broadcast(ev Event) { h.broadcast <- ev }
-
-// ------------------- Client -------------------
-
-type Client struct {
-	hub     *Hub
-	conn    *websocket.Conn
-	send    chan Event
-	userID  uint
-	handler *Handler
+func (c *Client) unsubscribe(in wsIncoming) {
+	if !c.handler.rooms.leave(in.RoomID, c) {
+		c.fail(in, wsNotSubscribed, "not subscribed to room")
+		return
+	}
+	c.trySend(Event{Type: "unsubscribed", RoomID: in.RoomID, RequestID: in.RequestID})
 }
-// Auto-generated swagger comments for addClient
-// @Summary Auto-generated summary for addClient
-// @Description Auto-generated description for addClient — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
 
-func (h *Handler) addClient(roomID, userID uint, conn *websocket.Conn) *Client {
-	cl := &Client{
-		hub:     h.rooms.hub(roomID),
-		conn:    conn,
-		send:    make(chan Event, 32),
-		userID:  userID,
-		handler: h,
+// post сохраняет сообщение из кадра message и отвечает ack или nack.
+func (c *Client) post(in wsIncoming) {
+	var p wsMessagePayload
+	json.Unmarshal(in.Payload, &p) // кадр уже проверен по схеме
+	if c.mux && !c.subscribed(in.RoomID) {
+		c.nack(in, p.ClientMsgID, &sendError{403, sendNotSubscribed, "not subscribed to room"})
+		return
+	}
+	if c.readOnly {
+		c.nack(in, p.ClientMsgID, &sendError{403, sendReadOnly, "token lacks scope " + auth.ScopeMessagesWrite})
+		return
 	}
-	cl.hub.register <- cl
-	return cl
+	msg := models.Message{
+		RoomID:   in.RoomID,
+		UserID:   c.userID,
+		Type:     p.Type,
+		Text:     p.Text,
+		ImageURL: p.ImageURL,
+	}
+	dup, serr := c.handler.sendMessage(&msg, p.ClientMsgID)
+	if serr != nil {
+		c.nack(in, p.ClientMsgID, serr)
+		return
+	}
+	c.trySend(Event{Type: "ack", RoomID: in.RoomID, RequestID: in.RequestID, Payload: messageAck(&msg, dup)})
 }
-// Auto-generated swagger comments for readPump
-// @Summary Auto-generated summary for readPump
-// @Description Auto-generated description for readPump — review and improve
-// @Tags internal
-// (internal function — not necessarily an HTTP handler)
 
+// readPump читает кадры клиента. Любой кадр, включая pong, продлевает
+// ожидание; частота кадров ограничена, и клиент, превысивший лимит RateBurst
+// раз подряд, отключается с кодом 1008. Соединение закрывает writePump.
 func (c *Client) readPump() {
-	defer func() {
-		c.hub.unregister <- c
-		c.conn.Close()
-		c.handler.presence.Offline(c.userID)
-	}()
+	defer c.disconnect()
+	lim := c.handler.ws
+	c.conn.SetReadLimit(lim.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(lim.PongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(lim.PongTimeout))
+	})
+	bucket := newTokenBucket(lim.RateLimit, lim.RateBurst)
+	rejected := 0
 	for {
-		var incoming wsIncoming
-		if err := c.conn.ReadJSON(&incoming); err != nil {
+		mt, data, err := c.conn.ReadMessage()
+		if err != nil {
+			wsStats.countReadError(err)
 			log.Println("read:", err)
 			break
 		}
-		switch incoming.Type {
-		case "typing":
-			c.hub.Broadcast(Event{Type: "typing", Payload: gin.H{"userId": c.userID}})
-		case "message":
-			typ, _ := incoming.Payload["type"].(string)
-			text, _ := incoming.Payload["text"].(string)
-			imageURL, _ := incoming.Payload["imageUrl"].(string)
-
-			msg := models.Message{
-				RoomID:   c.hub.roomID,
-				UserID:   c.userID,
-				Type:     typ,
-				Text:     text,
-				ImageURL: imageURL,
+		c.conn.SetReadDeadline(time.Now().Add(lim.PongTimeout))
+		if !bucket.allow(time.Now()) {
+			wsStats.rateLimited.Add(1)
+			if rejected++; rejected >= lim.RateBurst {
+				wsStats.rateEvictions.Add(1)
+				c.evict(closeRateLimited, "rate limit exceeded")
+				break
 			}
-			if msg.Type == "" {
-				msg.Type = "text"
+			// Кадр не проверяется: поля нужны только для ответа
+			var in wsIncoming
+			if js, ferr := c.codec.frame(mt, data); ferr == nil {
+				json.Unmarshal(js, &in)
 			}
-			if err := c.handler.db.Create(&msg).Error; err == nil {
-				c.hub.Broadcast(Event{Type: "message", Payload: gin.H{
-					"id":        msg.ID,
-					"roomId":    msg.RoomID,
-					"userId":    msg.UserID,
-					"type":      msg.Type,
-					"text":      msg.Text,
-					"imageUrl":  msg.ImageURL,
-					"createdAt": msg.CreatedAt,
-				}})
+			if in.Type == "message" {
+				c.nack(in, in.clientMsgID(), &sendError{429, sendRateLimited, "rate limit exceeded"})
+			} else {
+				c.fail(in, wsRateLimited, "rate limit exceeded")
 			}
+			continue
+		}
+		rejected = 0
+		in, ok := c.decode(mt, data)
+		if !ok {
+			continue
+		}
+		if !c.mux && (in.Type == "typing" || in.Type == "message") {
+			in.RoomID = c.room
+		}
+		switch in.Type {
+		case "subscribe":
+			if c.mux {
+				c.subscribe(in)
+			}
+		case "unsubscribe":
+			if c.mux {
+				c.unsubscribe(in)
+			}
+		case "typing":
+			if c.mux && !c.subscribed(in.RoomID) {
+				c.fail(in, wsNotSubscribed, "not subscribed to room")
+				continue
+			}
+			c.activity(false)
+			c.handler.rooms.Emit(in.RoomID, Event{Type: "typing", Payload: gin.H{"userId": c.userID}})
+		case "message":
+			c.activity(false)
+			c.post(in)
+		case "activity":
+			var p struct {
+				Idle bool `json:"idle"`
+			}
+			json.Unmarshal(in.Payload, &p)
+			c.activity(p.Idle)
 		}
 	}
 }
@@ -295,11 +263,42 @@ func (c *Client) readPump() {
 // @Tags internal
 // (internal function — not necessarily an HTTP handler)
 
+// writePump пишет события из очереди и ping каждые PingInterval. Каждая запись
+// ограничена WriteTimeout. Когда очередь закрыта, клиент получает кадр
+// закрытия с причиной, и соединение закрывается.
 func (c *Client) writePump() {
-	defer c.conn.Close()
-	for ev := range c.send {
-		if err := c.conn.WriteJSON(ev); err != nil {
-			break
+	lim := c.handler.ws
+	ticker := time.NewTicker(lim.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case f, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(lim.WriteTimeout))
+			if !ok {
+				c.sendMu.Lock()
+				msg := websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+				c.sendMu.Unlock()
+				c.conn.WriteMessage(websocket.CloseMessage, msg)
+				return
+			}
+			data, err := f.encoded(c.codec)
+			if err != nil {
+				log.Printf("ws: encode %s as %s: %v", f.ev.Type, c.codec.subprotocol, err)
+				continue
+			}
+			if err := c.conn.WriteMessage(c.codec.messageType, data); err != nil {
+				wsStats.countWriteError(err)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(lim.WriteTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				wsStats.countWriteError(err)
+				return
+			}
 		}
 	}
 }
@@ -311,18 +310,86 @@ func (c *Client) writePump() {
 // @Tags internal
 // (internal function — not necessarily an HTTP handler)
 
+// initWS согласует версию протокола и поднимает соединение. roomID != 0 — соединение одной комнаты
+// (/ws/rooms/:id), которое параметром lastSeq может возобновить сессию;
+// 0 — мультиплексное соединение /ws.
 func (h *Handler) initWS(c *gin.Context, roomID uint) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	offered := websocket.Subprotocols(c.Request)
+	proto, ok := wsproto.Negotiate(offered)
+	if !ok {
+		respondErr(c, 400, "unsupported subprotocol, supported: "+strings.Join(wsproto.Supported, ", "))
+		return
+	}
+	// Страницы других сайтов не подключаются от имени пользователя
+	if !h.origins.CheckOrigin(c.Request) {
+		respondErr(c, 403, "origin not allowed")
+		return
+	}
+	up := upgrader
+	up.CheckOrigin = h.origins.CheckOrigin
+	// Выбранный подпротокол возвращается, только если клиент его предлагал
+	if len(offered) > 0 {
+		up.Subprotocols = []string{proto}
+	}
+	conn, err := up.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		respondErr(c, 400, "upgrade failed")
 		return
 	}
 	userID := uid(c)
-	h.presence.Online(userID)
-	cl := h.addClient(roomID, userID, conn)
+	cl := &Client{
+		conn:     conn,
+		send:     make(chan *wsFrame, h.ws.SendBuffer),
+		codec:    codecFor(proto),
+		userID:   userID,
+		handler:  h,
+		readOnly: !auth.HasScope(c, auth.ScopeMessagesWrite),
+		room:     roomID,
+		mux:      roomID == 0,
+	}
+	if id, ok := auth.TokenRoom(c); ok {
+		cl.tokenRoom = id
+	}
+	h.presence.Online(cl)
+	h.users.add(cl)
+	if roomID != 0 {
+		lastSeq, _ := strconv.ParseUint(c.Query("lastSeq"), 10, 64)
+		h.rooms.resume(roomID, cl, lastSeq)
+	} else {
+		h.presenceChanged(userID)
+	}
 	go cl.writePump()
 	go cl.readPump()
 }
+
+// disconnect отписывает клиента от комнат, закрывает его очередь и, если это
+// было последнее соединение пользователя на узле, сохраняет lastSeen.
+func (c *Client) disconnect() {
+	c.handler.rooms.leaveAll(c)
+	c.handler.users.remove(c)
+	c.closeSend()
+	if c.handler.presence.Offline(c) {
+		c.handler.persistLastSeen(c.userID)
+	}
+	c.handler.presenceChanged(c.userID)
+}
+
+// roomAccess проверяет, что комната существует, а приватная доступна только
+// участникам. Возвращает HTTP-статус и текст ошибки; пустой текст — доступ есть.
+func (h *Handler) roomAccess(roomID, userID uint) (int, string) {
+	var r models.Room
+	if err := h.db.First(&r, roomID).Error; err != nil {
+		return 404, "room not found"
+	}
+	if r.IsPrivate {
+		var n int64
+		h.db.Model(&models.RoomMember{}).Where("room_id = ? AND user_id = ?", roomID, userID).Count(&n)
+		if n == 0 {
+			return 403, "not a member of private room"
+		}
+	}
+	return 0, ""
+}
 // Auto-generated swagger comments for RoomWebSocket
 // @Summary Auto-generated summary for RoomWebSocket
 // @Description Auto-generated description for RoomWebSocket — review and improve
@@ -335,17 +402,25 @@ func (h *Handler) RoomWebSocket(c *gin.Context) {
 	roomID := uint(rid64)
 
 	// Проверка приватной комнаты
-	var r models.Room
-	if err := h.db.First(&r, roomID).Error; err != nil {
-		respondErr(c, 404, "room not found")
+	if code, msg := h.roomAccess(roomID, uid(c)); msg != "" {
+		respondErr(c, code, msg)
 		return
 	}
-	if r.IsPrivate {
-		var m models.RoomMember
-		if err := h.db.Where("room_id = ? AND user_id = ?", roomID, uid(c)).First(&m).Error; err != nil {
-			respondErr(c, 403, "not a member of private room")
-			return
-		}
-	}
 	h.initWS(c, roomID)
 }
+
+// @Summary Мультиплексное WebSocket-соединение
+// @Description Одно соединение на пользователя вместо соединения на комнату. Клиент управляет подписками кадрами {"type":"subscribe","roomId":1} и {"type":"unsubscribe","roomId":1}; сервер отвечает subscribed, unsubscribed или error. Доступ проверяется при каждой подписке: приватные комнаты — только участникам, токен с ограничением комнатой — только эта комната. События комнат помечены roomId; кадры typing и message тоже указывают roomId и требуют подписки. На кадр message сервер отвечает ack с id и createdAt сохраненного сообщения или nack с машиночитаемым code (not_subscribed, read_only, rate_limited, invalid_payload, internal_error); payload.clientMsgId делает отправку идемпотентной и повторяется в ack, nack и событии message. Без подписок приходят события пользователя: dm (сообщение в приватной комнате, на которую соединение не подписано), mention, unread, membership и status (пользователь изменил свой статус присутствия). Кадр {"type":"activity"} сообщает об активности пользователя, {"type":"activity","payload":{"idle":true}} — что он отошел; соединение без activity, typing и message дольше WS_IDLE_AFTER бездействует, и presence_update показывает для каждого пользователя state (online, idle, away, dnd) и свой статус. Для возобновления сессии subscribe передает lastSeq — номер seq последнего полученного события комнаты: сервер досылает пропущенные события до живых или, если разрыв больше журнала, присылает resync_required, после которого историю нужно перечитать через REST. Версия протокола согласуется заголовком Sec-WebSocket-Protocol: linkup.v1 — JSON в текстовых кадрах, linkup.v1+msgpack и linkup.v1+cbor — те же кадры в MessagePack или CBOR в двоичных кадрах; сервер выбирает первый поддерживаемый в порядке клиента (клиент без заголовка получает linkup.v1, только неизвестные подпротоколы — 400). Каждый кадр проверяется по схеме из /ws/schema; отклоненный кадр получает error с code (malformed_frame, invalid_frame, unknown_type, unsupported_frame, room_not_found, forbidden, not_subscribed, rate_limited) и message, а requestId кадра повторяется в ответах на него. Токен передается заголовком Authorization; браузер, который не может задать заголовок, передает параметром ticket одноразовый билет из POST /ws/ticket. Параметр token с самим токеном попадает в журналы прокси и принимается, только если для старых клиентов включен WS_ALLOW_QUERY_TOKEN. Подключение со страницы, источник которой не входит в CORS_ORIGINS, отклоняется с 403
+// @Tags websocket
+// @Security BearerAuth
+// @Param ticket query string false "Одноразовый билет из POST /ws/ticket"
+// @Param token query string false "JWT или персональный токен (устаревший способ, только с WS_ALLOW_QUERY_TOKEN=true)"
+// @Param Sec-WebSocket-Protocol header string false "Подпротоколы в порядке предпочтения" Enums(linkup.v1, linkup.v1+msgpack, linkup.v1+cbor)
+// @Success 101 {string} string "Switching Protocols"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /ws [get]
+func (h *Handler) UserWebSocket(c *gin.Context) {
+	h.initWS(c, 0)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"LinkUp/internal/wsproto"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Кодировки кадров. Подпротокол linkup.v1 передает кадры текстом в JSON,
+// linkup.v1+msgpack и linkup.v1+cbor — те же кадры двоичными в MessagePack и
+// CBOR. Модель событий одна: поля называются по тегам json, время кодируется
+// штампом времени MessagePack или строкой RFC 3339 с тегом CBOR 0. Входящие
+// двоичные кадры переводятся в JSON и проверяются той же схемой.
+
+// wsCodec — кодировка кадров соединения.
+type wsCodec struct {
+	// id — индекс кодировки в wsFrame
+	id          int
+	subprotocol string
+	// messageType — тип кадров WebSocket: текстовые или двоичные
+	messageType int
+	marshal     func(v any) ([]byte, error)
+	// toJSON переводит кадр клиента в JSON для проверки по схеме; nil — кадр уже JSON
+	toJSON func(data []byte) ([]byte, error)
+}
+
+var (
+	jsonCodec = &wsCodec{
+		id:          0,
+		subprotocol: wsproto.V1,
+		messageType: websocket.TextMessage,
+		marshal:     json.Marshal,
+	}
+	msgpackCodec = &wsCodec{
+		id:          1,
+		subprotocol: wsproto.V1MsgPack,
+		messageType: websocket.BinaryMessage,
+		marshal:     marshalMsgpack,
+		toJSON:      msgpackToJSON,
+	}
+	cborCodec = &wsCodec{
+		id:          2,
+		subprotocol: wsproto.V1CBOR,
+		messageType: websocket.BinaryMessage,
+		marshal:     cborEnc.Marshal,
+		toJSON:      cborToJSON,
+	}
+)
+
+// wsCodecs — кодировки по индексу id.
+var wsCodecs = [...]*wsCodec{jsonCodec, msgpackCodec, cborCodec}
+
+// codecFor возвращает кодировку согласованного подпротокола.
+func codecFor(subprotocol string) *wsCodec {
+	for _, k := range wsCodecs {
+		if k.subprotocol == subprotocol {
+			return k
+		}
+	}
+	return jsonCodec
+}
+
+// frame переводит кадр клиента в JSON. Кадр не того типа, что у кодировки,
+// получает unsupported_frame, нераспознанный — malformed_frame.
+func (k *wsCodec) frame(mt int, data []byte) ([]byte, *wsproto.FrameError) {
+	if mt != k.messageType {
+		if k.messageType == websocket.TextMessage {
+			return nil, &wsproto.FrameError{Code: wsUnsupportedFrame, Message: "binary frames are not supported by " + k.subprotocol}
+		}
+		return nil, &wsproto.FrameError{Code: wsUnsupportedFrame, Message: "text frames are not supported by " + k.subprotocol}
+	}
+	if k.toJSON == nil {
+		return data, nil
+	}
+	out, err := k.toJSON(data)
+	if err != nil {
+		return nil, &wsproto.FrameError{Code: wsproto.CodeMalformed, Message: "frame is not valid " + k.subprotocol}
+	}
+	return out, nil
+}
+
+func marshalMsgpack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func msgpackToJSON(data []byte) ([]byte, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	v, err := dec.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+var cborEnc, cborDec = cborModes()
+
+func cborModes() (cbor.EncMode, cbor.DecMode) {
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano, TimeTag: cbor.EncTagRequired}.EncMode()
+	if err != nil {
+		panic("cbor: " + err.Error())
+	}
+	// Ключи объектов — строки, как в JSON
+	dec, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+	if err != nil {
+		panic("cbor: " + err.Error())
+	}
+	return enc, dec
+}
+
+func cborToJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := cborDec.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// ------------------- Общие кадры -------------------
+
+// wsFrame — событие в очередях отправки. Один кадр разделяют все получатели
+// рассылки, и каждая кодировка считается не больше одного раза — первым
+// writePump, которому она понадобилась.
+type wsFrame struct {
+	ev   Event
+	once [len(wsCodecs)]sync.Once
+	data [len(wsCodecs)][]byte
+	err  [len(wsCodecs)]error
+}
+
+func newFrame(ev Event) *wsFrame { return &wsFrame{ev: ev} }
+
+// encoded возвращает событие в кодировке k.
+func (f *wsFrame) encoded(k *wsCodec) ([]byte, error) {
+	f.once[k.id].Do(func() {
+		f.data[k.id], f.err[k.id] = k.marshal(f.ev)
+	})
+	return f.data[k.id], f.err[k.id]
+}
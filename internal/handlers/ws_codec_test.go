@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"LinkUp/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func benchEvent() Event {
+	text := "Привет! Встречаемся в 18:00 у входа"
+	id := "7f3c2a9e-5b1d-4c8e-9a0f-2d6b8e1c4f7a"
+	return Event{Type: "message", RoomID: 12, Seq: 40812, Payload: messagePayload(&models.Message{
+		ID:          987654,
+		RoomID:      12,
+		UserID:      345,
+		Type:        "text",
+		Text:        text,
+		ClientMsgID: &id,
+		CreatedAt:   time.Date(2024, 1, 15, 10, 30, 0, 123456789, time.UTC),
+	})}
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	ev := benchEvent()
+	for _, k := range wsCodecs {
+		data, err := newFrame(ev).encoded(k)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", k.subprotocol, err)
+		}
+		js, ferr := k.frame(k.messageType, data)
+		if ferr != nil {
+			t.Fatalf("%s: decode: %v", k.subprotocol, ferr)
+		}
+		var got struct {
+			Type    string `json:"type"`
+			RoomID  uint   `json:"roomId"`
+			Seq     uint64 `json:"seq"`
+			Payload struct {
+				ID          uint      `json:"id"`
+				Text        string    `json:"text"`
+				ClientMsgID string    `json:"clientMsgId"`
+				CreatedAt   time.Time `json:"createdAt"`
+			} `json:"payload"`
+		}
+		if err := json.Unmarshal(js, &got); err != nil {
+			t.Fatalf("%s: %v", k.subprotocol, err)
+		}
+		p := ev.Payload.(gin.H)
+		if got.Type != ev.Type || got.RoomID != ev.RoomID || got.Seq != ev.Seq ||
+			got.Payload.ID != p["id"] || got.Payload.Text != p["text"] || got.Payload.ClientMsgID != p["clientMsgId"] ||
+			!got.Payload.CreatedAt.Equal(p["createdAt"].(time.Time)) {
+			t.Fatalf("%s: round trip changed the event: %+v", k.subprotocol, got)
+		}
+
+		other := websocket.BinaryMessage
+		if k.messageType == other {
+			other = websocket.TextMessage
+		}
+		if _, ferr := k.frame(other, data); ferr == nil || ferr.Code != wsUnsupportedFrame {
+			t.Fatalf("%s: frame of the other type accepted: %v", k.subprotocol, ferr)
+		}
+	}
+}
+
+func TestFrameEncodedOncePerCodec(t *testing.T) {
+	calls := 0
+	k := &wsCodec{id: 1, marshal: func(v any) ([]byte, error) {
+		calls++
+		return json.Marshal(v)
+	}}
+	f := newFrame(benchEvent())
+	for i := 0; i < 10; i++ {
+		if _, err := f.encoded(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("event encoded %d times, want 1", calls)
+	}
+}
+
+// ------------------- Benchmarks -------------------
+//
+//	go test -bench Codec -benchmem -run '^$' ./internal/handlers
+
+// BenchmarkCodecEncode — кодирование одного события.
+func BenchmarkCodecEncode(b *testing.B) {
+	ev := benchEvent()
+	for _, k := range wsCodecs {
+		b.Run(k.subprotocol, func(b *testing.B) {
+			data, _ := k.marshal(ev)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := k.marshal(ev); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCodecBroadcast — рассылка события клиентам комнаты: прежний путь
+// (WriteJSON кодирует событие для каждого клиента) против общего кадра.
+func BenchmarkCodecBroadcast(b *testing.B) {
+	ev := benchEvent()
+	for _, clients := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("per-client-json/%d", clients), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < clients; j++ {
+					if _, err := json.Marshal(ev); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		for _, k := range wsCodecs {
+			b.Run(fmt.Sprintf("shared-%s/%d", k.subprotocol, clients), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					f := newFrame(ev)
+					for j := 0; j < clients; j++ {
+						if _, err := f.encoded(k); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			})
+		}
+	}
+}
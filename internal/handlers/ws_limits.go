@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Коды закрытия, с которыми сервер отключает клиента
+const (
+	// closeSlowConsumer — очередь отправки клиента переполнена (1013 Try Again Later)
+	closeSlowConsumer = websocket.CloseTryAgainLater
+	// closeRateLimited — клиент превысил лимит входящих кадров (1008 Policy Violation)
+	closeRateLimited = websocket.ClosePolicyViolation
+)
+
+// wsLimits — параметры здоровья WebSocket-соединений.
+type wsLimits struct {
+	// PingInterval — период ping; PongTimeout — сколько ждать любого кадра от
+	// клиента, прежде чем считать соединение мертвым
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// WriteTimeout — предельное время записи одного кадра
+	WriteTimeout time.Duration
+	// MaxMessageSize — максимальный размер входящего кадра в байтах
+	MaxMessageSize int64
+	// SendBuffer — длина очереди отправки; при переполнении клиент отключается
+	SendBuffer int
+	// RateLimit — входящих кадров в секунду, RateBurst — допустимый всплеск.
+	// Лишние кадры отклоняются; при RateBurst отклонениях подряд соединение закрывается
+	RateLimit float64
+	RateBurst int
+	// PollTimeout — сколько long-poll запрос ждет событий комнаты
+	PollTimeout time.Duration
+}
+
+// wsLimitsFromEnv читает параметры из окружения:
+// WS_PING_INTERVAL (30s), WS_PONG_TIMEOUT (60s), WS_WRITE_TIMEOUT (10s),
+// WS_MAX_MESSAGE_SIZE (65536), WS_SEND_BUFFER (32), WS_RATE_LIMIT (20), WS_RATE_BURST (40),
+// LONGPOLL_TIMEOUT (25s).
+func wsLimitsFromEnv() wsLimits {
+	l := wsLimits{
+		PingInterval:   envDuration("WS_PING_INTERVAL", 30*time.Second),
+		PongTimeout:    envDuration("WS_PONG_TIMEOUT", 60*time.Second),
+		WriteTimeout:   envDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+		MaxMessageSize: int64(envInt("WS_MAX_MESSAGE_SIZE", 64<<10)),
+		SendBuffer:     envInt("WS_SEND_BUFFER", 32),
+		RateBurst:      envInt("WS_RATE_BURST", 40),
+		RateLimit:      20,
+		PollTimeout:    envDuration("LONGPOLL_TIMEOUT", 25*time.Second),
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("WS_RATE_LIMIT"), 64); err == nil && v > 0 {
+		l.RateLimit = v
+	}
+	// Ping должен успеть дойти до истечения ожидания pong
+	if l.PingInterval >= l.PongTimeout {
+		l.PingInterval = l.PongTimeout * 9 / 10
+	}
+	return l
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// ------------------- Счетчики -------------------
+
+// wsCounters — счетчики событий здоровья соединений с момента запуска.
+type wsCounters struct {
+	pingTimeouts  atomic.Int64
+	oversized     atomic.Int64
+	writeTimeouts atomic.Int64
+	rateLimited   atomic.Int64
+	rateEvictions atomic.Int64
+	slowEvictions atomic.Int64
+}
+
+var wsStats wsCounters
+
+// snapshot возвращает текущие значения счетчиков.
+func (s *wsCounters) snapshot() WSCounters {
+	return WSCounters{
+		PingTimeouts:          s.pingTimeouts.Load(),
+		OversizedFrames:       s.oversized.Load(),
+		WriteTimeouts:         s.writeTimeouts.Load(),
+		RateLimitedFrames:     s.rateLimited.Load(),
+		RateLimitEvictions:    s.rateEvictions.Load(),
+		SlowConsumerEvictions: s.slowEvictions.Load(),
+	}
+}
+
+// countReadError учитывает причину обрыва чтения: истекшее ожидание pong
+// или слишком большой кадр.
+func (s *wsCounters) countReadError(err error) {
+	var ne net.Error
+	switch {
+	case errors.Is(err, websocket.ErrReadLimit):
+		s.oversized.Add(1)
+	case errors.As(err, &ne) && ne.Timeout():
+		s.pingTimeouts.Add(1)
+	}
+}
+
+func (s *wsCounters) countWriteError(err error) {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		s.writeTimeouts.Add(1)
+	}
+}
+
+// ------------------- Лимит входящих кадров -------------------
+
+// tokenBucket — ограничитель частоты входящих кадров одного соединения.
+// Используется только из readPump, поэтому без блокировок.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow списывает токен; false — лимит исчерпан.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
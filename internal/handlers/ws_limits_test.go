@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(2, 3)
+	b.last = start
+	// всплеск до burst, дальше отказ
+	for i := 0; i < 3; i++ {
+		if !b.allow(start) {
+			t.Fatalf("frame %d of the burst rejected", i+1)
+		}
+	}
+	if b.allow(start) {
+		t.Fatal("frame over the burst allowed")
+	}
+	// за полсекунды при 2 кадрах в секунду копится ровно один токен
+	if !b.allow(start.Add(500 * time.Millisecond)) {
+		t.Fatal("refilled token rejected")
+	}
+	if b.allow(start.Add(500 * time.Millisecond)) {
+		t.Fatal("second frame allowed after one refill")
+	}
+	// долгая пауза не накапливает больше burst
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !b.allow(later) {
+			t.Fatalf("frame %d after a pause rejected", i+1)
+		}
+	}
+	if b.allow(later) {
+		t.Fatal("bucket refilled over the burst")
+	}
+}
+
+func TestWSLimitsFromEnv(t *testing.T) {
+	for _, k := range []string{"WS_PING_INTERVAL", "WS_PONG_TIMEOUT", "WS_WRITE_TIMEOUT", "WS_MAX_MESSAGE_SIZE", "WS_SEND_BUFFER", "WS_RATE_LIMIT", "WS_RATE_BURST", "LONGPOLL_TIMEOUT"} {
+		t.Setenv(k, "")
+	}
+	l := wsLimitsFromEnv()
+	if l.PingInterval != 30*time.Second || l.PongTimeout != 60*time.Second || l.SendBuffer != 32 || l.RateLimit != 20 || l.RateBurst != 40 {
+		t.Fatalf("defaults: %+v", l)
+	}
+
+	t.Setenv("WS_RATE_LIMIT", "2.5")
+	t.Setenv("WS_SEND_BUFFER", "-1")
+	t.Setenv("WS_MAX_MESSAGE_SIZE", "junk")
+	// ping реже, чем истекает ожидание pong, оборвал бы живое соединение
+	t.Setenv("WS_PING_INTERVAL", "20s")
+	t.Setenv("WS_PONG_TIMEOUT", "10s")
+	l = wsLimitsFromEnv()
+	if l.RateLimit != 2.5 || l.SendBuffer != 32 || l.MaxMessageSize != 64<<10 {
+		t.Fatalf("parsed: %+v", l)
+	}
+	if l.PingInterval != 9*time.Second {
+		t.Fatalf("ping interval = %v", l.PingInterval)
+	}
+}
+
+// Клиент, не успевающий забирать события, отключается с кодом 1013 и
+// причиной в кадре закрытия.
+func TestSlowConsumerEviction(t *testing.T) {
+	h := &Handler{ws: wsLimits{PingInterval: time.Minute, WriteTimeout: time.Second}}
+	evicted := wsStats.slowEvictions.Load()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := testClient(1, 2)
+		c.conn, c.handler = conn, h
+		for i := 0; i < 3; i++ {
+			if ok := c.trySend(Event{Type: "message"}); ok != (i < 2) {
+				t.Errorf("event %d: delivered = %v", i+1, ok)
+			}
+		}
+		c.writePump()
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frames := 0
+	for {
+		_, _, err := conn.ReadMessage()
+		var ce *websocket.CloseError
+		if errors.As(err, &ce) {
+			if ce.Code != websocket.CloseTryAgainLater || ce.Text != "send queue overflow" {
+				t.Fatalf("close frame: %d %q", ce.Code, ce.Text)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames++
+	}
+	// события, уже стоявшие в очереди, уходят до кадра закрытия
+	if frames != 2 {
+		t.Fatalf("%d frames before close", frames)
+	}
+	if n := wsStats.slowEvictions.Load() - evicted; n == 0 {
+		t.Fatal("slow consumer eviction not counted")
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"LinkUp/internal/wsproto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Коды событий error, кроме кодов разбора кадра из wsproto
+const (
+	wsUnsupportedFrame = "unsupported_frame"
+	wsRoomNotFound     = sendRoomNotFound
+	wsForbidden        = sendForbidden
+	wsNotSubscribed    = sendNotSubscribed
+	wsRateLimited      = sendRateLimited
+)
+
+// wsIncoming — кадр от клиента (схема — wsproto, $defs/clientFrame). В
+// мультиплексном соединении /ws roomId указывает комнату для subscribe,
+// unsubscribe, typing и message; lastSeq в subscribe возобновляет сессию
+// комнаты; requestId повторяется в ответах на кадр.
+type wsIncoming struct {
+	Type      string          `json:"type"`
+	RoomID    uint            `json:"roomId"`
+	LastSeq   uint64          `json:"lastSeq"`
+	RequestID string          `json:"requestId"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// wsMessagePayload — payload кадра message.
+type wsMessagePayload struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	ImageURL    string `json:"imageUrl"`
+	ClientMsgID string `json:"clientMsgId"`
+}
+
+// clientMsgID достает clientMsgId из payload непроверенного кадра.
+func (in wsIncoming) clientMsgID() string {
+	var p struct {
+		ClientMsgID string `json:"clientMsgId"`
+	}
+	json.Unmarshal(in.Payload, &p)
+	return p.ClientMsgID
+}
+
+// decode переводит кадр в JSON и проверяет по схеме протокола. Отклоненный
+// кадр message получает nack, чтобы клиент снял неотправленное сообщение,
+// остальные — error.
+func (c *Client) decode(mt int, data []byte) (wsIncoming, bool) {
+	var in wsIncoming
+	data, ferr := c.codec.frame(mt, data)
+	if ferr != nil {
+		c.fail(in, ferr.Code, ferr.Message)
+		return in, false
+	}
+	typ, ferr := wsproto.Validate(data)
+	// Поля отклоненного кадра нужны для ответа, ошибка типов здесь не важна
+	json.Unmarshal(data, &in)
+	if ferr == nil {
+		return in, true
+	}
+	if typ == "message" && ferr.Code == wsproto.CodeInvalid {
+		c.nack(in, in.clientMsgID(), &sendError{400, sendInvalid, ferr.Message})
+	} else {
+		c.fail(in, ferr.Code, ferr.Message)
+	}
+	return in, false
+}
+
+// fail отвечает на кадр событием error.
+func (c *Client) fail(in wsIncoming, code, msg string) {
+	c.trySend(Event{Type: "error", RoomID: in.RoomID, RequestID: in.RequestID, Payload: gin.H{"code": code, "message": msg}})
+}
+
+// nack сообщает отправителю, что сообщение не сохранено.
+func (c *Client) nack(in wsIncoming, clientMsgID string, e *sendError) {
+	c.trySend(Event{Type: "nack", RoomID: in.RoomID, RequestID: in.RequestID, Payload: gin.H{"code": e.code, "message": e.msg, "clientMsgId": clientMsgID}})
+}
+
+// @Summary JSON Schema протокола WebSocket
+// @Description Возвращает JSON Schema (draft 2020-12) кадров протокола linkup.v1: $defs/clientFrame — кадры клиента, $defs/serverEvent и *Payload — события сервера. По этой схеме сервер проверяет каждый входящий кадр
+// @Tags websocket
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /ws/schema [get]
+func (h *Handler) WSSchema(c *gin.Context) {
+	c.Data(http.StatusOK, "application/schema+json", wsproto.Schema())
+}
+
+// @Summary AsyncAPI протокола WebSocket
+// @Description Возвращает описание каналов /ws и /ws/rooms/{roomId} в формате AsyncAPI 2.6, построенное из JSON Schema протокола linkup.v1, для генераторов клиентов
+// @Tags websocket
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /ws/asyncapi [get]
+func (h *Handler) WSAsyncAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, wsproto.AsyncAPI())
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"LinkUp/internal/auth"
+	apiErrors "LinkUp/internal/err"
+	"LinkUp/internal/models"
+	"LinkUp/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidWSTicket = errors.New("invalid or expired websocket ticket")
+
+// RedeemWSTicket гасит билет WebSocket. Запись удаляется, поэтому билет
+// действует один раз, даже если его предъявят сразу нескольким репликам.
+func (h *Handler) RedeemWSTicket(ticket string) (*auth.TicketInfo, error) {
+	var t models.WSTicket
+	if err := h.db.Where("ticket_hash = ?", utils.HashToken(ticket)).First(&t).Error; err != nil {
+		return nil, errInvalidWSTicket
+	}
+	res := h.db.Delete(&t)
+	if res.Error != nil || res.RowsAffected != 1 || time.Now().After(t.ExpiresAt) {
+		return nil, errInvalidWSTicket
+	}
+	return &auth.TicketInfo{
+		UserID:    t.UserID,
+		SessionID: t.SessionID,
+		TokenID:   t.TokenID,
+		Scopes:    t.Scopes,
+		RoomID:    t.RoomID,
+	}, nil
+}
+
+// @Summary Билет для подключения к WebSocket
+// @Description Выдает одноразовый билет, с которым браузер подключается к /ws или /ws/rooms/{id} параметром ticket вместо токена: долгоживущий токен не попадает в URL и журналы прокси. Билет действует WS_TICKET_TTL (по умолчанию 30 секунд), гасится при подключении и дает те же права, что токен запроса. roomId привязывает билет к комнате: с ним можно подключиться только к /ws/rooms/{roomId} или подписаться на мультиплексном соединении только на эту комнату. Билет по персональному токену, ограниченному комнатой, всегда привязан к ней
+// @Tags websocket
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param ticket body WSTicketRequest false "Комната, к которой привязать билет"
+// @Success 201 {object} WSTicketResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /ws/ticket [post]
+func (h *Handler) IssueWSTicket(c *gin.Context) {
+	var req WSTicketRequest
+	if bindErr := c.ShouldBindJSON(&req); bindErr != nil && !errors.Is(bindErr, io.EOF) {
+		apiErr := apiErrors.NewAPIError("IssueWSTicket.BindJSON", bindErr, "invalid body", 400)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Invalid request body.")
+		return
+	}
+	if req.RoomID != nil && !roomAllowed(c, *req.RoomID) {
+		apiErr := apiErrors.NewAPIError("IssueWSTicket.Room", nil, "token restricted to another room", 403)
+		apiErrors.LogAndRespondAPI(c, apiErr, "This token is restricted to another room.")
+		return
+	}
+	info := auth.TicketFor(c, req.RoomID)
+	if info.RoomID != nil {
+		if code, msg := h.roomAccess(*info.RoomID, info.UserID); msg != "" {
+			userMsg := "Room not found."
+			if code == http.StatusForbidden {
+				userMsg = "You are not a member of this room."
+			}
+			apiErr := apiErrors.NewAPIError("IssueWSTicket.Room", nil, msg, code)
+			apiErrors.LogAndRespondAPI(c, apiErr, userMsg)
+			return
+		}
+	}
+
+	secret, genErr := auth.GenerateOpaqueToken()
+	if genErr != nil {
+		apiErr := apiErrors.NewAPIError("IssueWSTicket.Generate", genErr, "failed to generate ticket", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	now := time.Now()
+	// Непогашенные билеты больше не нужны после истечения
+	h.db.Where("expires_at < ?", now).Delete(&models.WSTicket{})
+	t := models.WSTicket{
+		TicketHash: utils.HashToken(secret),
+		UserID:     info.UserID,
+		SessionID:  info.SessionID,
+		TokenID:    info.TokenID,
+		Scopes:     info.Scopes,
+		RoomID:     info.RoomID,
+		ExpiresAt:  now.Add(auth.WSTicketTTL()),
+	}
+	if createErr := h.db.Create(&t).Error; createErr != nil {
+		apiErr := apiErrors.NewAPIError("IssueWSTicket.Create", createErr, "failed to save ticket", 500)
+		apiErrors.LogAndRespondAPI(c, apiErr, "Internal server error.")
+		return
+	}
+	c.JSON(http.StatusCreated, WSTicketResponse{Ticket: secret, ExpiresAt: t.ExpiresAt})
+}
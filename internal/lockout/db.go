@@ -0,0 +1,88 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"LinkUp/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore хранит счетчики в таблице login_throttles, общей для всех реплик.
+// Увеличение счетчика выполняется одним upsert, поэтому параллельные
+// неудачи на разных репликах не теряются.
+type DBStore struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewDBStore создает хранилище поверх db.
+func NewDBStore(db *gorm.DB) *DBStore { return &DBStore{db: db} }
+
+// Incr реализует Store.
+func (s *DBStore) Incr(ctx context.Context, key string, window time.Duration) (int, error) {
+	now := time.Now()
+	row := models.LoginThrottle{Bucket: key, Failures: 1, LastFailureAt: now}
+	var out models.LoginThrottle
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "bucket"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures":        gorm.Expr("CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END", now.Add(-window)),
+				"last_failure_at": now,
+				"updated_at":      now,
+			}),
+		}).Create(&row).Error; err != nil {
+			return err
+		}
+		return tx.Where("bucket = ?", key).First(&out).Error
+	})
+	s.purge(ctx, now)
+	return out.Failures, err
+}
+
+// purge раз в час удаляет давно неактивные счетчики.
+func (s *DBStore) purge(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastPurge) < time.Hour {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPurge = now
+	s.mu.Unlock()
+	cutoff := now.Add(-24 * time.Hour)
+	s.db.WithContext(ctx).
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", cutoff, now).
+		Delete(&models.LoginThrottle{})
+}
+
+// Lock реализует Store.
+func (s *DBStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.LoginThrottle{}).
+		Where("bucket = ? AND (locked_until IS NULL OR locked_until < ?)", key, until).
+		Update("locked_until", until).Error
+}
+
+// LockedUntil реализует Store.
+func (s *DBStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	var t models.LoginThrottle
+	err := s.db.WithContext(ctx).Where("bucket = ?", key).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && t.LockedUntil == nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return *t.LockedUntil, nil
+}
+
+// Reset реализует Store.
+func (s *DBStore) Reset(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Where("bucket = ?", key).Delete(&models.LoginThrottle{}).Error
+}
@@ -0,0 +1,171 @@
+package lockout
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store хранит счетчики неудачных попыток по ключу ("login:bob", "ip:203.0.113.7").
+// Реализации должны быть безопасны для конкурентного использования; DB-реализация
+// нужна, чтобы счетчики были общими для нескольких реплик.
+type Store interface {
+	// Incr увеличивает счетчик ключа и возвращает новое значение. Если с
+	// прошлой неудачи прошло больше window, счет начинается заново.
+	Incr(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock блокирует ключ до until (более ранняя блокировка не сокращает текущую).
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil возвращает конец блокировки или нулевое время.
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	// Reset удаляет счетчик и блокировку ключа.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy задает порог и экспоненциальную задержку для одного вида ключей.
+type Policy struct {
+	// FreeAttempts — сколько неудач подряд допускается без блокировки
+	FreeAttempts int
+	// BaseDelay — блокировка после первой неудачи сверх порога; далее удваивается
+	BaseDelay time.Duration
+	// MaxDelay ограничивает блокировку сверху
+	MaxDelay time.Duration
+	// Window — через сколько после последней неудачи счетчик обнуляется
+	Window time.Duration
+}
+
+// Delay возвращает длительность блокировки после failures неудач подряд.
+func (p Policy) Delay(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 1; i < over && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// Guard применяет политики к логину и IP клиента.
+type Guard struct {
+	store Store
+	login Policy
+	ip    Policy
+}
+
+// New создает Guard поверх хранилища.
+func New(store Store, login, ip Policy) *Guard {
+	return &Guard{store: store, login: login, ip: ip}
+}
+
+// FromEnv собирает Guard из окружения:
+//
+//	LOCKOUT_STORE            memory (по умолчанию) или db — общий счетчик для нескольких реплик
+//	LOCKOUT_MAX_ATTEMPTS     неудач подряд на логин до блокировки (5)
+//	LOCKOUT_IP_MAX_ATTEMPTS  неудач подряд с одного IP до блокировки (20)
+//	LOCKOUT_BASE_DELAY       первая блокировка (30s), далее удваивается
+//	LOCKOUT_MAX_DELAY        максимальная блокировка (15m)
+//	LOCKOUT_WINDOW           через сколько без неудач счетчик обнуляется (15m)
+func FromEnv(db *gorm.DB) *Guard {
+	var store Store = NewMemoryStore()
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("LOCKOUT_STORE")), "db") {
+		store = NewDBStore(db)
+	}
+	base := Policy{
+		BaseDelay: envDuration("LOCKOUT_BASE_DELAY", 30*time.Second),
+		MaxDelay:  envDuration("LOCKOUT_MAX_DELAY", 15*time.Minute),
+		Window:    envDuration("LOCKOUT_WINDOW", 15*time.Minute),
+	}
+	login, ip := base, base
+	login.FreeAttempts = envInt("LOCKOUT_MAX_ATTEMPTS", 5)
+	ip.FreeAttempts = envInt("LOCKOUT_IP_MAX_ATTEMPTS", 20)
+	return New(store, login, ip)
+}
+
+// LoginKey и IPKey строят ключи счетчиков.
+func LoginKey(login string) string { return "login:" + strings.ToLower(strings.TrimSpace(login)) }
+func IPKey(ip string) string       { return "ip:" + ip }
+
+// Check возвращает, сколько еще длится блокировка логина или IP (0 — вход разрешен).
+// Ошибки хранилища не блокируют вход, а только пишутся в лог.
+func (g *Guard) Check(ctx context.Context, login, ip string) time.Duration {
+	var wait time.Duration
+	now := time.Now()
+	for _, key := range []string{LoginKey(login), IPKey(ip)} {
+		until, err := g.store.LockedUntil(ctx, key)
+		if err != nil {
+			log.Printf("lockout: check %s: %v", key, err)
+			continue
+		}
+		if d := until.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// Fail учитывает неудачную попытку и при превышении порога блокирует ключ.
+// Возвращает длительность наступившей блокировки (0 — блокировки нет).
+func (g *Guard) Fail(ctx context.Context, login, ip string) time.Duration {
+	var wait time.Duration
+	for _, k := range []struct {
+		key    string
+		policy Policy
+	}{{LoginKey(login), g.login}, {IPKey(ip), g.ip}} {
+		n, err := g.store.Incr(ctx, k.key, k.policy.Window)
+		if err != nil {
+			log.Printf("lockout: incr %s: %v", k.key, err)
+			continue
+		}
+		d := k.policy.Delay(n)
+		if d <= 0 {
+			continue
+		}
+		if err := g.store.Lock(ctx, k.key, time.Now().Add(d)); err != nil {
+			log.Printf("lockout: lock %s: %v", k.key, err)
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// Succeed сбрасывает счетчик логина. Счетчик IP не сбрасывается: иначе
+// перебор можно было бы перемежать входами в собственный аккаунт.
+func (g *Guard) Succeed(ctx context.Context, login string) {
+	if err := g.store.Reset(ctx, LoginKey(login)); err != nil {
+		log.Printf("lockout: reset %s: %v", login, err)
+	}
+}
+
+// Unlock снимает блокировку с логина (для администратора).
+func (g *Guard) Unlock(ctx context.Context, login string) error {
+	return g.store.Reset(ctx, LoginKey(login))
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
+}
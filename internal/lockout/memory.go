@@ -0,0 +1,92 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+	window      time.Duration
+}
+
+// MemoryStore держит счетчики в памяти процесса. Подходит для одной реплики.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memEntry
+	lastSweep time.Time
+}
+
+// NewMemoryStore создает пустое хранилище.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memEntry{}, lastSweep: time.Now()}
+}
+
+// Incr реализует Store.
+func (s *MemoryStore) Incr(_ context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweepLocked(now)
+	e, ok := s.entries[key]
+	if !ok {
+		e = &memEntry{}
+		s.entries[key] = e
+	}
+	if now.Sub(e.lastFailure) > window {
+		e.failures = 0
+	}
+	e.failures++
+	e.lastFailure = now
+	e.window = window
+	return e.failures, nil
+}
+
+// Lock реализует Store.
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		e = &memEntry{lastFailure: time.Now()}
+		s.entries[key] = e
+	}
+	if until.After(e.lockedUntil) {
+		e.lockedUntil = until
+	}
+	return nil
+}
+
+// LockedUntil реализует Store.
+func (s *MemoryStore) LockedUntil(_ context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		return e.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+// Reset реализует Store.
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweepLocked раз в минуту удаляет записи, у которых истекли и окно, и блокировка.
+func (s *MemoryStore) sweepLocked(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if now.Sub(e.lastFailure) > e.window && now.After(e.lockedUntil) {
+			delete(s.entries, k)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message — одно текстовое письмо.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer отправляет письма. Реализации должны быть безопасны для
+// конкурентного использования.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromEnv выбирает реализацию по MAIL_DRIVER:
+//
+//	smtp  SMTP_HOST, SMTP_PORT (587), SMTP_USERNAME, SMTP_PASSWORD
+//	file  пишет .eml в MAIL_DIR (по умолчанию ./mail)
+//	log   пишет письма в лог (по умолчанию)
+//
+// Адрес отправителя берется из MAIL_FROM.
+func FromEnv() Mailer {
+	from := strings.TrimSpace(os.Getenv("MAIL_FROM"))
+	if from == "" {
+		from = "LinkUp <no-reply@linkup.local>"
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_DRIVER"))) {
+	case "smtp":
+		port := strings.TrimSpace(os.Getenv("SMTP_PORT"))
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Addr:     net.JoinHostPort(strings.TrimSpace(os.Getenv("SMTP_HOST")), port),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "file":
+		dir := strings.TrimSpace(os.Getenv("MAIL_DIR"))
+		if dir == "" {
+			dir = "./mail"
+		}
+		return &FileMailer{Dir: dir, From: from}
+	default:
+		return &LogMailer{From: from}
+	}
+}
+
+// SMTPMailer отправляет письма через SMTP-сервер. STARTTLS используется,
+// если сервер его поддерживает; без TLS пароль не передается.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send отправляет письмо.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var a smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		a = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, a, envelope(m.From), []string{msg.To}, render(m.From, msg))
+}
+
+// FileMailer сохраняет каждое письмо в отдельный .eml файл — удобно для
+// локальной разработки и тестов без сети.
+type FileMailer struct {
+	Dir  string
+	From string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// Send сохраняет письмо в Dir.
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%d_%03d.eml", time.Now().UnixNano(), m.seq)
+	m.mu.Unlock()
+	return os.WriteFile(filepath.Join(m.Dir, name), render(m.From, msg), 0o600)
+}
+
+// LogMailer пишет письма в стандартный лог.
+type LogMailer struct {
+	From string
+}
+
+// Send выводит письмо в лог.
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("mail: to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// render собирает письмо в формате RFC 5322.
+func render(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + header(from) + "\r\n")
+	b.WriteString("To: " + header(msg.To) + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", header(msg.Subject)) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// header не дает подставить дополнительные заголовки через значение.
+func header(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+// envelope извлекает адрес из "Name <addr>".
+func envelope(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		return strings.TrimSuffix(from[i+1:], ">")
+	}
+	return from
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session представляет серверную сессию пользователя на одном устройстве.
+// Все refresh-токены, выпущенные в рамках сессии, образуют одно семейство
+type Session struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID     uint       `gorm:"index" json:"userId"`
+	Device     string     `gorm:"size:120" json:"device"`
+	IP         string     `gorm:"size:64" json:"ip"`
+	UserAgent  string     `gorm:"size:255" json:"userAgent"`
+	LastUsedAt time.Time  `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expiresAt"`
+	RevokedAt  *time.Time `gorm:"index" json:"revokedAt"`
+}
+
+// RefreshToken представляет один refresh-токен сессии. После обмена токен
+// помечается использованным; повторное предъявление отзывает всю сессию
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	SessionID uint       `gorm:"index" json:"sessionId"`
+	TokenHash string     `gorm:"uniqueIndex;size:64" json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
+
+// ExternalIdentity связывает локального пользователя с учетной записью у
+// внешнего OIDC-провайдера (issuer + sub)
+type ExternalIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID      uint       `gorm:"index" json:"userId"`
+	Provider    string     `gorm:"size:64" json:"provider"`
+	Issuer      string     `gorm:"size:255;uniqueIndex:uniq_issuer_subject" json:"issuer"`
+	Subject     string     `gorm:"size:255;uniqueIndex:uniq_issuer_subject" json:"subject"`
+	Email       string     `gorm:"size:255" json:"email"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+// OIDCLoginState хранит state, nonce и PKCE verifier между редиректом на
+// провайдера и callback. Запись одноразовая
+type OIDCLoginState struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	StateHash    string    `gorm:"uniqueIndex;size:64" json:"-"`
+	Provider     string    `gorm:"size:64" json:"provider"`
+	Nonce        string    `gorm:"size:128" json:"-"`
+	CodeVerifier string    `gorm:"size:128" json:"-"`
+	LinkUserID   *uint     `json:"linkUserId"` // не nil — привязка к существующему аккаунту
+	ExpiresAt    time.Time `gorm:"index" json:"expiresAt"`
+}
+
+// EmailToken — одноразовый токен из письма: подтверждение адреса или сброс
+// пароля. Хранится только хэш
+type EmailToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID    uint       `gorm:"index" json:"userId"`
+	Purpose   string     `gorm:"size:16;index" json:"purpose"` // "verify" | "reset"
+	Email     string     `gorm:"size:255" json:"email"`        // адрес, на который отправлено письмо
+	TokenHash string     `gorm:"uniqueIndex;size:64" json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
+
+// LoginThrottle — счетчик неудачных попыток входа для одного ключа
+// (логин или IP). Используется, когда блокировки должны действовать на всех репликах
+type LoginThrottle struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Bucket        string     `gorm:"uniqueIndex;size:160" json:"bucket"` // "login:<login>" | "ip:<addr>"
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `gorm:"index" json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil"`
+}
+
+// LoginAttempt фиксирует неудачную попытку входа для разбора инцидентов
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Login     string `gorm:"size:64;index" json:"login"`
+	UserID    *uint  `gorm:"index" json:"userId"` // nil — такого пользователя нет
+	IP        string `gorm:"size:64;index" json:"ip"`
+	UserAgent string `gorm:"size:255" json:"userAgent"`
+	Reason    string `gorm:"size:32" json:"reason"` // "bad_password" | "unknown_user" | "bad_2fa" | "locked"
+}
+
+// PersonalAccessToken — долгоживущий токен для ботов и скриптов. Значение
+// показывается один раз, хранится только хэш
+type PersonalAccessToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID     uint       `gorm:"index" json:"userId"`
+	Name       string     `gorm:"size:100" json:"name"`
+	Prefix     string     `gorm:"size:16" json:"prefix"` // первые символы токена, чтобы узнать его в списке
+	TokenHash  string     `gorm:"uniqueIndex;size:64" json:"-"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"`
+	RoomID     *uint      `json:"roomId"` // не nil — токен действует только в этой комнате
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `gorm:"index" json:"revokedAt"`
+}
+
+// Invite — приглашение на регистрацию. Код показывается один раз, хранится
+// только хэш; при регистрации по коду выдаются указанные комнаты и роли
+type Invite struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	CreatedBy uint       `gorm:"index" json:"createdBy"`
+	Prefix    string     `gorm:"size:16" json:"prefix"` // первые символы кода, чтобы узнать приглашение в списке
+	CodeHash  string     `gorm:"uniqueIndex;size:64" json:"-"`
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	RoomIDs   []uint     `gorm:"serializer:json" json:"roomIds"`
+	RoleIDs   []uint     `gorm:"serializer:json" json:"roleIds"` // глобальные роли
+	ExpiresAt time.Time  `gorm:"index" json:"expiresAt"`
+	RevokedAt *time.Time `gorm:"index" json:"revokedAt"`
+}
+
+// WebAuthnCredential — зарегистрированный ключ WebAuthn (passkey или
+// аппаратный ключ). Используется для входа без пароля и как второй фактор
+type WebAuthnCredential struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	UserID         uint       `gorm:"index" json:"userId"`
+	Name           string     `gorm:"size:100" json:"name"`
+	CredentialID   string     `gorm:"uniqueIndex;size:1400" json:"credentialId"` // base64url
+	PublicKey      []byte     `json:"-"`                                         // COSE_Key
+	Algorithm      int64      `json:"algorithm"`
+	SignCount      uint32     `json:"-"`
+	AAGUID         string     `gorm:"size:32" json:"aaguid"`
+	Transports     []string   `gorm:"serializer:json" json:"transports"`
+	BackupEligible bool       `json:"backupEligible"`
+	LastUsedAt     *time.Time `json:"lastUsedAt"`
+}
+
+// WebAuthnChallenge хранит challenge незавершенной церемонии WebAuthn.
+// Запись одноразовая
+type WebAuthnChallenge struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	Challenge string    `gorm:"uniqueIndex;size:64" json:"-"`
+	Purpose   string    `gorm:"size:16" json:"purpose"` // register | login | 2fa
+	UserID    *uint     `gorm:"index" json:"userId"`    // nil — вход без указания логина
+	ExpiresAt time.Time `gorm:"index" json:"expiresAt"`
+}
+
+// UsedChallenge — погашенный challenge-токен второго шага входа (jti).
+// Запись живет, пока не истечет сам токен, поэтому один challenge дает не
+// больше одного входа
+type UsedChallenge struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	JTI       string    `gorm:"uniqueIndex;size:64" json:"-"`
+	UserID    uint      `gorm:"index" json:"userId"`
+	ExpiresAt time.Time `gorm:"index" json:"expiresAt"`
+}
+
+// WSTicket — одноразовый билет для подключения к WebSocket без токена в URL.
+// Хранится только хэш; при погашении запись удаляется
+type WSTicket struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	TicketHash string    `gorm:"uniqueIndex;size:64" json:"-"`
+	UserID     uint      `gorm:"index" json:"userId"`
+	SessionID  uint      `json:"sessionId"`                     // сессия JWT, по которой выдан билет
+	TokenID    *uint     `json:"tokenId"`                       // не nil — билет выдан по персональному токену
+	Scopes     []string  `gorm:"serializer:json" json:"scopes"` // области персонального токена
+	RoomID     *uint     `json:"roomId"`                        // не nil — билет действует только для этой комнаты
+	ExpiresAt  time.Time `gorm:"index" json:"expiresAt"`
+}
+
+// ErrAuditAppendOnly возвращается при попытке изменить или удалить запись
+// журнала аудита через ORM.
+var ErrAuditAppendOnly = errors.New("audit log is append-only")
+
+// AuditEvent — запись журнала аудита: кто, что и над чем сделал. Журнал
+// только дополняется; записи удаляет лишь очистка по сроку хранения
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+
+	ActorID    *uint                  `gorm:"index" json:"actorId"`                             // nil — действие без входа (сброс пароля по ссылке и т. п.)
+	Action     string                 `gorm:"size:64;index" json:"action"`                      // "auth.login", "admin.role.assign", ...
+	TargetType string                 `gorm:"size:32;index:idx_audit_target" json:"targetType"` // user | role | room | session | token | passkey | identity
+	TargetID   uint                   `gorm:"index:idx_audit_target" json:"targetId"`
+	IP         string                 `gorm:"size:64" json:"ip"`
+	UserAgent  string                 `gorm:"size:255" json:"userAgent"`
+	Diff       map[string]interface{} `gorm:"serializer:json" json:"diff,omitempty"` // поле -> {"old": ..., "new": ...}
+}
+
+// BeforeUpdate запрещает изменять записи журнала.
+func (AuditEvent) BeforeUpdate(*gorm.DB) error { return ErrAuditAppendOnly }
+
+// BeforeDelete запрещает удалять записи журнала; очистка по сроку хранения
+// выполняется с SkipHooks.
+func (AuditEvent) BeforeDelete(*gorm.DB) error { return ErrAuditAppendOnly }
@@ -47,9 +47,9 @@ type TwoFactorAuth struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 
 	UserID      uint       `gorm:"uniqueIndex" json:"userId"`
-	Secret      string     `gorm:"size:32" json:"secret"`
+	Secret      string     `gorm:"size:32" json:"-"`
 	Enabled     bool       `json:"enabled"`
-	BackupCodes []string   `gorm:"serializer:json" json:"backupCodes"`
+	BackupCodes []string   `gorm:"serializer:json" json:"-"` // SHA-256 хэши неиспользованных резервных кодов
 	LastUsed    *time.Time `json:"lastUsed"`
 }
 
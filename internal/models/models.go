@@ -15,6 +15,21 @@ type User struct {
 	AvatarURL string     `gorm:"size:255" json:"avatarUrl"`
 	Online    bool       `gorm:"-" json:"online"`
 	LastSeen  *time.Time `json:"lastSeen"`
+	// Статус присутствия, заданный пользователем (см. handlers/presence_status.go):
+	// PresenceMode — away или dnd вместо автоматического online/idle ("" — автоматически),
+	// StatusText и StatusEmoji — свой статус, который снимается в StatusExpiresAt,
+	// HideOnline — другие видят пользователя офлайн
+	PresenceMode    string     `gorm:"size:16;not null;default:''" json:"presenceMode"`
+	StatusText      string     `gorm:"size:100" json:"statusText"`
+	StatusEmoji     string     `gorm:"size:32" json:"statusEmoji"`
+	StatusExpiresAt *time.Time `json:"statusExpiresAt"`
+	HideOnline      bool       `gorm:"not null;default:false" json:"hideOnline"`
+	// Email хранится в нижнем регистре; nil — адрес не указан
+	Email           *string    `gorm:"uniqueIndex;size:255" json:"-"`
+	EmailVerifiedAt *time.Time `json:"-"`
+	// ErasedAt — аккаунт удален по запросу владельца: персональные данные
+	// стерты, сообщения остаются от имени «Deleted user»
+	ErasedAt *time.Time `gorm:"index" json:"-"`
 }
 
 type Room struct {
@@ -26,6 +41,8 @@ type Room struct {
 	Name      string `gorm:"size:120" json:"name"`
 	IsPrivate bool   `json:"isPrivate"`
 	OwnerID   uint   `json:"ownerId"`
+	// LastSeq — номер последнего события комнаты (см. handlers/replay.go)
+	LastSeq uint64 `gorm:"not null;default:0" json:"-"`
 }
 
 type RoomMember struct {
@@ -43,11 +60,14 @@ type Message struct {
 	CreatedAt time.Time `gorm:"index" json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 
-	RoomID   uint   `gorm:"index" json:"roomId"`
-	UserID   uint   `gorm:"index" json:"userId"`
+	RoomID   uint   `gorm:"index;uniqueIndex:uniq_room_user_client_msg" json:"roomId"`
+	UserID   uint   `gorm:"index;uniqueIndex:uniq_room_user_client_msg" json:"userId"`
 	Type     string `gorm:"size:16" json:"type"` // "text" | "image" | "system"
 	Text     string `gorm:"size:4000" json:"text"`
 	ImageURL string `gorm:"size:255" json:"imageUrl"`
+	// ClientMsgID — идентификатор, выбранный клиентом; повтор отправки с тем же
+	// значением в ту же комнату не создает второе сообщение
+	ClientMsgID *string `gorm:"size:64;uniqueIndex:uniq_room_user_client_msg" json:"clientMsgId,omitempty"`
 }
 
 type Reaction struct {
@@ -0,0 +1,88 @@
+package oidc
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Registry хранит настроенных провайдеров по имени.
+type Registry struct {
+	providers map[string]*Provider
+}
+
+// NewRegistry собирает реестр из готовых провайдеров.
+func NewRegistry(providers ...*Provider) *Registry {
+	r := &Registry{providers: map[string]*Provider{}}
+	for _, p := range providers {
+		r.providers[p.cfg.Name] = p
+	}
+	return r
+}
+
+// FromEnv читает провайдеров из окружения. OIDC_PROVIDERS перечисляет имена
+// через запятую, настройки каждого берутся из OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL,
+// OIDC_<NAME>_SCOPES, OIDC_<NAME>_AUTO_PROVISION и OIDC_<NAME>_{LOGIN,NAME,AVATAR}_CLAIM.
+// Если OIDC_PROVIDERS не задан, но задан OIDC_ISSUER, создается провайдер
+// "default" из переменных без имени (OIDC_CLIENT_ID и т.д.).
+func FromEnv() *Registry {
+	names := splitList(os.Getenv("OIDC_PROVIDERS"))
+	if len(names) == 0 && os.Getenv("OIDC_ISSUER") != "" {
+		names = []string{"default"}
+	}
+	r := NewRegistry()
+	for _, name := range names {
+		get := func(key string) string {
+			if name == "default" {
+				return strings.TrimSpace(os.Getenv("OIDC_" + key))
+			}
+			return strings.TrimSpace(os.Getenv("OIDC_" + strings.ToUpper(name) + "_" + key))
+		}
+		if get("ISSUER") == "" || get("CLIENT_ID") == "" {
+			continue
+		}
+		auto, _ := strconv.ParseBool(get("AUTO_PROVISION"))
+		cfg := Config{
+			Name:          strings.ToLower(name),
+			Issuer:        get("ISSUER"),
+			ClientID:      get("CLIENT_ID"),
+			ClientSecret:  get("CLIENT_SECRET"),
+			RedirectURL:   get("REDIRECT_URL"),
+			Scopes:        strings.Fields(strings.ReplaceAll(get("SCOPES"), ",", " ")),
+			AutoProvision: auto,
+			LoginClaim:    get("LOGIN_CLAIM"),
+			NameClaim:     get("NAME_CLAIM"),
+			AvatarClaim:   get("AVATAR_CLAIM"),
+		}
+		r.providers[cfg.Name] = NewProvider(cfg, nil)
+	}
+	return r
+}
+
+// Get возвращает провайдера по имени.
+func (r *Registry) Get(name string) (*Provider, bool) {
+	p, ok := r.providers[strings.ToLower(name)]
+	return p, ok
+}
+
+// Names возвращает имена провайдеров в алфавитном порядке.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for n := range r.providers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,160 @@
+// Package oidctest — локальный OIDC-издатель для тестов: discovery, JWKS и
+// token endpoint поверх httptest.Server.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyID — kid подписывающего ключа в JWKS издателя.
+const KeyID = "test-key"
+
+// Issuer выдает ID-токены, подписанные RS256. Страницы входа нет: ее заменяет
+// Authorize, которая сразу выдает code по ссылке авторизации.
+type Issuer struct {
+	*httptest.Server
+	ClientID string
+
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// grant — выданный, но еще не обмененный code.
+type grant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+// NewIssuer запускает издателя для клиента clientID. Закрывать через Close.
+func NewIssuer(clientID string) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	i := &Issuer{ClientID: clientID, key: key, grants: map[string]grant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/jwks", i.jwks)
+	mux.HandleFunc("/token", i.token)
+	i.Server = httptest.NewServer(mux)
+	return i, nil
+}
+
+// Authorize имитирует вход пользователя у провайдера: разбирает ссылку
+// авторизации и возвращает одноразовый code и state из нее. claims попадут в
+// ID-токен поверх стандартных iss, aud, iat, exp и nonce, так что их можно и
+// испортить.
+func (i *Issuer) Authorize(authURL string, claims jwt.MapClaims) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	if q.Get("client_id") != i.ClientID {
+		return "", "", errors.New("oidctest: unknown client_id " + q.Get("client_id"))
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		return "", "", errors.New("oidctest: PKCE S256 challenge required")
+	}
+	now := time.Now()
+	all := jwt.MapClaims{
+		"iss":   i.URL,
+		"aud":   i.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	code = base64.RawURLEncoding.EncodeToString(buf)
+	i.mu.Lock()
+	i.grants[code] = grant{challenge: q.Get("code_challenge"), claims: all}
+	i.mu.Unlock()
+	return code, q.Get("state"), nil
+}
+
+// Sign подписывает произвольные claims ключом издателя.
+func (i *Issuer) Sign(claims jwt.MapClaims) (string, error) {
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = KeyID
+	return tok.SignedString(i.key)
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	b64 := base64.RawURLEncoding
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": KeyID,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   b64.EncodeToString(i.key.N.Bytes()),
+		"e":   b64.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+	}}})
+}
+
+// token обменивает code на ID-токен, проверяя PKCE code_verifier (RFC 7636).
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	if r.Form.Get("client_id") != i.ClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	code := r.Form.Get("code")
+	i.mu.Lock()
+	g, ok := i.grants[code]
+	delete(i.grants, code)
+	i.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	idToken, err := i.Sign(g.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "at-" + code,
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+		"expires_in":   300,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,301 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config описывает одного OIDC-провайдера.
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// AutoProvision разрешает создавать локального пользователя при первом входе
+	AutoProvision bool
+	// Claims, из которых берутся login, name и avatar пользователя
+	LoginClaim  string
+	NameClaim   string
+	AvatarClaim string
+}
+
+// Discovery — нужная нам часть /.well-known/openid-configuration.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// Tokens — ответ token endpoint.
+type Tokens struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// IDTokenClaims — проверенные claims ID-токена.
+type IDTokenClaims struct {
+	Nonce string `json:"nonce"`
+	AZP   string `json:"azp"`
+	jwt.RegisteredClaims
+	// Raw содержит все claims для сопоставления с полями пользователя
+	Raw map[string]interface{} `json:"-"`
+}
+
+// String возвращает строковый claim или пустую строку.
+func (c *IDTokenClaims) String(name string) string {
+	if v, ok := c.Raw[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Provider выполняет authorization code flow с PKCE против одного издателя.
+// Discovery и JWKS загружаются лениво и кэшируются.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]interface{}
+	keysAt    time.Time
+}
+
+// NewProvider создает провайдера. client можно подменить, например, для
+// локального тестового издателя; nil означает клиента с таймаутом 10 секунд.
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.LoginClaim == "" {
+		cfg.LoginClaim = "preferred_username"
+	}
+	if cfg.NameClaim == "" {
+		cfg.NameClaim = "name"
+	}
+	if cfg.AvatarClaim == "" {
+		cfg.AvatarClaim = "picture"
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+// Config возвращает настройки провайдера.
+func (p *Provider) Config() Config { return p.cfg }
+
+// Discover загружает и проверяет документ discovery.
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	var d Discovery
+	if err := p.getJSON(ctx, wellKnown, &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q != %q", d.Issuer, p.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// AuthCodeURL собирает адрес авторизации с state, nonce и PKCE challenge (S256).
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange обменивает authorization code на токены.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Tokens, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token endpoint: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var t Tokens
+	if err := json.Unmarshal(body, &t); err != nil {
+		return nil, fmt.Errorf("oidc token endpoint: %w", err)
+	}
+	if t.IDToken == "" {
+		return nil, errors.New("oidc token endpoint: no id_token in response")
+	}
+	return &t, nil
+}
+
+// VerifyIDToken проверяет подпись по JWKS издателя, iss, aud, exp и nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDTokenClaims, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id_token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("oidc id_token: missing sub")
+	}
+	if len(claims.Audience) > 1 && claims.AZP != p.cfg.ClientID {
+		return nil, errors.New("oidc id_token: azp does not match client")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("oidc id_token: nonce mismatch")
+	}
+	// Сохраняем все claims для сопоставления атрибутов
+	parser := jwt.NewParser()
+	rawClaims := jwt.MapClaims{}
+	if _, _, err := parser.ParseUnverified(raw, rawClaims); err == nil {
+		claims.Raw = rawClaims
+	}
+	return claims, nil
+}
+
+// key возвращает ключ издателя по kid. Неизвестный kid приводит к повторной
+// загрузке JWKS (не чаще раза в минуту) — так поддерживается ротация у провайдера.
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.lookupLocked(kid); ok {
+		return k, nil
+	}
+	if p.keys != nil && time.Since(p.keysAt) < time.Minute {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	var set jwkSet
+	if err := p.getJSON(ctx, p.discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	p.keys = set.publicKeys()
+	p.keysAt = time.Now()
+	if k, ok := p.lookupLocked(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (p *Provider) lookupLocked(kid string) (interface{}, bool) {
+	if kid != "" {
+		k, ok := p.keys[kid]
+		return k, ok
+	}
+	// Без kid допускаем только единственный ключ издателя
+	if len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// NewPKCE возвращает code_verifier и соответствующий S256 code_challenge.
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString возвращает n случайных байт в base64url (для state и nonce).
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
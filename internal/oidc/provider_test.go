@@ -0,0 +1,145 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"LinkUp/internal/oidc"
+	"LinkUp/internal/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newIssuer(t *testing.T) (*oidctest.Issuer, *oidc.Provider) {
+	t.Helper()
+	iss, err := oidctest.NewIssuer("linkup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(iss.Close)
+	p := oidc.NewProvider(oidc.Config{Name: "mock", Issuer: iss.URL, ClientID: "linkup", RedirectURL: "http://app/cb"}, nil)
+	return iss, p
+}
+
+// login проходит весь поток и возвращает ID-токен до проверки.
+func login(t *testing.T, iss *oidctest.Issuer, p *oidc.Provider, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, "st", "n-1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := iss.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens.IDToken, "n-1"
+}
+
+func TestPKCE(t *testing.T) {
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("challenge is not S256(verifier)")
+	}
+	if len(verifier) < 43 {
+		t.Fatalf("verifier too short: %d", len(verifier))
+	}
+
+	iss, p := newIssuer(t)
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, "st", "n-1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if q.Get("code_challenge") != challenge || q.Get("code_challenge_method") != "S256" || q.Get("state") != "st" || q.Get("nonce") != "n-1" {
+		t.Fatalf("authorization url: %s", authURL)
+	}
+	code, _, err := iss.Authorize(authURL, jwt.MapClaims{"sub": "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, _ := oidc.NewPKCE()
+	if _, err := p.Exchange(ctx, code, other); err == nil {
+		t.Fatal("code exchanged with a foreign verifier")
+	}
+	// неудачный обмен гасит code, как у настоящего провайдера
+	if _, err := p.Exchange(ctx, code, verifier); err == nil {
+		t.Fatal("code reused")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	iss, p := newIssuer(t)
+	ctx := context.Background()
+
+	raw, nonce := login(t, iss, p, jwt.MapClaims{"sub": "s-1", "preferred_username": "alice", "name": "Alice", "email": "a@x.io"})
+	claims, err := p.VerifyIDToken(ctx, raw, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := p.Config()
+	if claims.Subject != "s-1" || claims.Issuer != iss.URL {
+		t.Fatalf("claims: %+v", claims)
+	}
+	if claims.String(cfg.LoginClaim) != "alice" || claims.String(cfg.NameClaim) != "Alice" || claims.String("email") != "a@x.io" {
+		t.Fatalf("claim mapping: %v", claims.Raw)
+	}
+	if claims.String(cfg.AvatarClaim) != "" || claims.String("exp") != "" {
+		t.Fatalf("missing or non-string claim mapped: %v", claims.Raw)
+	}
+	if _, err := p.VerifyIDToken(ctx, raw, "other"); err == nil {
+		t.Fatal("nonce mismatch accepted")
+	}
+	if _, err := p.VerifyIDToken(ctx, raw, ""); err == nil {
+		t.Fatal("empty nonce accepted")
+	}
+
+	past := time.Now().Add(-10 * time.Minute).Unix()
+	for name, bad := range map[string]jwt.MapClaims{
+		"wrong iss":   {"sub": "s-1", "iss": "https://evil.example"},
+		"wrong aud":   {"sub": "s-1", "aud": "other-client"},
+		"expired":     {"sub": "s-1", "exp": past},
+		"missing exp": {"sub": "s-1", "exp": nil},
+		"missing sub": {},
+		"foreign azp": {"sub": "s-1", "aud": []string{"linkup", "other"}, "azp": "other"},
+	} {
+		raw, nonce := login(t, iss, p, bad)
+		if _, err := p.VerifyIDToken(ctx, raw, nonce); err == nil {
+			t.Errorf("%s: id_token accepted", name)
+		}
+	}
+	raw, nonce = login(t, iss, p, jwt.MapClaims{"sub": "s-1", "aud": []string{"linkup", "other"}, "azp": "linkup"})
+	if _, err := p.VerifyIDToken(ctx, raw, nonce); err != nil {
+		t.Errorf("azp for this client rejected: %v", err)
+	}
+
+	// подпись чужим ключом с тем же kid
+	forger, err := oidctest.NewIssuer("linkup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer forger.Close()
+	forged, _ := forger.Sign(jwt.MapClaims{"iss": iss.URL, "aud": "linkup", "sub": "s-1", "exp": time.Now().Add(time.Minute).Unix(), "nonce": nonce})
+	if _, err := p.VerifyIDToken(ctx, forged, nonce); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("forged signature: %v", err)
+	}
+}
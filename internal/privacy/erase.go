@@ -0,0 +1,221 @@
+package privacy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"LinkUp/internal/lockout"
+	"LinkUp/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeletedUserName — имя, под которым показываются сообщения удаленного аккаунта.
+const DeletedUserName = "Deleted user"
+
+// Erase удаляет аккаунт userID по запросу владельца.
+//
+// Строка users остается обезличенной заглушкой («Deleted user»), чтобы
+// сообщения, комнаты и прочие общие данные сохранили автора; логин заменяется
+// случайным, email, аватар и пароль стираются. Строки, принадлежащие только
+// пользователю (сессии, токены, реакции, голоса, настройки и т. п.), удаляются,
+// а его id вычищается из списков участников опросов, событий и игр.
+// Загруженные файлы удаляются с диска после фиксации транзакции. Журнал аудита
+// не трогается: его записи живут до истечения AUDIT_RETENTION.
+//
+// Новую таблицу из storage.AutoMigrate со ссылкой на пользователя нужно
+// учесть здесь и в Collect.
+func (s *Service) Erase(ctx context.Context, userID uint) error {
+	var files []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("erased_at IS NULL").First(&u, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+		var fileRecords []models.FileStorage
+		if err := tx.Where("user_id = ?", userID).Find(&fileRecords).Error; err != nil {
+			return err
+		}
+		paths, err := s.uploads(userID, fileRecords)
+		if err != nil {
+			return err
+		}
+		files = paths
+
+		if err := scrubPolls(tx, userID); err != nil {
+			return err
+		}
+		if err := scrubEvents(tx, userID); err != nil {
+			return err
+		}
+		if err := scrubGames(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.MusicRoom{}).Where("dj = ?", userID).Update("dj", nil).Error; err != nil {
+			return err
+		}
+		// Картинки из удаляемых загрузок в сообщениях больше не откроются
+		if err := tx.Model(&models.Message{}).
+			Where(`user_id = ? AND image_url LIKE ? ESCAPE '\'`, userID, fmt.Sprintf("%%/uploads/%d\\_%%", userID)).
+			Update("image_url", "").Error; err != nil {
+			return err
+		}
+
+		fileIDs := make([]uint, 0, len(fileRecords))
+		for _, f := range fileRecords {
+			fileIDs = append(fileIDs, f.ID)
+		}
+		if len(fileIDs) > 0 {
+			if err := tx.Where("file_id IN ?", fileIDs).Delete(&models.FileVersion{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("session_id IN (?)", tx.Model(&models.Session{}).Select("id").Where("user_id = ?", userID)).
+			Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		owned := []interface{}{
+			&models.RoomMember{}, &models.Reaction{}, &models.UserRole{}, &models.TwoFactorAuth{},
+			&models.Analytics{}, &models.PollVote{}, &models.NotificationSettings{}, &models.Mention{},
+			&models.FileStorage{}, &models.UserAchievement{}, &models.UserLevel{}, &models.GitHubIntegration{},
+			&models.PushSubscription{}, &models.OfflineMessage{}, &models.Session{}, &models.ExternalIdentity{},
+			&models.EmailToken{}, &models.PersonalAccessToken{}, &models.WebAuthnCredential{}, &models.WebAuthnChallenge{},
+			&models.WSTicket{},
+		}
+		for _, m := range owned {
+			if err := tx.Where("user_id = ?", userID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("link_user_id = ?", userID).Delete(&models.OIDCLoginState{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR login = ?", userID, u.Login).Delete(&models.LoginAttempt{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("bucket = ?", lockout.LoginKey(u.Login)).Delete(&models.LoginThrottle{}).Error; err != nil {
+			return err
+		}
+
+		suffix := make([]byte, 6)
+		if _, err := rand.Read(suffix); err != nil {
+			return err
+		}
+		now := time.Now()
+		return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"login":             fmt.Sprintf("deleted-%d-%s", userID, hex.EncodeToString(suffix)),
+			"password":          "",
+			"name":              DeletedUserName,
+			"avatar_url":        "",
+			"last_seen":         nil,
+			"presence_mode":     "",
+			"status_text":       "",
+			"status_emoji":      "",
+			"status_expires_at": nil,
+			"email":             nil,
+			"email_verified_at": nil,
+			"erased_at":         now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range files {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[privacy] remove upload %s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// scrubPolls убирает пользователя из карт голосов опросов, где он голосовал.
+func scrubPolls(tx *gorm.DB, userID uint) error {
+	var polls []models.Poll
+	if err := tx.Where("id IN (?)", tx.Model(&models.PollVote{}).Select("poll_id").Where("user_id = ?", userID)).
+		Find(&polls).Error; err != nil {
+		return err
+	}
+	for _, p := range polls {
+		removed := int64(0)
+		for opt, ids := range p.Votes {
+			kept := removeID(ids, userID)
+			removed += int64(len(ids) - len(kept))
+			p.Votes[opt] = kept
+		}
+		p.TotalVotes -= removed
+		if p.TotalVotes < 0 {
+			p.TotalVotes = 0
+		}
+		if err := tx.Model(&p).Select("votes", "total_votes").Updates(&p).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrubEvents убирает пользователя из участников событий календаря.
+// Списки хранятся в JSON, поэтому LIKE лишь отбирает кандидатов.
+func scrubEvents(tx *gorm.DB, userID uint) error {
+	var events []models.CalendarEvent
+	if err := tx.Where("attendees LIKE ?", fmt.Sprintf("%%%d%%", userID)).Find(&events).Error; err != nil {
+		return err
+	}
+	for _, ev := range events {
+		kept := removeID(ev.Attendees, userID)
+		if len(kept) == len(ev.Attendees) {
+			continue
+		}
+		ev.Attendees = kept
+		if err := tx.Model(&ev).Select("attendees").Updates(&ev).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrubGames убирает пользователя из игроков, счета и победителей игр.
+func scrubGames(tx *gorm.DB, userID uint) error {
+	var games []models.ChatGame
+	if err := tx.Where("players LIKE ? OR winner = ?", fmt.Sprintf("%%%d%%", userID), userID).
+		Find(&games).Error; err != nil {
+		return err
+	}
+	for _, g := range games {
+		players := removeID(g.Players, userID)
+		_, scored := g.Score[userID]
+		won := g.Winner != nil && *g.Winner == userID
+		if len(players) == len(g.Players) && !scored && !won {
+			continue
+		}
+		delete(g.Score, userID)
+		g.Players = players
+		if won {
+			g.Winner = nil
+		}
+		if err := tx.Model(&g).Select("players", "score", "winner").Updates(&g).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeID(ids []uint, id uint) []uint {
+	out := make([]uint, 0, len(ids))
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
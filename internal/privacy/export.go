@@ -0,0 +1,229 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"LinkUp/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound — пользователя нет или его аккаунт уже удален.
+var ErrNotFound = errors.New("privacy: user not found")
+
+// ExportVersion — версия формата data.json.
+const ExportVersion = 1
+
+// Service выгружает и стирает персональные данные пользователя.
+type Service struct {
+	db        *gorm.DB
+	uploadDir string
+}
+
+// New создает сервис. uploadDir — каталог, куда /upload сохраняет файлы.
+func New(db *gorm.DB, uploadDir string) *Service {
+	return &Service{db: db, uploadDir: uploadDir}
+}
+
+// User — профиль в выгрузке; в отличие от API включает email.
+type User struct {
+	models.User
+	Email            *string    `json:"email"`
+	EmailVerifiedAt  *time.Time `json:"emailVerifiedAt"`
+	TwoFactorEnabled bool       `json:"twoFactorEnabled"`
+}
+
+// Export — содержимое data.json. Секреты (хэши паролей и токенов, ключи
+// 2FA и passkey) в выгрузку не попадают.
+type Export struct {
+	Version              int                          `json:"version"`
+	ExportedAt           time.Time                    `json:"exportedAt"`
+	User                 User                         `json:"user"`
+	Memberships          []models.RoomMember          `json:"memberships"`
+	Messages             []models.Message             `json:"messages"`
+	Reactions            []models.Reaction            `json:"reactions"`
+	PollVotes            []models.PollVote            `json:"pollVotes"`
+	Mentions             []models.Mention             `json:"mentions"`
+	Analytics            *models.Analytics            `json:"analytics"`
+	Achievements         []models.UserAchievement     `json:"achievements"`
+	Level                *models.UserLevel            `json:"level"`
+	Files                []models.FileStorage         `json:"files"`
+	NotificationSettings *models.NotificationSettings `json:"notificationSettings"`
+	CalendarEvents       []models.CalendarEvent       `json:"calendarEvents"`
+	PushSubscriptions    []models.PushSubscription    `json:"pushSubscriptions"`
+	Sessions             []models.Session             `json:"sessions"`
+	Identities           []models.ExternalIdentity    `json:"identities"`
+	Passkeys             []models.WebAuthnCredential  `json:"passkeys"`
+	AccessTokens         []models.PersonalAccessToken `json:"accessTokens"`
+	LoginAttempts        []models.LoginAttempt        `json:"loginAttempts"`
+	Invites              []models.Invite              `json:"invites"`
+	// Uploads — имена загруженных файлов в каталоге files/ архива
+	Uploads []string `json:"uploads"`
+
+	uploadPaths []string
+}
+
+// Collect собирает данные пользователя userID.
+func (s *Service) Collect(ctx context.Context, userID uint) (*Export, error) {
+	db := s.db.WithContext(ctx)
+	var u models.User
+	if err := db.Where("erased_at IS NULL").First(&u, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	e := &Export{
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		User:       User{User: u, Email: u.Email, EmailVerifiedAt: u.EmailVerifiedAt},
+	}
+	var twoFA models.TwoFactorAuth
+	if err := db.Where("user_id = ?", userID).Limit(1).Find(&twoFA).Error; err != nil {
+		return nil, err
+	}
+	e.User.TwoFactorEnabled = twoFA.Enabled
+
+	lists := []struct {
+		dest  interface{}
+		query string
+	}{
+		{&e.Memberships, "user_id = ?"},
+		{&e.Messages, "user_id = ?"},
+		{&e.Reactions, "user_id = ?"},
+		{&e.PollVotes, "user_id = ?"},
+		{&e.Mentions, "user_id = ? OR mentioned_by = ?"},
+		{&e.Achievements, "user_id = ?"},
+		{&e.Files, "user_id = ?"},
+		{&e.CalendarEvents, "user_id = ?"},
+		{&e.PushSubscriptions, "user_id = ?"},
+		{&e.Sessions, "user_id = ?"},
+		{&e.Identities, "user_id = ?"},
+		{&e.Passkeys, "user_id = ?"},
+		{&e.AccessTokens, "user_id = ?"},
+		{&e.LoginAttempts, "user_id = ?"},
+		{&e.Invites, "created_by = ?"},
+	}
+	for _, l := range lists {
+		args := make([]interface{}, strings.Count(l.query, "?"))
+		for i := range args {
+			args[i] = userID
+		}
+		if err := db.Where(l.query, args...).Order("id").Find(l.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var analytics models.Analytics
+	if res := db.Where("user_id = ?", userID).Limit(1).Find(&analytics); res.Error != nil {
+		return nil, res.Error
+	} else if res.RowsAffected > 0 {
+		e.Analytics = &analytics
+	}
+	var level models.UserLevel
+	if res := db.Where("user_id = ?", userID).Limit(1).Find(&level); res.Error != nil {
+		return nil, res.Error
+	} else if res.RowsAffected > 0 {
+		e.Level = &level
+	}
+	var notify models.NotificationSettings
+	if res := db.Where("user_id = ?", userID).Limit(1).Find(&notify); res.Error != nil {
+		return nil, res.Error
+	} else if res.RowsAffected > 0 {
+		e.NotificationSettings = &notify
+	}
+
+	paths, err := s.uploads(userID, e.Files)
+	if err != nil {
+		return nil, err
+	}
+	e.uploadPaths = paths
+	e.Uploads = make([]string, 0, len(paths))
+	for _, p := range paths {
+		e.Uploads = append(e.Uploads, filepath.Base(p))
+	}
+	return e, nil
+}
+
+// uploads возвращает пути к локальным файлам пользователя: загруженным через
+// /upload (имя начинается с "<userID>_") и описанным записями FileStorage.
+func (s *Service) uploads(userID uint, files []models.FileStorage) ([]string, error) {
+	if s.uploadDir == "" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(s.uploadDir, fmt.Sprintf("%d_*", userID)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Filename == "" || (f.StorageType != "" && f.StorageType != "local") {
+			continue
+		}
+		p := filepath.Join(s.uploadDir, filepath.Base(f.Filename))
+		if st, err := os.Stat(p); err == nil && st.Mode().IsRegular() {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	out := paths[:0]
+	for i, p := range paths {
+		if i == 0 || p != paths[i-1] {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// WriteArchive пишет zip-архив: data.json и загруженные файлы в files/.
+// Файл, удаленный между Collect и записью, пропускается.
+func (e *Export) WriteArchive(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "data.json", Method: zip.Deflate, Modified: e.ExportedAt})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	for _, p := range e.uploadPaths {
+		if err := addFile(zw, p); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func addFile(zw *zip.Writer, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+	st, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: "files/" + filepath.Base(path), Method: zip.Deflate, Modified: st.ModTime()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -52,6 +52,9 @@ func OpenDefault() (*gorm.DB, error) {
 	sqlDB.SetConnMaxLifetime(1 * time.Hour)
 	return db, nil
 }
+
+// AutoMigrate создает и обновляет таблицы. Таблицу со ссылкой на пользователя
+// нужно также учесть в privacy.Service (выгрузка и удаление аккаунта).
 func AutoMigrate(db *gorm.DB) error {
 	return db.AutoMigrate(
 		&models.User{},
@@ -83,5 +86,19 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.ChatGame{},
 		&models.PushSubscription{},
 		&models.OfflineMessage{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.ExternalIdentity{},
+		&models.OIDCLoginState{},
+		&models.EmailToken{},
+		&models.LoginThrottle{},
+		&models.LoginAttempt{},
+		&models.PersonalAccessToken{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
+		&models.UsedChallenge{},
+		&models.AuditEvent{},
+		&models.Invite{},
+		&models.WSTicket{},
 	)
 }
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2Params — параметры argon2id. Memory задается в КиБ.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params — рекомендация OWASP: 19 МиБ, 2 прохода, 1 поток.
+var DefaultArgon2Params = Argon2Params{Memory: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+var (
+	argon2Once   sync.Once
+	argon2Params Argon2Params
+)
+
+// currentArgon2Params читает ARGON2_MEMORY (КиБ), ARGON2_ITERATIONS и
+// ARGON2_PARALLELISM один раз при первом обращении.
+func currentArgon2Params() Argon2Params {
+	argon2Once.Do(func() {
+		argon2Params = DefaultArgon2Params
+		if n, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY"), 10, 32); err == nil && n >= 8*1024 {
+			argon2Params.Memory = uint32(n)
+		}
+		if n, err := strconv.ParseUint(os.Getenv("ARGON2_ITERATIONS"), 10, 32); err == nil && n >= 1 {
+			argon2Params.Iterations = uint32(n)
+		}
+		if n, err := strconv.ParseUint(os.Getenv("ARGON2_PARALLELISM"), 10, 8); err == nil && n >= 1 {
+			argon2Params.Parallelism = uint8(n)
+		}
+	})
+	return argon2Params
+}
+
+// HashPassword хэширует пароль argon2id и возвращает строку в формате PHC:
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>.
+func HashPassword(pw string) (string, error) {
+	p := currentArgon2Params()
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(pw), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword сверяет пароль с хэшем argon2id или bcrypt (хэши,
+// созданные до перехода на argon2id).
+func CheckPassword(hash, pw string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		p, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(pw), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil
+}
+
+// NeedsRehash сообщает, что хэш создан устаревшим алгоритмом или с другими
+// параметрами и его стоит пересчитать при следующем успешном входе.
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return true
+	}
+	p, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return true
+	}
+	cur := currentArgon2Params()
+	return p.Memory != cur.Memory || p.Iterations != cur.Iterations || p.Parallelism != cur.Parallelism ||
+		uint32(len(salt)) != cur.SaltLength || uint32(len(key)) != cur.KeyLength
+}
+
+func decodeArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
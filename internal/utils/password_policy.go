@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Нарушения парольной политики. Тексты ошибок можно показывать пользователю.
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooLong  = errors.New("password is too long")
+	ErrPasswordCommon   = errors.New("password is too common")
+	ErrPasswordHasLogin = errors.New("password must not contain the login")
+)
+
+// PasswordPolicy — требования к новым паролям.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	blocklist map[string]struct{}
+}
+
+// NewPasswordPolicy создает политику со встроенным списком распространенных
+// паролей. Он короткий и отсекает только самые частые пароли; это не проверка
+// по утечкам. Полный список утекших паролей подключается через
+// PASSWORD_BLOCKLIST_FILE.
+func NewPasswordPolicy(minLength, maxLength int) *PasswordPolicy {
+	p := &PasswordPolicy{MinLength: minLength, MaxLength: maxLength, blocklist: map[string]struct{}{}}
+	p.addBlocklist(strings.NewReader(commonPasswords))
+	return p
+}
+
+// PasswordPolicyFromEnv читает PASSWORD_MIN_LENGTH (по умолчанию 8),
+// PASSWORD_MAX_LENGTH (128) и PASSWORD_BLOCKLIST_FILE — файл с дополнительными
+// запрещенными паролями, по одному в строке.
+func PasswordPolicyFromEnv() *PasswordPolicy {
+	minLen, maxLen := 8, 128
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		minLen = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_LENGTH")); err == nil && n >= minLen {
+		maxLen = n
+	}
+	p := NewPasswordPolicy(minLen, maxLen)
+	if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("password policy: blocklist %s: %v", path, err)
+			return p
+		}
+		defer f.Close()
+		p.addBlocklist(f)
+	}
+	return p
+}
+
+func (p *PasswordPolicy) addBlocklist(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if w := strings.ToLower(strings.TrimSpace(sc.Text())); w != "" && !strings.HasPrefix(w, "#") {
+			p.blocklist[w] = struct{}{}
+		}
+	}
+}
+
+// Validate проверяет новый пароль пользователя login.
+func (p *PasswordPolicy) Validate(password, login string) error {
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters required", ErrPasswordTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return fmt.Errorf("%w: at most %d characters allowed", ErrPasswordTooLong, p.MaxLength)
+	}
+	lower := strings.ToLower(password)
+	if _, ok := p.blocklist[lower]; ok {
+		return ErrPasswordCommon
+	}
+	if l := strings.ToLower(strings.TrimSpace(login)); len(l) >= 3 && strings.Contains(lower, l) {
+		return ErrPasswordHasLogin
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Минимальный CBOR (RFC 8949) в объеме, который нужен WebAuthn: целые числа,
+// байтовые и текстовые строки, массивы, словари и простые значения.
+// Аутентификаторы обязаны использовать каноническую форму CTAP2, поэтому
+// неопределенная длина не поддерживается.
+
+var errCBOR = errors.New("webauthn: malformed CBOR")
+
+const cborMaxDepth = 16
+
+// cborDecode разбирает одно значение и возвращает его вместе с числом
+// прочитанных байт. Целые числа возвращаются как int64, словари — как
+// map[interface{}]interface{}.
+func cborDecode(b []byte) (interface{}, int, error) {
+	d := cborDecoder{b: b}
+	v, err := d.value(0)
+	return v, d.off, err
+}
+
+type cborDecoder struct {
+	b   []byte
+	off int
+}
+
+func (d *cborDecoder) head() (major byte, arg uint64, err error) {
+	if d.off >= len(d.b) {
+		return 0, 0, errCBOR
+	}
+	ib := d.b[d.off]
+	d.off++
+	major, info := ib>>5, ib&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		n := 1 << (info - 24)
+		if d.off+n > len(d.b) {
+			return 0, 0, errCBOR
+		}
+		var v uint64
+		for _, c := range d.b[d.off : d.off+n] {
+			v = v<<8 | uint64(c)
+		}
+		d.off += n
+		return major, v, nil
+	default:
+		return 0, 0, fmt.Errorf("%w: unsupported additional info %d", errCBOR, info)
+	}
+}
+
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)-d.off) {
+		return nil, errCBOR
+	}
+	out := d.b[d.off : d.off+int(n)]
+	d.off += int(n)
+	return out, nil
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, fmt.Errorf("%w: nesting too deep", errCBOR)
+	}
+	start := d.off
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return -1 - int64(arg), nil
+	case 2:
+		return d.bytes(arg)
+	case 3:
+		s, err := d.bytes(arg)
+		return string(s), err
+	case 4:
+		if arg > uint64(len(d.b)) {
+			return nil, errCBOR
+		}
+		arr := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case 5:
+		if arg > uint64(len(d.b)) {
+			return nil, errCBOR
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key", errCBOR)
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case 7:
+		switch d.b[start] & 0x1f {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: unsupported simple value", errCBOR)
+	}
+	return nil, fmt.Errorf("%w: unsupported major type %d", errCBOR, major)
+}
+
+// cborEncode кодирует значения тех же типов, что возвращает cborDecode
+// (а также int и map[string]/map[int64]). Ключи словарей сортируются
+// канонически. Нужен программному аутентификатору.
+func cborEncode(v interface{}) ([]byte, error) {
+	var out []byte
+	err := cborAppend(&out, v)
+	return out, err
+}
+
+func cborHead(out *[]byte, major byte, n uint64) {
+	switch {
+	case n < 24:
+		*out = append(*out, major<<5|byte(n))
+	case n <= math.MaxUint8:
+		*out = append(*out, major<<5|24, byte(n))
+	case n <= math.MaxUint16:
+		*out = append(*out, major<<5|25)
+		*out = binary.BigEndian.AppendUint16(*out, uint16(n))
+	case n <= math.MaxUint32:
+		*out = append(*out, major<<5|26)
+		*out = binary.BigEndian.AppendUint32(*out, uint32(n))
+	default:
+		*out = append(*out, major<<5|27)
+		*out = binary.BigEndian.AppendUint64(*out, n)
+	}
+}
+
+func cborAppend(out *[]byte, v interface{}) error {
+	switch x := v.(type) {
+	case int:
+		return cborAppend(out, int64(x))
+	case int64:
+		if x >= 0 {
+			cborHead(out, 0, uint64(x))
+		} else {
+			cborHead(out, 1, uint64(-1-x))
+		}
+	case []byte:
+		cborHead(out, 2, uint64(len(x)))
+		*out = append(*out, x...)
+	case string:
+		cborHead(out, 3, uint64(len(x)))
+		*out = append(*out, x...)
+	case bool:
+		if x {
+			*out = append(*out, 0xf5)
+		} else {
+			*out = append(*out, 0xf4)
+		}
+	case nil:
+		*out = append(*out, 0xf6)
+	case []interface{}:
+		cborHead(out, 4, uint64(len(x)))
+		for _, e := range x {
+			if err := cborAppend(out, e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(x))
+		for k, e := range x {
+			m[k] = e
+		}
+		return cborAppend(out, m)
+	case map[int64]interface{}:
+		m := make(map[interface{}]interface{}, len(x))
+		for k, e := range x {
+			m[k] = e
+		}
+		return cborAppend(out, m)
+	case map[interface{}]interface{}:
+		type kv struct {
+			key []byte
+			val interface{}
+		}
+		pairs := make([]kv, 0, len(x))
+		for k, e := range x {
+			var kb []byte
+			if err := cborAppend(&kb, k); err != nil {
+				return err
+			}
+			pairs = append(pairs, kv{kb, e})
+		}
+		// Каноническая форма CTAP2: короткие ключи раньше, затем лексикографически
+		sort.Slice(pairs, func(i, j int) bool {
+			if len(pairs[i].key) != len(pairs[j].key) {
+				return len(pairs[i].key) < len(pairs[j].key)
+			}
+			return string(pairs[i].key) < string(pairs[j].key)
+		})
+		cborHead(out, 5, uint64(len(pairs)))
+		for _, p := range pairs {
+			*out = append(*out, p.key...)
+			if err := cborAppend(out, p.val); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("webauthn: cannot encode %T as CBOR", v)
+	}
+	return nil
+}
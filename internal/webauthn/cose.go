@@ -0,0 +1,125 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Алгоритмы COSE (RFC 9053), которые принимает сервер, в порядке предпочтения.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms перечисляет алгоритмы для pubKeyCredParams.
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// Параметры COSE_Key
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1
+	coseX   = -2 // для RSA — модуль n
+	coseY   = -3 // для RSA — экспонента e
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+var errUnsupportedKey = errors.New("webauthn: unsupported credential public key")
+
+// parsePublicKey разбирает COSE_Key и возвращает алгоритм и ключ.
+func parsePublicKey(cose []byte) (int64, crypto.PublicKey, error) {
+	v, n, err := cborDecode(cose)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n != len(cose) {
+		return 0, nil, errCBOR
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, errUnsupportedKey
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+	crv, _ := m[int64(coseCrv)].(int64)
+	x, _ := m[int64(coseX)].([]byte)
+	y, _ := m[int64(coseY)].([]byte)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256 && crv == crvP256:
+		if len(x) != 32 || len(y) != 32 {
+			return 0, nil, errUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return 0, nil, errUnsupportedKey
+		}
+		return alg, pub, nil
+	case kty == ktyOKP && alg == AlgEdDSA && crv == crvEd25519:
+		if len(x) != ed25519.PublicKeySize {
+			return 0, nil, errUnsupportedKey
+		}
+		return alg, ed25519.PublicKey(x), nil
+	case kty == ktyRSA && alg == AlgRS256:
+		if len(x) < 256 || len(y) == 0 || len(y) > 4 {
+			return 0, nil, errUnsupportedKey
+		}
+		e := new(big.Int).SetBytes(y)
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(x), E: int(e.Int64())}, nil
+	}
+	return 0, nil, fmt.Errorf("%w: kty=%d alg=%d crv=%d", errUnsupportedKey, kty, alg, crv)
+}
+
+// verifySignature проверяет подпись data ключом из COSE_Key.
+func verifySignature(cose, data, sig []byte) error {
+	_, key, err := parsePublicKey(cose)
+	if err != nil {
+		return err
+	}
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(data)
+		if ecdsa.VerifyASN1(k, sum[:], sig) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(k, data, sig) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil {
+			return nil
+		}
+	}
+	return errBadSignature
+}
+
+// encodeEC2Key кодирует открытый ключ P-256 в COSE_Key.
+func encodeEC2Key(pub *ecdsa.PublicKey) ([]byte, error) {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return cborEncode(map[int64]interface{}{
+		coseKty: int64(ktyEC2),
+		coseAlg: AlgES256,
+		coseCrv: int64(crvP256),
+		coseX:   x,
+		coseY:   y,
+	})
+}
@@ -0,0 +1,147 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// ErrNoCredential — у программного аутентификатора нет подходящего ключа.
+var ErrNoCredential = errors.New("webauthn: no matching credential")
+
+// SoftAuthenticator — программный аутентификатор с ключами ES256 в памяти.
+// Ведет себя как платформенный passkey: создает discoverable-ключи, всегда
+// подтверждает присутствие и проверку пользователя. Предназначен для тестов
+// и локальной отладки церемоний без браузера.
+type SoftAuthenticator struct {
+	// Origin подставляется в clientDataJSON
+	Origin string
+
+	mu    sync.Mutex
+	creds []*softCredential
+}
+
+type softCredential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// NewSoftAuthenticator создает аутентификатор для клиента с данным origin.
+func NewSoftAuthenticator(origin string) *SoftAuthenticator {
+	return &SoftAuthenticator{Origin: origin}
+}
+
+func (a *SoftAuthenticator) clientData(typ, challenge string) []byte {
+	b, _ := json.Marshal(clientData{Type: typ, Challenge: challenge, Origin: a.Origin})
+	return b
+}
+
+// Create выполняет navigator.credentials.create() для opts.
+func (a *SoftAuthenticator) Create(opts *CreationOptions) (*RegistrationResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, ex := range opts.ExcludeCredentials {
+		for _, c := range a.creds {
+			if c.rpID == opts.RP.ID && EncodeID(c.id) == ex.ID {
+				return nil, errors.New("webauthn: credential already registered")
+			}
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	userHandle, err := DecodeID(opts.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	cred := &softCredential{id: make([]byte, 16), rpID: opts.RP.ID, userHandle: userHandle, key: key}
+	if _, err := rand.Read(cred.id); err != nil {
+		return nil, err
+	}
+	cose, err := encodeEC2Key(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authData(cred.rpID, flagUP|flagUV|flagAT, 0)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(cred.id)))
+	authData = append(authData, cred.id...)
+	authData = append(authData, cose...)
+	attObj, err := cborEncode(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.creds = append(a.creds, cred)
+
+	resp := &RegistrationResponse{ID: EncodeID(cred.id), RawID: EncodeID(cred.id), Type: "public-key"}
+	resp.Response.ClientDataJSON = EncodeID(a.clientData("webauthn.create", opts.Challenge))
+	resp.Response.AttestationObject = EncodeID(attObj)
+	resp.Response.Transports = []string{"internal"}
+	return resp, nil
+}
+
+// Get выполняет navigator.credentials.get() для opts. При пустом
+// allowCredentials используется первый ключ этого RP.
+func (a *SoftAuthenticator) Get(opts *RequestOptions) (*AssertionResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var cred *softCredential
+	for _, c := range a.creds {
+		if c.rpID != opts.RPID {
+			continue
+		}
+		if len(opts.AllowCredentials) == 0 {
+			cred = c
+			break
+		}
+		for _, allow := range opts.AllowCredentials {
+			if allow.ID == EncodeID(c.id) {
+				cred = c
+				break
+			}
+		}
+		if cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return nil, ErrNoCredential
+	}
+	cred.signCount++
+	authData := a.authData(cred.rpID, flagUP|flagUV, cred.signCount)
+	cd := a.clientData("webauthn.get", opts.Challenge)
+	hash := sha256.Sum256(cd)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), hash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &AssertionResponse{ID: EncodeID(cred.id), RawID: EncodeID(cred.id), Type: "public-key"}
+	resp.Response.ClientDataJSON = EncodeID(cd)
+	resp.Response.AuthenticatorData = EncodeID(authData)
+	resp.Response.Signature = EncodeID(sig)
+	resp.Response.UserHandle = EncodeID(cred.userHandle)
+	return resp, nil
+}
+
+func (a *SoftAuthenticator) authData(rpID string, flags byte, signCount uint32) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	out := append([]byte(nil), h[:]...)
+	out = append(out, flags)
+	return binary.BigEndian.AppendUint32(out, signCount)
+}
@@ -0,0 +1,476 @@
+// Package webauthn реализует серверную часть WebAuthn (Level 2): выдачу
+// параметров церемоний регистрации и входа и проверку ответов аутентификатора.
+// Аттестация не запрашивается (attestation: "none"), поэтому доверие к модели
+// аутентификатора не проверяется — только подпись, challenge, origin и RP ID.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Ошибки проверки ответов аутентификатора
+var (
+	ErrInvalidResponse  = errors.New("webauthn: invalid authenticator response")
+	ErrChallenge        = errors.New("webauthn: challenge mismatch")
+	ErrOrigin           = errors.New("webauthn: origin not allowed")
+	ErrRPID             = errors.New("webauthn: RP ID hash mismatch")
+	ErrUserPresence     = errors.New("webauthn: user presence flag not set")
+	ErrUserVerification = errors.New("webauthn: user verification required")
+	ErrSignCount        = errors.New("webauthn: signature counter did not increase, authenticator may be cloned")
+	errBadSignature     = errors.New("webauthn: invalid signature")
+)
+
+// Флаги authenticatorData
+const (
+	flagUP = 0x01
+	flagUV = 0x04
+	flagBE = 0x08
+	flagBS = 0x10
+	flagAT = 0x40
+	flagED = 0x80
+)
+
+// Требование к проверке пользователя (PIN, биометрия)
+const (
+	UVRequired  = "required"
+	UVPreferred = "preferred"
+)
+
+// Config — параметры проверяющей стороны (Relying Party).
+type Config struct {
+	// RPID — домен сайта (без схемы и порта), к которому привязываются ключи
+	RPID   string
+	RPName string
+	// Origins — допустимые origin клиентов, например https://chat.example.com
+	Origins []string
+	Timeout time.Duration
+}
+
+// FromEnv читает WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME и WEBAUTHN_ORIGINS
+// (через запятую). По умолчанию origin — APP_URL, а RP ID — его хост.
+func FromEnv() *RelyingParty {
+	appURL := strings.TrimSpace(os.Getenv("APP_URL"))
+	if appURL == "" {
+		appURL = "http://localhost:3000"
+	}
+	cfg := Config{
+		RPID:    strings.TrimSpace(os.Getenv("WEBAUTHN_RP_ID")),
+		RPName:  strings.TrimSpace(os.Getenv("WEBAUTHN_RP_NAME")),
+		Timeout: 5 * time.Minute,
+	}
+	for _, o := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			cfg.Origins = append(cfg.Origins, o)
+		}
+	}
+	if len(cfg.Origins) == 0 {
+		cfg.Origins = []string{strings.TrimRight(appURL, "/")}
+	}
+	if cfg.RPID == "" {
+		if u, err := url.Parse(cfg.Origins[0]); err == nil && u.Hostname() != "" {
+			cfg.RPID = u.Hostname()
+		} else {
+			cfg.RPID = "localhost"
+		}
+	}
+	if cfg.RPName == "" {
+		cfg.RPName = "LinkUp"
+	}
+	return New(cfg)
+}
+
+// RelyingParty выдает параметры церемоний и проверяет ответы.
+type RelyingParty struct {
+	cfg Config
+}
+
+// New создает проверяющую сторону.
+func New(cfg Config) *RelyingParty {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Minute
+	}
+	return &RelyingParty{cfg: cfg}
+}
+
+// Config возвращает настройки.
+func (rp *RelyingParty) Config() Config { return rp.cfg }
+
+// NewChallenge возвращает случайный challenge (256 бит) в base64url.
+func NewChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// EncodeID кодирует бинарный идентификатор в base64url без выравнивания.
+func EncodeID(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// DecodeID декодирует base64url с выравниванием или без.
+func DecodeID(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// ==================== ПАРАМЕТРЫ ЦЕРЕМОНИЙ ====================
+
+// Структуры ниже повторяют JSON-представление WebAuthn Level 3: бинарные поля
+// передаются в base64url, поэтому клиент может передать их в
+// PublicKeyCredential.parseCreationOptionsFromJSON / parseRequestOptionsFromJSON.
+
+// RPEntity описывает сайт.
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity описывает владельца ключа. ID не должен содержать персональных данных.
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter — допустимый алгоритм ключа.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor ссылается на зарегистрированный ключ.
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection — требования к аутентификатору.
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions — PublicKeyCredentialCreationOptions.
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions — PublicKeyCredentialRequestOptions.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions собирает параметры регистрации нового ключа. Ключи из
+// exclude повторно не регистрируются. Создаются discoverable-ключи (passkeys),
+// чтобы ими можно было войти без ввода логина.
+func (rp *RelyingParty) CreationOptions(challenge string, user UserEntity, exclude []CredentialDescriptor) *CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+	return &CreationOptions{
+		Challenge:          challenge,
+		RP:                 RPEntity{ID: rp.cfg.RPID, Name: rp.cfg.RPName},
+		User:               user,
+		PubKeyCredParams:   params,
+		Timeout:            rp.cfg.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "preferred",
+			RequireResidentKey: false,
+			UserVerification:   UVPreferred,
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions собирает параметры входа. Пустой allow означает вход
+// discoverable-ключом без указания логина.
+func (rp *RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor, userVerification string) *RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.cfg.Timeout.Milliseconds(),
+		RPID:             rp.cfg.RPID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// ==================== ОТВЕТЫ АУТЕНТИФИКАТОРА ====================
+
+// RegistrationResponse — результат navigator.credentials.create() в JSON (toJSON()).
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse — результат navigator.credentials.get() в JSON (toJSON()).
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// Credential — проверенный новый ключ для сохранения.
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key
+	Algorithm      int64
+	SignCount      uint32
+	AAGUID         string
+	Transports     []string
+	UserVerified   bool
+	BackupEligible bool
+}
+
+// Assertion — проверенный ответ на вход.
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+	BackedUp     bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// Challenge извлекает challenge из clientDataJSON, чтобы найти церемонию
+// до полной проверки ответа.
+func Challenge(clientDataJSON string) (string, error) {
+	raw, err := DecodeID(clientDataJSON)
+	if err != nil {
+		return "", ErrInvalidResponse
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil || cd.Challenge == "" {
+		return "", ErrInvalidResponse
+	}
+	return cd.Challenge, nil
+}
+
+func (rp *RelyingParty) verifyClientData(b64, typ, challenge string) ([]byte, error) {
+	raw, err := DecodeID(b64)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	if cd.Type != typ {
+		return nil, fmt.Errorf("%w: unexpected type %q", ErrInvalidResponse, cd.Type)
+	}
+	if cd.Challenge != challenge {
+		return nil, ErrChallenge
+	}
+	allowed := false
+	for _, o := range rp.cfg.Origins {
+		if cd.Origin == o {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: %s", ErrOrigin, cd.Origin)
+	}
+	return raw, nil
+}
+
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	aaguid    []byte
+	credID    []byte
+	publicKey []byte
+}
+
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < 37 {
+		return nil, ErrInvalidResponse
+	}
+	ad := &authenticatorData{rpIDHash: b[:32], flags: b[32], signCount: binary.BigEndian.Uint32(b[33:37])}
+	rest := b[37:]
+	if ad.flags&flagAT != 0 {
+		if len(rest) < 18 {
+			return nil, ErrInvalidResponse
+		}
+		ad.aaguid = rest[:16]
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n == 0 || n > 1023 || len(rest) < n {
+			return nil, ErrInvalidResponse
+		}
+		ad.credID = rest[:n]
+		rest = rest[n:]
+		_, used, err := cborDecode(rest)
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		ad.publicKey = rest[:used]
+		rest = rest[used:]
+	}
+	if ad.flags&flagED != 0 {
+		_, used, err := cborDecode(rest)
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		rest = rest[used:]
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidResponse
+	}
+	return ad, nil
+}
+
+func (rp *RelyingParty) checkFlags(ad *authenticatorData, userVerification string) error {
+	want := sha256.Sum256([]byte(rp.cfg.RPID))
+	if !bytes.Equal(ad.rpIDHash, want[:]) {
+		return ErrRPID
+	}
+	if ad.flags&flagUP == 0 {
+		return ErrUserPresence
+	}
+	if userVerification == UVRequired && ad.flags&flagUV == 0 {
+		return ErrUserVerification
+	}
+	return nil
+}
+
+// VerifyRegistration проверяет ответ на CreationOptions с данным challenge.
+func (rp *RelyingParty) VerifyRegistration(resp *RegistrationResponse, challenge, userVerification string) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+	if _, err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+	attObj, err := DecodeID(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	v, n, err := cborDecode(attObj)
+	if err != nil || n != len(attObj) {
+		return nil, ErrInvalidResponse
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+	rawAuthData, _ := m["authData"].([]byte)
+	if _, ok := m["fmt"].(string); !ok {
+		return nil, ErrInvalidResponse
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkFlags(ad, userVerification); err != nil {
+		return nil, err
+	}
+	if ad.flags&flagAT == 0 {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrInvalidResponse)
+	}
+	if id, err := DecodeID(resp.RawID); err != nil || !bytes.Equal(id, ad.credID) {
+		return nil, fmt.Errorf("%w: credential id mismatch", ErrInvalidResponse)
+	}
+	alg, _, err := parsePublicKey(ad.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:             append([]byte(nil), ad.credID...),
+		PublicKey:      append([]byte(nil), ad.publicKey...),
+		Algorithm:      alg,
+		SignCount:      ad.signCount,
+		AAGUID:         hex.EncodeToString(ad.aaguid),
+		Transports:     resp.Response.Transports,
+		UserVerified:   ad.flags&flagUV != 0,
+		BackupEligible: ad.flags&flagBE != 0,
+	}, nil
+}
+
+// VerifyAssertion проверяет ответ на RequestOptions с данным challenge
+// сохраненным ключом publicKey. storedCount — последний известный счетчик
+// подписей: если аутентификатор ведет счетчик, новое значение обязано быть больше.
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge, userVerification string, publicKey []byte, storedCount uint32) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+	rawClientData, err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+	rawAuthData, err := DecodeID(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	sig, err := DecodeID(resp.Response.Signature)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkFlags(ad, userVerification); err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(rawClientData)
+	signed := append(append([]byte(nil), rawAuthData...), hash[:]...)
+	if err := verifySignature(publicKey, signed, sig); err != nil {
+		return nil, err
+	}
+	if (ad.signCount != 0 || storedCount != 0) && ad.signCount <= storedCount {
+		return nil, ErrSignCount
+	}
+	return &Assertion{
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUV != 0,
+		BackedUp:     ad.flags&flagBS != 0,
+	}, nil
+}
@@ -0,0 +1,181 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+const testOrigin = "https://chat.example.com"
+
+func testRP() *RelyingParty {
+	return New(Config{RPID: "chat.example.com", RPName: "LinkUp", Origins: []string{testOrigin}})
+}
+
+// register регистрирует ключ программного аутентификатора и возвращает его.
+func register(t *testing.T, rp *RelyingParty, a *SoftAuthenticator) *Credential {
+	t.Helper()
+	challenge, _ := NewChallenge()
+	opts := rp.CreationOptions(challenge, UserEntity{ID: EncodeID([]byte("42")), Name: "alice", DisplayName: "Alice"}, nil)
+	resp, err := a.Create(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := rp.VerifyRegistration(resp, challenge, UVPreferred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cred
+}
+
+// assert выполняет вход и возвращает ответ вместе с challenge.
+func assert(t *testing.T, rp *RelyingParty, a *SoftAuthenticator, cred *Credential) (*AssertionResponse, string) {
+	t.Helper()
+	challenge, _ := NewChallenge()
+	allow := []CredentialDescriptor{{Type: "public-key", ID: EncodeID(cred.ID)}}
+	resp, err := a.Get(rp.RequestOptions(challenge, allow, UVRequired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, challenge
+}
+
+// resign меняет authenticatorData ответа и подписывает его заново ключом
+// аутентификатора — так подделанные флаги и rpIdHash доходят до проверки флагов,
+// а не отсекаются подписью.
+func resign(t *testing.T, a *SoftAuthenticator, resp *AssertionResponse, mutate func(authData []byte)) {
+	t.Helper()
+	authData, _ := DecodeID(resp.Response.AuthenticatorData)
+	clientData, _ := DecodeID(resp.Response.ClientDataJSON)
+	mutate(authData)
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), hash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.creds[0].key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Response.AuthenticatorData = EncodeID(authData)
+	resp.Response.Signature = EncodeID(sig)
+}
+
+func TestSoftAuthenticatorCeremonies(t *testing.T) {
+	rp := testRP()
+	a := NewSoftAuthenticator(testOrigin)
+	cred := register(t, rp, a)
+	if cred.Algorithm != AlgES256 || cred.SignCount != 0 || !cred.UserVerified {
+		t.Fatalf("credential: %+v", cred)
+	}
+
+	var count uint32
+	for i := 0; i < 2; i++ {
+		resp, challenge := assert(t, rp, a, cred)
+		if resp.Response.UserHandle != EncodeID([]byte("42")) {
+			t.Fatalf("user handle: %q", resp.Response.UserHandle)
+		}
+		res, err := rp.VerifyAssertion(resp, challenge, UVRequired, cred.PublicKey, count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.SignCount <= count || !res.UserVerified {
+			t.Fatalf("assertion: %+v", res)
+		}
+		count = res.SignCount
+	}
+
+	// excludeCredentials не дает зарегистрировать тот же ключ повторно
+	challenge, _ := NewChallenge()
+	exclude := []CredentialDescriptor{{Type: "public-key", ID: EncodeID(cred.ID)}}
+	if _, err := a.Create(rp.CreationOptions(challenge, UserEntity{ID: EncodeID([]byte("42"))}, exclude)); err == nil {
+		t.Fatal("excluded credential registered again")
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	rp := testRP()
+	user := UserEntity{ID: EncodeID([]byte("42")), Name: "alice"}
+
+	challenge, _ := NewChallenge()
+	resp, _ := NewSoftAuthenticator("https://evil.example").Create(rp.CreationOptions(challenge, user, nil))
+	if _, err := rp.VerifyRegistration(resp, challenge, UVPreferred); !errors.Is(err, ErrOrigin) {
+		t.Errorf("wrong origin: %v", err)
+	}
+
+	opts := rp.CreationOptions(challenge, user, nil)
+	opts.RP.ID = "evil.example"
+	resp, _ = NewSoftAuthenticator(testOrigin).Create(opts)
+	if _, err := rp.VerifyRegistration(resp, challenge, UVPreferred); !errors.Is(err, ErrRPID) {
+		t.Errorf("wrong rpIdHash: %v", err)
+	}
+
+	resp, _ = NewSoftAuthenticator(testOrigin).Create(rp.CreationOptions(challenge, user, nil))
+	other, _ := NewChallenge()
+	if _, err := rp.VerifyRegistration(resp, other, UVPreferred); !errors.Is(err, ErrChallenge) {
+		t.Errorf("foreign challenge: %v", err)
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	rp := testRP()
+	a := NewSoftAuthenticator(testOrigin)
+	cred := register(t, rp, a)
+
+	cases := []struct {
+		name   string
+		mutate func(authData []byte)
+		uv     string
+		want   error
+	}{
+		{"wrong rpIdHash", func(ad []byte) { ad[0] ^= 0xff }, UVRequired, ErrRPID},
+		{"no UP", func(ad []byte) { ad[32] &^= flagUP }, UVPreferred, ErrUserPresence},
+		{"no UV", func(ad []byte) { ad[32] &^= flagUV }, UVRequired, ErrUserVerification},
+	}
+	for _, tc := range cases {
+		resp, challenge := assert(t, rp, a, cred)
+		resign(t, a, resp, tc.mutate)
+		if _, err := rp.VerifyAssertion(resp, challenge, tc.uv, cred.PublicKey, 0); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+
+	// без UV ключ годится там, где проверка пользователя только желательна
+	resp, challenge := assert(t, rp, a, cred)
+	resign(t, a, resp, func(ad []byte) { ad[32] &^= flagUV })
+	if _, err := rp.VerifyAssertion(resp, challenge, UVPreferred, cred.PublicKey, 0); err != nil {
+		t.Errorf("no UV with preferred: %v", err)
+	}
+
+	// без новой подписи подмененный authenticatorData не проходит
+	resp, challenge = assert(t, rp, a, cred)
+	authData, _ := DecodeID(resp.Response.AuthenticatorData)
+	binary.BigEndian.PutUint32(authData[33:], 1000)
+	resp.Response.AuthenticatorData = EncodeID(authData)
+	if _, err := rp.VerifyAssertion(resp, challenge, UVRequired, cred.PublicKey, 0); err == nil {
+		t.Error("tampered authenticatorData accepted")
+	}
+
+	a.Origin = "https://evil.example"
+	resp, challenge = assert(t, rp, a, cred)
+	if _, err := rp.VerifyAssertion(resp, challenge, UVRequired, cred.PublicKey, 0); !errors.Is(err, ErrOrigin) {
+		t.Errorf("wrong origin: %v", err)
+	}
+	a.Origin = testOrigin
+
+	// ответ на один challenge не подходит к другому
+	resp, _ = assert(t, rp, a, cred)
+	other, _ := NewChallenge()
+	if _, err := rp.VerifyAssertion(resp, other, UVRequired, cred.PublicKey, 0); !errors.Is(err, ErrChallenge) {
+		t.Errorf("replayed assertion: %v", err)
+	}
+
+	resp, challenge = assert(t, rp, a, cred)
+	authData, _ = DecodeID(resp.Response.AuthenticatorData)
+	count := binary.BigEndian.Uint32(authData[33:])
+	for _, stored := range []uint32{count, count + 1} {
+		if _, err := rp.VerifyAssertion(resp, challenge, UVRequired, cred.PublicKey, stored); !errors.Is(err, ErrSignCount) {
+			t.Errorf("sign count %d after %d: %v", count, stored, err)
+		}
+	}
+}
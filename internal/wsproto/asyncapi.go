@@ -0,0 +1,148 @@
+package wsproto
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// serverMessages — события сервера с отдельной схемой payload в $defs.
+var serverMessages = []struct{ name, payload, summary string }{
+	{"error", "errorPayload", "A frame was rejected"},
+	{"ack", "ackPayload", "A message was stored"},
+	{"nack", "nackPayload", "A message was not stored"},
+	{"resync_required", "resyncPayload", "The gap since lastSeq is no longer buffered"},
+	{"message", "messageEventPayload", "New message in a subscribed room"},
+	{"dm", "messageEventPayload", "New message in a private room the connection is not subscribed to"},
+	{"presence_update", "presenceUpdatePayload", "Presence of the users in a room"},
+	{"status", "statusPayload", "The user changed their presence status"},
+}
+
+// AsyncAPI возвращает описание протокола V1 в формате AsyncAPI 2.6 для
+// генераторов клиентов. Схемы берутся из JSON Schema протокола.
+func AsyncAPI() map[string]any {
+	var doc map[string]any
+	if err := json.Unmarshal(schemaV1, &doc); err != nil {
+		panic("wsproto: parse schema: " + err.Error())
+	}
+	defs := rewriteRefs(doc["$defs"]).(map[string]any)
+
+	messages := map[string]any{}
+	var publish, subscribe []any
+	for _, t := range frameTypes {
+		messages[t] = map[string]any{
+			"name":        t,
+			"title":       t,
+			"summary":     defs[t].(map[string]any)["description"],
+			"contentType": "application/json",
+			"payload":     ref(t),
+		}
+		publish = append(publish, msgRef(t))
+	}
+	for _, m := range serverMessages {
+		name := "server_" + m.name
+		messages[name] = map[string]any{
+			"name":        m.name,
+			"title":       m.name,
+			"summary":     m.summary,
+			"contentType": "application/json",
+			"payload": map[string]any{
+				"allOf": []any{
+					ref("serverEvent"),
+					map[string]any{
+						"properties": map[string]any{
+							"type":    map[string]any{"const": m.name},
+							"payload": ref(m.payload),
+						},
+					},
+				},
+			},
+		}
+		subscribe = append(subscribe, msgRef(name))
+	}
+	messages["server_event"] = map[string]any{
+		"name":        "event",
+		"title":       "event",
+		"summary":     "Any other server event: subscribed, unsubscribed, typing, reactions, polls, presence_join, presence_leave, mention, unread, membership",
+		"contentType": "application/json",
+		"payload":     ref("serverEvent"),
+	}
+	subscribe = append(subscribe, msgRef("server_event"))
+
+	bindings := map[string]any{
+		"ws": map[string]any{
+			"method": "GET",
+			"query": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"ticket": map[string]any{"type": "string", "description": "Single-use ticket from POST /ws/ticket"},
+					"token":  map[string]any{"type": "string", "description": "JWT or personal access token (deprecated: ends up in proxy logs; accepted only with WS_ALLOW_QUERY_TOKEN=true)"},
+				},
+			},
+			"headers": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"Sec-WebSocket-Protocol": map[string]any{"type": "string", "enum": Supported},
+				},
+			},
+		},
+	}
+	// operationId уникален во всем документе, поэтому у каналов свой суффикс
+	operations := func(desc, suffix string) map[string]any {
+		return map[string]any{
+			"description": desc,
+			"bindings":    bindings,
+			"publish":     map[string]any{"operationId": "send" + suffix, "message": map[string]any{"oneOf": publish}},
+			"subscribe":   map[string]any{"operationId": "receive" + suffix, "message": map[string]any{"oneOf": subscribe}},
+		}
+	}
+	room := operations("Connection bound to a single room; typing and message frames may omit roomId. lastSeq in the query resumes the session.", "RoomFrame")
+	room["parameters"] = map[string]any{
+		"roomId": map[string]any{"schema": map[string]any{"type": "integer", "minimum": 1}},
+	}
+
+	return map[string]any{
+		"asyncapi": "2.6.0",
+		"id":       schemaID,
+		"info": map[string]any{
+			"title":       "LinkUp WebSocket API",
+			"version":     V1,
+			"description": doc["description"],
+		},
+		"defaultContentType": "application/json",
+		"channels": map[string]any{
+			"/ws":                operations("Multiplexed connection: subscribe to rooms with subscribe frames and receive user events.", "Frame"),
+			"/ws/rooms/{roomId}": room,
+		},
+		"components": map[string]any{
+			"schemas":  defs,
+			"messages": messages,
+		},
+	}
+}
+
+func ref(def string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + def}
+}
+
+func msgRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/messages/" + name}
+}
+
+// rewriteRefs переводит ссылки #/$defs/... в #/components/schemas/...
+func rewriteRefs(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if s, ok := e.(string); ok && k == "$ref" {
+				v[k] = strings.Replace(s, "#/$defs/", "#/components/schemas/", 1)
+				continue
+			}
+			v[k] = rewriteRefs(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = rewriteRefs(e)
+		}
+	}
+	return v
+}
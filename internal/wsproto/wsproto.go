@@ -0,0 +1,129 @@
+// Package wsproto описывает версионированный протокол WebSocket: согласование
+// подпротокола через Sec-WebSocket-Protocol, схему кадров и ее экспорт в
+// JSON Schema и AsyncAPI. Схема — единственный источник правды: по ней
+// проверяются входящие кадры и из нее строится документ AsyncAPI.
+package wsproto
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Подпротоколы первой версии: одна модель кадров в JSON (текстовые кадры)
+// и в двоичных кодировках MessagePack и CBOR (двоичные кадры).
+const (
+	V1        = "linkup.v1"
+	V1MsgPack = "linkup.v1+msgpack"
+	V1CBOR    = "linkup.v1+cbor"
+)
+
+// Supported — поддерживаемые подпротоколы.
+var Supported = []string{V1, V1MsgPack, V1CBOR}
+
+// Коды ошибок разбора кадра
+const (
+	CodeMalformed   = "malformed_frame" // кадр не разбирается в кодировке подпротокола
+	CodeInvalid     = "invalid_frame"   // кадр не соответствует схеме
+	CodeUnknownType = "unknown_type"    // неизвестный type
+)
+
+//go:embed linkup.v1.json
+var schemaV1 []byte
+
+// frameTypes — типы кадров клиента; каждому соответствует $defs/<type> схемы.
+var frameTypes = []string{"subscribe", "unsubscribe", "typing", "message", "activity"}
+
+var frames = compile()
+
+// FrameError — кадр отклонен: Code — один из Code*, Message — что не так.
+type FrameError struct {
+	Code    string
+	Message string
+}
+
+func (e *FrameError) Error() string { return e.Code + ": " + e.Message }
+
+// Schema возвращает JSON Schema протокола V1. Срез нельзя изменять.
+func Schema() []byte { return schemaV1 }
+
+// Negotiate выбирает первый поддерживаемый подпротокол в порядке
+// предпочтения клиента. Клиент без Sec-WebSocket-Protocol получает V1: так
+// работают клиенты, написанные до появления версий. ok=false — клиент
+// предложил только неизвестные подпротоколы.
+func Negotiate(offered []string) (string, bool) {
+	if len(offered) == 0 {
+		return V1, true
+	}
+	for _, o := range offered {
+		for _, p := range Supported {
+			if o == p {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Validate проверяет кадр клиента в JSON и возвращает его type. Кадры
+// двоичных подпротоколов проверяются после перевода в JSON.
+func Validate(data []byte) (string, *FrameError) {
+	v, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return "", &FrameError{CodeMalformed, "frame is not valid JSON"}
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return "", &FrameError{CodeInvalid, "frame must be a JSON object"}
+	}
+	typ, ok := obj["type"].(string)
+	if !ok {
+		return "", &FrameError{CodeInvalid, "type must be a string"}
+	}
+	sch := frames[typ]
+	if sch == nil {
+		return typ, &FrameError{CodeUnknownType, fmt.Sprintf("unknown frame type %q", typ)}
+	}
+	if err := sch.Validate(v); err != nil {
+		return typ, &FrameError{CodeInvalid, describe(err)}
+	}
+	return typ, nil
+}
+
+func compile() map[string]*jsonschema.Schema {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaV1))
+	if err != nil {
+		panic("wsproto: parse schema: " + err.Error())
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(schemaID, doc); err != nil {
+		panic("wsproto: " + err.Error())
+	}
+	out := make(map[string]*jsonschema.Schema, len(frameTypes))
+	for _, t := range frameTypes {
+		out[t] = c.MustCompile(schemaID + "#/$defs/" + t)
+	}
+	return out
+}
+
+const schemaID = "urn:linkup:ws:linkup.v1"
+
+var printer = message.NewPrinter(language.English)
+
+// describe сводит ошибку проверки к первой конкретной причине вида
+// "/payload/text: length must be <= 4000, but got 4001".
+func describe(err error) string {
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err.Error()
+	}
+	for len(ve.Causes) > 0 {
+		ve = ve.Causes[0]
+	}
+	return "/" + strings.Join(ve.InstanceLocation, "/") + ": " + ve.ErrorKind.LocalizedString(printer)
+}
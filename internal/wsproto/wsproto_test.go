@@ -0,0 +1,69 @@
+package wsproto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	long := strings.Repeat("x", 4001)
+	for _, tc := range []struct {
+		frame, typ, code string
+	}{
+		{`{"type":"subscribe","roomId":1,"lastSeq":5,"requestId":"r1"}`, "subscribe", ""},
+		{`{"type":"message","payload":{"text":"hi","clientMsgId":"c1"}}`, "message", ""},
+		{`{"type":"typing"}`, "typing", ""},
+		{`{"type":"subscribe",`, "", CodeMalformed},
+		{`not json`, "", CodeMalformed},
+		{`[1,2]`, "", CodeInvalid},
+		{`{"roomId":1}`, "", CodeInvalid},
+		{`{"type":1}`, "", CodeInvalid},
+		{`{"type":"subscribe"}`, "subscribe", CodeInvalid},
+		{`{"type":"subscribe","roomId":0}`, "subscribe", CodeInvalid},
+		{`{"type":"typing","extra":true}`, "typing", CodeInvalid},
+		{`{"type":"message","payload":{"text":""}}`, "message", CodeInvalid},
+		{`{"type":"message","payload":{"text":"` + long + `"}}`, "message", CodeInvalid},
+		{`{"type":"delete","id":1}`, "delete", CodeUnknownType},
+	} {
+		typ, ferr := Validate([]byte(tc.frame))
+		code := ""
+		if ferr != nil {
+			code = ferr.Code
+		}
+		if typ != tc.typ || code != tc.code {
+			name := tc.frame
+			if len(name) > 60 {
+				name = name[:60] + "..."
+			}
+			t.Errorf("%s: type %q, error %v; want type %q, code %q", name, typ, ferr, tc.typ, tc.code)
+		}
+	}
+}
+
+func TestValidateDescribesCause(t *testing.T) {
+	_, ferr := Validate([]byte(`{"type":"message","payload":{"text":"` + strings.Repeat("x", 4001) + `"}}`))
+	if ferr == nil || !strings.HasPrefix(ferr.Message, "/payload/text: ") {
+		t.Fatalf("error = %v", ferr)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		offered []string
+		want    string
+		ok      bool
+	}{
+		{nil, V1, true},
+		{[]string{V1}, V1, true},
+		// выбирается первый поддерживаемый в порядке клиента, а не сервера
+		{[]string{V1CBOR, V1}, V1CBOR, true},
+		{[]string{"linkup.v2", V1MsgPack, V1}, V1MsgPack, true},
+		{[]string{"linkup.v2"}, "", false},
+		{[]string{"chat", "linkup.v2+json"}, "", false},
+	} {
+		got, ok := Negotiate(tc.offered)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Negotiate(%q) = %q, %v; want %q, %v", tc.offered, got, ok, tc.want, tc.ok)
+		}
+	}
+}